@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/derWhity/kyabia/internal/log"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// APIKeyService provides service functions for managing the API keys machine clients authenticate with
+type APIKeyService interface {
+	// Create creates a new API key for the given purpose with the given permissions. The key itself is only returned
+	// here - it cannot be retrieved later on
+	Create(ctx context.Context, name string, permissions []string) (*models.APIKey, string, error)
+	// List returns all API keys
+	List(ctx context.Context) ([]models.APIKey, error)
+	// Revoke deletes the API key with the given ID
+	Revoke(ctx context.Context, id uint) error
+	// Authenticate returns the session and the service identity for the given API key. If the key is unknown, nil is
+	// returned
+	Authenticate(ctx context.Context, key string) (*models.Session, *models.User, error)
+}
+
+const (
+	// The number of random bytes an API key is made of - the key is hex-encoded and thus twice as long
+	apiKeyBytes = 32
+	// The number of characters of an API key that are stored for telling keys apart
+	apiKeyPrefixLength = 8
+	// The prefix of the names of the service identities API keys are mapped to
+	apiKeyUserPrefix = "apikey:"
+)
+
+// -- APIKeyService implementation -------------------------------------------------------------------------------------
+
+// APIKeyService implementation
+type apiKeyService struct {
+	repo   repos.APIKeyRepo
+	logger *logrus.Entry
+}
+
+// NewAPIKeyService creates a new API key service instance with the provided repository
+func NewAPIKeyService(repo repos.APIKeyRepo, logger *logrus.Entry) APIKeyService {
+	return &apiKeyService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Create creates a new API key. Keys have to be limited to specific permissions - granting all permissions or the
+// permission to manage users (and thus API keys) is not allowed
+func (s *apiKeyService) Create(ctx context.Context, name string, permissions []string) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", MakeErrorWithData(http.StatusBadRequest, ErrCodeRequiredFieldMissing, "A name is required",
+			map[string]string{"field": "name"},
+		)
+	}
+	if len(permissions) == 0 {
+		return nil, "", MakeErrorWithData(http.StatusBadRequest, ErrCodeRequiredFieldMissing,
+			"At least one permission is required",
+			map[string]string{"field": "permissions"},
+		)
+	}
+	if err := checkPermissions(permissions); err != nil {
+		return nil, "", err
+	}
+	for _, p := range permissions {
+		if p == models.PermAll || p == models.PermUserManage {
+			return nil, "", MakeErrorWithData(http.StatusBadRequest, ErrCodeIllegalValue,
+				fmt.Sprintf("API keys cannot be granted the permission '%s'", p),
+				map[string]string{"field": "permissions"},
+			)
+		}
+	}
+	b := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", MakeErrorWithData(http.StatusInternalServerError, ErrCodeUnknown, "Failed to generate API key", err)
+	}
+	key := hex.EncodeToString(b)
+	k := models.APIKey{
+		Name:        name,
+		Prefix:      key[:apiKeyPrefixLength],
+		KeyHash:     models.HashAPIKey(key),
+		Permissions: strings.Join(permissions, ","),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repo.Create(&k); err != nil {
+		return nil, "", MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError, "Failed to store API key", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		log.FldID: k.ID,
+		"name":    k.Name,
+	}).Info("Created API key")
+	audit(ctx, models.AuditAPIKeyCreate, fmt.Sprintf("%d", k.ID), fmt.Sprintf("%s - Permissions: %s", k.Name, k.Permissions))
+	return &k, key, nil
+}
+
+// List returns all API keys
+func (s *apiKeyService) List(ctx context.Context) ([]models.APIKey, error) {
+	list, err := s.repo.List()
+	if err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError, "Failed to load API keys", err)
+	}
+	return list, nil
+}
+
+// Revoke deletes the API key with the given ID - clients using it cannot authenticate any more
+func (s *apiKeyService) Revoke(ctx context.Context, id uint) error {
+	if err := s.repo.Delete(id); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return MakeError(http.StatusNotFound, ErrCodeAPIKeyNotFound, fmt.Sprintf("API key #%d does not exist", id))
+		}
+		return MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Failed to revoke API key #%d", id), err,
+		)
+	}
+	s.logger.WithField(log.FldID, id).Info("Revoked API key")
+	audit(ctx, models.AuditAPIKeyRevoke, fmt.Sprintf("%d", id), "")
+	return nil
+}
+
+// Authenticate maps the given API key to a service identity. The identity has no user ID and only the permissions
+// granted to the key
+func (s *apiKeyService) Authenticate(ctx context.Context, key string) (*models.Session, *models.User, error) {
+	k, err := s.repo.GetByHash(models.HashAPIKey(key))
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return nil, nil, nil
+		}
+		s.logger.WithError(err).Error("Failed to retrieve API key from repo")
+		return nil, nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to retrieve API key from storage",
+		)
+	}
+	sess := models.Session{
+		ID:          apiKeyUserPrefix + k.Prefix,
+		Permissions: k.PermissionList(),
+		APIKeyID:    k.ID,
+	}
+	u := models.User{
+		Name:        apiKeyUserPrefix + k.Name,
+		FullName:    k.Name,
+		Permissions: k.Permissions,
+	}
+	return &sess, &u, nil
+}
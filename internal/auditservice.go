@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/derWhity/kyabia/internal/ctxhelper"
+	"github.com/derWhity/kyabia/internal/log"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// AuditService provides service functions for recording administrative actions and browsing the audit log
+type AuditService interface {
+	// Record adds an entry for the given action to the audit log. The user taking the action is taken from the context.
+	// Failures are logged, but never returned - an action that has been taken should not fail because of auditing
+	Record(ctx context.Context, action string, target string, detail string)
+	// List returns the audit log entries matching the given search - the newest entries first
+	List(ctx context.Context, search *Search) ([]models.AuditEntry, uint, error)
+}
+
+// -- AuditService implementation --------------------------------------------------------------------------------------
+
+// AuditService implementation
+type auditService struct {
+	repo   repos.AuditRepo
+	logger *logrus.Entry
+}
+
+// NewAuditService creates a new audit service instance with the provided repository
+func NewAuditService(repo repos.AuditRepo, logger *logrus.Entry) AuditService {
+	return &auditService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Record adds an entry for the given action to the audit log
+func (s *auditService) Record(ctx context.Context, action string, target string, detail string) {
+	entry := models.AuditEntry{
+		Action:    action,
+		Target:    target,
+		Detail:    detail,
+		CreatedAt: time.Now(),
+	}
+	if user := ctxhelper.User(ctx); user != nil {
+		entry.UserID = user.ID
+		entry.UserName = user.Name
+	}
+	logger := s.logger.WithFields(logrus.Fields{
+		log.FldUser: entry.UserName,
+		"action":    action,
+		"target":    target,
+	})
+	if err := s.repo.Add(&entry); err != nil {
+		logger.WithError(err).Error("Failed to record administrative action in the audit log")
+		return
+	}
+	logger.Info("Recorded administrative action")
+}
+
+// List returns the audit log entries matching the given search
+func (s *auditService) List(ctx context.Context, search *Search) ([]models.AuditEntry, uint, error) {
+	list, numRows, err := s.repo.Find(search.Search, search.Offset, search.Limit)
+	if err != nil {
+		return nil, 0, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			"Error while searching the audit log", err,
+		)
+	}
+	return list, numRows, nil
+}
+
+// audit records the given action using the audit service stored inside the context. If there is none - like for
+// actions not triggered by an API call - nothing is recorded
+func audit(ctx context.Context, action string, target string, detail string) {
+	if as, ok := ctx.Value(ctxhelper.KeyAuditService).(AuditService); ok {
+		as.Record(ctx, action, target, detail)
+	}
+}
@@ -31,21 +31,35 @@ type ConfigService interface {
 	RemoveFromWhitelist(ctx context.Context, ipAddr string) error
 	// IsWhitelisted checks if the given IP address has been whitelisted
 	IsWhitelisted(ipAddr string) bool
+	// BannedIPs returns the list of IP addresses that have been banned from adding wishes
+	BannedIPs(ctx context.Context) []string
+	// AddToBanlist adds an IP address to the list of hosts banned from adding wishes
+	AddToBanlist(ctx context.Context, ipAddr string) error
+	// RemoveFromBanlist removes an IP address from the list of hosts banned from adding wishes
+	RemoveFromBanlist(ctx context.Context, ipAddr string) error
+	// IsBanned checks if the given IP address has been banned
+	IsBanned(ipAddr string) bool
 	// Load loads the application config from its default file location
 	Load(ctx context.Context) error
 	// LoadFromFile loads the configuration from the given JSON file and returns it
 	LoadFromFile(ctx context.Context, filename string) error
+	// Reload loads the application config from its default file location again and returns the new configuration.
+	// Settings only used on startup - like the listen address - do not take effect before the next restart. See
+	// the documentation of the reload API call for the full list
+	Reload(ctx context.Context) (models.AppConfig, error)
 	// Write writes the current application configuration to the default file name
 	Write(ctx context.Context) error
 	// WriteToFile writes the current application configuration to a JSON file
 	WriteToFile(ctx context.Context, filename string) error
 	// GetConfig retuns the current application configuration
 	GetConfig(ctx context.Context) models.AppConfig
+	// SetScrapingPresets replaces the list of user-defined file name scraping presets and writes the configuration
+	SetScrapingPresets(ctx context.Context, presets []models.FileNamePreset) error
 }
 
 // -- ConfigService implementation -------------------------------------------------------------------------------------
 
-// Simple index structure to speed up whitelist lookups
+// Simple index structure to speed up whitelist and banlist lookups
 type whitelistIdx struct {
 	sync.RWMutex
 	data map[string]bool
@@ -53,8 +67,12 @@ type whitelistIdx struct {
 
 type configService struct {
 	configFilename string
-	config         *models.AppConfig
-	whitelist      *whitelistIdx
+	// Guards the config pointer and the data it points to. When combined with the lock of the whitelist or banlist
+	// index, the index has to be locked first
+	configLock sync.RWMutex
+	config     *models.AppConfig
+	whitelist  *whitelistIdx
+	banlist    *whitelistIdx
 }
 
 // NewConfigService creates a new configuration service instance with the given default file name
@@ -64,6 +82,9 @@ func NewConfigService(configFilename string) ConfigService {
 		whitelist: &whitelistIdx{
 			data: make(map[string]bool),
 		},
+		banlist: &whitelistIdx{
+			data: make(map[string]bool),
+		},
 	}
 }
 
@@ -81,10 +102,8 @@ func (s *configService) buildWhitelistIdx(ctx context.Context) {
 	s.whitelist.Lock()
 	defer s.whitelist.Unlock()
 	s.whitelist.data = make(map[string]bool)
-	if s.config != nil {
-		for _, ip := range s.config.Restrictions.IPWhitelist {
-			s.whitelist.data[ip] = true
-		}
+	for _, ip := range s.GetConfig(ctx).Restrictions.IPWhitelist {
+		s.whitelist.data[ip] = true
 	}
 }
 
@@ -110,9 +129,11 @@ func (s *configService) AddToWhitelist(ctx context.Context, ipAddr string) error
 	s.whitelist.Lock()
 	defer s.whitelist.Unlock()
 	s.whitelist.data[ipAddr] = true
+	s.configLock.Lock()
 	if s.config != nil {
 		s.config.Restrictions.IPWhitelist = s.whitelistIdxToSlice()
 	}
+	s.configLock.Unlock()
 	return s.Write(ctx)
 }
 
@@ -127,9 +148,11 @@ func (s *configService) RemoveFromWhitelist(ctx context.Context, ipAddr string)
 	s.whitelist.Lock()
 	defer s.whitelist.Unlock()
 	delete(s.whitelist.data, ipAddr)
+	s.configLock.Lock()
 	if s.config != nil {
 		s.config.Restrictions.IPWhitelist = s.whitelistIdxToSlice()
 	}
+	s.configLock.Unlock()
 	return s.Write(ctx)
 }
 
@@ -143,6 +166,83 @@ func (s *configService) IsWhitelisted(ipAddr string) bool {
 	return false
 }
 
+func (s *configService) banlistIdxToSlice() []string {
+	ret := []string{}
+	for item := range s.banlist.data {
+		ret = append(ret, item)
+	}
+	return ret
+}
+
+func (s *configService) buildBanlistIdx(ctx context.Context) {
+	logger := ctxhelper.Logger(ctx)
+	logger.Info("Rebuilding index of banned IPs...")
+	s.banlist.Lock()
+	defer s.banlist.Unlock()
+	s.banlist.data = make(map[string]bool)
+	for _, ip := range s.GetConfig(ctx).Restrictions.IPBanlist {
+		s.banlist.data[ip] = true
+	}
+}
+
+// BannedIPs returns the list of IP addresses that have been banned from adding wishes
+func (s *configService) BannedIPs(ctx context.Context) []string {
+	s.banlist.RLock()
+	defer s.banlist.RUnlock()
+	return s.banlistIdxToSlice()
+}
+
+// AddToBanlist adds an IP address to the list of hosts banned from adding wishes
+func (s *configService) AddToBanlist(ctx context.Context, ipAddr string) error {
+	logger := ctxhelper.Logger(ctx)
+	if ip := net.ParseIP(ipAddr); ip == nil {
+		return ErrIllegalIP
+	}
+	if s.IsBanned(ipAddr) {
+		// This IP is already banned - just ignore
+		return nil
+	}
+	logger.WithField(log.FldIP, ipAddr).Info("Adding IP address to banlist")
+	s.banlist.Lock()
+	defer s.banlist.Unlock()
+	s.banlist.data[ipAddr] = true
+	s.configLock.Lock()
+	if s.config != nil {
+		s.config.Restrictions.IPBanlist = s.banlistIdxToSlice()
+	}
+	s.configLock.Unlock()
+	audit(ctx, models.AuditIPBan, ipAddr, "")
+	return s.Write(ctx)
+}
+
+// RemoveFromBanlist removes an IP address from the list of hosts banned from adding wishes
+func (s *configService) RemoveFromBanlist(ctx context.Context, ipAddr string) error {
+	if ip := net.ParseIP(ipAddr); ip == nil {
+		return ErrIllegalIP
+	}
+	if !s.IsBanned(ipAddr) {
+		return repos.ErrEntityNotExisting
+	}
+	s.banlist.Lock()
+	defer s.banlist.Unlock()
+	delete(s.banlist.data, ipAddr)
+	s.configLock.Lock()
+	if s.config != nil {
+		s.config.Restrictions.IPBanlist = s.banlistIdxToSlice()
+	}
+	s.configLock.Unlock()
+	audit(ctx, models.AuditIPUnban, ipAddr, "")
+	return s.Write(ctx)
+}
+
+// IsBanned checks if the given IP address has been banned
+func (s *configService) IsBanned(ipAddr string) bool {
+	s.banlist.RLock()
+	defer s.banlist.RUnlock()
+	_, ok := s.banlist.data[ipAddr]
+	return ok
+}
+
 // Load loads the application config from its default file location
 func (s *configService) Load(ctx context.Context) error {
 	return s.LoadFromFile(ctx, s.configFilename)
@@ -164,11 +264,27 @@ func (s *configService) LoadFromFile(ctx context.Context, filename string) error
 	if err = json.NewDecoder(f).Decode(&conf); err != nil {
 		return errors.Wrap(err, "LoadFromFile: Failed to decode configuration file")
 	}
+	s.configLock.Lock()
 	s.config = conf
+	s.configLock.Unlock()
 	s.buildWhitelistIdx(ctx)
+	s.buildBanlistIdx(ctx)
 	return nil
 }
 
+// Reload loads the application config from its default file location again and returns the new configuration. If
+// loading fails, the current configuration is kept
+func (s *configService) Reload(ctx context.Context) (models.AppConfig, error) {
+	if err := s.Load(ctx); err != nil {
+		ctxhelper.Logger(ctx).WithError(err).Error("Failed to reload the configuration")
+		return models.AppConfig{}, MakeError(http.StatusInternalServerError, ErrCodeUnknown,
+			"Failed to reload the configuration - see the server log for details",
+		)
+	}
+	audit(ctx, models.AuditConfigReload, s.configFilename, "")
+	return s.GetConfig(ctx), nil
+}
+
 // Write writes the current application configuration to the default file name
 func (s *configService) Write(ctx context.Context) error {
 	return s.WriteToFile(ctx, s.configFilename)
@@ -194,6 +310,8 @@ func (s *configService) WriteToFile(ctx context.Context, filename string) error
 
 // GetConfig retuns the current application configuration
 func (s *configService) GetConfig(ctx context.Context) models.AppConfig {
+	s.configLock.RLock()
+	defer s.configLock.RUnlock()
 	var ret models.AppConfig
 	if s.config != nil {
 		ret = *s.config
@@ -204,3 +322,19 @@ func (s *configService) GetConfig(ctx context.Context) models.AppConfig {
 	}
 	return ret
 }
+
+// SetScrapingPresets replaces the list of user-defined file name scraping presets and writes the configuration
+func (s *configService) SetScrapingPresets(ctx context.Context, presets []models.FileNamePreset) error {
+	s.configLock.Lock()
+	if s.config == nil {
+		conf, err := models.GetDefaultConfig()
+		if err != nil {
+			s.configLock.Unlock()
+			return errors.Wrap(err, "SetScrapingPresets: Failed to create default config")
+		}
+		s.config = conf
+	}
+	s.config.Scraper.Presets = presets
+	s.configLock.Unlock()
+	return s.Write(ctx)
+}
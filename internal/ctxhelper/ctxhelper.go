@@ -10,10 +10,17 @@ import (
 var (
 	// KeySession is the context key for storing the session associated with the current call
 	KeySession = ctxKey("session")
+	// KeySessionFromCookie is the context key for storing whether the session token has been sent inside the session
+	// cookie instead of the token header
+	KeySessionFromCookie = ctxKey("sessionFromCookie")
 	// KeyUser is the context key for storing the user object associated with the current call
 	KeyUser = ctxKey("user")
 	// KeyLogger is the context key for storing the logger in the context
 	KeyLogger = ctxKey("logger")
+	// KeyAuditService is the context key for storing the service recording administrative actions in the audit log
+	KeyAuditService = ctxKey("auditService")
+	// KeyMaxPageSize is the context key for storing the maximum number of entries a client can request per page
+	KeyMaxPageSize = ctxKey("maxPageSize")
 )
 
 // internal context key
@@ -27,6 +34,12 @@ func Session(ctx context.Context) *models.Session {
 	return nil
 }
 
+// SessionFromCookie returns whether the session of the current context has been authenticated by the session cookie
+func SessionFromCookie(ctx context.Context) bool {
+	fromCookie, _ := ctx.Value(KeySessionFromCookie).(bool)
+	return fromCookie
+}
+
 // User returns the user from the current context, if available
 func User(ctx context.Context) *models.User {
 	usr, ok := ctx.Value(KeyUser).(models.User)
@@ -44,3 +57,11 @@ func Logger(ctx context.Context) *logrus.Entry {
 	}
 	panic("No logger in context")
 }
+
+// MaxPageSize returns the maximum page size from the current context. If none is available, the default is returned
+func MaxPageSize(ctx context.Context) uint {
+	if max, ok := ctx.Value(KeyMaxPageSize).(uint); ok && max > 0 {
+		return max
+	}
+	return models.DefaultMaxPageSize
+}
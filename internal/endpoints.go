@@ -1,45 +1,96 @@
 package internal
 
 import (
+	"encoding/xml"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/derWhity/kyabia/internal/ctxhelper"
 	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/scraper"
 	"github.com/go-kit/kit/endpoint"
 	"golang.org/x/net/context"
 )
 
 // ScrapingEndpoints is a collection of endpoints to the scraping service
 type ScrapingEndpoints struct {
-	ListDirs    endpoint.Endpoint
-	ListScrapes endpoint.Endpoint
-	GetScrape   endpoint.Endpoint
-	Start       endpoint.Endpoint
+	ListDirs     endpoint.Endpoint
+	ListScrapes  endpoint.Endpoint
+	GetScrape    endpoint.Endpoint
+	GetScrapeLog endpoint.Endpoint
+	Start        endpoint.Endpoint
+	Stop         endpoint.Endpoint
+	ListPresets  endpoint.Endpoint
+	CreatePreset endpoint.Endpoint
+	DeletePreset endpoint.Endpoint
+	TestPreset   endpoint.Endpoint
 }
 
 // VideoEndpoints is a collection of endpoints to the video service
 type VideoEndpoints struct {
-	List   endpoint.Endpoint
-	Get    endpoint.Endpoint
-	Update endpoint.Endpoint
-	Delete endpoint.Endpoint
+	List         endpoint.Endpoint
+	Get          endpoint.Endpoint
+	GetByIdent   endpoint.Endpoint
+	Create       endpoint.Endpoint
+	Update       endpoint.Endpoint
+	UpdateMany   endpoint.Endpoint
+	Delete       endpoint.Endpoint
+	Merge        endpoint.Endpoint
+	Restore      endpoint.Endpoint
+	Purge        endpoint.Endpoint
+	MarkPlayed   endpoint.Endpoint
+	Verify       endpoint.Endpoint
+	Relocate     endpoint.Endpoint
+	Thumbnail    endpoint.Endpoint
+	Sprite       endpoint.Endpoint
+	Chapters     endpoint.Endpoint
+	AddTag       endpoint.Endpoint
+	RemoveTag    endpoint.Endpoint
+	ListTags     endpoint.Endpoint
+	Export       endpoint.Endpoint
+	Top          endpoint.Endpoint
+	Languages    endpoint.Endpoint
+	Artists      endpoint.Endpoint
+	RelatedMedia endpoint.Endpoint
 }
 
 // PlaylistEndpoints is a collection of endpoints for working with the playlist service
 type PlaylistEndpoints struct {
-	Create           endpoint.Endpoint
-	Get              endpoint.Endpoint
-	Update           endpoint.Endpoint
-	Delete           endpoint.Endpoint
-	List             endpoint.Endpoint
-	ListEntries      endpoint.Endpoint
-	AddEntry         endpoint.Endpoint
-	UpdateEntry      endpoint.Endpoint
-	DeleteEntry      endpoint.Endpoint
-	PlaceEntryBefore endpoint.Endpoint
-	GetMain          endpoint.Endpoint
-	ListMainEntries  endpoint.Endpoint
-	AddMainEntry     endpoint.Endpoint
+	Create              endpoint.Endpoint
+	Get                 endpoint.Endpoint
+	Update              endpoint.Endpoint
+	Delete              endpoint.Endpoint
+	List                endpoint.Endpoint
+	ListEntries         endpoint.Endpoint
+	AddEntry            endpoint.Endpoint
+	AddEntries          endpoint.Endpoint
+	UpdateEntry         endpoint.Endpoint
+	DeleteEntry         endpoint.Endpoint
+	MarkEntryPlayed     endpoint.Endpoint
+	ApproveEntry        endpoint.Endpoint
+	SetEntryPriority    endpoint.Endpoint
+	RejectEntry         endpoint.Endpoint
+	RemovePlayed        endpoint.Endpoint
+	RemoveByIP          endpoint.Endpoint
+	MergeInto           endpoint.Endpoint
+	TotalDuration       endpoint.Endpoint
+	PlaceEntryBefore    endpoint.Endpoint
+	SwapEntries         endpoint.Endpoint
+	MoveToTop           endpoint.Endpoint
+	MoveToBottom        endpoint.Endpoint
+	Shuffle             endpoint.Endpoint
+	ExportXSPF          endpoint.Endpoint
+	ImportM3U           endpoint.Endpoint
+	GetMain             endpoint.Endpoint
+	ListMainEntries     endpoint.Endpoint
+	AddMainEntry        endpoint.Endpoint
+	NextMainEntry       endpoint.Endpoint
+	EstimatedWait       endpoint.Endpoint
+	EntryPosition       endpoint.Endpoint
+	CurrentMainEntry    endpoint.Endpoint
+	SetCurrentMainEntry endpoint.Endpoint
 }
 
 // EventEndpoints is a collection of endpoints for working with the event service
@@ -52,13 +103,46 @@ type EventEndpoints struct {
 	SetCurrentEvent   endpoint.Endpoint
 	CurrentEvent      endpoint.Endpoint
 	DefaultPlaylistID endpoint.Endpoint
+	Statistics        endpoint.Endpoint
+	TopRequesters     endpoint.Endpoint
+	TopVideos         endpoint.Endpoint
+	Clone             endpoint.Endpoint
+	Archive           endpoint.Endpoint
+	Overlaps          endpoint.Endpoint
+	ResetStatistics   endpoint.Endpoint
 }
 
 // SessionEndpoints is a collection of endpoints for working with the session service
 type SessionEndpoints struct {
-	Login  endpoint.Endpoint
-	Logout endpoint.Endpoint
-	WhoAmI endpoint.Endpoint
+	Login     endpoint.Endpoint
+	Logout    endpoint.Endpoint
+	LogoutAll endpoint.Endpoint
+	WhoAmI    endpoint.Endpoint
+	Refresh   endpoint.Endpoint
+	Sessions  endpoint.Endpoint
+}
+
+// UserEndpoints is a collection of endpoints for managing users
+type UserEndpoints struct {
+	List           endpoint.Endpoint
+	Get            endpoint.Endpoint
+	Create         endpoint.Endpoint
+	Update         endpoint.Endpoint
+	SetPermissions endpoint.Endpoint
+	ChangePassword endpoint.Endpoint
+	Delete         endpoint.Endpoint
+}
+
+// AuditEndpoints is a collection of endpoints for browsing the audit log
+type AuditEndpoints struct {
+	List endpoint.Endpoint
+}
+
+// APIKeyEndpoints is a collection of endpoints for managing API keys
+type APIKeyEndpoints struct {
+	List   endpoint.Endpoint
+	Create endpoint.Endpoint
+	Revoke endpoint.Endpoint
 }
 
 // ConfigEndpoints is a collection of endpoints for changing the system's configuration
@@ -66,6 +150,10 @@ type ConfigEndpoints struct {
 	GetWhitelist        endpoint.Endpoint
 	AddToWhitelist      endpoint.Endpoint
 	RemoveFromWhitelist endpoint.Endpoint
+	GetBanlist          endpoint.Endpoint
+	AddToBanlist        endpoint.Endpoint
+	RemoveFromBanlist   endpoint.Endpoint
+	Reload              endpoint.Endpoint
 }
 
 // The base for all responses which always contains an "ok" property to show if the call was successful and a
@@ -80,6 +168,52 @@ type pagingResponse struct {
 	List interface{} `json:"list"`
 }
 
+// A response that sends the contents of a local file instead of a JSON document
+type fileResponse struct {
+	// The absolute path of the file to send
+	Path string
+}
+
+// A response that is written to the client piece by piece instead of being built in memory first
+type streamResponse struct {
+	// The content type of the response
+	ContentType string
+	// The file name the client should use when saving the response
+	FileName string
+	// Writes the response body
+	Write func(w io.Writer) error
+}
+
+// A JSON response that additionally sets or clears the session cookie
+type sessionCookieResponse struct {
+	basicResponse
+	// The session ID to store inside the cookie - if empty, the cookie is cleared
+	SessionID string `json:"-"`
+}
+
+// A request for adding an entry to a playlist - optionally at a specific index
+type addEntryRequest struct {
+	// The entry to add
+	Entry models.PlaylistEntry
+	// The index to insert the entry at - the entry is appended if not set
+	Index *uint
+}
+
+// A request for changing a playlist entry. The note is a pointer, so a missing note (keep it) can be told from an empty
+// one (remove it) - it shadows the note of the embedded entry when decoding JSON
+type updateEntryRequest struct {
+	models.PlaylistEntry
+	Note *string `json:"note"`
+}
+
+// A request for changing the priority of a playlist entry
+type entryPriorityRequest struct {
+	// The entry to change
+	Entry uint
+	// The new priority of the entry
+	Priority int
+}
+
 type reorderRequest struct {
 	// The entry to move in order
 	Entry uint
@@ -87,9 +221,204 @@ type reorderRequest struct {
 	OtherEntry uint
 }
 
+// A request for starting a new scrape
+type startScrapeRequest struct {
+	// The directory (or file) to start scraping at
+	RootDir string
+	// The options to start the scrape with
+	Options scraper.ScrapeOptions
+}
+
+// A request for testing a file name scraping preset against a sample file name
+type testPresetRequest struct {
+	// The name of the preset to test
+	PresetName string `json:"-"`
+	// The sample file name
+	FileName string `json:"fileName"`
+}
+
+// A request for changing the metadata of multiple videos at once
+type bulkVideoUpdateRequest struct {
+	// The IDs (SHA-512 hashes) of the videos to update
+	IDs []string `json:"ids"`
+	// The fields to change - empty ones are left untouched
+	Patch models.VideoPatch `json:"patch"`
+}
+
+// The result of a bulk update of videos
+type bulkVideoUpdateResponse struct {
+	// The number of videos that have been updated
+	NumUpdated uint `json:"numUpdated"`
+}
+
+// A request for merging two videos into one
+type mergeVideosRequest struct {
+	// The ID (SHA-512 hash) of the video to keep
+	Keep string `json:"keep"`
+	// The ID (SHA-512 hash) of the video to merge into the kept one - it is removed afterwards
+	Merge string `json:"merge"`
+}
+
+// A request for moving the videos of one directory to another one
+type relocateVideosRequest struct {
+	// The directory the video files have been moved from
+	OldDir string `json:"oldDir"`
+	// The directory the video files have been moved to
+	NewDir string `json:"newDir"`
+}
+
+// The result of moving videos to another directory
+type relocateVideosResponse struct {
+	// The number of videos that have been moved
+	NumRelocated uint `json:"numRelocated"`
+}
+
+// A request for adding a tag to or removing a tag from a video
+type videoTagRequest struct {
+	// The ID (SHA-512 hash) of the video
+	ID string `json:"-"`
+	// The tag to add or remove
+	Tag string `json:"tag"`
+}
+
+// A request for permanently removing deleted videos
+type purgeVideosRequest struct {
+	// Only videos deleted more than this number of days ago are removed
+	Days uint
+}
+
+// The response to a purge of deleted videos
+type purgeVideosResponse struct {
+	// The number of videos removed
+	NumPurged uint `json:"numPurged"`
+}
+
+// A request for the list of the most popular videos
+// A request for the statistics of an event
+type eventStatisticsRequest struct {
+	// The ID of the event
+	EventID uint
+	// If set, the videos are ranked by the number of times they have been played instead of requested
+	ByPlayed bool
+}
+
+// A request for resetting the statistics of an event
+type resetStatisticsRequest struct {
+	// The ID of the event
+	EventID uint
+	// Should the global counters of the videos be reduced by the event's counts, too?
+	ResetVideoCounters bool
+}
+
+// A request for the guests that added the most wishes during an event
+type topRequestersRequest struct {
+	// The ID of the event
+	EventID uint
+	// The maximum number of requesters to return
+	Limit uint
+}
+
+// A request for the videos played most during an event
+type eventTopVideosRequest struct {
+	// The ID of the event
+	EventID uint
+	// The maximum number of videos to return
+	Limit uint
+}
+
+// A request for cloning an event
+type cloneEventRequest struct {
+	// The ID of the event to clone
+	EventID uint `json:"-"`
+	// When the new event starts
+	StartsAt time.Time `json:"startsAt"`
+	// When the new event ends
+	EndsAt time.Time `json:"endsAt"`
+	// Should the approved entries of the event's main playlist be copied to the new event?
+	CopyEntries bool `json:"copyEntries"`
+}
+
+type topVideosRequest struct {
+	// The number of videos to return
+	Limit uint
+	// If set, the videos are ranked by the number of times they have been played instead of requested
+	ByPlayed bool
+}
+
+// A request for the sprite sheet of a video
+type spriteRequest struct {
+	// The ID (SHA-512 hash) of the video
+	ID string
+	// The number of frames to put into the sprite sheet
+	Frames uint
+	// The number of columns the frames are arranged in
+	Columns uint
+}
+
+// A request for importing a playlist file into a playlist
+type playlistImportRequest struct {
+	PlaylistID uint
+	// The contents of the playlist file
+	Contents string
+	// The template for the entries to create - contains the requester
+	Entry models.PlaylistEntry
+}
+
+// A request for removing the entries added from an IP address
+type removeEntriesByIPRequest struct {
+	PlaylistID uint
+	IPAddress  string
+}
+
+// The response to removing multiple entries from a playlist at once
+type removeEntriesResponse struct {
+	// The number of entries removed
+	NumRemoved uint `json:"numRemoved"`
+}
+
+// A request for adding multiple entries to a playlist at once
+type addEntriesRequest struct {
+	PlaylistID uint
+	Entries    []models.PlaylistEntry
+}
+
+// A request for merging the entries of one playlist into another
+type mergePlaylistRequest struct {
+	// The playlist to take the entries from
+	Source uint
+	// The playlist to append the entries to
+	Target uint
+	// Remove the source playlist after merging?
+	DeleteSource bool
+}
+
+// The response to merging the entries of one playlist into another
+type mergePlaylistResponse struct {
+	// The number of entries moved to the target playlist
+	NumMerged uint `json:"numMerged"`
+}
+
+// The response containing the time it takes to play all videos of a playlist
+type playlistDurationResponse struct {
+	TotalDuration models.Duration `json:"totalDuration"`
+}
+
+// The response containing the estimated time until a playlist entry will be played
+type estimatedWaitResponse struct {
+	EstimatedWait models.Duration `json:"estimatedWait"`
+}
+
+// The response containing the position of a playlist entry inside its playlist
+type entryPositionResponse struct {
+	// The 1-based position of the entry
+	Position uint `json:"position"`
+	// The total number of entries in the playlist
+	Total uint `json:"total"`
+}
+
 // A request for listing the contents of a playlist
 type playlistEntryListRequest struct {
-	Pagination
+	PlaylistEntrySearch
 	PlaylistID uint
 }
 
@@ -97,6 +426,85 @@ type playlistEntryListRequest struct {
 type loginRequest struct {
 	User string `json:"user"`
 	Pass string `json:"password"`
+	// Store the session ID inside an HttpOnly cookie instead of returning it
+	UseCookie bool `json:"useCookie"`
+}
+
+// The response to logging out all sessions of a user
+type logoutAllResponse struct {
+	// The number of sessions terminated
+	Terminated uint `json:"terminated"`
+}
+
+// A request for creating a new user
+type createUserRequest struct {
+	Name        string   `json:"name"`
+	Password    string   `json:"password"`
+	FullName    string   `json:"fullName"`
+	Permissions []string `json:"permissions"`
+}
+
+// A request for changing the display name of a user
+type updateUserRequest struct {
+	ID       uint   `json:"-"`
+	FullName string `json:"fullName"`
+}
+
+// A request for setting a new password for a user
+type changePasswordRequest struct {
+	ID       uint   `json:"-"`
+	Password string `json:"password"`
+}
+
+// A request for creating a new API key
+type createAPIKeyRequest struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// The API key data returned to the client - the key itself is only contained right after creating the key
+type apiKeyResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Prefix      string    `json:"prefix"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Key         string    `json:"key,omitempty"`
+}
+
+// makeAPIKeyResponse creates the response for the given API key
+func makeAPIKeyResponse(k *models.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:          k.ID,
+		Name:        k.Name,
+		Prefix:      k.Prefix,
+		Permissions: k.PermissionList(),
+		CreatedAt:   k.CreatedAt,
+	}
+}
+
+// A request for replacing the permissions of a user
+type userPermissionsRequest struct {
+	ID          uint     `json:"-"`
+	Permissions []string `json:"permissions"`
+}
+
+// The user data returned to the client - it never contains the password hash
+type userResponse struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	FullName    string   `json:"fullName"`
+	Permissions []string `json:"permissions"`
+}
+
+// makeUserResponse strips the password hash from the given user
+func makeUserResponse(u *models.User) userResponse {
+	return userResponse{
+		ID:          u.ID,
+		Name:        u.Name,
+		FullName:    u.FullName,
+		Permissions: u.PermissionList(),
+	}
 }
 
 // -- Configuration ----------------------------------------------------------------------------------------------------
@@ -104,9 +512,13 @@ type loginRequest struct {
 // MakeConfigEndpoints creates the endpoints needed to use the configuration service
 func MakeConfigEndpoints(s ConfigService) ConfigEndpoints {
 	return ConfigEndpoints{
-		GetWhitelist:        EnsureUserLoggedIn(MakeGetWhitelistEndpoint(s)),
-		AddToWhitelist:      EnsureUserLoggedIn(MakeAddToWhitelistEndpoint(s)),
-		RemoveFromWhitelist: EnsureUserLoggedIn(MakeRemoveFromWhitelistEndpoint(s)),
+		GetWhitelist:        EnsureUserCan(models.PermConfig)(MakeGetWhitelistEndpoint(s)),
+		AddToWhitelist:      EnsureUserCan(models.PermConfig)(MakeAddToWhitelistEndpoint(s)),
+		RemoveFromWhitelist: EnsureUserCan(models.PermConfig)(MakeRemoveFromWhitelistEndpoint(s)),
+		GetBanlist:          EnsureUserCan(models.PermConfig)(MakeGetBanlistEndpoint(s)),
+		AddToBanlist:        EnsureUserCan(models.PermConfig)(MakeAddToBanlistEndpoint(s)),
+		RemoveFromBanlist:   EnsureUserCan(models.PermConfig)(MakeRemoveFromBanlistEndpoint(s)),
+		Reload:              EnsureUserCan(models.PermConfig)(MakeReloadConfigEndpoint(s)),
 	}
 }
 
@@ -145,15 +557,74 @@ func MakeRemoveFromWhitelistEndpoint(s ConfigService) endpoint.Endpoint {
 	}
 }
 
+// MakeGetBanlistEndpoint returns and endpoint calling the BannedIPs method of the ConfigService
+func MakeGetBanlistEndpoint(s ConfigService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return basicResponse{true, s.BannedIPs(ctx)}, nil
+	}
+}
+
+// MakeAddToBanlistEndpoint returns and endpoint calling the AddToBanlist method of the ConfigService
+func MakeAddToBanlistEndpoint(s ConfigService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ipAddr, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Missing IP address parameter")
+		}
+		if err := s.AddToBanlist(ctx, ipAddr); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeRemoveFromBanlistEndpoint returns and endpoint calling the RemoveFromBanlist method of the ConfigService
+func MakeRemoveFromBanlistEndpoint(s ConfigService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ipAddr, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Missing IP address parameter")
+		}
+		if err := s.RemoveFromBanlist(ctx, ipAddr); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeReloadConfigEndpoint returns an endpoint calling the Reload method of the ConfigService. Secrets are removed
+// from the configuration returned
+func MakeReloadConfigEndpoint(s ConfigService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		conf, err := s.Reload(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conf.JWTSecret = ""
+		if conf.DefaultUser != nil {
+			defaultUser := *conf.DefaultUser
+			defaultUser.Password = ""
+			conf.DefaultUser = &defaultUser
+		}
+		return basicResponse{true, conf}, nil
+	}
+}
+
 // -- Scraping ---------------------------------------------------------------------------------------------------------
 
 // MakeScrapingEndpoints creates the endpoints needed to use the scraping service
 func MakeScrapingEndpoints(s ScrapingService) ScrapingEndpoints {
 	return ScrapingEndpoints{
-		ListDirs:    EnsureUserLoggedIn(MakeListDirsEndpoint(s)),
-		ListScrapes: EnsureUserLoggedIn(MakeListScrapesEndpoint(s)),
-		GetScrape:   EnsureUserLoggedIn(MakeGetScrapeEndpoint(s)),
-		Start:       EnsureUserLoggedIn(MakeStartEndpoint(s)),
+		ListDirs:     EnsureUserCan(models.PermScrape)(MakeListDirsEndpoint(s)),
+		ListScrapes:  EnsureUserCan(models.PermScrape)(MakeListScrapesEndpoint(s)),
+		GetScrape:    EnsureUserCan(models.PermScrape)(MakeGetScrapeEndpoint(s)),
+		GetScrapeLog: EnsureUserCan(models.PermScrape)(MakeGetScrapeLogEndpoint(s)),
+		Start:        EnsureUserCan(models.PermScrape)(MakeStartEndpoint(s)),
+		Stop:         EnsureUserCan(models.PermScrape)(MakeStopScrapeEndpoint(s)),
+		ListPresets:  EnsureUserCan(models.PermScrape)(MakeListPresetsEndpoint(s)),
+		CreatePreset: EnsureUserCan(models.PermScrape)(MakeCreatePresetEndpoint(s)),
+		DeletePreset: EnsureUserCan(models.PermScrape)(MakeDeletePresetEndpoint(s)),
+		TestPreset:   EnsureUserCan(models.PermScrape)(MakeTestPresetEndpoint(s)),
 	}
 }
 
@@ -194,21 +665,100 @@ func MakeGetScrapeEndpoint(s ScrapingService) endpoint.Endpoint {
 	}
 }
 
+// MakeGetScrapeLogEndpoint returns an endpoint calling the GetScrapeLog method on the provided ScrapingService
+func MakeGetScrapeLogEndpoint(s ScrapingService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		rootDir, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Illegal path parameter")
+		}
+		entries, err := s.GetScrapeLog(ctx, rootDir)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, entries}, nil
+	}
+}
+
 // MakeStartEndpoint returns an endpoint calling the Start method on the provided ScrapingService
 func MakeStartEndpoint(s ScrapingService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(startScrapeRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal scrape request")
+		}
+		err := s.Start(ctx, req.RootDir, req.Options)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeStopScrapeEndpoint returns an endpoint calling the Stop method on the provided ScrapingService
+func MakeStopScrapeEndpoint(s ScrapingService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		rootDir, ok := request.(string)
 		if !ok {
 			return nil, fmt.Errorf("Illegal path parameter")
 		}
-		err := s.Start(ctx, rootDir)
-		if err != nil {
+		if err := s.Stop(ctx, rootDir); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeListPresetsEndpoint returns an endpoint calling the ListPresets method on the provided ScrapingService
+func MakeListPresetsEndpoint(s ScrapingService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return basicResponse{true, s.ListPresets(ctx)}, nil
+	}
+}
+
+// MakeCreatePresetEndpoint returns an endpoint calling the CreatePreset method on the provided ScrapingService
+func MakeCreatePresetEndpoint(s ScrapingService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		preset, ok := request.(scraper.NameScrapingPreset)
+		if !ok {
+			return nil, fmt.Errorf("Illegal scraping preset parameter")
+		}
+		if err := s.CreatePreset(ctx, preset); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeDeletePresetEndpoint returns an endpoint calling the DeletePreset method on the provided ScrapingService
+func MakeDeletePresetEndpoint(s ScrapingService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		name, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Illegal preset name parameter")
+		}
+		if err := s.DeletePreset(ctx, name); err != nil {
 			return nil, err
 		}
 		return basicResponse{true, nil}, nil
 	}
 }
 
+// MakeTestPresetEndpoint returns an endpoint calling the TestPreset method on the provided ScrapingService
+func MakeTestPresetEndpoint(s ScrapingService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(testPresetRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal preset test request")
+		}
+		res, err := s.TestPreset(ctx, req.PresetName, req.FileName)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, res}, nil
+	}
+}
+
 // -- Video data -------------------------------------------------------------------------------------------------------
 
 // Repacks the videos into the guest-facing response type
@@ -223,26 +773,52 @@ func repackVideos(vids []models.Video) []models.VideoSummary {
 // MakeVideoEndpoints creates the endpoints needed for using the video service
 func MakeVideoEndpoints(s VideoService) VideoEndpoints {
 	return VideoEndpoints{
-		List:   MakeListVideosEndpoint(s),
-		Get:    EnsureUserLoggedIn(MakeGetVideoEndpoint(s)),
-		Update: EnsureUserLoggedIn(MakeUpdateVideoEndpoint(s)),
-		Delete: EnsureUserLoggedIn(MakeDeleteVideoEndpoint(s)),
+		List:         MakeListVideosEndpoint(s),
+		Get:          EnsureUserLoggedIn(MakeGetVideoEndpoint(s)),
+		GetByIdent:   MakeGetVideosByIdentifierEndpoint(s),
+		Create:       EnsureUserCan(models.PermVideoEdit)(MakeCreateVideoEndpoint(s)),
+		Update:       EnsureUserCan(models.PermVideoEdit)(MakeUpdateVideoEndpoint(s)),
+		UpdateMany:   EnsureUserCan(models.PermVideoEdit)(MakeUpdateManyVideosEndpoint(s)),
+		Delete:       EnsureUserCan(models.PermVideoDelete)(MakeDeleteVideoEndpoint(s)),
+		Merge:        EnsureUserCan(models.PermVideoEdit)(MakeMergeVideosEndpoint(s)),
+		Restore:      EnsureUserCan(models.PermVideoEdit)(MakeRestoreVideoEndpoint(s)),
+		Purge:        EnsureUserCan(models.PermVideoDelete)(MakePurgeVideosEndpoint(s)),
+		MarkPlayed:   EnsureUserCan(models.PermPlayback)(MakeMarkVideoPlayedEndpoint(s)),
+		Verify:       EnsureUserLoggedIn(MakeVerifyVideosEndpoint(s)),
+		Relocate:     EnsureUserCan(models.PermVideoEdit)(MakeRelocateVideosEndpoint(s)),
+		Thumbnail:    MakeVideoThumbnailEndpoint(s),
+		Sprite:       EnsureUserLoggedIn(MakeVideoSpriteEndpoint(s)),
+		Chapters:     MakeVideoChaptersEndpoint(s),
+		AddTag:       EnsureUserCan(models.PermVideoEdit)(MakeAddVideoTagEndpoint(s)),
+		RemoveTag:    EnsureUserCan(models.PermVideoEdit)(MakeRemoveVideoTagEndpoint(s)),
+		ListTags:     MakeListTagsEndpoint(s),
+		Export:       EnsureUserLoggedIn(MakeExportVideosEndpoint(s)),
+		Top:          MakeTopVideosEndpoint(s),
+		Languages:    MakeLanguageFacetsEndpoint(s),
+		Artists:      MakeListArtistsEndpoint(s),
+		RelatedMedia: MakeListRelatedMediaEndpoint(s),
 	}
 }
 
 // MakeListVideosEndpoint returns an endpoint calling the List method on the provided VideoService
 func MakeListVideosEndpoint(s VideoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		search, ok := request.(Search)
+		search, ok := request.(VideoSearch)
 		if !ok {
 			return nil, fmt.Errorf("Illegal search parameter")
 		}
+		sess := ctxhelper.Session(ctx)
+		admin := sess != nil && sess.UserCan(models.PermVideoSeeFullDetails)
+		if !admin {
+			// Guests only get to see the videos that can actually be played
+			available := true
+			search.Available = &available
+		}
 		vids, numRows, err := s.List(ctx, &search)
 		if err != nil {
 			return nil, err
 		}
-		sess := ctxhelper.Session(ctx)
-		if sess != nil && sess.UserCan(models.PermVideoSeeFullDetails) {
+		if admin {
 			// We have an admin - so he gets the full video data
 			return basicResponse{true, pagingResponse{numRows, vids}}, nil
 		}
@@ -266,6 +842,50 @@ func MakeGetVideoEndpoint(s VideoService) endpoint.Endpoint {
 	}
 }
 
+// MakeGetVideosByIdentifierEndpoint returns an endpoint calling the GetByIdentifier method on the provided
+// VideoService. If only one video matches, it is returned as a single object - otherwise, a list is returned
+// Guests only get to see the guest-facing data of available videos
+func MakeGetVideosByIdentifierEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		identifier, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Illegal video identifier parameter")
+		}
+		sess := ctxhelper.Session(ctx)
+		admin := sess != nil && sess.UserCan(models.PermVideoSeeFullDetails)
+		vids, err := s.GetByIdentifier(ctx, identifier, !admin)
+		if err != nil {
+			return nil, err
+		}
+		if admin {
+			if len(vids) == 1 {
+				return basicResponse{true, vids[0]}, nil
+			}
+			return basicResponse{true, vids}, nil
+		}
+		summaries := repackVideos(vids)
+		if len(summaries) == 1 {
+			return basicResponse{true, summaries[0]}, nil
+		}
+		return basicResponse{true, summaries}, nil
+	}
+}
+
+// MakeCreateVideoEndpoint returns an endpoint calling the Create method on the provided VideoService
+func MakeCreateVideoEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		vid, ok := request.(models.Video)
+		if !ok {
+			return nil, fmt.Errorf("Illegal video parameter")
+		}
+		created, err := s.Create(ctx, &vid)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, created}, nil
+	}
+}
+
 // MakeUpdateVideoEndpoint returns an endpoint calling the List method on the provided VideoService
 func MakeUpdateVideoEndpoint(s VideoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
@@ -280,6 +900,21 @@ func MakeUpdateVideoEndpoint(s VideoService) endpoint.Endpoint {
 	}
 }
 
+// MakeUpdateManyVideosEndpoint returns an endpoint calling the UpdateMany method on the provided VideoService
+func MakeUpdateManyVideosEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(bulkVideoUpdateRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal bulk update request")
+		}
+		num, err := s.UpdateMany(ctx, req.IDs, req.Patch)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, bulkVideoUpdateResponse{num}}, nil
+	}
+}
+
 // MakeDeleteVideoEndpoint returns an endpoint calling the List method on the provided VideoService
 func MakeDeleteVideoEndpoint(s VideoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
@@ -294,76 +929,341 @@ func MakeDeleteVideoEndpoint(s VideoService) endpoint.Endpoint {
 	}
 }
 
-// -- Playlists --------------------------------------------------------------------------------------------------------
-
-// MakePlaylistEndpoints creates the endpoints needed for using the playlist service
-func MakePlaylistEndpoints(s PlaylistService) PlaylistEndpoints {
-	return PlaylistEndpoints{
-		Create:           EnsureUserLoggedIn(MakeCreatePlaylistEndpoint(s)),
-		Update:           EnsureUserLoggedIn(MakeUpdatePlaylistEndpoint(s)),
-		Delete:           EnsureUserLoggedIn(MakeDeletePlaylistEndpoint(s)),
-		Get:              EnsureUserLoggedIn(MakeGetPlaylistEndpoint(s)),
-		List:             EnsureUserLoggedIn(MakeListPlaylistsEndpoint(s)),
-		ListEntries:      EnsureUserLoggedIn(MakeListPlaylistEntriesEndpoint(s)),
-		AddEntry:         EnsureUserLoggedIn(MakeAddPlaylistEntryEndpoint(s)),
-		PlaceEntryBefore: EnsureUserLoggedIn(MakePlaceEntryBeforeEndpint(s)),
-		UpdateEntry:      EnsureUserLoggedIn(MakeUpdateEntryEndpoint(s)),
-		DeleteEntry:      EnsureUserLoggedIn(MakeDeleteEntryEndpoint(s)),
-		GetMain:          MakeGetMainPlaylistEndpoint(s),
-		ListMainEntries:  MakeListMainPlaylistEntriesEndpoint(s),
-		AddMainEntry:     MakeAddMainPlaylistEntryEndpoint(s),
-	}
-}
-
-// MakeListPlaylistsEndpoint returns an endpoint calling the Create method on the provided PlaylistService
-func MakeListPlaylistsEndpoint(s PlaylistService) endpoint.Endpoint {
+// MakeMergeVideosEndpoint returns an endpoint calling the Merge method on the provided VideoService
+func MakeMergeVideosEndpoint(s VideoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		se, ok := request.(Search)
+		req, ok := request.(mergeVideosRequest)
 		if !ok {
-			return nil, fmt.Errorf("Illegal search parameter")
+			return nil, fmt.Errorf("Illegal merge request")
 		}
-		lists, numRows, err := s.List(ctx, &se)
+		vid, err := s.Merge(ctx, req.Keep, req.Merge)
 		if err != nil {
 			return nil, err
 		}
-		return basicResponse{true, pagingResponse{numRows, lists}}, nil
+		return basicResponse{true, vid}, nil
 	}
 }
 
-// MakeCreatePlaylistEndpoint returns an endpoint calling the Create method on the provided PlaylistService
-func MakeCreatePlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
+// MakeRestoreVideoEndpoint returns an endpoint calling the Restore method on the provided VideoService
+func MakeRestoreVideoEndpoint(s VideoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		playlist, ok := request.(models.Playlist)
+		id, ok := request.(string)
 		if !ok {
-			return nil, fmt.Errorf("Illegal playlist parameter")
+			return nil, fmt.Errorf("Illegal video ID parameter")
 		}
-		pl, err := s.Create(ctx, &playlist)
-		if err != nil {
+		if err := s.Restore(ctx, id); err != nil {
 			return nil, err
 		}
-		return basicResponse{true, pl}, nil
+		return basicResponse{true, nil}, nil
 	}
 }
 
-// MakeGetPlaylistEndpoint returns an endpoint calling the Get method on the provided PlaylistService
-func MakeGetPlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
+// MakePurgeVideosEndpoint returns an endpoint calling the Purge method on the provided VideoService
+func MakePurgeVideosEndpoint(s VideoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		id, ok := request.(uint)
+		req, ok := request.(purgeVideosRequest)
 		if !ok {
-			return nil, fmt.Errorf("Illegal playlist ID")
+			return nil, fmt.Errorf("Illegal purge request")
 		}
-		pl, err := s.Get(ctx, id)
+		num, err := s.Purge(ctx, req.Days)
 		if err != nil {
 			return nil, err
 		}
-		return basicResponse{true, pl}, nil
+		return basicResponse{true, purgeVideosResponse{num}}, nil
 	}
 }
 
-// MakeUpdatePlaylistEndpoint returns an endpoint calling the Update method on the provided PlaylistService
-func MakeUpdatePlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
+// MakeMarkVideoPlayedEndpoint returns an endpoint calling the MarkPlayed method on the provided VideoService
+func MakeMarkVideoPlayedEndpoint(s VideoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		playlist, ok := request.(models.Playlist)
+		id, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Illegal video ID parameter")
+		}
+		if err := s.MarkPlayed(ctx, id); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeVerifyVideosEndpoint returns an endpoint calling the Verify method on the provided VideoService
+func MakeVerifyVideosEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		res, err := s.Verify(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, res}, nil
+	}
+}
+
+// MakeRelocateVideosEndpoint returns an endpoint calling the Relocate method on the provided VideoService
+func MakeRelocateVideosEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(relocateVideosRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal relocation request")
+		}
+		num, err := s.Relocate(ctx, req.OldDir, req.NewDir)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, relocateVideosResponse{num}}, nil
+	}
+}
+
+// MakeVideoThumbnailEndpoint returns an endpoint calling the GetThumbnail method on the provided VideoService
+func MakeVideoThumbnailEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Illegal video ID parameter")
+		}
+		fileName, err := s.GetThumbnail(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return fileResponse{fileName}, nil
+	}
+}
+
+// MakeVideoSpriteEndpoint returns an endpoint calling the GetSprite method on the provided VideoService
+func MakeVideoSpriteEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(spriteRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal sprite request")
+		}
+		fileName, err := s.GetSprite(ctx, req.ID, req.Frames, req.Columns)
+		if err != nil {
+			return nil, err
+		}
+		return fileResponse{fileName}, nil
+	}
+}
+
+// MakeVideoChaptersEndpoint returns an endpoint calling the GetChapters method on the provided VideoService
+func MakeVideoChaptersEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Illegal video ID parameter")
+		}
+		chapters, err := s.GetChapters(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, chapters}, nil
+	}
+}
+
+// MakeAddVideoTagEndpoint returns an endpoint calling the AddTag method on the provided VideoService
+func MakeAddVideoTagEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(videoTagRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal tag request")
+		}
+		if err := s.AddTag(ctx, req.ID, req.Tag); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeRemoveVideoTagEndpoint returns an endpoint calling the RemoveTag method on the provided VideoService
+func MakeRemoveVideoTagEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(videoTagRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal tag request")
+		}
+		if err := s.RemoveTag(ctx, req.ID, req.Tag); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeListTagsEndpoint returns an endpoint calling the ListTags method on the provided VideoService
+func MakeListTagsEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		tags, err := s.ListTags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, tags}, nil
+	}
+}
+
+// MakeListArtistsEndpoint returns an endpoint calling the Artists method on the provided VideoService
+func MakeListArtistsEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		search, ok := request.(Search)
+		if !ok {
+			return nil, fmt.Errorf("Illegal search parameter")
+		}
+		artists, err := s.Artists(ctx, &search)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, artists}, nil
+	}
+}
+
+// MakeListRelatedMediaEndpoint returns an endpoint calling the RelatedMedia method on the provided VideoService
+func MakeListRelatedMediaEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		search, ok := request.(Search)
+		if !ok {
+			return nil, fmt.Errorf("Illegal search parameter")
+		}
+		media, err := s.RelatedMedia(ctx, &search)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, media}, nil
+	}
+}
+
+// MakeLanguageFacetsEndpoint returns an endpoint calling the LanguageFacets method on the provided VideoService
+// Like with the video list, guests only get the available videos counted
+func MakeLanguageFacetsEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		sess := ctxhelper.Session(ctx)
+		admin := sess != nil && sess.UserCan(models.PermVideoSeeFullDetails)
+		facets, err := s.LanguageFacets(ctx, !admin)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, facets}, nil
+	}
+}
+
+// MakeTopVideosEndpoint returns an endpoint calling the Top method on the provided VideoService
+// Since the top list is public, only the guest-facing video data is returned
+func MakeTopVideosEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(topVideosRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal top list request")
+		}
+		vids, err := s.Top(ctx, req.Limit, req.ByPlayed)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, repackVideos(vids)}, nil
+	}
+}
+
+// MakeExportVideosEndpoint returns an endpoint calling the Export method on the provided VideoService
+func MakeExportVideosEndpoint(s VideoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		search, ok := request.(VideoSearch)
+		if !ok {
+			return nil, fmt.Errorf("Illegal search parameter")
+		}
+		return streamResponse{
+			ContentType: "text/csv; charset=utf-8",
+			FileName:    "videos.csv",
+			Write: func(w io.Writer) error {
+				return s.Export(ctx, &search, w)
+			},
+		}, nil
+	}
+}
+
+// -- Playlists --------------------------------------------------------------------------------------------------------
+
+// MakePlaylistEndpoints creates the endpoints needed for using the playlist service
+func MakePlaylistEndpoints(s PlaylistService) PlaylistEndpoints {
+	return PlaylistEndpoints{
+		Create:              EnsureUserLoggedIn(MakeCreatePlaylistEndpoint(s)),
+		Update:              EnsureUserLoggedIn(MakeUpdatePlaylistEndpoint(s)),
+		Delete:              EnsureUserLoggedIn(MakeDeletePlaylistEndpoint(s)),
+		Get:                 EnsureUserLoggedIn(MakeGetPlaylistEndpoint(s)),
+		List:                EnsureUserLoggedIn(MakeListPlaylistsEndpoint(s)),
+		ListEntries:         EnsureUserLoggedIn(MakeListPlaylistEntriesEndpoint(s)),
+		AddEntry:            EnsureUserLoggedIn(MakeAddPlaylistEntryEndpoint(s)),
+		AddEntries:          EnsureUserLoggedIn(MakeAddPlaylistEntriesEndpoint(s)),
+		PlaceEntryBefore:    EnsureUserLoggedIn(MakePlaceEntryBeforeEndpint(s)),
+		SwapEntries:         EnsureUserLoggedIn(MakeSwapEntriesEndpoint(s)),
+		MoveToTop:           EnsureUserLoggedIn(MakeMoveToTopEndpoint(s)),
+		MoveToBottom:        EnsureUserLoggedIn(MakeMoveToBottomEndpoint(s)),
+		Shuffle:             EnsureUserLoggedIn(MakeShufflePlaylistEndpoint(s)),
+		ExportXSPF:          EnsureUserLoggedIn(MakeExportPlaylistXSPFEndpoint(s)),
+		ImportM3U:           EnsureUserLoggedIn(MakeImportPlaylistM3UEndpoint(s)),
+		UpdateEntry:         EnsureUserLoggedIn(MakeUpdateEntryEndpoint(s)),
+		DeleteEntry:         EnsureUserLoggedIn(MakeDeleteEntryEndpoint(s)),
+		MarkEntryPlayed:     EnsureUserCan(models.PermPlayback)(MakeMarkEntryPlayedEndpoint(s)),
+		ApproveEntry:        EnsureUserLoggedIn(MakeApproveEntryEndpoint(s)),
+		SetEntryPriority:    EnsureUserLoggedIn(MakeSetEntryPriorityEndpoint(s)),
+		RejectEntry:         EnsureUserLoggedIn(MakeRejectEntryEndpoint(s)),
+		RemovePlayed:        EnsureUserLoggedIn(MakeRemovePlayedEntriesEndpoint(s)),
+		RemoveByIP:          EnsureUserLoggedIn(MakeRemoveEntriesByIPEndpoint(s)),
+		MergeInto:           EnsureUserLoggedIn(MakeMergePlaylistEndpoint(s)),
+		TotalDuration:       EnsureUserLoggedIn(MakeTotalDurationEndpoint(s)),
+		GetMain:             MakeGetMainPlaylistEndpoint(s),
+		ListMainEntries:     MakeListMainPlaylistEntriesEndpoint(s),
+		AddMainEntry:        MakeAddMainPlaylistEntryEndpoint(s),
+		NextMainEntry:       MakeNextMainPlaylistEntryEndpoint(s),
+		EstimatedWait:       MakeEstimatedWaitEndpoint(s),
+		EntryPosition:       MakeEntryPositionEndpoint(s),
+		CurrentMainEntry:    MakeCurrentMainPlaylistEntryEndpoint(s),
+		SetCurrentMainEntry: EnsureUserCan(models.PermPlayback)(MakeSetCurrentMainPlaylistEntryEndpoint(s)),
+	}
+}
+
+// MakeListPlaylistsEndpoint returns an endpoint calling the Create method on the provided PlaylistService
+func MakeListPlaylistsEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		se, ok := request.(Search)
+		if !ok {
+			return nil, fmt.Errorf("Illegal search parameter")
+		}
+		lists, numRows, err := s.List(ctx, &se)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, pagingResponse{numRows, lists}}, nil
+	}
+}
+
+// MakeCreatePlaylistEndpoint returns an endpoint calling the Create method on the provided PlaylistService
+func MakeCreatePlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		playlist, ok := request.(models.Playlist)
+		if !ok {
+			return nil, fmt.Errorf("Illegal playlist parameter")
+		}
+		pl, err := s.Create(ctx, &playlist)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, pl}, nil
+	}
+}
+
+// MakeGetPlaylistEndpoint returns an endpoint calling the Get method on the provided PlaylistService
+func MakeGetPlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal playlist ID")
+		}
+		pl, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, pl}, nil
+	}
+}
+
+// MakeUpdatePlaylistEndpoint returns an endpoint calling the Update method on the provided PlaylistService
+func MakeUpdatePlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		playlist, ok := request.(models.Playlist)
 		if !ok {
 			return nil, fmt.Errorf("Illegal playlist parameter")
 		}
@@ -390,14 +1290,81 @@ func MakeDeletePlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
 	}
 }
 
+// MakeShufflePlaylistEndpoint returns an endpoint calling the Shuffle method on the provided PlaylistService
+func MakeShufflePlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal playlist ID")
+		}
+		if err := s.Shuffle(ctx, id); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeExportPlaylistXSPFEndpoint returns an endpoint calling the ExportXSPF method on the provided PlaylistService
+func MakeExportPlaylistXSPFEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal playlist ID")
+		}
+		pl, err := s.ExportXSPF(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return streamResponse{
+			ContentType: "application/xspf+xml; charset=utf-8",
+			FileName:    fmt.Sprintf("playlist-%d.xspf", id),
+			Write: func(w io.Writer) error {
+				if _, err := io.WriteString(w, xml.Header); err != nil {
+					return err
+				}
+				enc := xml.NewEncoder(w)
+				enc.Indent("", "  ")
+				return enc.Encode(pl)
+			},
+		}, nil
+	}
+}
+
+// MakeImportPlaylistM3UEndpoint returns an endpoint calling the ImportM3U method on the provided PlaylistService
+// If no requester is given, the entries are marked as requested by the user logged in
+func MakeImportPlaylistM3UEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(playlistImportRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal import request")
+		}
+		if usr := ctxhelper.User(ctx); usr != nil && strings.TrimSpace(req.Entry.RequestedBy) == "" {
+			req.Entry.RequestedBy = usr.FullName
+			if req.Entry.RequestedBy == "" {
+				req.Entry.RequestedBy = usr.Name
+			}
+		}
+		res, err := s.ImportM3U(ctx, req.PlaylistID, req.Contents, req.Entry)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, res}, nil
+	}
+}
+
 // MakeAddPlaylistEntryEndpoint returns an endpoint calling the AddEntry method on the provided PlaylistService
 func MakeAddPlaylistEntryEndpoint(s PlaylistService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req, ok := request.(models.PlaylistEntry)
+		req, ok := request.(addEntryRequest)
 		if !ok {
 			return nil, fmt.Errorf("Illegal playlist entry request")
 		}
-		err := s.AddEntry(ctx, req.PlaylistID, &req)
+		var err error
+		if req.Index != nil {
+			err = s.InsertEntry(ctx, req.Entry.PlaylistID, &req.Entry, *req.Index)
+		} else {
+			err = s.AddEntry(ctx, req.Entry.PlaylistID, &req.Entry)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -412,7 +1379,7 @@ func MakeListPlaylistEntriesEndpoint(s PlaylistService) endpoint.Endpoint {
 		if !ok {
 			return nil, fmt.Errorf("Illegal playlist list request")
 		}
-		list, numRows, err := s.ListEntries(ctx, req.PlaylistID, req.Offset, req.Limit)
+		list, numRows, err := s.ListEntries(ctx, req.PlaylistID, &req.PlaylistEntrySearch)
 		if err != nil {
 			return nil, err
 		}
@@ -427,65 +1394,309 @@ func MakeGetMainPlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
 		if err != nil {
 			return nil, err
 		}
-		return basicResponse{true, pl}, nil
+		return basicResponse{true, pl}, nil
+	}
+}
+
+// MakeListMainPlaylistEntriesEndpoint returns an endpoint calling the ListMainEntries method on the provided
+// PlaylistService
+func MakeListMainPlaylistEntriesEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		search, ok := request.(PlaylistEntrySearch)
+		if !ok {
+			return nil, fmt.Errorf("Illegal search parameter")
+		}
+		list, numRows, err := s.ListMainEntries(ctx, &search)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, pagingResponse{numRows, list}}, nil
+	}
+}
+
+// MakeNextMainPlaylistEntryEndpoint returns an endpoint calling the NextMainEntry method on the provided
+// PlaylistService
+func MakeNextMainPlaylistEntryEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		entry, err := s.NextMainEntry(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, entry}, nil
+	}
+}
+
+// MakeEstimatedWaitEndpoint returns an endpoint calling the EstimatedWait method on the provided PlaylistService
+func MakeEstimatedWaitEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal entry ID")
+		}
+		wait, err := s.EstimatedWait(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, estimatedWaitResponse{models.Duration(wait)}}, nil
+	}
+}
+
+// MakeEntryPositionEndpoint returns an endpoint calling the EntryPosition method on the provided PlaylistService
+func MakeEntryPositionEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal entry ID")
+		}
+		position, total, err := s.EntryPosition(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, entryPositionResponse{position, total}}, nil
+	}
+}
+
+// MakeAddPlaylistEntriesEndpoint returns an endpoint calling the AddEntries method on the provided PlaylistService
+func MakeAddPlaylistEntriesEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(addEntriesRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal batch request")
+		}
+		results, err := s.AddEntries(ctx, req.PlaylistID, req.Entries)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, results}, nil
+	}
+}
+
+// MakeUpdateEntryEndpoint returns an endpoint calling the UpdateEntry method on the provided PlaylistService
+func MakeUpdateEntryEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(updateEntryRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal playlist entry")
+		}
+		err := s.UpdateEntry(ctx, req.PlaylistEntry, req.Note)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeDeleteEntryEndpoint returns an endpoint calling the DeleteEntry method on the provided PlaylistService
+func MakeDeleteEntryEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal entry ID")
+		}
+		err := s.DeleteEntry(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeCurrentMainPlaylistEntryEndpoint returns an endpoint calling the CurrentMainEntry method on the provided
+// PlaylistService
+func MakeCurrentMainPlaylistEntryEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		entry, err := s.CurrentMainEntry(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, entry}, nil
+	}
+}
+
+// MakeSetCurrentMainPlaylistEntryEndpoint returns an endpoint calling the SetCurrentMainEntry method on the provided
+// PlaylistService
+func MakeSetCurrentMainPlaylistEntryEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal entry ID")
+		}
+		entry, err := s.SetCurrentMainEntry(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, entry}, nil
+	}
+}
+
+// MakeMarkEntryPlayedEndpoint returns an endpoint calling the MarkEntryPlayed method on the provided PlaylistService
+func MakeMarkEntryPlayedEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal entry ID")
+		}
+		if err := s.MarkEntryPlayed(ctx, id); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeSetEntryPriorityEndpoint returns an endpoint calling the SetEntryPriority method on the provided PlaylistService
+func MakeSetEntryPriorityEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(entryPriorityRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal priority request")
+		}
+		if err := s.SetEntryPriority(ctx, req.Entry, req.Priority); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeApproveEntryEndpoint returns an endpoint calling the ApproveEntry method on the provided PlaylistService
+func MakeApproveEntryEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal entry ID")
+		}
+		if err := s.ApproveEntry(ctx, id); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeRejectEntryEndpoint returns an endpoint calling the RejectEntry method on the provided PlaylistService
+func MakeRejectEntryEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal entry ID")
+		}
+		if err := s.RejectEntry(ctx, id); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// MakeRemovePlayedEntriesEndpoint returns an endpoint calling the RemovePlayedEntries method on the provided
+// PlaylistService
+func MakeRemovePlayedEntriesEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal playlist ID")
+		}
+		num, err := s.RemovePlayedEntries(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, removeEntriesResponse{num}}, nil
+	}
+}
+
+// MakeRemoveEntriesByIPEndpoint returns an endpoint calling the RemoveEntriesByIP method on the provided PlaylistService
+func MakeRemoveEntriesByIPEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(removeEntriesByIPRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal removal request")
+		}
+		num, err := s.RemoveEntriesByIP(ctx, req.PlaylistID, req.IPAddress)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, removeEntriesResponse{num}}, nil
+	}
+}
+
+// MakeMergePlaylistEndpoint returns an endpoint calling the MergeInto method on the provided PlaylistService
+func MakeMergePlaylistEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(mergePlaylistRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal merge request")
+		}
+		num, err := s.MergeInto(ctx, req.Source, req.Target, req.DeleteSource)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, mergePlaylistResponse{num}}, nil
+	}
+}
+
+// MakeTotalDurationEndpoint returns an endpoint calling the TotalDuration method on the provided PlaylistService
+func MakeTotalDurationEndpoint(s PlaylistService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal playlist ID")
+		}
+		total, err := s.TotalDuration(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, playlistDurationResponse{models.Duration(total)}}, nil
 	}
 }
 
-// MakeListMainPlaylistEntriesEndpoint returns an endpoint calling the ListMainEntries method on the provided
-// PlaylistService
-func MakeListMainPlaylistEntriesEndpoint(s PlaylistService) endpoint.Endpoint {
+// MakePlaceEntryBeforeEndpint returns an endpoint calling the PlaceEntryBefore method on the provided PlaylistService
+func MakePlaceEntryBeforeEndpint(s PlaylistService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		pag, ok := request.(Pagination)
+		req, ok := request.(reorderRequest)
 		if !ok {
-			return nil, fmt.Errorf("Illegal pagination parameter")
+			return nil, fmt.Errorf("Illegal reorder request")
 		}
-		list, numRows, err := s.ListMainEntries(ctx, pag.Offset, pag.Limit)
+		err := s.PlaceEntryBefore(ctx, req.Entry, req.OtherEntry)
 		if err != nil {
 			return nil, err
 		}
-		return basicResponse{true, pagingResponse{numRows, list}}, nil
+		return basicResponse{true, nil}, nil
 	}
 }
 
-// MakeUpdateEntryEndpoint returns an endpoint calling the UpdateEntry method on the provided PlaylistService
-func MakeUpdateEntryEndpoint(s PlaylistService) endpoint.Endpoint {
+// MakeSwapEntriesEndpoint returns an endpoint calling the SwapEntries method on the provided PlaylistService
+func MakeSwapEntriesEndpoint(s PlaylistService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req, ok := request.(models.PlaylistEntry)
+		req, ok := request.(reorderRequest)
 		if !ok {
-			return nil, fmt.Errorf("Illegal playlist entry")
+			return nil, fmt.Errorf("Illegal reorder request")
 		}
-		err := s.UpdateEntry(ctx, req)
-		if err != nil {
+		if err := s.SwapEntries(ctx, req.Entry, req.OtherEntry); err != nil {
 			return nil, err
 		}
 		return basicResponse{true, nil}, nil
 	}
 }
 
-// MakeDeleteEntryEndpoint returns an endpoint calling the DeleteEntry method on the provided PlaylistService
-func MakeDeleteEntryEndpoint(s PlaylistService) endpoint.Endpoint {
+// MakeMoveToTopEndpoint returns an endpoint calling the MoveToTop method on the provided PlaylistService
+func MakeMoveToTopEndpoint(s PlaylistService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		id, ok := request.(uint)
 		if !ok {
 			return nil, fmt.Errorf("Illegal entry ID")
 		}
-		err := s.DeleteEntry(ctx, id)
-		if err != nil {
+		if err := s.MoveToTop(ctx, id); err != nil {
 			return nil, err
 		}
 		return basicResponse{true, nil}, nil
 	}
 }
 
-// MakePlaceEntryBeforeEndpint returns an endpoint calling the PlaceEntryBefore method on the provided PlaylistService
-func MakePlaceEntryBeforeEndpint(s PlaylistService) endpoint.Endpoint {
+// MakeMoveToBottomEndpoint returns an endpoint calling the MoveToBottom method on the provided PlaylistService
+func MakeMoveToBottomEndpoint(s PlaylistService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req, ok := request.(reorderRequest)
+		id, ok := request.(uint)
 		if !ok {
-			return nil, fmt.Errorf("Illegal reorder request")
+			return nil, fmt.Errorf("Illegal entry ID")
 		}
-		err := s.PlaceEntryBefore(ctx, req.Entry, req.OtherEntry)
-		if err != nil {
+		if err := s.MoveToBottom(ctx, id); err != nil {
 			return nil, err
 		}
 		return basicResponse{true, nil}, nil
@@ -519,6 +1730,13 @@ func MakeEventEndpoints(s EventService) EventEndpoints {
 		Delete:          EnsureUserLoggedIn(makeDeleteEventEndpoint(s)),
 		SetCurrentEvent: EnsureUserLoggedIn(makeSetCurrentEventEndpoint(s)),
 		CurrentEvent:    makeGetCurrentEventEndpoint(s),
+		Statistics:      EnsureUserLoggedIn(makeEventStatisticsEndpoint(s)),
+		TopRequesters:   EnsureUserLoggedIn(makeTopRequestersEndpoint(s)),
+		TopVideos:       EnsureUserLoggedIn(makeEventTopVideosEndpoint(s)),
+		Clone:           EnsureUserLoggedIn(makeCloneEventEndpoint(s)),
+		Archive:         EnsureUserLoggedIn(makeArchiveEventEndpoint(s)),
+		Overlaps:        EnsureUserLoggedIn(makeEventOverlapsEndpoint(s)),
+		ResetStatistics: EnsureUserLoggedIn(makeResetEventStatisticsEndpoint(s)),
 	}
 }
 
@@ -550,6 +1768,61 @@ func makeGetEventEndpoint(s EventService) endpoint.Endpoint {
 	}
 }
 
+func makeEventStatisticsEndpoint(s EventService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(eventStatisticsRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal statistics request")
+		}
+		stats, err := s.Statistics(ctx, req.EventID, req.ByPlayed)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, stats}, nil
+	}
+}
+
+func makeResetEventStatisticsEndpoint(s EventService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(resetStatisticsRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal statistics reset request")
+		}
+		if err := s.ResetStatistics(ctx, req.EventID, req.ResetVideoCounters); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+func makeTopRequestersEndpoint(s EventService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(topRequestersRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal top requesters request")
+		}
+		requesters, err := s.TopRequesters(ctx, req.EventID, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, requesters}, nil
+	}
+}
+
+func makeEventTopVideosEndpoint(s EventService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(eventTopVideosRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal top videos request")
+		}
+		videos, err := s.TopVideos(ctx, req.EventID, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, videos}, nil
+	}
+}
+
 func makeCreateEventEndpoint(s EventService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		event, ok := request.(models.Event)
@@ -564,6 +1837,50 @@ func makeCreateEventEndpoint(s EventService) endpoint.Endpoint {
 	}
 }
 
+func makeCloneEventEndpoint(s EventService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(cloneEventRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal clone request")
+		}
+		ev, err := s.Clone(ctx, req.EventID, req.StartsAt, req.EndsAt, req.CopyEntries)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, ev}, nil
+	}
+}
+
+func makeArchiveEventEndpoint(s EventService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal event ID")
+		}
+		// Check for the event before the response headers are sent
+		if _, err := s.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return streamResponse{
+			ContentType: "application/json; charset=utf-8",
+			FileName:    fmt.Sprintf("event-%d.json", id),
+			Write: func(w io.Writer) error {
+				return s.Archive(ctx, id, w)
+			},
+		}, nil
+	}
+}
+
+func makeEventOverlapsEndpoint(s EventService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		overlaps, err := s.Overlaps(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, overlaps}, nil
+	}
+}
+
 func makeUpdateEventEndpoint(s EventService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		event, ok := request.(models.Event)
@@ -606,13 +1923,23 @@ func makeSetCurrentEventEndpoint(s EventService) endpoint.Endpoint {
 	}
 }
 
+// guestEvent returns a copy of the given event without the data guests are not allowed to see
+func guestEvent(ev *models.Event) *models.Event {
+	if ev == nil {
+		return nil
+	}
+	ret := *ev
+	ret.Notes = ""
+	return &ret
+}
+
 func makeGetCurrentEventEndpoint(s EventService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		ev, err := s.CurrentEvent(ctx)
 		if err != nil {
 			return nil, err
 		}
-		return basicResponse{true, ev}, nil
+		return basicResponse{true, guestEvent(ev)}, nil
 	}
 }
 
@@ -621,9 +1948,12 @@ func makeGetCurrentEventEndpoint(s EventService) endpoint.Endpoint {
 // MakeSessionEndpoints builds the endpoints needed to communicate with the Session Service
 func MakeSessionEndpoints(s SessionService) SessionEndpoints {
 	return SessionEndpoints{
-		Login:  makeLoginEndpoint(s),
-		Logout: makeLogoutEndpoint(s),
-		WhoAmI: makeWhoAmIEndpoint(s),
+		Login:     makeLoginEndpoint(s),
+		Logout:    makeLogoutEndpoint(s),
+		LogoutAll: makeLogoutAllEndpoint(s),
+		WhoAmI:    makeWhoAmIEndpoint(s),
+		Refresh:   makeRefreshSessionEndpoint(s),
+		Sessions:  makeListSessionsEndpoint(s),
 	}
 }
 
@@ -637,6 +1967,12 @@ func makeLoginEndpoint(s SessionService) endpoint.Endpoint {
 		if err != nil {
 			return nil, err
 		}
+		if se.UseCookie {
+			// The session ID is only readable by the browser - not by the scripts running inside it
+			sessionID := si.SessionID
+			si.SessionID = ""
+			return sessionCookieResponse{basicResponse{true, si}, sessionID}, nil
+		}
 		return basicResponse{true, si}, nil
 	}
 }
@@ -651,7 +1987,55 @@ func makeLogoutEndpoint(s SessionService) endpoint.Endpoint {
 		if err != nil {
 			return nil, err
 		}
-		return basicResponse{true, nil}, nil
+		return sessionCookieResponse{basicResponse{true, nil}, ""}, nil
+	}
+}
+
+func makeRefreshSessionEndpoint(s SessionService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Illegal session token")
+		}
+		si, err := s.Refresh(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if ctxhelper.SessionFromCookie(ctx) {
+			// The refreshed token replaces the one inside the cookie and stays hidden from scripts
+			sessionID := si.SessionID
+			si.SessionID = ""
+			return sessionCookieResponse{basicResponse{true, si}, sessionID}, nil
+		}
+		return basicResponse{true, si}, nil
+	}
+}
+
+func makeListSessionsEndpoint(s SessionService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Illegal session token")
+		}
+		list, err := s.Sessions(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, list}, nil
+	}
+}
+
+func makeLogoutAllEndpoint(s SessionService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(string)
+		if !ok {
+			return nil, fmt.Errorf("Illegal session token")
+		}
+		num, err := s.LogoutAll(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return sessionCookieResponse{basicResponse{true, logoutAllResponse{num}}, ""}, nil
 	}
 }
 
@@ -665,6 +2049,203 @@ func makeWhoAmIEndpoint(s SessionService) endpoint.Endpoint {
 		if err != nil {
 			return nil, err
 		}
+		if ctxhelper.SessionFromCookie(ctx) {
+			// Sessions authenticated by cookie do not reveal their ID to the scripts running inside the browser
+			si.SessionID = ""
+		}
 		return basicResponse{true, si}, nil
 	}
 }
+
+// -- Users ------------------------------------------------------------------------------------------------------------
+
+// MakeUserEndpoints builds the endpoints needed to communicate with the User Service
+func MakeUserEndpoints(s UserService) UserEndpoints {
+	return UserEndpoints{
+		List:           EnsureLoggedInUserCan(models.PermUserManage)(makeListUsersEndpoint(s)),
+		Get:            EnsureLoggedInUserCan(models.PermUserManage)(makeGetUserEndpoint(s)),
+		Create:         EnsureLoggedInUserCan(models.PermUserManage)(makeCreateUserEndpoint(s)),
+		Update:         EnsureLoggedInUserCan(models.PermUserManage)(makeUpdateUserEndpoint(s)),
+		SetPermissions: EnsureLoggedInUserCan(models.PermUserManage)(makeSetUserPermissionsEndpoint(s)),
+		// Users may change their own password - the service checks the permission for other users
+		ChangePassword: EnsureUserLoggedIn(makeChangePasswordEndpoint(s)),
+		Delete:         EnsureLoggedInUserCan(models.PermUserManage)(makeDeleteUserEndpoint(s)),
+	}
+}
+
+func makeListUsersEndpoint(s UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		se, ok := request.(Search)
+		if !ok {
+			return nil, fmt.Errorf("Illegal search parameter")
+		}
+		users, err := s.List(ctx, &se)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]userResponse, len(users))
+		for i := range users {
+			ret[i] = makeUserResponse(&users[i])
+		}
+		return basicResponse{true, ret}, nil
+	}
+}
+
+func makeGetUserEndpoint(s UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal user ID")
+		}
+		u, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, makeUserResponse(u)}, nil
+	}
+}
+
+func makeCreateUserEndpoint(s UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(createUserRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal user parameter")
+		}
+		u, err := s.Create(ctx, req.Name, req.Password, req.FullName, req.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, makeUserResponse(u)}, nil
+	}
+}
+
+func makeUpdateUserEndpoint(s UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(updateUserRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal user parameter")
+		}
+		u, err := s.UpdateFullName(ctx, req.ID, req.FullName)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, makeUserResponse(u)}, nil
+	}
+}
+
+func makeSetUserPermissionsEndpoint(s UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(userPermissionsRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal permissions parameter")
+		}
+		u, err := s.SetPermissions(ctx, req.ID, req.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, makeUserResponse(u)}, nil
+	}
+}
+
+func makeChangePasswordEndpoint(s UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(changePasswordRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal password parameter")
+		}
+		if err := s.ChangePassword(ctx, req.ID, req.Password); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+func makeDeleteUserEndpoint(s UserService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal user ID")
+		}
+		if err := s.Delete(ctx, id); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
+
+// -- Audit log --------------------------------------------------------------------------------------------------------
+
+// MakeAuditEndpoints builds the endpoints needed to communicate with the Audit Service
+func MakeAuditEndpoints(s AuditService) AuditEndpoints {
+	return AuditEndpoints{
+		List: EnsureUserCan(models.PermAuditView)(makeListAuditEntriesEndpoint(s)),
+	}
+}
+
+func makeListAuditEntriesEndpoint(s AuditService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		se, ok := request.(Search)
+		if !ok {
+			return nil, fmt.Errorf("Illegal search parameter")
+		}
+		list, numRows, err := s.List(ctx, &se)
+		if err != nil {
+			return nil, err
+		}
+		return basicResponse{true, pagingResponse{numRows, list}}, nil
+	}
+}
+
+// -- API keys ---------------------------------------------------------------------------------------------------------
+
+// MakeAPIKeyEndpoints builds the endpoints needed to communicate with the API Key Service
+func MakeAPIKeyEndpoints(s APIKeyService) APIKeyEndpoints {
+	return APIKeyEndpoints{
+		List:   EnsureLoggedInUserCan(models.PermUserManage)(makeListAPIKeysEndpoint(s)),
+		Create: EnsureLoggedInUserCan(models.PermUserManage)(makeCreateAPIKeyEndpoint(s)),
+		Revoke: EnsureLoggedInUserCan(models.PermUserManage)(makeRevokeAPIKeyEndpoint(s)),
+	}
+}
+
+func makeListAPIKeysEndpoint(s APIKeyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		list, err := s.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]apiKeyResponse, len(list))
+		for i := range list {
+			ret[i] = makeAPIKeyResponse(&list[i])
+		}
+		return basicResponse{true, ret}, nil
+	}
+}
+
+func makeCreateAPIKeyEndpoint(s APIKeyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(createAPIKeyRequest)
+		if !ok {
+			return nil, fmt.Errorf("Illegal API key parameter")
+		}
+		k, key, err := s.Create(ctx, req.Name, req.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		ret := makeAPIKeyResponse(k)
+		ret.Key = key
+		return basicResponse{true, ret}, nil
+	}
+}
+
+func makeRevokeAPIKeyEndpoint(s APIKeyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id, ok := request.(uint)
+		if !ok {
+			return nil, fmt.Errorf("Illegal API key ID")
+		}
+		if err := s.Revoke(ctx, id); err != nil {
+			return nil, err
+		}
+		return basicResponse{true, nil}, nil
+	}
+}
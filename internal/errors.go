@@ -13,6 +13,14 @@ const (
 	// ErrCodeScrapeRunning is returned when a new scrape is requested that will run in a directory that is already
 	// inside the scraping queue
 	ErrCodeScrapeRunning = "SCRAPE_ALREADY_QUEUED"
+	// ErrCodeScrapeNotFound is returned when an operation is requested on a scrape that does not exist
+	ErrCodeScrapeNotFound = "SCRAPE_NOT_FOUND"
+	// ErrCodePresetExists is returned when a scraping preset should be created with a name that is already in use
+	ErrCodePresetExists = "PRESET_ALREADY_EXISTS"
+	// ErrCodePresetNotFound is returned when an operation is requested on a scraping preset that does not exist
+	ErrCodePresetNotFound = "PRESET_NOT_FOUND"
+	// ErrCodePresetBuiltIn is returned when trying to remove one of the built-in scraping presets
+	ErrCodePresetBuiltIn = "PRESET_IS_BUILT_IN"
 	// ErrCodeRepoError is returned when the request to a repo fails with an error
 	ErrCodeRepoError = "STORAGE_QUERY_FAILED"
 	// ErrCodeRequiredFieldMissing is returned when at least one required field has not been populated on an incoming
@@ -28,13 +36,29 @@ const (
 	ErrCodePlaylistEntryNotFound = "PLAYLIST_ENTRY_NOT_FOUND"
 	// ErrCodePlaylistLockedForNewEntries is returned when a playlist is locked for adding new playlist entries
 	ErrCodePlaylistLockedForNewEntries = "PLAYLIST_LOCKED_FOR_ADDING"
+	// ErrCodeNoEntriesLeft is returned when the next entry of a playlist is requested, but all entries have been played
+	ErrCodeNoEntriesLeft = "NO_ENTRIES_LEFT"
+	// ErrCodeNoCurrentEntry is returned when the currently playing entry of the main playlist is requested, but none is
+	// set
+	ErrCodeNoCurrentEntry = "NO_CURRENT_ENTRY"
 	// ErrCodeTooManyWishes is returned when an IP address requests more than the allowed number of videos
 	ErrCodeTooManyWishes = "TOO_MANY_WISHES"
+	// ErrCodeWishlistFull is returned when a guest tries to add a wish while the main playlist already contains the
+	// maximum number of unplayed wishes
+	ErrCodeWishlistFull = "WISHLIST_FULL"
+	// ErrCodeTooManyWishesForVideo is returned when an IP address requests the same video more often than allowed
+	ErrCodeTooManyWishesForVideo = "TOO_MANY_WISHES_FOR_VIDEO"
+	// ErrCodeWishCooldown is returned when an IP address adds a wish before the cooldown after its last wish has passed
+	ErrCodeWishCooldown = "WISH_COOLDOWN"
+	// ErrCodeIPBanned is returned when a guest tries to add a wish from an IP address that has been banned
+	ErrCodeIPBanned = "IP_BANNED"
 	// ErrCodeDuplicateWishesNotAllowed is returned when there are no duplicate wishes allowed for the main playlist and
 	// a guest tries to add a video that has already been wished for
 	ErrCodeDuplicateWishesNotAllowed = "NO_DUPLICATE_WISHES"
 	// ErrCodeEventNotFound is returned when an operation works on an event that does not exist
 	ErrCodeEventNotFound = "EVENT_NOT_FOUND"
+	// ErrCodeEventOverlap is returned when an event would overlap with other events and overlaps are not allowed
+	ErrCodeEventOverlap = "EVENT_OVERLAP"
 	// ErrCodeInvalidUint is returned when an ID is required inside a request, but is not provided or in a wrong format
 	ErrCodeInvalidUint = "INVALID_UINT"
 	// ErrCodeNoCurrentEvent is returned when something depending on a currently active event is requested, but no
@@ -42,11 +66,34 @@ const (
 	ErrCodeNoCurrentEvent = "NO_EVENT_SELECTED"
 	// ErrCodeVideoNotFound is returned when a referenced video does not exist
 	ErrCodeVideoNotFound = "VIDEO_NOT_FOUND"
+	// ErrCodeVideoExists is returned when a video should be created with an ID that is already in use
+	ErrCodeVideoExists = "VIDEO_ALREADY_EXISTS"
+	// ErrCodeThumbnailNotFound is returned when the thumbnail of a video is requested, but none has been scraped
+	ErrCodeThumbnailNotFound = "THUMBNAIL_NOT_FOUND"
+	// ErrCodeVideoFileMissing is returned when an operation needs the file of a video, but the file does not exist
+	// anymore
+	ErrCodeVideoFileMissing = "VIDEO_FILE_MISSING"
+	// ErrCodeSpriteFailed is returned when generating the sprite sheet of a video fails
+	ErrCodeSpriteFailed = "SPRITE_GENERATION_FAILED"
+	// ErrCodeTagNotFound is returned when a tag should be removed from a video that does not have this tag
+	ErrCodeTagNotFound = "TAG_NOT_FOUND"
+	// ErrCodeUserNotFound is returned when an operation works on a user that does not exist
+	ErrCodeUserNotFound = "USER_NOT_FOUND"
+	// ErrCodeUserExists is returned when a user should be created with a name that is already in use
+	ErrCodeUserExists = "USER_ALREADY_EXISTS"
+	// ErrCodeUserNotDeletable is returned when a user tries to delete his/her own account or the last remaining user
+	ErrCodeUserNotDeletable = "USER_NOT_DELETABLE"
+	// ErrCodeWeakPassword is returned when a password does not meet the configured complexity rules
+	ErrCodeWeakPassword = "WEAK_PASSWORD"
+	// ErrCodeAPIKeyNotFound is returned when an operation works on an API key that does not exist
+	ErrCodeAPIKeyNotFound = "API_KEY_NOT_FOUND"
 	// ErrCodeLoginFailed is returned when the user fails to login for some reason
 	ErrCodeLoginFailed = "LOGIN_FAILED"
 	// ErrCodeNotLoggedIn is returned when the user tried to access an API that needs a logged-in user, but the user
 	// has no authenticated session
 	ErrCodeNotLoggedIn = "NOT_LOGGED_IN"
+	// ErrCodePermissionDenied is returned when the logged-in user lacks the permission needed for an API
+	ErrCodePermissionDenied = "PERMISSION_DENIED"
 )
 
 var (
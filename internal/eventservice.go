@@ -1,10 +1,15 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/derWhity/kyabia/internal/log"
 	"github.com/derWhity/kyabia/internal/models"
 	"github.com/derWhity/kyabia/internal/repos"
 	"github.com/sirupsen/logrus"
@@ -19,27 +24,116 @@ type EventService interface {
 	Update(ctx context.Context, event *models.Event) error
 	Delete(ctx context.Context, id uint) error
 	SetCurrentEvent(ctx context.Context, id uint) error
+	SelectEventByDate(ctx context.Context, date time.Time) error
+	CloseEndedEvent(ctx context.Context, date time.Time) error
 	CurrentEvent(ctx context.Context) (*models.Event, error)
+	CurrentEventID(ctx context.Context) uint
 	DefaultPlaylistID(ctx context.Context) uint
+	Statistics(ctx context.Context, id uint, byPlayed bool) (*models.EventStatistics, error)
+	TopRequesters(ctx context.Context, id uint, limit uint) ([]models.Requester, error)
+	TopVideos(ctx context.Context, id uint, limit uint) ([]models.VideoStatisticsEntry, error)
+	Clone(ctx context.Context, sourceID uint, startsAt time.Time, endsAt time.Time, copyEntries bool) (*models.Event, error)
+	SubscribeCurrentEvent(ctx context.Context) (<-chan *models.Event, func())
+	Archive(ctx context.Context, id uint, w io.Writer) error
+	Overlaps(ctx context.Context) ([]models.EventOverlap, error)
+	ResetStatistics(ctx context.Context, id uint, resetVideoCounters bool) error
 }
 
+const (
+	// DefaultTopRequesters is the number of requesters returned by the top list if nothing else is requested
+	DefaultTopRequesters = 10
+	// MaxTopRequesters is the maximum number of requesters returned by the top list
+	MaxTopRequesters = 100
+)
+
 // -- EventService implementation --------------------------------------------------------------------------------------
 
 // EventService implementation
 type eventService struct {
 	repo              repos.EventRepo
 	playlistRepo      repos.PlaylistRepo
+	statsRepo         repos.StatisticsRepo
+	cs                ConfigService
 	logger            *logrus.Entry
+	mtx               sync.RWMutex
 	currentEventID    uint
 	defaultPlaylistID uint
+	// The ID of the event last found by SelectEventByDate - used to detect event boundaries
+	dateEventID uint
+	// The ID of the event whose main playlist has last been closed by CloseEndedEvent
+	closedEventID uint
+	// Subscribers to changes of the current event
+	subMtx      sync.Mutex
+	subscribers map[chan *models.Event]struct{}
 }
 
 // NewEventService creates a new event service instance
-func NewEventService(repo repos.EventRepo, playlists repos.PlaylistRepo, logger *logrus.Entry) EventService {
+func NewEventService(
+	repo repos.EventRepo,
+	playlists repos.PlaylistRepo,
+	stats repos.StatisticsRepo,
+	cs ConfigService,
+	logger *logrus.Entry,
+) EventService {
 	return &eventService{
 		repo:         repo,
 		playlistRepo: playlists,
+		statsRepo:    stats,
+		cs:           cs,
 		logger:       logger,
+		subscribers:  map[chan *models.Event]struct{}{},
+	}
+}
+
+// setCurrent makes the given event - or none if nil - the current event and notifies the subscribers if this changes
+// the current event or its main playlist. The caller must hold the lock
+func (s *eventService) setCurrent(ev *models.Event) {
+	var id, playlistID uint
+	if ev != nil {
+		id, playlistID = ev.ID, ev.MainPlaylistID
+	}
+	if id == s.currentEventID && playlistID == s.defaultPlaylistID {
+		return
+	}
+	s.currentEventID = id
+	s.defaultPlaylistID = playlistID
+	s.notifySubscribers(ev)
+}
+
+// notifySubscribers sends the given event to all subscribers without blocking. Subscribers that did not yet receive
+// the previous change only get the latest one
+func (s *eventService) notifySubscribers(ev *models.Event) {
+	s.subMtx.Lock()
+	defer s.subMtx.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Replace the pending change
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- ev
+		}
+	}
+}
+
+// SubscribeCurrentEvent returns a channel receiving the new current event - or nil if there is none - every time the
+// current event or its main playlist changes. The returned function ends the subscription and closes the channel
+func (s *eventService) SubscribeCurrentEvent(_ context.Context) (<-chan *models.Event, func()) {
+	ch := make(chan *models.Event, 1)
+	s.subMtx.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.subMtx.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.subMtx.Lock()
+			defer s.subMtx.Unlock()
+			delete(s.subscribers, ch)
+			close(ch)
+		})
 	}
 }
 
@@ -57,21 +151,108 @@ func (s *eventService) SetCurrentEvent(ctx context.Context, id uint) error {
 			fmt.Sprintf("Error while retrieving event #%d", id), err,
 		)
 	}
-	s.currentEventID = id
-	s.defaultPlaylistID = ev.MainPlaylistID
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.setCurrent(ev)
+	return nil
+}
+
+// SelectEventByDate makes the event valid for the given point in time the current event. Switching only happens when
+// the event valid for that time differs from the one found on the last call - so an event selected manually using
+// SetCurrentEvent stays active until the next event starts
+func (s *eventService) SelectEventByDate(ctx context.Context, date time.Time) error {
+	evts, err := s.repo.GetByDate(date)
+	if err != nil {
+		return MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			"Error while retrieving the events valid for the current time", err,
+		)
+	}
+	var ev *models.Event
+	if len(evts) > 0 {
+		ev = &evts[0]
+	}
+	if len(evts) > 1 {
+		s.logger.WithField(log.FldID, ev.ID).Warnf("%d events are valid at the same time - using the first one", len(evts))
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if ev == nil {
+		if s.dateEventID != 0 {
+			s.logger.WithField(log.FldID, s.dateEventID).Info("Event has ended - keeping the current event selected")
+			s.dateEventID = 0
+		}
+		return nil
+	}
+	if ev.ID == s.dateEventID {
+		// Nothing has changed since the last check
+		return nil
+	}
+	s.dateEventID = ev.ID
+	if ev.ID != s.currentEventID {
+		s.logger.WithField(log.FldID, ev.ID).Infof("Auto-selecting event %d (%s) as current event", ev.ID, ev.Name)
+		s.setCurrent(ev)
+	}
+	return nil
+}
+
+// CloseEndedEvent closes the main playlist of the current event for guests if the event has ended at the given point
+// in time. This is done only once per event, so the playlist can be reopened manually afterwards
+func (s *eventService) CloseEndedEvent(ctx context.Context, date time.Time) error {
+	id := s.CurrentEventID(ctx)
+	s.mtx.RLock()
+	closed := id == s.closedEventID
+	s.mtx.RUnlock()
+	if id == 0 || closed {
+		return nil
+	}
+	ev, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if ev.EndsAt.After(date) || ev.MainPlaylistID == 0 {
+		return nil
+	}
+	pl, err := s.playlistRepo.GetByID(ev.MainPlaylistID)
+	if err != nil {
+		return MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Error while retrieving playlist #%d", ev.MainPlaylistID), err,
+		)
+	}
+	if !pl.ClosedForGuest() {
+		s.logger.WithField(log.FldID, ev.ID).Infof("Event %d (%s) has ended - closing its main playlist", ev.ID, ev.Name)
+		pl.Status = models.PlaylistStatusClosedForGuest
+		if err := s.playlistRepo.Update(pl); err != nil {
+			return MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+				fmt.Sprintf("Error while closing playlist #%d", pl.ID), err,
+			)
+		}
+	}
+	s.mtx.Lock()
+	s.closedEventID = id
+	s.mtx.Unlock()
 	return nil
 }
 
 // CurrentEvent returns the event which is currently active
 func (s *eventService) CurrentEvent(ctx context.Context) (*models.Event, error) {
-	if s.currentEventID == 0 {
+	id := s.CurrentEventID(ctx)
+	if id == 0 {
 		return nil, ErrNoCurrentEvent
 	}
-	return s.Get(ctx, s.currentEventID)
+	return s.Get(ctx, id)
+}
+
+// CurrentEventID returns the ID of the event which is currently active - or 0 if there is none
+func (s *eventService) CurrentEventID(_ context.Context) uint {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.currentEventID
 }
 
 // DefaultPlaylistID returns the ID of the currently active playlist
 func (s *eventService) DefaultPlaylistID(_ context.Context) uint {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
 	return s.defaultPlaylistID
 }
 
@@ -105,6 +286,93 @@ func (s *eventService) Get(ctx context.Context, id uint) (*models.Event, error)
 	return ev, nil
 }
 
+// Statistics returns the statistical report of the event with the given ID - the request and play counts of all videos
+// wished for or played during the event, ordered by the number of requests or, if byPlayed is set, by the number of
+// plays
+func (s *eventService) Statistics(ctx context.Context, id uint, byPlayed bool) (*models.EventStatistics, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	videos, err := s.statsRepo.GetByEvent(id, byPlayed, 0)
+	if err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Error while retrieving the statistics of event #%d", id), err,
+		)
+	}
+	numWishes, numRequesters, err := s.statsRepo.GetEventTotals(id)
+	if err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Error while retrieving the statistics of event #%d", id), err,
+		)
+	}
+	return &models.EventStatistics{
+		EventID:       id,
+		NumWishes:     numWishes,
+		NumRequesters: numRequesters,
+		Videos:        videos,
+	}, nil
+}
+
+// ResetStatistics zeroes the video statistics of the event with the given ID. The global play and request counters of
+// the videos are only reduced by the event's counts if resetVideoCounters is set
+func (s *eventService) ResetStatistics(ctx context.Context, id uint, resetVideoCounters bool) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := s.statsRepo.ResetByEvent(id, resetVideoCounters); err != nil {
+		return MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Error while resetting the statistics of event #%d", id), err,
+		)
+	}
+	return nil
+}
+
+// TopRequesters returns the given number of guests that added the most wishes to the main playlist of the event with
+// the given ID. Wishes without a name and wishes added from whitelisted IP addresses - usually the host's own machines -
+// are not counted. The limit is capped at MaxTopRequesters
+func (s *eventService) TopRequesters(ctx context.Context, id uint, limit uint) ([]models.Requester, error) {
+	ev, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ev.MainPlaylistID == 0 {
+		return []models.Requester{}, nil
+	}
+	if limit == 0 {
+		limit = DefaultTopRequesters
+	} else if limit > MaxTopRequesters {
+		limit = MaxTopRequesters
+	}
+	requesters, err := s.playlistRepo.GetTopRequesters(ev.MainPlaylistID, s.cs.WhitelistedIPs(ctx), limit)
+	if err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Error while retrieving the top requesters of event #%d", id), err,
+		)
+	}
+	return requesters, nil
+}
+
+// TopVideos returns the given number of videos played most during the event with the given ID - videos played equally
+// often are ranked by the number of requests. The list is built from the recorded statistics, so it is available for
+// past events as well. The limit is capped at MaxTopVideos
+func (s *eventService) TopVideos(ctx context.Context, id uint, limit uint) ([]models.VideoStatisticsEntry, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		limit = DefaultTopVideos
+	} else if limit > MaxTopVideos {
+		limit = MaxTopVideos
+	}
+	videos, err := s.statsRepo.GetByEvent(id, true, limit)
+	if err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Error while retrieving the top videos of event #%d", id), err,
+		)
+	}
+	return videos, nil
+}
+
 // Create creates a new event (and, optionally, a new default playlist)
 func (s *eventService) Create(ctx context.Context, event *models.Event) (*models.Event, error) {
 	event.Name = strings.TrimSpace(event.Name)
@@ -118,6 +386,12 @@ func (s *eventService) Create(ctx context.Context, event *models.Event) (*models
 			},
 		)
 	}
+	if err := checkTimeSpan(event); err != nil {
+		return nil, err
+	}
+	if err := s.checkOverlaps(ctx, event); err != nil {
+		return nil, err
+	}
 	if event.MainPlaylistID == 0 {
 		// Create a new playlist
 		pl := models.Playlist{
@@ -138,6 +412,172 @@ func (s *eventService) Create(ctx context.Context, event *models.Event) (*models
 	return event, nil
 }
 
+// Clone creates a new event for the given time span with the name and description of the source event and a fresh main
+// playlist. If copyEntries is set, the approved entries of the source event's main playlist are copied to the new one.
+// The source event, its playlist and its statistics stay untouched
+func (s *eventService) Clone(
+	ctx context.Context,
+	sourceID uint,
+	startsAt time.Time,
+	endsAt time.Time,
+	copyEntries bool,
+) (*models.Event, error) {
+	source, err := s.Get(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := s.Create(ctx, &models.Event{
+		Name:        source.Name,
+		Description: source.Description,
+		StartsAt:    startsAt,
+		EndsAt:      endsAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if copyEntries && source.MainPlaylistID > 0 {
+		if _, err := s.playlistRepo.CopyEntries(source.MainPlaylistID, ev.MainPlaylistID); err != nil {
+			return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+				fmt.Sprintf("Error while copying the playlist entries of event #%d", sourceID), err,
+			)
+		}
+	}
+	return ev, nil
+}
+
+// archivePageSize is the number of playlist entries loaded at once when archiving an event
+const archivePageSize = 100
+
+// Archive writes a JSON document containing the event with the given ID, its main playlist with all entries and the
+// statistics of the event into the given writer. The playlist entries are loaded and written page by page, so large
+// playlists do not need to fit into memory
+func (s *eventService) Archive(ctx context.Context, id uint, w io.Writer) error {
+	if err := s.writeArchive(ctx, id, w); err != nil {
+		s.logger.WithError(err).WithField(log.FldID, id).Error("Event archive failed")
+		return err
+	}
+	return nil
+}
+
+func (s *eventService) writeArchive(ctx context.Context, id uint, w io.Writer) error {
+	ev, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	var pl *models.Playlist
+	if ev.MainPlaylistID > 0 {
+		if pl, err = s.playlistRepo.GetByID(ev.MainPlaylistID); err != nil && err != repos.ErrEntityNotExisting {
+			return err
+		}
+	}
+	stats, err := s.statsRepo.GetByEvent(id, false, 0)
+	if err != nil {
+		return err
+	}
+	write := func(prefix string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, prefix); err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	if err := write(`{"archivedAt":`, time.Now()); err != nil {
+		return err
+	}
+	if err := write(`,"event":`, ev); err != nil {
+		return err
+	}
+	if err := write(`,"playlist":`, pl); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"entries":[`); err != nil {
+		return err
+	}
+	if pl != nil {
+		var offset uint
+		for {
+			page, numRows, err := s.playlistRepo.GetEntries(pl.ID, "", repos.PlaylistEntryFilter{}, offset, archivePageSize)
+			if err != nil {
+				return err
+			}
+			for _, entry := range page {
+				sep := ","
+				if offset == 0 {
+					sep = ""
+				}
+				if err := write(sep, entry); err != nil {
+					return err
+				}
+				offset++
+			}
+			if len(page) == 0 || offset >= numRows {
+				break
+			}
+		}
+	}
+	if err := write(`],"statistics":`, stats); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+// checkTimeSpan checks that the given event ends after it has started
+func checkTimeSpan(event *models.Event) error {
+	if !event.EndsAt.After(event.StartsAt) {
+		return MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"The event must end after it has started",
+			map[string]string{"field": "endsAt"},
+		)
+	}
+	return nil
+}
+
+// checkOverlaps checks if the given event overlaps with other events. Depending on the configuration, an overlap is
+// either logged or rejected with an error listing the IDs of the conflicting events
+func (s *eventService) checkOverlaps(ctx context.Context, event *models.Event) error {
+	others, err := s.repo.GetOverlapping(event.StartsAt, event.EndsAt, event.ID)
+	if err != nil {
+		return MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			"Error while checking for overlapping events", err,
+		)
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(others))
+	for i, other := range others {
+		ids[i] = other.ID
+	}
+	if s.cs.GetConfig(ctx).RejectOverlappingEvents {
+		return MakeErrorWithData(
+			http.StatusConflict,
+			ErrCodeEventOverlap,
+			"The event overlaps with other events",
+			map[string][]uint{"conflicts": ids},
+		)
+	}
+	s.logger.WithField("conflicts", ids).Warnf("Event '%s' overlaps with other events", event.Name)
+	return nil
+}
+
+// Overlaps returns all pairs of events whose time spans overlap
+func (s *eventService) Overlaps(ctx context.Context) ([]models.EventOverlap, error) {
+	overlaps, err := s.repo.FindOverlaps()
+	if err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			"Error while searching for overlapping events", err,
+		)
+	}
+	return overlaps, nil
+}
+
 func (s *eventService) checkPlaylist(id uint) error {
 	if _, err := s.playlistRepo.GetByID(id); err != nil {
 		if err == repos.ErrEntityNotExisting {
@@ -168,6 +608,7 @@ func (s *eventService) Update(ctx context.Context, event *models.Event) error {
 		originalEvent.Name = event.Name
 	}
 	originalEvent.Description = event.Description
+	originalEvent.Notes = event.Notes
 	if event.MainPlaylistID > 0 {
 		// Check if the playlist exists
 		if err := s.checkPlaylist(event.MainPlaylistID); err != nil {
@@ -177,6 +618,12 @@ func (s *eventService) Update(ctx context.Context, event *models.Event) error {
 	}
 	originalEvent.StartsAt = event.StartsAt
 	originalEvent.EndsAt = event.EndsAt
+	if err := checkTimeSpan(originalEvent); err != nil {
+		return err
+	}
+	if err := s.checkOverlaps(ctx, originalEvent); err != nil {
+		return err
+	}
 	err = s.repo.Update(originalEvent)
 	if err != nil {
 		if err == repos.ErrEntityNotExisting {
@@ -194,8 +641,10 @@ func (s *eventService) Update(ctx context.Context, event *models.Event) error {
 		)
 	}
 	// Did the default playlist change?
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
 	if originalEvent.ID == s.currentEventID && originalEvent.MainPlaylistID != s.defaultPlaylistID {
-		s.defaultPlaylistID = originalEvent.MainPlaylistID
+		s.setCurrent(originalEvent)
 	}
 	return nil
 }
@@ -210,10 +659,11 @@ func (s *eventService) Delete(ctx context.Context, id uint) error {
 			fmt.Sprintf("Event #%d does not exist", id),
 		)
 	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
 	if id == s.currentEventID {
 		// Now, we don't have a current event any more
-		s.currentEventID = 0
-		s.defaultPlaylistID = 0
+		s.setCurrent(nil)
 	}
 	return nil
 }
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/derWhity/kyabia/internal/models"
+)
+
+func TestCheckTimeSpan(t *testing.T) {
+	start := time.Date(2019, 5, 1, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		endsAt  time.Time
+		wantErr bool
+	}{
+		{"equal start and end", start, true},
+		{"end before start", start.Add(-time.Hour), true},
+		{"end one second before start", start.Add(-time.Second), true},
+		{"valid range", start.Add(4 * time.Hour), false},
+		{"end one second after start", start.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		err := checkTimeSpan(&models.Event{StartsAt: start, EndsAt: tt.endsAt})
+		if !tt.wantErr {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		httpErr, ok := err.(*HTTPError)
+		if !ok {
+			t.Errorf("%s: got %v, want an HTTP error", tt.name, err)
+			continue
+		}
+		if httpErr.Status() != 400 || httpErr.ErrorCode() != ErrCodeIllegalValue {
+			t.Errorf("%s: got %d %s, want 400 %s", tt.name, httpErr.Status(), httpErr.ErrorCode(), ErrCodeIllegalValue)
+		}
+	}
+}
@@ -8,8 +8,23 @@ import (
 	"golang.org/x/net/context"
 )
 
-// EnsureUserLoggedIn is a middleware that checks if there is a valid user session for the current call
+// EnsureUserLoggedIn is a middleware that checks if there is a valid user session for the current call. Clients
+// authenticated by API key are rejected - they can only use functions that need a specific permission
 func EnsureUserLoggedIn(next endpoint.Endpoint) endpoint.Endpoint {
+	return ensureAuthenticated(func(ctx context.Context, request interface{}) (interface{}, error) {
+		if sess := ctxhelper.Session(ctx); sess != nil && sess.APIKeyID != 0 {
+			return nil, MakeError(
+				http.StatusForbidden,
+				ErrCodePermissionDenied,
+				"This function cannot be used with an API key",
+			)
+		}
+		return next(ctx, request)
+	})
+}
+
+// ensureAuthenticated is a middleware that checks if there is a valid user session or API key for the current call
+func ensureAuthenticated(next endpoint.Endpoint) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		user := ctxhelper.User(ctx)
 		if user == nil {
@@ -23,3 +38,30 @@ func EnsureUserLoggedIn(next endpoint.Endpoint) endpoint.Endpoint {
 		return next(ctx, request)
 	}
 }
+
+// EnsureUserCan creates a middleware that checks if there is a valid user session or API key for the current call and
+// if the user has been granted the given permission
+func EnsureUserCan(permission string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return ensureAuthenticated(func(ctx context.Context, request interface{}) (interface{}, error) {
+			sess := ctxhelper.Session(ctx)
+			if sess == nil || !sess.UserCan(permission) {
+				return nil, MakeErrorWithData(
+					http.StatusForbidden,
+					ErrCodePermissionDenied,
+					"You are not allowed to use this function",
+					map[string]string{"permission": permission},
+				)
+			}
+			return next(ctx, request)
+		})
+	}
+}
+
+// EnsureLoggedInUserCan creates a middleware that works like EnsureUserCan, but rejects clients authenticated by API
+// key - even if the key has been granted the given permission
+func EnsureLoggedInUserCan(permission string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return EnsureUserLoggedIn(EnsureUserCan(permission)(next))
+	}
+}
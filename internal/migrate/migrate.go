@@ -13,6 +13,13 @@ var migrations []dbMigration
 type dbMigration struct {
 	Version uint
 	Queries []string
+	// Optional migrations depend on features the SQLite library may have been built without. If an optional migration
+	// fails, its Revert queries are run and Kyabia continues without it - it is retried on the next start
+	Optional bool
+	// Check is run on every start once an optional migration succeeded. If it fails, the feature is no longer
+	// available and the migration is reverted
+	Check  string
+	Revert []string
 }
 
 // Execute runs the current DB migration on the given database
@@ -28,23 +35,45 @@ func (mig *dbMigration) Execute(db *sqlx.DB, logger *logrus.Entry) error {
 			return err
 		}
 	}
-	if !success {
-		// We need to execute this migration
-		logger.Infof("Executing DB migration #%d", mig.Version)
-		for i, query := range mig.Queries {
-			logger.Infof("Query %d of %d...", (i + 1), len(mig.Queries))
-			if _, err := db.Exec(query); err != nil {
-				logger.WithError(err).Errorf("Query #%d failed", (i + 1))
-				db.Exec(`REPLACE INTO Migrations(version, success) VALUES($1, 0)`, mig.Version)
-				return err
+	if success {
+		if mig.Optional && mig.Check != "" {
+			if _, err := db.Exec(mig.Check); err != nil {
+				logger.WithError(err).Warnf("DB migration #%d is no longer supported - reverting it", mig.Version)
+				mig.revert(db, logger)
 			}
 		}
-		// Queries executed successfully - save our status
-		db.Exec(`REPLACE INTO Migrations(version, success) VALUES($1, 1)`, mig.Version)
+		return nil
 	}
+	// We need to execute this migration
+	logger.Infof("Executing DB migration #%d", mig.Version)
+	for i, query := range mig.Queries {
+		logger.Infof("Query %d of %d...", (i + 1), len(mig.Queries))
+		if _, err := db.Exec(query); err != nil {
+			if mig.Optional {
+				logger.WithError(err).Warnf("Optional DB migration #%d failed - skipping it", mig.Version)
+				mig.revert(db, logger)
+				return nil
+			}
+			logger.WithError(err).Errorf("Query #%d failed", (i + 1))
+			db.Exec(`REPLACE INTO Migrations(version, success) VALUES($1, 0)`, mig.Version)
+			return err
+		}
+	}
+	// Queries executed successfully - save our status
+	db.Exec(`REPLACE INTO Migrations(version, success) VALUES($1, 1)`, mig.Version)
 	return nil
 }
 
+// revert runs the revert queries of the migration and marks it as not executed
+func (mig *dbMigration) revert(db *sqlx.DB, logger *logrus.Entry) {
+	for i, query := range mig.Revert {
+		if _, err := db.Exec(query); err != nil {
+			logger.WithError(err).Debugf("Revert query #%d failed", (i + 1))
+		}
+	}
+	db.Exec(`REPLACE INTO Migrations(version, success) VALUES($1, 0)`, mig.Version)
+}
+
 // ExecuteMigrationsOnDb executes the database migrations on the given database instance
 func ExecuteMigrationsOnDb(db *sqlx.DB, logger *logrus.Entry) error {
 	// Create the migrations table if it does not exist, yet
@@ -159,5 +188,268 @@ func init() {
 				`CREATE INDEX idx_playlist_video_search ON PlaylistEntries (playlistId ASC, videoHash ASC)`,
 			},
 		},
+		{
+			Version: 6,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN subtitleLanguages VARCHAR(128) NOT NULL DEFAULT '';`,
+			},
+		},
+		{
+			Version: 7,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN frameRate REAL NOT NULL DEFAULT 0;`,
+				`ALTER TABLE Videos ADD COLUMN videoProfile VARCHAR(64) NOT NULL DEFAULT '';`,
+			},
+		},
+		{
+			Version: 8,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN thumbnail VARCHAR(255) NOT NULL DEFAULT '';`,
+			},
+		},
+		{
+			Version: 9,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN fileModTime DATETIME NOT NULL DEFAULT '0001-01-01 00:00:00';`,
+				`CREATE INDEX idx_videos_filename ON Videos(filename);`,
+			},
+		},
+		{
+			Version: 10,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN rotation INTEGER NOT NULL DEFAULT 0;`,
+			},
+		},
+		{
+			Version: 11,
+			Queries: []string{
+				`CREATE TABLE "Chapters" (
+                    videoHash VARCHAR(128) NOT NULL,
+                    chapterIndex INTEGER NOT NULL,
+                    title VARCHAR(255) NOT NULL DEFAULT '',
+                    startsAt INTEGER(8) NOT NULL DEFAULT 0,
+                    endsAt INTEGER(8) NOT NULL DEFAULT 0,
+                    PRIMARY KEY(videoHash, chapterIndex)
+                );`,
+			},
+		},
+		{
+			Version: 12,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN container VARCHAR(128) NOT NULL DEFAULT '';`,
+			},
+		},
+		{
+			Version: 13,
+			Queries: []string{
+				`CREATE TABLE "Tags" (
+                    videoHash VARCHAR(128) NOT NULL,
+                    tag VARCHAR(64) NOT NULL,
+                    PRIMARY KEY(videoHash, tag)
+                );`,
+				`CREATE INDEX idx_tags_tag ON Tags (tag ASC);`,
+			},
+		},
+		{
+			// Full-text search on the video metadata - needs SQLite to be built with FTS5 (build tag "sqlite_fts5")
+			Version:  14,
+			Optional: true,
+			Queries: []string{
+				`CREATE VIRTUAL TABLE IF NOT EXISTS VideoSearch USING fts5(
+                    sha512 UNINDEXED, title, artist, relatedMedium, mediumDetail, description, identifier
+                );`,
+				`CREATE TRIGGER IF NOT EXISTS trg_videosearch_insert AFTER INSERT ON Videos BEGIN
+                    INSERT INTO VideoSearch(sha512, title, artist, relatedMedium, mediumDetail, description, identifier)
+                    VALUES(new.sha512, new.title, new.artist, new.relatedMedium, new.mediumDetail, new.description,
+                        new.identifier);
+                END;`,
+				`CREATE TRIGGER IF NOT EXISTS trg_videosearch_update
+                AFTER UPDATE OF sha512, title, artist, relatedMedium, mediumDetail, description, identifier ON Videos
+                BEGIN
+                    DELETE FROM VideoSearch WHERE sha512 = old.sha512;
+                    INSERT INTO VideoSearch(sha512, title, artist, relatedMedium, mediumDetail, description, identifier)
+                    VALUES(new.sha512, new.title, new.artist, new.relatedMedium, new.mediumDetail, new.description,
+                        new.identifier);
+                END;`,
+				`CREATE TRIGGER IF NOT EXISTS trg_videosearch_delete AFTER DELETE ON Videos BEGIN
+                    DELETE FROM VideoSearch WHERE sha512 = old.sha512;
+                END;`,
+				`DELETE FROM VideoSearch;`,
+				`INSERT INTO VideoSearch(sha512, title, artist, relatedMedium, mediumDetail, description, identifier)
+                SELECT sha512, title, artist, relatedMedium, mediumDetail, description, identifier FROM Videos;`,
+			},
+			Check: `SELECT rowid FROM VideoSearch LIMIT 0;`,
+			// Without the triggers, the videos table stays usable when FTS5 is not available
+			Revert: []string{
+				`DROP TRIGGER IF EXISTS trg_videosearch_insert;`,
+				`DROP TRIGGER IF EXISTS trg_videosearch_update;`,
+				`DROP TRIGGER IF EXISTS trg_videosearch_delete;`,
+				`DROP TABLE IF EXISTS VideoSearch;`,
+			},
+		},
+		{
+			Version: 15,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN available INTEGER NOT NULL DEFAULT 1;`,
+			},
+		},
+		{
+			Version: 16,
+			Queries: []string{
+				`CREATE INDEX idx_videos_identifier ON Videos(identifier);`,
+			},
+		},
+		{
+			Version: 17,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN deletedAt DATETIME NULL DEFAULT NULL;`,
+			},
+		},
+		{
+			// Case and accent folded copies of the searchable fields - filled by the video repository
+			Version: 18,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN searchText TEXT NULL DEFAULT NULL;`,
+				`ALTER TABLE Videos ADD COLUMN sortTitle TEXT NULL DEFAULT NULL;`,
+				`CREATE INDEX idx_videos_sorttitle ON Videos(sortTitle);`,
+			},
+		},
+		{
+			Version: 19,
+			Queries: []string{
+				`ALTER TABLE Videos ADD COLUMN lastPlayedAt DATETIME NULL DEFAULT NULL;`,
+			},
+		},
+		{
+			Version: 20,
+			Queries: []string{
+				`ALTER TABLE PlaylistEntries ADD COLUMN playedAt DATETIME NULL DEFAULT NULL;`,
+			},
+		},
+		{
+			// Spread the playlist positions so that entries can be moved without renumbering the whole playlist
+			Version: 21,
+			Queries: []string{
+				`CREATE TEMPORARY TABLE PlaylistEntryRanks AS SELECT
+					pe.id AS id,
+					(
+						SELECT COUNT(*) FROM PlaylistEntries o
+						WHERE o.playlistId = pe.playlistId AND (
+							o.position < pe.position OR (o.position = pe.position AND o.id <= pe.id)
+						)
+					) AS entryRank
+				FROM PlaylistEntries pe;`,
+				`UPDATE PlaylistEntries SET position = 1024 * (
+					SELECT entryRank FROM PlaylistEntryRanks r WHERE r.id = PlaylistEntries.id
+				);`,
+				`DROP TABLE PlaylistEntryRanks;`,
+				`CREATE INDEX idx_playlistentries_position ON PlaylistEntries(playlistId, position);`,
+			},
+		},
+		{
+			Version: 22,
+			Queries: []string{
+				`ALTER TABLE PlaylistEntries ADD COLUMN note TEXT NOT NULL DEFAULT '';`,
+			},
+		},
+		{
+			Version: 23,
+			Queries: []string{
+				`ALTER TABLE PlaylistEntries ADD COLUMN status INTEGER NOT NULL DEFAULT 0;`,
+			},
+		},
+		{
+			Version: 24,
+			Queries: []string{
+				`ALTER TABLE PlaylistEntries ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;`,
+			},
+		},
+		{
+			Version: 25,
+			Queries: []string{
+				`CREATE TABLE "VideoStatistics" (
+                    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                    eventId INTEGER NOT NULL,
+                    videoHash VARCHAR(128) NOT NULL,
+                    numPlayed INTEGER(4) NOT NULL DEFAULT 0,
+                    numRequested INTEGER(4) NOT NULL DEFAULT 0
+                );`,
+				`CREATE UNIQUE INDEX idx_videostatistics_event_video ON VideoStatistics (eventId, videoHash);`,
+			},
+		},
+		{
+			Version: 26,
+			Queries: []string{
+				`CREATE TABLE "EventRequesters" (
+                    eventId INTEGER NOT NULL,
+                    requesterIp VARCHAR(64) NOT NULL,
+                    PRIMARY KEY(eventId, requesterIp)
+                );`,
+			},
+		},
+		{
+			Version: 27,
+			Queries: []string{
+				`ALTER TABLE Events ADD COLUMN notes TEXT NOT NULL DEFAULT '';`,
+			},
+		},
+		{
+			Version: 28,
+			Queries: []string{
+				`CREATE UNIQUE INDEX idx_users_name ON Users (name ASC);`,
+			},
+		},
+		{
+			Version: 29,
+			Queries: []string{
+				// Existing users keep the full access they had before
+				`ALTER TABLE Users ADD COLUMN permissions TEXT NOT NULL DEFAULT '*';`,
+			},
+		},
+		{
+			Version: 30,
+			Queries: []string{
+				`CREATE TABLE "Sessions" (
+                    id VARCHAR(128) NOT NULL PRIMARY KEY,
+                    userId INTEGER NOT NULL,
+                    expiresAt INTEGER NOT NULL
+                );`,
+				`CREATE INDEX idx_sessions_expiresat ON Sessions (expiresAt);`,
+			},
+		},
+		{
+			Version: 31,
+			Queries: []string{
+				`CREATE INDEX idx_sessions_userid ON Sessions (userId);`,
+			},
+		},
+		{
+			Version: 32,
+			Queries: []string{
+				`CREATE TABLE "AuditLog" (
+                    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                    userId INTEGER NOT NULL,
+                    userName VARCHAR(255) NOT NULL DEFAULT '',
+                    action VARCHAR(64) NOT NULL,
+                    target VARCHAR(255) NOT NULL DEFAULT '',
+                    detail TEXT NOT NULL DEFAULT '',
+                    createdAt DATETIME NOT NULL
+                );`,
+			},
+		},
+		{
+			Version: 33,
+			Queries: []string{
+				`CREATE TABLE "ApiKeys" (
+                    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+                    name VARCHAR(255) NOT NULL,
+                    prefix VARCHAR(16) NOT NULL,
+                    keyHash VARCHAR(128) NOT NULL,
+                    permissions TEXT NOT NULL DEFAULT '',
+                    createdAt DATETIME NOT NULL
+                );`,
+				`CREATE UNIQUE INDEX idx_apikeys_keyhash ON ApiKeys (keyHash);`,
+			},
+		},
 	}
 }
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// APIKey is a key machine clients like the stage player use for authenticating instead of logging in as a user. Only
+// the hash of the key is stored - the key itself is shown once when it is created
+type APIKey struct {
+	// Internal ID
+	ID uint `db:"id" json:"id"`
+	// The purpose of the key
+	Name string `db:"name" json:"name"`
+	// The first characters of the key for telling keys apart
+	Prefix string `db:"prefix" json:"prefix"`
+	// The hex-encoded SHA-256 hash of the key
+	KeyHash string `db:"keyHash" json:"-"`
+	// Comma-separated list of the permissions granted to clients using this key
+	Permissions string `db:"permissions" json:"-"`
+	// Creation date of this key
+	CreatedAt time.Time `db:"createdAt" json:"createdAt"`
+}
+
+// HashAPIKey returns the hash of the given API key as it is stored
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// PermissionList returns the permissions granted to clients using this key
+func (k *APIKey) PermissionList() []string {
+	ret := []string{}
+	for _, p := range strings.Split(k.Permissions, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
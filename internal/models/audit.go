@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+const (
+	// AuditVideoDelete is the audit action recorded when a video has been deleted
+	AuditVideoDelete = "video.delete"
+	// AuditVideoPurge is the audit action recorded when deleted videos have been purged
+	AuditVideoPurge = "video.purge"
+	// AuditPlaylistStatus is the audit action recorded when the status of a playlist has been changed
+	AuditPlaylistStatus = "playlist.status"
+	// AuditIPBan is the audit action recorded when an IP address has been banned
+	AuditIPBan = "ip.ban"
+	// AuditIPUnban is the audit action recorded when an IP address has been removed from the banlist
+	AuditIPUnban = "ip.unban"
+	// AuditUserCreate is the audit action recorded when a user has been created
+	AuditUserCreate = "user.create"
+	// AuditUserDelete is the audit action recorded when a user has been deleted
+	AuditUserDelete = "user.delete"
+	// AuditUserPermissions is the audit action recorded when the permissions of a user have been changed
+	AuditUserPermissions = "user.permissions"
+	// AuditConfigReload is the audit action recorded when the configuration has been reloaded from its file
+	AuditConfigReload = "config.reload"
+	// AuditAPIKeyCreate is the audit action recorded when an API key has been created
+	AuditAPIKeyCreate = "apikey.create"
+	// AuditAPIKeyRevoke is the audit action recorded when an API key has been revoked
+	AuditAPIKeyRevoke = "apikey.revoke"
+)
+
+// AuditEntry is an entry of the audit log that records an administrative action
+type AuditEntry struct {
+	// Internal ID
+	ID uint `db:"id" json:"id"`
+	// The ID of the user that has taken the action
+	UserID uint `db:"userId" json:"userId"`
+	// The name of the user that has taken the action - kept in case the user gets deleted later on
+	UserName string `db:"userName" json:"userName"`
+	// The action taken - one of the Audit* constants
+	Action string `db:"action" json:"action"`
+	// The entity the action has been taken on - like a video ID or an IP address
+	Target string `db:"target" json:"target"`
+	// Additional information about the action
+	Detail string `db:"detail" json:"detail,omitempty"`
+	// When has the action been taken?
+	CreatedAt time.Time `db:"createdAt" json:"createdAt"`
+}
@@ -1,11 +1,34 @@
 package models
 
 import (
+	"fmt"
 	"path"
+	"unicode"
 
 	"github.com/kardianos/osext"
 )
 
+const (
+	// DefaultMaxPageSize is the maximum number of entries per page if no other maximum is configured
+	DefaultMaxPageSize = 200
+	// DefaultAverageSongLength is the length in seconds assumed for videos of unknown duration if no other length is
+	// configured
+	DefaultAverageSongLength = 240
+	// DefaultEventSelectInterval is the interval in minutes in which the current event is selected by date if no other
+	// interval is configured
+	DefaultEventSelectInterval = 1
+	// DefaultPasswordMinLength is the minimum length of a password if no other length is configured
+	DefaultPasswordMinLength = 8
+	// SessionStoreMemory keeps the sessions in memory - they are lost on restart
+	SessionStoreMemory = "memory"
+	// SessionStoreSQLite stores the sessions inside the database
+	SessionStoreSQLite = "sqlite"
+	// AuthModeSession authenticates users with opaque session IDs kept in the configured session store
+	AuthModeSession = "session"
+	// AuthModeJWT authenticates users with self-contained tokens signed with the configured JWT secret
+	AuthModeJWT = "jwt"
+)
+
 // AppConfig is the application's main configuration structure
 type AppConfig struct {
 	// The directory where Kyabia stores all of its data - defaults to the /data subdirectory of the folder, the
@@ -15,8 +38,34 @@ type AppConfig struct {
 	DefaultUser *DefaultUserConfig `json:"defaultUser"`
 	// The IP address to listen at - including the port number
 	ListenAddress string `json:"listenAddress"`
+	// The maximum number of entries a client can request per page - requests for larger pages are capped
+	MaxPageSize uint `json:"maxPageSize"`
+	// The length in seconds assumed for videos whose duration is unknown when estimating waiting times
+	AverageSongLength uint `json:"averageSongLength"`
+	// The interval in minutes in which Kyabia checks for an event starting or ending and switches the current event
+	// accordingly. If 0, the current event is only selected by date once on startup
+	EventSelectInterval uint `json:"eventSelectInterval"`
+	// Should the main playlist of the current event be closed for guests once the event has ended? Checked in the
+	// interval configured in EventSelectInterval
+	AutoClosePlaylist bool `json:"autoClosePlaylist"`
+	// Should creating or updating an event be rejected if it overlaps with another event? If not set, the overlap is
+	// only logged
+	RejectOverlappingEvents bool `json:"rejectOverlappingEvents"`
+	// Where the sessions of logged-in users are stored. Can be "memory" (default) or "sqlite" for keeping the sessions
+	// in the database, so they survive restarts and can be shared between processes using the same database
+	SessionStore string `json:"sessionStore"`
+	// How logged-in users are authenticated. Can be "session" (default) for opaque session IDs kept in the session
+	// store or "jwt" for signed tokens that every instance knowing the JWT secret can validate without a shared session
+	// store. Tokens cannot be revoked - logging out does not invalidate them before they expire
+	AuthMode string `json:"authMode"`
+	// The secret used for signing the tokens if AuthMode is "jwt" - has to be the same for all instances
+	JWTSecret string `json:"jwtSecret"`
+	// The rules passwords of users have to follow
+	PasswordRules PasswordRuleConfig `json:"passwordRules"`
 	// The restrictions for guests working with Kyabia
 	Restrictions GuestRestrictionConfig `json:"restrictions"`
+	// The configuration of the video scraper
+	Scraper ScraperConfig `json:"scraper"`
 }
 
 // The DefaultUserConfig struct configures the default user that can log in
@@ -26,14 +75,120 @@ type DefaultUserConfig struct {
 	Password string `json:"password"`
 }
 
+// PasswordRuleConfig defines the complexity a password needs to have when it is set
+type PasswordRuleConfig struct {
+	// MinLength is the minimum number of characters of a password
+	MinLength uint `json:"minLength"`
+	// RequireLower requires at least one lower case letter
+	RequireLower bool `json:"requireLower"`
+	// RequireUpper requires at least one upper case letter
+	RequireUpper bool `json:"requireUpper"`
+	// RequireDigit requires at least one digit
+	RequireDigit bool `json:"requireDigit"`
+	// RequireSpecial requires at least one character that is neither a letter nor a digit
+	RequireSpecial bool `json:"requireSpecial"`
+}
+
+// Unmet checks the given password against the rules and returns the descriptions of all rules the password does not
+// meet. If the password is fine, an empty list is returned
+func (c PasswordRuleConfig) Unmet(pass string) []string {
+	var lower, upper, digit, special bool
+	var length uint
+	for _, r := range pass {
+		length++
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsLetter(r):
+			// Letters without case do not count as special characters
+		default:
+			special = true
+		}
+	}
+	ret := []string{}
+	if length < c.MinLength {
+		ret = append(ret, fmt.Sprintf("at least %d characters", c.MinLength))
+	}
+	if c.RequireLower && !lower {
+		ret = append(ret, "a lower case letter")
+	}
+	if c.RequireUpper && !upper {
+		ret = append(ret, "an upper case letter")
+	}
+	if c.RequireDigit && !digit {
+		ret = append(ret, "a digit")
+	}
+	if c.RequireSpecial && !special {
+		ret = append(ret, "a special character")
+	}
+	return ret
+}
+
 // GuestRestrictionConfig is the configuration for restricting some aspects of Kyabia for guest users
 type GuestRestrictionConfig struct {
 	// NumWishesFromSameIP is the number of unplayed wishes from the same IP address allowed in the main playlist
 	NumWishesFromSameIP uint `json:"wishesFromSameIP"`
+	// NumWishesPerVideoFromSameIP is the number of wishes for the same video allowed from the same IP address in the
+	// main playlist - 0 means no limit
+	NumWishesPerVideoFromSameIP uint `json:"wishesPerVideoFromSameIP"`
+	// WishCooldownSeconds is the minimum number of seconds between two wishes from the same IP address - 0 disables the
+	// cooldown
+	WishCooldownSeconds uint `json:"wishCooldownSeconds"`
+	// MaxTotalWishes is the maximum number of unplayed wishes in the main playlist - regardless of who added them. 0
+	// means no limit
+	MaxTotalWishes uint `json:"maxTotalWishes"`
 	// Can be set to `true` to allow the same video to be wished twice
 	AllowDuplicateWishes bool `json:"allowDuplicateWishes"`
+	// Can be set to `true` to hide new wishes of guests from the main playlist until they have been approved
+	RequireApproval bool `json:"requireApproval"`
 	// A list of IP addresses whitelisted. Guests from these IPs will have the restrictions lifted
 	IPWhitelist []string `json:"ipWhitelist"`
+	// A list of IP addresses banned. Guests from these IPs cannot add any wishes - unless they are whitelisted, too
+	IPBanlist []string `json:"ipBanlist"`
+}
+
+// ScraperConfig is the configuration for the video file scraper
+type ScraperConfig struct {
+	// HashMode defines how the SHA-512 hash identifying a video file is calculated. Can be "partial" for only hashing
+	// the first MiB of the file (fast, default) or "full" for hashing the whole file (slow, but collision-safe)
+	HashMode string `json:"hashMode"`
+	// MaxParallelScrapes is the maximum number of scrapes that are allowed to run at the same time. Additional scrapes
+	// will be queued until a running one has finished
+	MaxParallelScrapes uint `json:"maxParallelScrapes"`
+	// Exclude is a list of patterns matched against the base names of directories and files during scraping. Matching
+	// entries will be skipped on every scrape
+	Exclude []string `json:"exclude"`
+	// VideoExtensions is a list of file extensions (like ".ts" or ".m2ts") that are always treated as video files - in
+	// addition to the extensions registered as video file types in the system's MIME table
+	VideoExtensions []string `json:"videoExtensions"`
+	// FFProbePath is the path to the ffprobe executable or a command name searched for in the PATH. If empty, ffprobe is
+	// searched for in the PATH
+	FFProbePath string `json:"ffprobePath"`
+	// FFMpegPath is the path to the ffmpeg executable used for extracting thumbnails. If empty, ffmpeg is searched for
+	// in the PATH
+	FFMpegPath string `json:"ffmpegPath"`
+	// Presets is the list of user-defined presets for scraping metadata from file names
+	Presets []FileNamePreset `json:"presets"`
+	// VerifyInterval is the interval in minutes in which the existence of all video files is verified. Videos whose
+	// files went missing are marked as unavailable. If 0, the files are only verified on request
+	VerifyInterval uint `json:"verifyInterval"`
+	// WebhookURL is an optional URL a JSON summary is posted to every time a scrape has finished, failed or has been
+	// cancelled
+	WebhookURL string `json:"webhookUrl"`
+}
+
+// FileNamePreset is a user-defined preset for scraping metadata from the names of video files
+type FileNamePreset struct {
+	// The unique name of the preset
+	Name string `json:"name"`
+	// The regular expression matched against the file name
+	Regex string `json:"regex"`
+	// Maps the names of video fields to the index of the capture group of the regex that contains its value
+	FieldMap map[string]int `json:"fieldMap"`
 }
 
 // GetDefaultConfig returns the default configuration values for the application
@@ -51,7 +206,21 @@ func GetDefaultConfig() (*AppConfig, error) {
 		Restrictions: GuestRestrictionConfig{
 			NumWishesFromSameIP: 2,
 			IPWhitelist:         []string{},
+			IPBanlist:           []string{},
+		},
+		Scraper: ScraperConfig{
+			HashMode:           "partial",
+			MaxParallelScrapes: 2,
+		},
+		ListenAddress:       ":3000",
+		MaxPageSize:         DefaultMaxPageSize,
+		AverageSongLength:   DefaultAverageSongLength,
+		EventSelectInterval: DefaultEventSelectInterval,
+		AutoClosePlaylist:   true,
+		SessionStore:        SessionStoreMemory,
+		AuthMode:            AuthModeSession,
+		PasswordRules: PasswordRuleConfig{
+			MinLength: DefaultPasswordMinLength,
 		},
-		ListenAddress: ":3000",
 	}, nil
 }
@@ -11,6 +11,8 @@ type Event struct {
 	Name string `db:"name" json:"name"`
 	// A little description of the event
 	Description string `db:"description" json:"description,omitempty"`
+	// Internal notes of the organizers - not to be shown to guests
+	Notes string `db:"notes" json:"notes,omitempty"`
 	// The ID of the main playlist which contains the files played on stage
 	MainPlaylistID uint `db:"defaultPlaylist" json:"defaultPlaylist"`
 	// When does/did the event start?
@@ -22,3 +24,11 @@ type Event struct {
 	// Date of the last update of this entry
 	UpdatedAt time.Time `db:"updatedAt" json:"updatedAt"`
 }
+
+// EventOverlap describes two events whose time spans overlap
+type EventOverlap struct {
+	// The event starting first
+	First Event `json:"first"`
+	// The event overlapping with the first one
+	Second Event `json:"second"`
+}
@@ -9,6 +9,15 @@ const (
 	PlaylistStatusClosedForGuest
 )
 
+const (
+	// EntryStatusApproved is the status of a playlist entry that is visible to everyone
+	EntryStatusApproved = iota
+	// EntryStatusPending is the status of a guest's wish that has to be approved before it is shown on the main playlist
+	EntryStatusPending
+	// EntryStatusRejected is the status of a guest's wish that has been rejected
+	EntryStatusRejected
+)
+
 // A PlaylistEntry describes a video (song) requested to be played
 type PlaylistEntry struct {
 	// Internal ID of the playlist entry
@@ -19,10 +28,18 @@ type PlaylistEntry struct {
 	Position uint `db:"position" json:"-"`
 	// Who requested the video? - Users can enter this name freely
 	RequestedBy string `db:"requestedBy" json:"requestedBy"`
+	// The approval status of the entry - see "EntryStatus"- constants for possible values
+	Status uint `db:"status" json:"status"`
+	// Entries with a higher priority are played before all entries with a lower one - can only be set by admins
+	Priority int `db:"priority" json:"priority"`
+	// A free-text note on the entry - e.g. "key -2" or "start at the chorus"
+	Note string `db:"note" json:"note"`
 	// Creation timestamp of the entry == Timestamp of request
 	CreatedAt time.Time `db:"createdAt" json:"createdAt"`
 	// If updated - timestamp of the last update of the entry
 	UpdatedAt time.Time `db:"updatedAt" json:"updatedAt"`
+	// Timestamp of when the video of this entry has been played - null if it is still pending
+	PlayedAt *time.Time `db:"playedAt" json:"playedAt"`
 	// The playlist ID the entry belongs to
 	PlaylistID uint `db:"playlistId" json:"playlistId,omitempty"`
 	// The IP address of the machine this entry was requested from - not to be exported
@@ -36,6 +53,14 @@ type PlaylistVideoEntry struct {
 	Video *VideoSummary `json:"video"`
 }
 
+// A Requester is a guest who added wishes to a playlist, identified by the name given with the wishes
+type Requester struct {
+	// The name of the requester
+	Name string `db:"name" json:"name"`
+	// The number of wishes added under this name
+	NumWishes uint `db:"numWishes" json:"numWishes"`
+}
+
 // A Playlist is simply a list of video files
 type Playlist struct {
 	ID uint `db:"id" json:"id"`
@@ -12,6 +12,10 @@ type Session struct {
 	UserID uint
 	// When will the session expire?
 	ExpiresAt time.Time
+	// The permissions of the user that has logged-in - filled when the session is loaded
+	Permissions []string
+	// The ID of the API key the caller has authenticated with - 0 for sessions of users that have logged-in
+	APIKeyID uint
 }
 
 // Expired checks if the session has already expired
@@ -20,8 +24,11 @@ func (s *Session) Expired() bool {
 }
 
 // UserCan checks if the user in this session has the given permission
-//
-// Note: Currently this function will always return true, since the permission system is not yet implemented
 func (s *Session) UserCan(permission string) bool {
-	return true
+	for _, p := range s.Permissions {
+		if p == PermAll || p == permission {
+			return true
+		}
+	}
+	return false
 }
@@ -2,29 +2,86 @@ package models
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/elithrar/simple-scrypt"
 )
 
 const (
+	// PermAll grants every permission - even those added later on
+	PermAll = "*"
 	// PermVideoSeeFullDetails is the permission to view all details of any video
 	// If the user does not have the permission, only a small portion of a video's properties will be returned
 	PermVideoSeeFullDetails = "video.fullDetails"
+	// PermVideoEdit is the permission to create and change videos and their tags
+	PermVideoEdit = "video.edit"
+	// PermVideoDelete is the permission to delete and purge videos
+	PermVideoDelete = "video.delete"
+	// PermScrape is the permission to run scrapes and to manage the scraping presets
+	PermScrape = "scrape"
+	// PermConfig is the permission to change the system's configuration
+	PermConfig = "config"
+	// PermUserManage is the permission to manage the users of the application
+	PermUserManage = "user.manage"
+	// PermAuditView is the permission to browse the audit log of administrative actions
+	PermAuditView = "audit.view"
+	// PermPlayback is the permission to mark videos and playlist entries as played and to set the currently playing
+	// entry - like the stage player does
+	PermPlayback = "playback"
 )
 
+// Permissions is the list of all permissions that can be granted to a user
+var Permissions = []string{
+	PermAll,
+	PermVideoSeeFullDetails,
+	PermVideoEdit,
+	PermVideoDelete,
+	PermScrape,
+	PermConfig,
+	PermUserManage,
+	PermAuditView,
+	PermPlayback,
+}
+
+// IsPermission checks if the given string is a known permission
+func IsPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
 // User defines an (admin?) user of the application and his/her permissions inside this
 // application
 type User struct {
 	// Internal user ID
-	ID uint
+	ID uint `db:"id"`
 	// The user name used to log-in
-	Name string
+	Name string `db:"name"`
 	// The hashed password for authentication
-	PasswordHash string
+	PasswordHash string `db:"passwordHash"`
 	// The full user name for display reasons
-	FullName string
-	// A list of rights this user has - accessed by functions - for now, all authenticated users are admins
-	// rights []string
+	FullName string `db:"fullName"`
+	// Comma-separated list of the permissions granted to this user - accessed by functions
+	Permissions string `db:"permissions"`
+}
+
+// PermissionList returns the permissions granted to the user
+func (u *User) PermissionList() []string {
+	ret := []string{}
+	for _, p := range strings.Split(u.Permissions, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// SetPermissions replaces the permissions granted to the user
+func (u *User) SetPermissions(permissions []string) {
+	u.Permissions = strings.Join(permissions, ",")
 }
 
 // SetPassword sets a new password creating a password hash from the incoming password and storing it in the user's
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // Dimensions defines a width and a height
 type Dimensions struct {
@@ -15,22 +19,104 @@ type Video struct {
 	VideoSummary
 	// The file name of the video file
 	Filename string `db:"filename" json:"fileName"`
+	// The name of the container format the video file uses (like "matroska,webm")
+	Container string `db:"container" json:"container"`
 	// The video format used for encoding this video
 	VideoFormat string `db:"videoFormat" json:"videoFormat"`
 	// The bitrate of the primary video stream
 	VideoBitrate int `db:"videoBitrate" json:"videoBitrate"`
+	// The codec profile used for encoding the primary video stream (like "Main" or "High")
+	VideoProfile string `db:"videoProfile" json:"videoProfile"`
+	// The frame rate of the primary video stream in frames per second
+	FrameRate float64 `db:"frameRate" json:"frameRate"`
+	// The clockwise rotation in degrees the primary video stream needs to be displayed with
+	Rotation int `db:"rotation" json:"rotation"`
 	// The audio format used for encoding this video
 	AudioFormat string `db:"audioFormat" json:"audioFormat"`
 	// This bitrate of the primary audio stream
 	AudioBitrate int `db:"audioBitrate" json:"audioBitrate"`
+	// Comma-separated list of the languages of all subtitle streams contained in the video file
+	SubtitleLanguages string `db:"subtitleLanguages" json:"subtitleLanguages"`
+	// Path of the thumbnail image for this video - relative to the data directory
+	Thumbnail string `db:"thumbnail" json:"thumbnail"`
+	// The modification time of the video file when it has been scraped the last time
+	FileModTime time.Time `db:"fileModTime" json:"fileModTime"`
+	// Is false if the video file could not be found on disk during the last verification
+	Available bool `db:"available" json:"available"`
 	// Timestamp of the creation of this metadata record
 	CreatedAt time.Time `db:"createdAt" json:"createdAt"`
 	// Timestamp of the last change of this metadata record
 	UpdatedAt time.Time `db:"updatedAt" json:"updatedAt"`
+	// Timestamp of the deletion of this video. Deleted videos are kept until they get purged
+	DeletedAt *time.Time `db:"deletedAt" json:"deletedAt,omitempty"`
+	// Timestamp of the last time this video has been played
+	LastPlayedAt *time.Time `db:"lastPlayedAt" json:"lastPlayedAt,omitempty"`
 	// The number of times this video file has been played globally
 	NumPlayed uint `db:"numPlayed" json:"numPlayed"`
 	// The number of times this video file has been requested by players globally
 	NumRequested uint `db:"numRequested" json:"numRequested"`
+	// The chapters found inside the video file while scraping. These are stored separately and not loaded together
+	// with the video
+	Chapters []VideoChapter `db:"-" json:"chapters,omitempty"`
+	// Free-form tags describing the video - like "duet". These are stored separately and only loaded for the details
+	// of a single video
+	Tags []string `db:"-" json:"tags,omitempty"`
+}
+
+// FacetCount is the number of videos sharing the same value in one of their fields
+type FacetCount struct {
+	// The value of the field
+	Value string `db:"value" json:"value"`
+	// The number of videos having this value
+	Count uint `db:"count" json:"count"`
+}
+
+// VideoPatch contains the metadata fields that can be changed on multiple videos at once. Empty fields are left
+// untouched
+type VideoPatch struct {
+	Title         string `json:"title"`
+	Artist        string `json:"artist"`
+	Description   string `json:"description"`
+	RelatedMedium string `json:"relatedMedium"`
+	MediumDetail  string `json:"mediumDetail"`
+	Language      string `json:"language"`
+}
+
+// A VideoChapter is a chapter marker inside a video file - like a single song of a medley
+type VideoChapter struct {
+	// The hash of the video the chapter belongs to
+	VideoHash string `db:"videoHash" json:"videoHash"`
+	// The position of the chapter inside the video - starting at 0
+	Index uint `db:"chapterIndex" json:"index"`
+	// The title of the chapter
+	Title string `db:"title" json:"title"`
+	// The offset from the beginning of the video the chapter starts at
+	Start time.Duration `db:"startsAt" json:"start"`
+	// The offset from the beginning of the video the chapter ends at
+	End time.Duration `db:"endsAt" json:"end"`
+}
+
+// Duration is a time.Duration that is stored as is, but represented as a number of whole seconds in JSON
+type Duration time.Duration
+
+// Seconds returns the duration as a floating point number of seconds
+func (d Duration) Seconds() float64 {
+	return time.Duration(d).Seconds()
+}
+
+// MarshalJSON encodes the duration as a number of whole seconds
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int64(time.Duration(d).Round(time.Second) / time.Second))
+}
+
+// UnmarshalJSON decodes the duration from a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("Duration must be a number of seconds: %v", err)
+	}
+	*d = Duration(seconds * float64(time.Second))
+	return nil
 }
 
 // VideoSummary is a shortened version of the video data type that is used to send to non-admin users hiding some of
@@ -53,8 +139,8 @@ type VideoSummary struct {
 	MediumDetail string `db:"mediumDetail" json:"mediumDetail"`
 	// Further description for the file
 	Description string `db:"description" json:"description"`
-	// Length of the video file
-	Duration time.Duration `db:"duration" json:"duration"`
+	// Length of the video file - given in seconds in JSON
+	Duration Duration `db:"duration" json:"duration"`
 	// Internal identifier for this file
 	Identifier string `db:"identifier" json:"identifier"`
 }
@@ -63,13 +149,32 @@ type VideoSummary struct {
 // Inside this record, all statistical data will be held for later analysis
 type VideoStatistics struct {
 	// The internal ID
-	ID uint
+	ID uint `db:"id" json:"id"`
 	// The ID of the event associated with this entry
-	EventID uint
+	EventID uint `db:"eventId" json:"eventId"`
 	// The hash of the video associated with this entry
-	VideoHash string
+	VideoHash string `db:"videoHash" json:"videoHash"`
 	// Times this video was fully played during this event
-	NumPlayed uint
+	NumPlayed uint `db:"numPlayed" json:"numPlayed"`
 	// Times this video was requested to be played during this event
-	NumRequested uint
+	NumRequested uint `db:"numRequested" json:"numRequested"`
+}
+
+// A VideoStatisticsEntry contains the statistics of a video for an event together with a summary of the video - nil if
+// the video has been removed from the database in the meantime
+type VideoStatisticsEntry struct {
+	VideoStatistics
+	Video *VideoSummary `json:"video"`
+}
+
+// EventStatistics is the statistical report of an event
+type EventStatistics struct {
+	// The ID of the event
+	EventID uint `json:"eventId"`
+	// The total number of wishes added by guests during the event
+	NumWishes uint `json:"numWishes"`
+	// The number of different IP addresses guests added their wishes from
+	NumRequesters uint `json:"numRequesters"`
+	// The statistics of all videos wished for or played during the event
+	Videos []VideoStatisticsEntry `json:"videos"`
 }
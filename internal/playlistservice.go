@@ -1,9 +1,17 @@
 package internal
 
 import (
+	"bufio"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/derWhity/kyabia/internal/log"
 	"github.com/derWhity/kyabia/internal/models"
@@ -12,6 +20,9 @@ import (
 	"golang.org/x/net/context"
 )
 
+// MaxGuestNoteLength is the maximum number of characters allowed for the note on a wish added by a guest
+const MaxGuestNoteLength = 200
+
 // PlaylistService provides service functions for working with playlists
 type PlaylistService interface {
 	List(ctx context.Context, search *Search) ([]models.Playlist, uint, error)
@@ -19,14 +30,81 @@ type PlaylistService interface {
 	Create(ctx context.Context, playlist *models.Playlist) (*models.Playlist, error)
 	Update(ctx context.Context, playlist *models.Playlist) error
 	Delete(ctx context.Context, id uint) error
-	ListEntries(ctx context.Context, id uint, offset uint, limit uint) ([]models.PlaylistVideoEntry, uint, error)
+	ListEntries(ctx context.Context, id uint, search *PlaylistEntrySearch) ([]models.PlaylistVideoEntry, uint, error)
 	AddEntry(ctx context.Context, id uint, entry *models.PlaylistEntry) error
-	UpdateEntry(ctx context.Context, entry models.PlaylistEntry) error
+	InsertEntry(ctx context.Context, id uint, entry *models.PlaylistEntry, index uint) error
+	AddEntries(ctx context.Context, id uint, entries []models.PlaylistEntry) ([]BatchEntryResult, error)
+	UpdateEntry(ctx context.Context, entry models.PlaylistEntry, note *string) error
 	DeleteEntry(ctx context.Context, id uint) error
+	MarkEntryPlayed(ctx context.Context, id uint) error
+	ApproveEntry(ctx context.Context, id uint) error
+	SetEntryPriority(ctx context.Context, id uint, priority int) error
+	RejectEntry(ctx context.Context, id uint) error
+	RemovePlayedEntries(ctx context.Context, id uint) (uint, error)
+	RemoveEntriesByIP(ctx context.Context, id uint, ipAddr string) (uint, error)
+	MergeInto(ctx context.Context, sourceID uint, targetID uint, deleteSource bool) (uint, error)
+	TotalDuration(ctx context.Context, id uint) (time.Duration, error)
 	PlaceEntryBefore(ctx context.Context, entryID uint, otherEntryID uint) error
+	SwapEntries(ctx context.Context, entryID uint, otherEntryID uint) error
+	MoveToTop(ctx context.Context, entryID uint) error
+	MoveToBottom(ctx context.Context, entryID uint) error
+	Shuffle(ctx context.Context, id uint) error
+	ExportXSPF(ctx context.Context, id uint) (*XSPFPlaylist, error)
+	ImportM3U(ctx context.Context, id uint, m3u string, template models.PlaylistEntry) (*ImportResult, error)
 	GetMain(ctx context.Context) (*models.Playlist, error)
-	ListMainEntries(ctx context.Context, offset uint, limit uint) ([]models.PlaylistVideoEntry, uint, error)
+	ListMainEntries(ctx context.Context, search *PlaylistEntrySearch) ([]models.PlaylistVideoEntry, uint, error)
 	AddMainEntry(ctx context.Context, entry *models.PlaylistEntry) error
+	NextMainEntry(ctx context.Context) (*models.PlaylistVideoEntry, error)
+	EstimatedWait(ctx context.Context, entryID uint) (time.Duration, error)
+	EntryPosition(ctx context.Context, entryID uint) (uint, uint, error)
+	CurrentMainEntry(ctx context.Context) (*models.PlaylistVideoEntry, error)
+	SetCurrentMainEntry(ctx context.Context, entryID uint) (*models.PlaylistVideoEntry, error)
+}
+
+// ImportResult is the summary of importing a playlist file into a playlist
+type ImportResult struct {
+	// The number of entries added to the playlist
+	NumImported uint `json:"numImported"`
+	// The lines of the playlist file no (available) video could be found for
+	Unmatched []string `json:"unmatched"`
+}
+
+// BatchEntryResult is the outcome of adding a single entry of a batch to a playlist
+type BatchEntryResult struct {
+	// Index of the entry inside the batch - starting at 0
+	Index int `json:"index"`
+	// The hash of the requested video
+	VideoHash string `json:"videoHash"`
+	// Has the entry been added?
+	OK bool `json:"ok"`
+	// The ID of the new playlist entry - only set if the entry has been added
+	ID uint `json:"id,omitempty"`
+	// Error code and message telling why the entry has not been added
+	ErrorCode string `json:"errorCode,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// XSPFPlaylist is a playlist in the XML Shareable Playlist Format (XSPF) - see https://xspf.org
+type XSPFPlaylist struct {
+	XMLName   xml.Name      `xml:"http://xspf.org/ns/0/ playlist"`
+	Version   int           `xml:"version,attr"`
+	Title     string        `xml:"title,omitempty"`
+	TrackList XSPFTrackList `xml:"trackList"`
+}
+
+// XSPFTrackList is the list of tracks of an XSPF playlist - it is required even if the playlist is empty
+type XSPFTrackList struct {
+	Tracks []XSPFTrack `xml:"track"`
+}
+
+// XSPFTrack is a single track inside an XSPF playlist
+type XSPFTrack struct {
+	// URI of the video file
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	// Duration in milliseconds
+	Duration int64 `xml:"duration,omitempty"`
 }
 
 // -- PlaylistService implementation -----------------------------------------------------------------------------------
@@ -35,13 +113,34 @@ type playlistService struct {
 	logger    *logrus.Entry
 	repo      repos.PlaylistRepo
 	videoRepo repos.VideoRepo
+	statsRepo repos.StatisticsRepo
 	events    EventService
 	config    ConfigService
+	// The entry of the main playlist that is playing right now and the ID of the main playlist it has been set for
+	current struct {
+		sync.Mutex
+		entryID    uint
+		playlistID uint
+	}
 }
 
 // NewPlaylistService creates a new PlaylistService instance
-func NewPlaylistService(pRepo repos.PlaylistRepo, vRepo repos.VideoRepo, events EventService, cs ConfigService, logger *logrus.Entry) PlaylistService {
-	return &playlistService{logger, pRepo, vRepo, events, cs}
+func NewPlaylistService(
+	pRepo repos.PlaylistRepo,
+	vRepo repos.VideoRepo,
+	sRepo repos.StatisticsRepo,
+	events EventService,
+	cs ConfigService,
+	logger *logrus.Entry,
+) PlaylistService {
+	return &playlistService{
+		logger:    logger,
+		repo:      pRepo,
+		videoRepo: vRepo,
+		statsRepo: sRepo,
+		events:    events,
+		config:    cs,
+	}
 }
 
 // List returns a list of playlists matching the search term
@@ -125,6 +224,7 @@ func (s *playlistService) Update(ctx context.Context, playlist *models.Playlist)
 			},
 		)
 	}
+	oldStatus := originalPlaylist.Status
 	originalPlaylist.Name = strings.TrimSpace(playlist.Name)
 	originalPlaylist.Status = playlist.Status
 	originalPlaylist.Message = strings.TrimSpace(playlist.Message)
@@ -137,6 +237,11 @@ func (s *playlistService) Update(ctx context.Context, playlist *models.Playlist)
 			err,
 		)
 	}
+	if oldStatus != playlist.Status {
+		audit(ctx, models.AuditPlaylistStatus, fmt.Sprintf("%d", playlist.ID),
+			fmt.Sprintf("Status changed from %d to %d", oldStatus, playlist.Status),
+		)
+	}
 	return nil
 }
 
@@ -153,15 +258,42 @@ func (s *playlistService) Delete(ctx context.Context, id uint) error {
 	return nil
 }
 
-// ListEntries returns the playlist entries belonging to the list with the provided playlist ID
-func (s *playlistService) ListEntries(ctx context.Context, id uint, offset uint, limit uint) ([]models.PlaylistVideoEntry, uint, error) {
+// ListEntries returns the playlist entries belonging to the list with the provided playlist ID - optionally filtered
+// by a search string matched against the video's title and artist and the requester's name and by the requester's name
+// alone
+func (s *playlistService) ListEntries(
+	ctx context.Context,
+	id uint,
+	search *PlaylistEntrySearch,
+) ([]models.PlaylistVideoEntry, uint, error) {
+	return s.listEntries(ctx, id, search, false)
+}
+
+// listEntries returns the playlist entries belonging to the list with the provided playlist ID - leaving out the
+// entries that have not been approved if `onlyApproved` is set
+func (s *playlistService) listEntries(
+	ctx context.Context,
+	id uint,
+	search *PlaylistEntrySearch,
+	onlyApproved bool,
+) ([]models.PlaylistVideoEntry, uint, error) {
 	// Check if the playlist exists
 	_, err := s.Get(ctx, id)
 	if err != nil {
 		return nil, 0, err
 	}
 	// All right - get the entries
-	list, numRows, err := s.repo.GetEntries(id, offset, limit)
+	filter := repos.PlaylistEntryFilter{
+		OnlyApproved: onlyApproved,
+		RequestedBy:  strings.TrimSpace(search.RequestedBy),
+	}
+	list, numRows, err := s.repo.GetEntries(
+		id,
+		strings.TrimSpace(search.Search.Search),
+		filter,
+		search.Offset,
+		search.Limit,
+	)
 	if err != nil {
 		return nil, 0, MakeErrorWithData(
 			http.StatusInternalServerError,
@@ -175,11 +307,116 @@ func (s *playlistService) ListEntries(ctx context.Context, id uint, offset uint,
 
 // AddEntry adds an entry to the playlist with the playlist ID provided
 func (s *playlistService) AddEntry(ctx context.Context, id uint, entry *models.PlaylistEntry) error {
+	entry.Status = models.EntryStatusApproved
+	return s.addEntry(ctx, id, entry, nil)
+}
+
+// InsertEntry adds an entry to the playlist with the playlist ID provided at the given index - the entries following
+// it move one step down. If the index lies beyond the end of the playlist, the entry is appended
+func (s *playlistService) InsertEntry(ctx context.Context, id uint, entry *models.PlaylistEntry, index uint) error {
+	entry.Status = models.EntryStatusApproved
+	return s.addEntry(ctx, id, entry, &index)
+}
+
+// addEntry adds an entry to the playlist with the playlist ID provided - keeping the entry's status. The entry is
+// appended unless an index is given
+func (s *playlistService) addEntry(ctx context.Context, id uint, entry *models.PlaylistEntry, index *uint) error {
 	// Check if the playlist exists
 	_, err := s.Get(ctx, id)
 	if err != nil {
 		return err
 	}
+	if err := s.checkNewEntry(entry); err != nil {
+		return err
+	}
+	if index != nil {
+		err = s.repo.InsertEntry(id, entry, *index)
+	} else {
+		err = s.repo.AddEntry(id, entry)
+	}
+	if err != nil {
+		return MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while adding entry to playlist #%d", id),
+			err,
+		)
+	}
+	// NumRequested++
+	if err := s.videoRepo.BumpNumRequested(entry.VideoHash); err != nil {
+		// Do not report the error back, but log it!
+		s.logger.WithError(err).WithField(log.FldVideo, entry.VideoHash).Error("Failed to update request counter for video")
+	}
+	return nil
+}
+
+// AddEntries adds multiple entries to the playlist with the given ID - keeping their order. Entries that cannot be added
+// - e.g. because their video does not exist - are skipped and reported in the result, while the others are added
+// together
+func (s *playlistService) AddEntries(
+	ctx context.Context,
+	id uint,
+	entries []models.PlaylistEntry,
+) ([]BatchEntryResult, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	results := make([]BatchEntryResult, len(entries))
+	var valid []*models.PlaylistEntry
+	var validResults []*BatchEntryResult
+	for i := range entries {
+		entry := &entries[i]
+		results[i] = BatchEntryResult{Index: i, VideoHash: entry.VideoHash}
+		entry.Status = models.EntryStatusApproved
+		if err := s.checkNewEntry(entry); err != nil {
+			herr, ok := err.(*HTTPError)
+			if !ok || herr.Status() >= http.StatusInternalServerError {
+				return nil, err
+			}
+			results[i].ErrorCode = herr.ErrorCode()
+			results[i].Message = herr.Error()
+			continue
+		}
+		valid = append(valid, entry)
+		validResults = append(validResults, &results[i])
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+	if err := s.repo.AddEntries(id, valid); err != nil {
+		return nil, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while adding entries to playlist #%d", id),
+			err,
+		)
+	}
+	for i, entry := range valid {
+		validResults[i].OK = true
+		validResults[i].ID = entry.ID
+		if err := s.videoRepo.BumpNumRequested(entry.VideoHash); err != nil {
+			s.logger.WithError(err).WithField(log.FldVideo, entry.VideoHash).Error("Failed to update request counter for video")
+		}
+	}
+	return results, nil
+}
+
+// checkNote returns an error if the given note is longer than guests are allowed to write
+func checkNote(note string) error {
+	if len([]rune(strings.TrimSpace(note))) > MaxGuestNoteLength {
+		return MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			fmt.Sprintf("The note must not be longer than %d characters", MaxGuestNoteLength),
+			map[string]string{"field": "note"},
+		)
+	}
+	return nil
+}
+
+// checkNewEntry normalizes the given entry that should be added to a playlist and checks if it references a video that
+// exists and is available
+func (s *playlistService) checkNewEntry(entry *models.PlaylistEntry) error {
 	entry.RequestedBy = strings.TrimSpace(entry.RequestedBy)
 	if entry.RequestedBy == "" {
 		return MakeErrorWithData(
@@ -191,8 +428,9 @@ func (s *playlistService) AddEntry(ctx context.Context, id uint, entry *models.P
 			},
 		)
 	}
+	entry.Note = strings.TrimSpace(entry.Note)
 	// Check if the video exists
-	_, err = s.videoRepo.GetByID(entry.VideoHash)
+	vid, err := s.videoRepo.GetByID(entry.VideoHash)
 	if err != nil {
 		if err == repos.ErrEntityNotExisting {
 			return MakeError(
@@ -208,24 +446,19 @@ func (s *playlistService) AddEntry(ctx context.Context, id uint, entry *models.P
 			err,
 		)
 	}
-	if err := s.repo.AddEntry(id, entry); err != nil {
-		return MakeErrorWithData(
-			http.StatusInternalServerError,
-			ErrCodeRepoError,
-			fmt.Sprintf("Error while adding entry to playlist #%d", id),
-			err,
+	if !vid.Available {
+		return MakeError(
+			http.StatusBadRequest,
+			ErrCodeVideoFileMissing,
+			"The file of the requested video is currently not available",
 		)
 	}
-	// NumRequested++
-	if err := s.videoRepo.BumpNumRequested(entry.VideoHash); err != nil {
-		// Do not report the error back, but log it!
-		s.logger.WithError(err).WithField(log.FldVideo, entry.VideoHash).Error("Failed to update request counter for video")
-	}
 	return nil
 }
 
-// UpdateEntry updates the data of the given playlist entry
-func (s *playlistService) UpdateEntry(ctx context.Context, entry models.PlaylistEntry) error {
+// UpdateEntry updates the data of the given playlist entry. The note is only changed if one is given - an empty note
+// removes the existing one
+func (s *playlistService) UpdateEntry(ctx context.Context, entry models.PlaylistEntry, note *string) error {
 	originalEntry, err := s.repo.GetEntryByID(entry.ID)
 	if err != nil {
 		if err == repos.ErrEntityNotExisting {
@@ -235,12 +468,25 @@ func (s *playlistService) UpdateEntry(ctx context.Context, entry models.Playlist
 				fmt.Sprintf("UpdateEntry: Playlist entry #%d does not exist", entry.ID),
 			)
 		}
+		return MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Error while loading playlist entry",
+			err,
+		)
 	}
 	// Update only the supported fields on the original entry
 	// Requester
 	if strings.TrimSpace(entry.RequestedBy) != "" {
 		originalEntry.RequestedBy = strings.TrimSpace(entry.RequestedBy)
 	}
+	// Note
+	if note != nil {
+		if err := checkNote(*note); err != nil {
+			return err
+		}
+		originalEntry.Note = strings.TrimSpace(*note)
+	}
 	// Playlist ID
 	needsReorder := false
 	if entry.PlaylistID > 0 && originalEntry.PlaylistID != entry.PlaylistID {
@@ -330,28 +576,452 @@ func (s *playlistService) DeleteEntry(ctx context.Context, id uint) error {
 	return nil
 }
 
+// MarkEntryPlayed marks the given playlist entry as played and increases the play counter of its video. Entries that
+// have already been played are left as they are
+func (s *playlistService) MarkEntryPlayed(ctx context.Context, id uint) error {
+	entry, err := s.repo.GetEntryByID(id)
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return MakeError(
+				http.StatusNotFound,
+				ErrCodePlaylistEntryNotFound,
+				fmt.Sprintf("Playlist entry #%d does not exist", id),
+			)
+		}
+		return MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Error while retrieving playlist entry",
+			err,
+		)
+	}
+	if entry.PlayedAt != nil {
+		return nil
+	}
+	if err := s.repo.MarkEntryPlayed(id); err != nil {
+		return MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Error while updating playlist entry",
+			err,
+		)
+	}
+	// NumPlayed++
+	if err := s.videoRepo.BumpNumPlayed(entry.VideoHash); err != nil {
+		// Do not report the error back, but log it!
+		s.logger.WithError(err).WithField(log.FldVideo, entry.VideoHash).Error("Failed to update play counter for video")
+	}
+	if eventID := s.events.CurrentEventID(ctx); eventID != 0 {
+		if err := s.statsRepo.BumpNumPlayed(eventID, entry.VideoHash); err != nil {
+			s.logger.WithError(err).WithField(log.FldVideo, entry.VideoHash).Error("Failed to update event statistics for video")
+		}
+	}
+	return nil
+}
+
+// SetEntryPriority sets the priority of the given playlist entry. Entries with a higher priority are placed ahead of
+// all entries with a lower one - regardless of the order they have been added or moved in
+func (s *playlistService) SetEntryPriority(ctx context.Context, id uint, priority int) error {
+	if err := s.repo.SetEntryPriority(id, priority); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return MakeError(
+				http.StatusNotFound,
+				ErrCodePlaylistEntryNotFound,
+				fmt.Sprintf("Playlist entry #%d does not exist", id),
+			)
+		}
+		return MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Error while updating playlist entry",
+			err,
+		)
+	}
+	return nil
+}
+
+// ApproveEntry approves the given playlist entry - making it visible on the main playlist
+func (s *playlistService) ApproveEntry(ctx context.Context, id uint) error {
+	return s.setEntryStatus(id, models.EntryStatusApproved)
+}
+
+// RejectEntry rejects the given playlist entry. Rejected entries stay hidden from the guests and do not count towards
+// the wish limits anymore
+func (s *playlistService) RejectEntry(ctx context.Context, id uint) error {
+	return s.setEntryStatus(id, models.EntryStatusRejected)
+}
+
+// setEntryStatus sets the approval status of the given playlist entry
+func (s *playlistService) setEntryStatus(id uint, status uint) error {
+	if err := s.repo.SetEntryStatus(id, status); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return MakeError(
+				http.StatusNotFound,
+				ErrCodePlaylistEntryNotFound,
+				fmt.Sprintf("Playlist entry #%d does not exist", id),
+			)
+		}
+		return MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Error while updating playlist entry",
+			err,
+		)
+	}
+	return nil
+}
+
+// RemovePlayedEntries removes all entries that have been played from the given playlist and returns the number of
+// entries removed
+func (s *playlistService) RemovePlayedEntries(ctx context.Context, id uint) (uint, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return 0, err
+	}
+	num, err := s.repo.RemovePlayedEntries(id)
+	if err != nil {
+		return 0, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while removing played entries from playlist #%d", id),
+			err,
+		)
+	}
+	return num, nil
+}
+
+// RemoveEntriesByIP removes all entries of the given playlist that have been added from the given IP address and are
+// still pending. Entries that have already been played are kept. Returns the number of entries removed
+func (s *playlistService) RemoveEntriesByIP(ctx context.Context, id uint, ipAddr string) (uint, error) {
+	ipAddr = strings.TrimSpace(ipAddr)
+	if ipAddr == "" {
+		return 0, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeRequiredFieldMissing,
+			"The IP address must not be empty",
+			map[string]string{"field": "ipAddress"},
+		)
+	}
+	if _, err := s.Get(ctx, id); err != nil {
+		return 0, err
+	}
+	num, err := s.repo.RemovePendingEntriesByIP(id, ipAddr)
+	if err != nil {
+		return 0, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while removing entries from playlist #%d", id),
+			err,
+		)
+	}
+	return num, nil
+}
+
+// MergeInto appends all entries of the source playlist to the target playlist and returns the number of entries moved.
+// If deleteSource is set, the then empty source playlist is removed
+func (s *playlistService) MergeInto(ctx context.Context, sourceID uint, targetID uint, deleteSource bool) (uint, error) {
+	if sourceID == targetID {
+		return 0, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"A playlist cannot be merged into itself",
+		)
+	}
+	for _, id := range []uint{sourceID, targetID} {
+		if _, err := s.Get(ctx, id); err != nil {
+			return 0, err
+		}
+	}
+	num, err := s.repo.MergeEntries(sourceID, targetID, deleteSource)
+	if err != nil {
+		return 0, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while merging playlist #%d into #%d", sourceID, targetID),
+			err,
+		)
+	}
+	return num, nil
+}
+
+// TotalDuration returns the time it takes to play all videos of the given playlist
+func (s *playlistService) TotalDuration(ctx context.Context, id uint) (time.Duration, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return 0, err
+	}
+	total, err := s.repo.GetTotalDuration(id)
+	if err != nil {
+		return 0, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while calculating the duration of playlist #%d", id),
+			err,
+		)
+	}
+	return total, nil
+}
+
 // PlaceEntryBefore moves an entry inside the playlist's order before another entry
 // If the other entry is not found or does not belong to the same playlist, the entry is placed at the end of the
 // playlist
 func (s *playlistService) PlaceEntryBefore(ctx context.Context, entryID uint, otherEntryID uint) error {
-	if err := s.repo.PlaceEntryBefore(entryID, otherEntryID); err != nil {
-		if err == repos.ErrEntityNotExisting {
+	return reorderError(entryID, s.repo.PlaceEntryBefore(entryID, otherEntryID))
+}
+
+// SwapEntries exchanges the positions of the two given playlist entries inside their playlist - together with their
+// priorities, so they exchange their places in the play order. Both entries have to belong to the same playlist
+func (s *playlistService) SwapEntries(ctx context.Context, entryID uint, otherEntryID uint) error {
+	var playlistID uint
+	for _, id := range []uint{entryID, otherEntryID} {
+		entry, err := s.repo.GetEntryByID(id)
+		if err != nil {
+			return reorderError(id, err)
+		}
+		if playlistID != 0 && entry.PlaylistID != playlistID {
 			return MakeError(
-				http.StatusNotFound,
-				ErrCodePlaylistEntryNotFound,
-				fmt.Sprintf("Playlist entry #%d does not exist", entryID),
+				http.StatusBadRequest,
+				ErrCodeIllegalValue,
+				fmt.Sprintf("Playlist entries #%d and #%d belong to different playlists", entryID, otherEntryID),
 			)
 		}
+		playlistID = entry.PlaylistID
+	}
+	return reorderError(entryID, s.repo.SwapEntries(entryID, otherEntryID))
+}
+
+// MoveToTop moves the given playlist entry to the beginning of its playlist
+func (s *playlistService) MoveToTop(ctx context.Context, entryID uint) error {
+	return reorderError(entryID, s.repo.MoveEntryToTop(entryID))
+}
+
+// MoveToBottom moves the given playlist entry to the end of its playlist
+func (s *playlistService) MoveToBottom(ctx context.Context, entryID uint) error {
+	return reorderError(entryID, s.repo.MoveEntryToBottom(entryID))
+}
+
+// reorderError converts an error returned by the repository while moving the given playlist entry into a service error
+func reorderError(entryID uint, err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == repos.ErrEntityNotExisting {
+		return MakeError(
+			http.StatusNotFound,
+			ErrCodePlaylistEntryNotFound,
+			fmt.Sprintf("Playlist entry #%d does not exist", entryID),
+		)
+	}
+	return MakeErrorWithData(
+		http.StatusInternalServerError,
+		ErrCodeRepoError,
+		fmt.Sprintf("Error while reordering playlist entries"),
+		err,
+	)
+}
+
+// Shuffle puts the entries of the given playlist into a random order
+func (s *playlistService) Shuffle(ctx context.Context, id uint) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := s.repo.Shuffle(id); err != nil {
 		return MakeErrorWithData(
 			http.StatusInternalServerError,
 			ErrCodeRepoError,
-			fmt.Sprintf("Error while reordering playlist entries"),
+			fmt.Sprintf("Error while shuffling playlist #%d", id),
 			err,
 		)
 	}
 	return nil
 }
 
+// ImportM3U appends the videos listed in the given M3U playlist to the playlist with the given ID - in the order they
+// are listed. Each line is matched against the file names of the videos or - if it is a SHA-512 hash - against their
+// IDs. Lines no available video is found for are returned instead of failing the import. All entries are created
+// from the template, which provides the requester
+// Just like entries added by AddEntries, the imported entries count as requests of their videos, but are not counted
+// in the event statistics - those only count the wishes of guests
+func (s *playlistService) ImportM3U(
+	ctx context.Context,
+	id uint,
+	m3u string,
+	template models.PlaylistEntry,
+) (*ImportResult, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	template.RequestedBy = strings.TrimSpace(template.RequestedBy)
+	if template.RequestedBy == "" {
+		return nil, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeRequiredFieldMissing,
+			"RequestedBy must not be empty",
+			map[string]string{
+				"field": "requestedBy",
+			},
+		)
+	}
+	res := ImportResult{Unmatched: []string{}}
+	var entries []*models.PlaylistEntry
+	scanner := bufio.NewScanner(strings.NewReader(strings.TrimPrefix(m3u, "\ufeff")))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			// Comments and extended M3U directives like "#EXTINF"
+			continue
+		}
+		vid, err := s.findImportedVideo(line)
+		if err != nil {
+			return nil, MakeErrorWithData(
+				http.StatusInternalServerError,
+				ErrCodeRepoError,
+				"Failed to retrieve video information",
+				err,
+			)
+		}
+		if vid == nil || !vid.Available {
+			res.Unmatched = append(res.Unmatched, line)
+			continue
+		}
+		entry := template
+		entry.VideoHash = vid.SHA512
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			fmt.Sprintf("Failed to read the playlist file: %v", err),
+		)
+	}
+	if len(entries) > 0 {
+		if err := s.repo.AddEntries(id, entries); err != nil {
+			return nil, MakeErrorWithData(
+				http.StatusInternalServerError,
+				ErrCodeRepoError,
+				fmt.Sprintf("Error while adding entries to playlist #%d", id),
+				err,
+			)
+		}
+	}
+	for _, entry := range entries {
+		if err := s.videoRepo.BumpNumRequested(entry.VideoHash); err != nil {
+			s.logger.WithError(err).WithField(log.FldVideo, entry.VideoHash).Error("Failed to update request counter for video")
+		}
+	}
+	res.NumImported = uint(len(entries))
+	return &res, nil
+}
+
+// findImportedVideo returns the video referenced by a line of an imported playlist file - either by its ID (SHA-512
+// hash), its file name or a "file://" URI of it. If there is no such video, nil is returned
+func (s *playlistService) findImportedVideo(line string) (*models.Video, error) {
+	var vid *models.Video
+	var err error
+	if _, hexErr := hex.DecodeString(line); hexErr == nil && len(line) == sha512.Size*2 {
+		vid, err = s.videoRepo.GetByID(strings.ToLower(line))
+	} else {
+		vid, err = s.videoRepo.GetByFilename(filePath(line))
+	}
+	if err == repos.ErrEntityNotExisting {
+		return nil, nil
+	}
+	return vid, err
+}
+
+// filePath converts a "file://" URI into the path of the file - the reverse of fileURI. Anything else is returned as
+// it is
+func filePath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	p := u.Path
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		// Windows paths like "/C:/Videos" do not start with a slash
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+// ExportXSPF returns the entries of the given playlist in their current order as XSPF playlist. Entries whose videos
+// have been deleted are left out
+func (s *playlistService) ExportXSPF(ctx context.Context, id uint) (*XSPFPlaylist, error) {
+	pl, vids, err := s.exportEntries(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ret := XSPFPlaylist{
+		Version: 1,
+		Title:   pl.Name,
+	}
+	for _, vid := range vids {
+		ret.TrackList.Tracks = append(ret.TrackList.Tracks, XSPFTrack{
+			Location: fileURI(vid.Filename),
+			Title:    vid.Title,
+			Creator:  vid.Artist,
+			Duration: int64(time.Duration(vid.Duration) / time.Millisecond),
+		})
+	}
+	return &ret, nil
+}
+
+// exportEntries loads the playlist with the given ID and the videos of all of its entries in the playlist's order - as
+// needed for exporting the playlist to other players. Entries whose videos have been deleted and entries that have not
+// been approved are left out
+func (s *playlistService) exportEntries(ctx context.Context, id uint) (*models.Playlist, []models.Video, error) {
+	pl, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []models.PlaylistVideoEntry
+	for {
+		filter := repos.PlaylistEntryFilter{OnlyApproved: true}
+		page, numRows, err := s.repo.GetEntries(id, "", filter, uint(len(entries)), 0)
+		if err != nil {
+			return nil, nil, MakeErrorWithData(
+				http.StatusInternalServerError,
+				ErrCodeRepoError,
+				fmt.Sprintf("Error while retrieving playlist entries for #%d", id),
+				err,
+			)
+		}
+		entries = append(entries, page...)
+		if len(page) == 0 || uint(len(entries)) >= numRows {
+			break
+		}
+	}
+	vids := make([]models.Video, 0, len(entries))
+	for _, entry := range entries {
+		vid, err := s.videoRepo.GetByID(entry.VideoHash)
+		if err == repos.ErrEntityNotExisting {
+			continue
+		}
+		if err != nil {
+			return nil, nil, MakeErrorWithData(
+				http.StatusInternalServerError,
+				ErrCodeRepoError,
+				fmt.Sprintf("Error while retrieving video %s", entry.VideoHash),
+				err,
+			)
+		}
+		vids = append(vids, *vid)
+	}
+	return pl, vids, nil
+}
+
+// fileURI converts the file name of a video into a URI - file names that already are URLs are returned as they are
+func fileURI(filename string) string {
+	if isRemote(filename) {
+		return filename
+	}
+	p := filepath.ToSlash(filename)
+	if !strings.HasPrefix(p, "/") {
+		// Windows paths like "C:/Videos" need a leading slash
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
 // GetMain returns the main playlist for the event that is currently running
 func (s *playlistService) GetMain(ctx context.Context) (*models.Playlist, error) {
 	mainID := s.events.DefaultPlaylistID(ctx)
@@ -368,13 +1038,191 @@ func (s *playlistService) GetMain(ctx context.Context) (*models.Playlist, error)
 	return pl, nil
 }
 
-// ListMainEntries returns the playlist entries for the main playlist for the currently active event
-func (s *playlistService) ListMainEntries(ctx context.Context, offset uint, limit uint) ([]models.PlaylistVideoEntry, uint, error) {
+// ListMainEntries returns the playlist entries for the main playlist for the currently active event - optionally
+// filtered like with ListEntries
+func (s *playlistService) ListMainEntries(
+	ctx context.Context,
+	search *PlaylistEntrySearch,
+) ([]models.PlaylistVideoEntry, uint, error) {
 	mainID := s.events.DefaultPlaylistID(ctx)
 	if mainID == 0 {
 		return nil, 0, ErrNoCurrentEvent
 	}
-	return s.ListEntries(ctx, mainID, offset, limit)
+	return s.listEntries(ctx, mainID, search, true)
+}
+
+// NextMainEntry returns the entry of the main playlist that is next to be played - the first one that has not been
+// played, yet
+func (s *playlistService) NextMainEntry(ctx context.Context) (*models.PlaylistVideoEntry, error) {
+	mainID := s.events.DefaultPlaylistID(ctx)
+	if mainID == 0 {
+		return nil, ErrNoCurrentEvent
+	}
+	entry, err := s.repo.GetNextEntry(mainID)
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return nil, MakeError(
+				http.StatusNotFound,
+				ErrCodeNoEntriesLeft,
+				"All entries of the main playlist have been played",
+			)
+		}
+		return nil, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Error while retrieving the next playlist entry",
+			err,
+		)
+	}
+	return entry, nil
+}
+
+// CurrentMainEntry returns the entry of the main playlist that is playing right now. The entry is forgotten as soon as
+// the main playlist changes - e.g. because another event has been selected
+func (s *playlistService) CurrentMainEntry(ctx context.Context) (*models.PlaylistVideoEntry, error) {
+	mainID := s.events.DefaultPlaylistID(ctx)
+	if mainID == 0 {
+		return nil, ErrNoCurrentEvent
+	}
+	s.current.Lock()
+	defer s.current.Unlock()
+	if s.current.playlistID != mainID {
+		s.current.entryID = 0
+		s.current.playlistID = 0
+	}
+	errNoEntry := MakeError(
+		http.StatusNotFound,
+		ErrCodeNoCurrentEntry,
+		"There is no entry of the main playlist playing right now",
+	)
+	if s.current.entryID == 0 {
+		return nil, errNoEntry
+	}
+	entry, err := s.repo.GetVideoEntryByID(s.current.entryID)
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			// The entry has been removed in the meantime
+			s.current.entryID = 0
+			s.current.playlistID = 0
+			return nil, errNoEntry
+		}
+		return nil, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Error while retrieving the current playlist entry",
+			err,
+		)
+	}
+	return entry, nil
+}
+
+// SetCurrentMainEntry marks the given entry of the main playlist as the one playing right now
+func (s *playlistService) SetCurrentMainEntry(ctx context.Context, entryID uint) (*models.PlaylistVideoEntry, error) {
+	mainID := s.events.DefaultPlaylistID(ctx)
+	if mainID == 0 {
+		return nil, ErrNoCurrentEvent
+	}
+	plEntry, err := s.repo.GetEntryByID(entryID)
+	if err == nil && plEntry.PlaylistID != mainID {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			fmt.Sprintf("Playlist entry #%d is not part of the main playlist", entryID),
+		)
+	}
+	var entry *models.PlaylistVideoEntry
+	if err == nil {
+		entry, err = s.repo.GetVideoEntryByID(entryID)
+	}
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return nil, MakeError(
+				http.StatusNotFound,
+				ErrCodePlaylistEntryNotFound,
+				fmt.Sprintf("Playlist entry #%d does not exist", entryID),
+			)
+		}
+		return nil, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while retrieving playlist entry #%d", entryID),
+			err,
+		)
+	}
+	s.current.Lock()
+	s.current.entryID = entryID
+	s.current.playlistID = mainID
+	s.current.Unlock()
+	return entry, nil
+}
+
+// EstimatedWait estimates the time until the given entry of the main playlist will be played by summing up the
+// durations of the unplayed entries ahead of it. Videos whose duration is unknown are assumed to take the configured
+// average song length. Entries that have already been played do not have to wait at all
+func (s *playlistService) EstimatedWait(ctx context.Context, entryID uint) (time.Duration, error) {
+	mainID := s.events.DefaultPlaylistID(ctx)
+	if mainID == 0 {
+		return 0, ErrNoCurrentEvent
+	}
+	entry, err := s.repo.GetEntryByID(entryID)
+	if err == nil && entry.PlaylistID != mainID {
+		err = repos.ErrEntityNotExisting
+	}
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return 0, MakeError(
+				http.StatusNotFound,
+				ErrCodePlaylistEntryNotFound,
+				fmt.Sprintf("Playlist entry #%d does not exist on the main playlist", entryID),
+			)
+		}
+		return 0, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while retrieving playlist entry #%d", entryID),
+			err,
+		)
+	}
+	if entry.PlayedAt != nil {
+		return 0, nil
+	}
+	wait, numUnknown, err := s.repo.GetDurationAhead(entryID)
+	if err != nil {
+		return 0, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while estimating the waiting time for playlist entry #%d", entryID),
+			err,
+		)
+	}
+	avg := s.config.GetConfig(ctx).AverageSongLength
+	if avg == 0 {
+		avg = models.DefaultAverageSongLength
+	}
+	return wait + time.Duration(numUnknown*avg)*time.Second, nil
+}
+
+// EntryPosition returns the 1-based position of the given entry inside the queue of its playlist - the way the entries
+// are listed, but only counting approved entries that have not been played, yet - together with the total number of
+// entries in the queue
+func (s *playlistService) EntryPosition(ctx context.Context, entryID uint) (uint, uint, error) {
+	position, total, err := s.repo.GetEntryRank(entryID)
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return 0, 0, MakeError(
+				http.StatusNotFound,
+				ErrCodePlaylistEntryNotFound,
+				fmt.Sprintf("Playlist entry #%d does not exist", entryID),
+			)
+		}
+		return 0, 0, MakeErrorWithData(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			fmt.Sprintf("Error while retrieving the position of playlist entry #%d", entryID),
+			err,
+		)
+	}
+	return position, total, nil
 }
 
 // AddMainEntry adds a playlist entry to the main playlist for the currently active event
@@ -395,7 +1243,31 @@ func (s *playlistService) AddMainEntry(ctx context.Context, entry *models.Playli
 			"The playlist is locked for adding new entries",
 		)
 	}
+	if err := checkNote(entry.Note); err != nil {
+		return err
+	}
+	if s.config.IsBanned(entry.RequesterIP) && !s.config.IsWhitelisted(entry.RequesterIP) {
+		return MakeError(
+			http.StatusForbidden,
+			ErrCodeIPBanned,
+			"You are not allowed to add any wishes",
+		)
+	}
 	conf := s.config.GetConfig(ctx)
+	// Check if the wishlist is full - this also applies to whitelisted IPs
+	if limit := conf.Restrictions.MaxTotalWishes; limit > 0 {
+		count, err := s.repo.GetUnplayedEntryCount(mainID)
+		if err != nil {
+			return err
+		}
+		if count >= limit {
+			return MakeError(
+				http.StatusForbidden,
+				ErrCodeWishlistFull,
+				"The wishlist is full - please try again after some of the wishes have been played",
+			)
+		}
+	}
 	// Check if the video has already been added
 	if !conf.Restrictions.AllowDuplicateWishes {
 		count, err := s.repo.GetEntryCountByVideo(s.events.DefaultPlaylistID(ctx), entry.VideoHash)
@@ -424,7 +1296,53 @@ func (s *playlistService) AddMainEntry(ctx context.Context, entry *models.Playli
 				"You cannot add another wish, greedy one",
 			)
 		}
+		if cooldown := time.Duration(conf.Restrictions.WishCooldownSeconds) * time.Second; cooldown > 0 {
+			last, err := s.repo.GetLastEntryTimeByIP(mainID, entry.RequesterIP)
+			if err != nil {
+				return err
+			}
+			if last != nil {
+				if wait := cooldown - time.Since(*last); wait > 0 {
+					seconds := int64((wait + time.Second - 1) / time.Second)
+					return MakeErrorWithData(
+						http.StatusTooManyRequests,
+						ErrCodeWishCooldown,
+						fmt.Sprintf("Please wait %d more seconds before adding another wish", seconds),
+						map[string]int64{"retryAfter": seconds},
+					)
+				}
+			}
+		}
+		if limit := conf.Restrictions.NumWishesPerVideoFromSameIP; limit > 0 {
+			count, err := s.repo.GetEntryCountByIPAndVideo(mainID, entry.RequesterIP, entry.VideoHash)
+			if err != nil {
+				return err
+			}
+			if count >= limit {
+				return MakeError(
+					http.StatusForbidden,
+					ErrCodeTooManyWishesForVideo,
+					"You have already wished for this video - how about another one?",
+				)
+			}
+		}
 	}
 
-	return s.AddEntry(ctx, mainID, entry)
+	entry.Status = models.EntryStatusApproved
+	if conf.Restrictions.RequireApproval && !s.config.IsWhitelisted(entry.RequesterIP) {
+		entry.Status = models.EntryStatusPending
+	}
+	if err := s.addEntry(ctx, mainID, entry, nil); err != nil {
+		return err
+	}
+	if eventID := s.events.CurrentEventID(ctx); eventID != 0 {
+		if err := s.statsRepo.BumpNumRequested(eventID, entry.VideoHash); err != nil {
+			// Do not report the error back, but log it!
+			s.logger.WithError(err).WithField(log.FldVideo, entry.VideoHash).Error("Failed to update event statistics for video")
+		}
+		if err := s.statsRepo.AddRequester(eventID, entry.RequesterIP); err != nil {
+			s.logger.WithError(err).WithField(log.FldIP, entry.RequesterIP).Error("Failed to update event statistics for requester")
+		}
+	}
+	return nil
 }
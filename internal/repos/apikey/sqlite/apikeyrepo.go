@@ -0,0 +1,83 @@
+// Package sqlite provides an API key repository that stores its data inside a SQLite database
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/derWhity/kyabia/internal/log"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	apiKeyFields = `name, prefix, keyHash, permissions, createdAt`
+)
+
+// APIKeyRepo is a repository that stores its data inside a SQLite database
+type APIKeyRepo struct {
+	db     *sqlx.DB
+	logger *logrus.Entry
+}
+
+// New creates a new API key repository instance with the given database and logger
+func New(db *sqlx.DB, logger *logrus.Entry) *APIKeyRepo {
+	return &APIKeyRepo{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create stores a new API key
+func (r *APIKeyRepo) Create(k *models.APIKey) error {
+	r.logger.WithField("name", k.Name).Debug("Adding new API key")
+	query := fmt.Sprintf("INSERT INTO ApiKeys(%s) VALUES(?, ?, ?, ?, ?)", apiKeyFields)
+	res, err := r.db.Exec(query, k.Name, k.Prefix, k.KeyHash, k.Permissions, k.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Create: Failed to store API key: %v", err)
+	}
+	var id int64
+	if id, err = res.LastInsertId(); err == nil {
+		k.ID = uint(id)
+	}
+	return err
+}
+
+// Delete removes an API key
+func (r *APIKeyRepo) Delete(id uint) error {
+	r.logger.WithField(log.FldID, id).Debug("Deleting API key")
+	res, err := r.db.Exec("DELETE FROM ApiKeys WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("Delete: Failed to remove API key: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
+// List returns all API keys ordered by their name
+func (r *APIKeyRepo) List() ([]models.APIKey, error) {
+	ret := []models.APIKey{}
+	query := fmt.Sprintf("SELECT id, %s FROM ApiKeys ORDER BY name, id", apiKeyFields)
+	if err := r.db.Select(&ret, query); err != nil {
+		return nil, fmt.Errorf("List: Failed to query API keys: %v", err)
+	}
+	return ret, nil
+}
+
+// GetByHash returns the API key with the given key hash
+func (r *APIKeyRepo) GetByHash(keyHash string) (*models.APIKey, error) {
+	query := fmt.Sprintf("SELECT id, %s FROM ApiKeys WHERE keyHash = ?", apiKeyFields)
+	var k models.APIKey
+	if err := r.db.Get(&k, query, keyHash); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrEntityNotExisting
+		}
+		return nil, fmt.Errorf("GetByHash: Failed to load API key: %v", err)
+	}
+	return &k, nil
+}
@@ -0,0 +1,70 @@
+// Package sqlite provides an audit log repository that stores its data inside a SQLite database
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/derWhity/kyabia/internal/log"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	auditFields = `userId, userName, action, target, detail, createdAt`
+)
+
+// AuditRepo is a repository that stores its data inside a SQLite database
+type AuditRepo struct {
+	db     *sqlx.DB
+	logger *logrus.Entry
+}
+
+// New creates a new audit log repository instance with the given database and logger
+func New(db *sqlx.DB, logger *logrus.Entry) *AuditRepo {
+	return &AuditRepo{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Add adds a new entry to the audit log
+func (r *AuditRepo) Add(e *models.AuditEntry) error {
+	query := fmt.Sprintf("INSERT INTO AuditLog(%s) VALUES(?, ?, ?, ?, ?, ?)", auditFields)
+	res, err := r.db.Exec(query, e.UserID, e.UserName, e.Action, e.Target, e.Detail, e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Add: Failed to store audit log entry: %v", err)
+	}
+	var id int64
+	if id, err = res.LastInsertId(); err == nil {
+		e.ID = uint(id)
+	}
+	return err
+}
+
+// Find searches for audit log entries whose action, target or user name match the given search string - the newest
+// entries first. Supports pagination
+func (r *AuditRepo) Find(search string, offset uint, limit uint) ([]models.AuditEntry, uint, error) {
+	if limit == 0 {
+		limit = 50
+	}
+	r.logger.WithFields(logrus.Fields{
+		log.FldSearch: search,
+		log.FldOffset: offset,
+		log.FldLimit:  limit,
+	}).Debug("Searching for audit log entries")
+	search = repos.LikePattern(search)
+	where := `action LIKE $1 ESCAPE '\' OR target LIKE $1 ESCAPE '\' OR userName LIKE $1 ESCAPE '\'`
+	query := fmt.Sprintf(`SELECT id, %s FROM AuditLog WHERE %s ORDER BY id DESC LIMIT $2 OFFSET $3`, auditFields, where)
+	ret := []models.AuditEntry{}
+	if err := r.db.Select(&ret, query, search, limit, offset); err != nil {
+		return nil, 0, fmt.Errorf("Find: Failed to query audit log: %v", err)
+	}
+	var numRows uint
+	if err := r.db.Get(&numRows, "SELECT COUNT(*) FROM AuditLog WHERE "+where, search); err != nil {
+		return nil, 0, fmt.Errorf("Find: Failed to count audit log entries: %v", err)
+	}
+	return ret, numRows, nil
+}
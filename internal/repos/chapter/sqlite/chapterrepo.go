@@ -0,0 +1,63 @@
+// Package sqlite provides a chapter repository that uses SQLite for storing the chapter markers of videos
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/derWhity/kyabia/internal/log"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// The field names in the chapter table
+	fieldNames = `videoHash, chapterIndex, title, startsAt, endsAt`
+)
+
+// ChapterRepo implements kyabia.ChapterRepo and provides access to chapter data stored inside a SQLite database
+type ChapterRepo struct {
+	logger *logrus.Entry
+	db     *sqlx.DB
+}
+
+// New creates a new ChapterRepo
+func New(db *sqlx.DB, logger *logrus.Entry) repos.ChapterRepo {
+	return &ChapterRepo{logger, db}
+}
+
+// GetByVideo returns the chapters of the video with the given hash ordered by their index
+func (r *ChapterRepo) GetByVideo(videoHash string) ([]models.VideoChapter, error) {
+	r.logger.WithField(log.FldVideo, videoHash).Debug("Loading chapters")
+	query := fmt.Sprintf("SELECT %s FROM Chapters WHERE videoHash = ? ORDER BY chapterIndex", fieldNames)
+	ret := []models.VideoChapter{}
+	if err := r.db.Select(&ret, query, videoHash); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// SetForVideo replaces all chapters of the video with the given hash by the chapters provided
+// The video hash of the chapters is overwritten with the given one
+func (r *ChapterRepo) SetForVideo(videoHash string, chapters []models.VideoChapter) error {
+	r.logger.WithField(log.FldVideo, videoHash).Debugf("Storing %d chapter(s)", len(chapters))
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("SetForVideo: Failed to start transaction: %v", err)
+	}
+	query := "DELETE FROM Chapters WHERE videoHash = ?"
+	if _, err = tx.Exec(query, videoHash); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("SetForVideo: Failed to remove existing chapters: %v", err))
+	}
+	query = fmt.Sprintf("INSERT INTO Chapters(%s) VALUES(?, ?, ?, ?, ?)", fieldNames)
+	for _, ch := range chapters {
+		if _, err = tx.Exec(query, videoHash, ch.Index, ch.Title, ch.Start, ch.End); err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("SetForVideo: Failed to add chapter #%d: %v", ch.Index, err))
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("SetForVideo: Failed to commit transaction: %v", err)
+	}
+	return nil
+}
@@ -15,7 +15,7 @@ import (
 )
 
 const (
-	eventFields = `name, description, defaultPlaylist, startsAt, endsAt, createdAt, updatedAt`
+	eventFields = `name, description, notes, defaultPlaylist, startsAt, endsAt, createdAt, updatedAt`
 )
 
 // EventRepo is an repository that stores its data inside a SQLite database
@@ -35,8 +35,8 @@ func New(db *sqlx.DB, logger *logrus.Entry) *EventRepo {
 // Create creates a new event
 func (r *EventRepo) Create(ev *models.Event) error {
 	r.logger.WithField("name", ev.Name).Debug("Adding new event")
-	query := fmt.Sprintf("INSERT INTO Events(%s) VALUES(?, ?, ?, ?, ?, datetime('now'), datetime('now'))", eventFields)
-	res, err := r.db.Exec(query, ev.Name, ev.Description, ev.MainPlaylistID, ev.StartsAt, ev.EndsAt)
+	query := fmt.Sprintf("INSERT INTO Events(%s) VALUES(?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))", eventFields)
+	res, err := r.db.Exec(query, ev.Name, ev.Description, ev.Notes, ev.MainPlaylistID, ev.StartsAt, ev.EndsAt)
 	if err != nil {
 		return err
 	}
@@ -53,9 +53,9 @@ func (r *EventRepo) Create(ev *models.Event) error {
 // Update updates the given event
 func (r *EventRepo) Update(ev *models.Event) error {
 	r.logger.WithField(log.FldID, ev.ID).Debug("Updating event")
-	query := `UPDATE Events SET name = ?, description = ?, defaultPlaylist = ?, startsAt = ?, endsAt = ?, 
+	query := `UPDATE Events SET name = ?, description = ?, notes = ?, defaultPlaylist = ?, startsAt = ?, endsAt = ?, 
         updatedAt = datetime('now') WHERE id = ?`
-	res, err := r.db.Exec(query, ev.Name, ev.Description, ev.MainPlaylistID, ev.StartsAt, ev.EndsAt, ev.ID)
+	res, err := r.db.Exec(query, ev.Name, ev.Description, ev.Notes, ev.MainPlaylistID, ev.StartsAt, ev.EndsAt, ev.ID)
 	if err != nil {
 		return err
 	}
@@ -113,6 +113,51 @@ func (r *EventRepo) GetByDate(date time.Time) ([]models.Event, error) {
 	return ret, nil
 }
 
+// GetOverlapping returns the events whose time span overlaps with the given one - except for the event with the given
+// ID. Events ending exactly when the other one starts do not overlap
+func (r *EventRepo) GetOverlapping(startsAt time.Time, endsAt time.Time, excludeID uint) ([]models.Event, error) {
+	query := fmt.Sprintf(
+		`SELECT id, %s FROM Events WHERE startsAt < $1 AND endsAt > $2 AND id <> $3 ORDER BY startsAt, id`,
+		eventFields,
+	)
+	var ret []models.Event
+	if err := r.db.Select(&ret, query, endsAt, startsAt, excludeID); err != nil {
+		return nil, fmt.Errorf("GetOverlapping: Failed to query database: %v", err)
+	}
+	return ret, nil
+}
+
+// FindOverlaps returns all pairs of events whose time spans overlap - ordered by the start of the first event
+func (r *EventRepo) FindOverlaps() ([]models.EventOverlap, error) {
+	query := `SELECT a.id AS firstId, b.id AS secondId FROM Events a
+			JOIN Events b ON b.id <> a.id AND b.startsAt < a.endsAt AND b.endsAt > a.startsAt
+				AND (a.startsAt < b.startsAt OR (a.startsAt = b.startsAt AND a.id < b.id))
+			ORDER BY a.startsAt, a.id, b.startsAt, b.id`
+	var pairs []struct {
+		FirstID  uint `db:"firstId"`
+		SecondID uint `db:"secondId"`
+	}
+	if err := r.db.Select(&pairs, query); err != nil {
+		return nil, fmt.Errorf("FindOverlaps: Failed to query database: %v", err)
+	}
+	ret := make([]models.EventOverlap, 0, len(pairs))
+	events := map[uint]*models.Event{}
+	for _, pair := range pairs {
+		for _, id := range []uint{pair.FirstID, pair.SecondID} {
+			if _, ok := events[id]; ok {
+				continue
+			}
+			ev, err := r.GetByID(id)
+			if err != nil {
+				return nil, fmt.Errorf("FindOverlaps: Failed to load event #%d: %v", id, err)
+			}
+			events[id] = ev
+		}
+		ret = append(ret, models.EventOverlap{First: *events[pair.FirstID], Second: *events[pair.SecondID]})
+	}
+	return ret, nil
+}
+
 // Find searches for events mathing the given search string - supports pagination
 func (r *EventRepo) Find(search string, offset uint, limit uint) ([]models.Event, uint, error) {
 	if limit == 0 {
@@ -124,9 +169,9 @@ func (r *EventRepo) Find(search string, offset uint, limit uint) ([]models.Event
 		log.FldLimit:  limit,
 	}).Debug("Searching for event")
 	// For now, we're using a simple LIKE search
-	search = "%" + search + "%"
+	search = repos.LikePattern(search)
 	query := fmt.Sprintf(`SELECT id, %s FROM Events WHERE
-        name LIKE $1 OR description LIKE $1
+        name LIKE $1 ESCAPE '\' OR description LIKE $1 ESCAPE '\'
         LIMIT $2 OFFSET $3`, eventFields)
 	var ret []models.Event
 	err := r.db.Select(&ret, query, search, limit, offset)
@@ -134,7 +179,7 @@ func (r *EventRepo) Find(search string, offset uint, limit uint) ([]models.Event
 		return nil, 0, err
 	}
 	// Query the full count
-	query = `SELECT COUNT(*) FROM Events WHERE name LIKE $1 OR description LIKE $1`
+	query = `SELECT COUNT(*) FROM Events WHERE name LIKE $1 ESCAPE '\' OR description LIKE $1 ESCAPE '\'`
 	var numRows uint
 	if err = r.db.Get(&numRows, query, search); err != nil {
 		return nil, 0, err
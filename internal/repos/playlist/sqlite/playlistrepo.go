@@ -4,6 +4,7 @@ package sqlite
 import (
 	"database/sql"
 	"fmt"
+	"math/rand"
 	"strings"
 	"time"
 
@@ -32,11 +33,25 @@ const (
 						Events ev
 					ON
 						ev.defaultPlaylist = pl.id`
-	playlistEntryFields      = `videoHash, position, requestedBy, requesterIp, createdAt, updatedAt`
+	playlistEntryFields      = `videoHash, position, requestedBy, requesterIp, note, status, createdAt, updatedAt`
 	playlistReorderFields    = `id, playlistId`
-	fullPlaylistEntryFields  = `id, playlistId, position, videoHash, requestedBy, requesterIp, createdAt, updatedAt`
-	playlistVideoEntryFields = `id, videoHash, requestedBy, createdAt, updatedAt`
+	fullPlaylistEntryFields  = `id, playlistId, position, videoHash, requestedBy, requesterIp, note, status, priority, createdAt, updatedAt, playedAt`
+	playlistVideoEntryFields = `id, videoHash, requestedBy, note, status, priority, createdAt, updatedAt, playedAt`
 	videoFields              = `sha512, title, artist, language, relatedMedium, mediumDetail, description, duration, identifier`
+	// Distance between the positions of two neighbouring entries after adding or rebalancing them. Moving an entry
+	// places it in the middle of the gap between its new neighbours, so the gap allows for several moves into the same
+	// spot before the playlist needs to be rebalanced
+	positionGap = 1024
+	// Subquery calculating the position for a new entry at the end of a playlist - leaving a gap of positionGap
+	nextPositionQuery = `(SELECT IFNULL(MAX(position), 0) + 1024 FROM PlaylistEntries WHERE playlistId = ?)`
+	// Number of entries renumbered by a single statement - each entry needs three query parameters, so this keeps the
+	// statements below SQLite's default limit of 999 parameters
+	positionBatchSize = 300
+	// The order entries are played in - entries with a higher priority come first, the others keep their manual order
+	entryOrder = `priority DESC, position, id`
+	// The condition matching all entries "pe" placed before the entry "e" in the order defined by entryOrder
+	entryAheadCondition = `pe.playlistId = e.playlistId AND (pe.priority > e.priority OR (pe.priority = e.priority
+		AND (pe.position < e.position OR (pe.position = e.position AND pe.id < e.id))))`
 )
 
 // entryMoveHelper is a data model used when moving playlist entries from one position in a playlist's order to another
@@ -45,6 +60,13 @@ type reorderHelper struct {
 	PlaylistID uint `db:"playlistId"`
 }
 
+// positionHelper is a data model used when exchanging the positions of playlist entries
+type positionHelper struct {
+	reorderHelper
+	Position int64 `db:"position"`
+	Priority int   `db:"priority"`
+}
+
 // Helper struct to get the count of things
 type countHelper struct {
 	Count uint `db:"count"`
@@ -155,9 +177,9 @@ func (r *PlaylistRepo) Find(search string, offset uint, limit uint) ([]models.Pl
 		log.FldLimit:  limit,
 	}).Debug("Searching for playlist")
 	// For now, we're using a simple LIKE search
-	search = "%" + search + "%"
+	search = repos.LikePattern(search)
 	query := fmt.Sprintf(`%s WHERE
-        pl.name LIKE $1
+        pl.name LIKE $1 ESCAPE '\'
         LIMIT $2 OFFSET $3`, playlistSelect)
 	var ret []models.Playlist
 	err := r.db.Select(&ret, query, search, limit, offset)
@@ -166,7 +188,7 @@ func (r *PlaylistRepo) Find(search string, offset uint, limit uint) ([]models.Pl
 		return nil, 0, err
 	}
 	// Query the full count
-	query = `SELECT COUNT(*) FROM Playlists WHERE name = ?`
+	query = `SELECT COUNT(*) FROM Playlists WHERE name LIKE $1 ESCAPE '\'`
 	var numRows uint
 	if err = r.db.Get(&numRows, query, search); err != nil {
 		return nil, 0, err
@@ -177,10 +199,11 @@ func (r *PlaylistRepo) Find(search string, offset uint, limit uint) ([]models.Pl
 // AddEntry adds an entry to an existing playlist
 func (r *PlaylistRepo) AddEntry(playlistID uint, entry *models.PlaylistEntry) error {
 	query := fmt.Sprintf(
-		"INSERT INTO PlaylistEntries(playlistId, %s) VALUES(?, ?, -1, ?, ?, datetime('now'), datetime('now'))",
+		"INSERT INTO PlaylistEntries(playlistId, %s) VALUES(?, ?, %s, ?, ?, ?, ?, datetime('now'), datetime('now'))",
 		playlistEntryFields,
+		nextPositionQuery,
 	)
-	res, err := r.db.Exec(query, playlistID, entry.VideoHash, entry.RequestedBy, entry.RequesterIP)
+	res, err := r.db.Exec(query, playlistID, entry.VideoHash, playlistID, entry.RequestedBy, entry.RequesterIP, entry.Note, entry.Status)
 	if err != nil {
 		return fmt.Errorf("AddEntry: Failed to create entry: %v", err)
 	}
@@ -189,11 +212,75 @@ func (r *PlaylistRepo) AddEntry(playlistID uint, entry *models.PlaylistEntry) er
 		return fmt.Errorf("AddEntry: Failed to retrieve last insert ID: %v", err)
 	}
 	entry.ID = uint(id)
-	// Set the position of all unsorted playlist entries to their ID - this way they should be the last entry in their
-	// list
-	query = "UPDATE PlaylistEntries SET position = id WHERE position < 0"
-	if _, err = r.db.Exec(query); err != nil {
-		return fmt.Errorf("AddEntry: Failed to reposition playlist entries: %v", err)
+	return nil
+}
+
+// InsertEntry adds an entry to an existing playlist at the given index - moving the entry at this index and all the
+// following ones one step down. If the index lies beyond the end of the playlist, the entry is appended
+// The index refers to the order defined by entryOrder. Since the new entry has no priority, an index pointing at a
+// prioritized entry places the new entry right behind all prioritized entries
+func (r *PlaylistRepo) InsertEntry(playlistID uint, entry *models.PlaylistEntry, index uint) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("InsertEntry: Unable to start transaction: %v", err)
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO PlaylistEntries(playlistId, %s) VALUES(?, ?, %s, ?, ?, ?, ?, datetime('now'), datetime('now'))",
+		playlistEntryFields,
+		nextPositionQuery,
+	)
+	res, err := tx.Exec(query, playlistID, entry.VideoHash, playlistID, entry.RequestedBy, entry.RequesterIP, entry.Note, entry.Status)
+	if err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("InsertEntry: Failed to create entry: %v", err))
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("InsertEntry: Failed to retrieve last insert ID: %v", err))
+	}
+	// Find the entry currently occupying the index
+	var otherEntryID uint
+	query = `SELECT id FROM PlaylistEntries WHERE playlistId = ? AND id <> ? ORDER BY ` + entryOrder + ` LIMIT 1 OFFSET ?`
+	if err = tx.Get(&otherEntryID, query, playlistID, id, index); err != nil && err != sql.ErrNoRows {
+		return repos.DoRollback(tx, fmt.Errorf("InsertEntry: Failed to load the entry at index %d: %v", index, err))
+	}
+	if otherEntryID != 0 {
+		helper := &reorderHelper{EntryID: uint(id), PlaylistID: playlistID}
+		if err = placeBefore(tx, helper, otherEntryID); err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("InsertEntry: %v", err))
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("InsertEntry: Failed to commit transaction: %v", err)
+	}
+	entry.ID = uint(id)
+	return nil
+}
+
+// AddEntries adds multiple entries to the end of an existing playlist in the given order. The entries are added inside
+// a single transaction - so either all or none of them are added
+func (r *PlaylistRepo) AddEntries(playlistID uint, entries []*models.PlaylistEntry) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("AddEntries: Unable to start transaction: %v", err)
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO PlaylistEntries(playlistId, %s) VALUES(?, ?, %s, ?, ?, ?, ?, datetime('now'), datetime('now'))",
+		playlistEntryFields,
+		nextPositionQuery,
+	)
+	for _, entry := range entries {
+		res, err := tx.Exec(query, playlistID, entry.VideoHash, playlistID, entry.RequestedBy, entry.RequesterIP, entry.Note, entry.Status)
+		if err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("AddEntries: Failed to create entry: %v", err))
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("AddEntries: Failed to retrieve last insert ID: %v", err))
+		}
+		entry.ID = uint(id)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("AddEntries: Failed to commit transaction: %v", err)
 	}
 	return nil
 }
@@ -231,6 +318,95 @@ func (r *PlaylistRepo) RemoveEntry(entryID uint) error {
 	return err
 }
 
+// MergeEntries moves all entries of the source playlist to the end of the target playlist - keeping their order - and
+// returns the number of entries moved. If deleteSource is set, the source playlist is removed afterwards. Everything is
+// done inside a single transaction
+func (r *PlaylistRepo) MergeEntries(sourceID uint, targetID uint, deleteSource bool) (uint, error) {
+	r.logger.WithField("source", sourceID).WithField("target", targetID).Debug("Merging playlist entries")
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("MergeEntries: Unable to start transaction: %v", err)
+	}
+	var ids []uint
+	query := `SELECT id FROM PlaylistEntries WHERE playlistId = ? ORDER BY ` + entryOrder
+	if err = tx.Select(&ids, query, sourceID); err != nil {
+		return 0, repos.DoRollback(tx, fmt.Errorf("MergeEntries: Failed to load playlist entries: %v", err))
+	}
+	var last int64
+	query = `SELECT IFNULL(MAX(position), 0) FROM PlaylistEntries WHERE playlistId = ?`
+	if err = tx.Get(&last, query, targetID); err != nil {
+		return 0, repos.DoRollback(tx, fmt.Errorf("MergeEntries: Failed to load the last playlist position: %v", err))
+	}
+	query = `UPDATE PlaylistEntries SET playlistId = ?, updatedAt = datetime('now') WHERE playlistId = ?`
+	if _, err = tx.Exec(query, targetID, sourceID); err != nil {
+		return 0, repos.DoRollback(tx, fmt.Errorf("MergeEntries: Failed to move playlist entries: %v", err))
+	}
+	if err = writePositions(tx, ids, last); err != nil {
+		return 0, repos.DoRollback(tx, fmt.Errorf("MergeEntries: %v", err))
+	}
+	if deleteSource {
+		if _, err = tx.Exec("DELETE FROM Playlists WHERE id = ?", sourceID); err != nil {
+			return 0, repos.DoRollback(tx, fmt.Errorf("MergeEntries: Failed to remove the source playlist: %v", err))
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("MergeEntries: Failed to commit transaction: %v", err)
+	}
+	return uint(len(ids)), nil
+}
+
+// CopyEntries copies all approved entries of the source playlist to the target playlist as unplayed entries and
+// returns the number of entries copied. The copies keep their order, but are not associated with the IP addresses of
+// the original requesters. The source playlist stays untouched
+func (r *PlaylistRepo) CopyEntries(sourceID uint, targetID uint) (uint, error) {
+	r.logger.WithField("source", sourceID).WithField("target", targetID).Debug("Copying playlist entries")
+	query := `INSERT INTO PlaylistEntries
+				(playlistId, videoHash, position, requestedBy, requesterIp, note, status, priority, createdAt, updatedAt)
+			SELECT ?, videoHash, position, requestedBy, '', note, status, priority, datetime('now'), datetime('now')
+			FROM PlaylistEntries WHERE playlistId = ? AND status = ?
+			ORDER BY ` + entryOrder
+	res, err := r.db.Exec(query, targetID, sourceID, models.EntryStatusApproved)
+	if err != nil {
+		return 0, fmt.Errorf("CopyEntries: Failed to copy playlist entries: %v", err)
+	}
+	num, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("CopyEntries: Failed to count copied playlist entries: %v", err)
+	}
+	return uint(num), nil
+}
+
+// RemovePlayedEntries removes all entries of the given playlist that have been played and returns the number of entries
+// removed. The remaining entries keep their positions
+func (r *PlaylistRepo) RemovePlayedEntries(playlistID uint) (uint, error) {
+	r.logger.WithField("playlist", playlistID).Debug("Removing played playlist entries")
+	res, err := r.db.Exec("DELETE FROM PlaylistEntries WHERE playlistId = ? AND playedAt IS NOT NULL", playlistID)
+	if err != nil {
+		return 0, fmt.Errorf("RemovePlayedEntries: Failed to remove entries: %v", err)
+	}
+	num, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("RemovePlayedEntries: Failed to get number of removed entries: %v", err)
+	}
+	return uint(num), nil
+}
+
+// RemovePendingEntriesByIP removes all entries of the given playlist that have been added by the given IP address and
+// not been played, yet. Returns the number of entries removed
+func (r *PlaylistRepo) RemovePendingEntriesByIP(playlistID uint, ipAddr string) (uint, error) {
+	r.logger.WithField("playlist", playlistID).WithField("ip", ipAddr).Debug("Removing pending playlist entries by IP")
+	query := "DELETE FROM PlaylistEntries WHERE playlistId = ? AND requesterIp = ? AND playedAt IS NULL"
+	res, err := r.db.Exec(query, playlistID, ipAddr)
+	if err != nil {
+		return 0, fmt.Errorf("RemovePendingEntriesByIP: Failed to remove entries: %v", err)
+	}
+	num, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("RemovePendingEntriesByIP: Failed to get number of removed entries: %v", err)
+	}
+	return uint(num), nil
+}
+
 // UpdateEntry updates an entry - mainly used for internal updating
 func (r *PlaylistRepo) UpdateEntry(entry *models.PlaylistEntry) error {
 	r.logger.WithField(log.FldID, entry.ID).Debug("Updating playlist entry")
@@ -240,9 +416,10 @@ func (r *PlaylistRepo) UpdateEntry(entry *models.PlaylistEntry) error {
 				playlistId = ?,
 				videoHash = ?,
 				requestedBy = ?,
+				note = ?,
 				updatedAt = datetime('now')
 			WHERE id = ?`
-	res, err := r.db.Exec(query, entry.PlaylistID, entry.VideoHash, entry.RequestedBy, entry.ID)
+	res, err := r.db.Exec(query, entry.PlaylistID, entry.VideoHash, entry.RequestedBy, entry.Note, entry.ID)
 	if err != nil {
 		return fmt.Errorf("UpdateEntry: Failed to update entry in database: %v", err)
 	}
@@ -252,42 +429,292 @@ func (r *PlaylistRepo) UpdateEntry(entry *models.PlaylistEntry) error {
 	return nil
 }
 
+// SetEntryPriority sets the priority of the given entry
+func (r *PlaylistRepo) SetEntryPriority(entryID uint, priority int) error {
+	r.logger.WithField(log.FldID, entryID).WithField("priority", priority).Debug("Setting playlist entry priority")
+	query := `UPDATE PlaylistEntries SET priority = ?, updatedAt = datetime('now') WHERE id = ?`
+	res, err := r.db.Exec(query, priority, entryID)
+	if err != nil {
+		return fmt.Errorf("SetEntryPriority: Failed to update entry in database: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
+// SetEntryStatus sets the approval status of the given entry
+func (r *PlaylistRepo) SetEntryStatus(entryID uint, status uint) error {
+	r.logger.WithField(log.FldID, entryID).WithField("status", status).Debug("Setting playlist entry status")
+	query := `UPDATE PlaylistEntries SET status = ?, updatedAt = datetime('now') WHERE id = ?`
+	res, err := r.db.Exec(query, status, entryID)
+	if err != nil {
+		return fmt.Errorf("SetEntryStatus: Failed to update entry in database: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
+// MarkEntryPlayed sets the time the video of the given entry has been played to now
+func (r *PlaylistRepo) MarkEntryPlayed(entryID uint) error {
+	r.logger.WithField(log.FldID, entryID).Debug("Marking playlist entry as played")
+	query := `UPDATE PlaylistEntries SET playedAt = datetime('now'), updatedAt = datetime('now') WHERE id = ?`
+	res, err := r.db.Exec(query, entryID)
+	if err != nil {
+		return fmt.Errorf("MarkEntryPlayed: Failed to update entry in database: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
+// GetTotalDuration returns the sum of the durations of all videos in the given playlist. Entries whose video has been
+// deleted are not counted
+func (r *PlaylistRepo) GetTotalDuration(playlistID uint) (time.Duration, error) {
+	query := `SELECT IFNULL(SUM(v.duration), 0)
+			FROM PlaylistEntries pe
+			LEFT JOIN Videos v ON v.sha512 = pe.videoHash AND v.deletedAt IS NULL
+			WHERE pe.playlistId = ?`
+	var total int64
+	if err := r.db.Get(&total, query, playlistID); err != nil {
+		return 0, fmt.Errorf("GetTotalDuration: Failed to query database: %v", err)
+	}
+	return time.Duration(total), nil
+}
+
+// GetDurationAhead returns the sum of the video durations of all approved and unplayed entries placed before the given
+// entry in its playlist - together with the number of those entries whose video has been deleted or has no duration
+func (r *PlaylistRepo) GetDurationAhead(entryID uint) (time.Duration, uint, error) {
+	query := `SELECT
+				IFNULL(SUM(v.duration), 0) AS duration,
+				IFNULL(SUM(CASE WHEN IFNULL(v.duration, 0) = 0 THEN 1 ELSE 0 END), 0) AS numUnknown
+			FROM PlaylistEntries e
+			JOIN PlaylistEntries pe ON ` + entryAheadCondition + `
+			LEFT JOIN Videos v ON v.sha512 = pe.videoHash AND v.deletedAt IS NULL
+			WHERE e.id = ? AND pe.playedAt IS NULL AND pe.status = ?`
+	var res struct {
+		Duration   int64 `db:"duration"`
+		NumUnknown uint  `db:"numUnknown"`
+	}
+	if err := r.db.Get(&res, query, entryID, models.EntryStatusApproved); err != nil {
+		return 0, 0, fmt.Errorf("GetDurationAhead: Failed to query database: %v", err)
+	}
+	return time.Duration(res.Duration), res.NumUnknown, nil
+}
+
+// GetEntryRank returns the 1-based rank of the given entry inside the queue of its playlist - together with the total
+// number of entries in the queue. Just like for GetDurationAhead, only approved entries that have not been played, yet
+// are counted. The entry itself is always part of the total
+func (r *PlaylistRepo) GetEntryRank(entryID uint) (uint, uint, error) {
+	query := `SELECT
+				(SELECT COUNT(*) FROM PlaylistEntries pe
+					WHERE ` + entryAheadCondition + ` AND pe.playedAt IS NULL AND pe.status = $1) + 1 AS entryRank,
+				(SELECT COUNT(*) FROM PlaylistEntries pe
+					WHERE pe.playlistId = e.playlistId AND (pe.id = e.id OR (pe.playedAt IS NULL AND pe.status = $1))
+				) AS total
+			FROM PlaylistEntries e
+			WHERE e.id = $2`
+	var res struct {
+		Rank  uint `db:"entryRank"`
+		Total uint `db:"total"`
+	}
+	if err := r.db.Get(&res, query, models.EntryStatusApproved, entryID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, 0, repos.ErrEntityNotExisting
+		}
+		return 0, 0, fmt.Errorf("GetEntryRank: Failed to query database: %v", err)
+	}
+	return res.Rank, res.Total, nil
+}
+
+// GetTopRequesters returns the given number of requester names that added the most entries to the given playlist.
+// Names are compared case-insensitively and without surrounding whitespace. Entries without a requester name, rejected
+// entries and entries added from one of the excluded IP addresses are not counted
+func (r *PlaylistRepo) GetTopRequesters(playlistID uint, excludedIPs []string, limit uint) ([]models.Requester, error) {
+	params := []interface{}{playlistID, models.EntryStatusRejected}
+	ipCondition := ""
+	if len(excludedIPs) > 0 {
+		ipCondition = fmt.Sprintf(" AND requesterIp NOT IN (?%s)", strings.Repeat(", ?", len(excludedIPs)-1))
+		for _, ip := range excludedIPs {
+			params = append(params, ip)
+		}
+	}
+	params = append(params, limit)
+	query := `SELECT MIN(TRIM(requestedBy)) AS name, COUNT(*) AS numWishes FROM PlaylistEntries
+			WHERE playlistId = ? AND status <> ? AND TRIM(requestedBy) <> ''` + ipCondition + `
+			GROUP BY LOWER(TRIM(requestedBy))
+			ORDER BY numWishes DESC, MIN(createdAt)
+			LIMIT ?`
+	ret := []models.Requester{}
+	if err := r.db.Select(&ret, query, params...); err != nil {
+		return nil, fmt.Errorf("GetTopRequesters: Failed to query database: %v", err)
+	}
+	return ret, nil
+}
+
 // GetEntryCountByVideo returns the number of playlist entries in the given playlist having the given video selected
 func (r *PlaylistRepo) GetEntryCountByVideo(playlistID uint, videoHash string) (uint, error) {
-	query := `SELECT COUNT(*) as count FROM PlaylistEntries WHERE playlistId = ? AND videoHash = ?`
+	query := `SELECT COUNT(*) as count FROM PlaylistEntries WHERE playlistId = ? AND videoHash = ? AND status <> ?`
 	var c countHelper
-	err := r.db.Get(&c, query, playlistID, videoHash)
+	err := r.db.Get(&c, query, playlistID, videoHash, models.EntryStatusRejected)
 	if err != nil {
 		return 0, errors.Wrap(err, "GetEntryCountByIP: Failed to query database")
 	}
 	return c.Count, nil
 }
 
+// GetEntryCountByIPAndVideo returns the number of playlist entries in the given playlist added by the given IP address
+// having the given video selected
+func (r *PlaylistRepo) GetEntryCountByIPAndVideo(playlistID uint, ipAddr string, videoHash string) (uint, error) {
+	query := `SELECT COUNT(*) as count FROM PlaylistEntries
+			WHERE playlistId = ? AND requesterIp = ? AND videoHash = ? AND status <> ?`
+	var c countHelper
+	err := r.db.Get(&c, query, playlistID, ipAddr, videoHash, models.EntryStatusRejected)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetEntryCountByIPAndVideo: Failed to query database")
+	}
+	return c.Count, nil
+}
+
+// GetLastEntryTimeByIP returns the time the latest entry in the given playlist has been added by the given IP address -
+// or nil if there is none
+func (r *PlaylistRepo) GetLastEntryTimeByIP(playlistID uint, ipAddr string) (*time.Time, error) {
+	query := `SELECT createdAt FROM PlaylistEntries WHERE playlistId = ? AND requesterIp = ? ORDER BY createdAt DESC LIMIT 1`
+	var createdAt time.Time
+	if err := r.db.Get(&createdAt, query, playlistID, ipAddr); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "GetLastEntryTimeByIP: Failed to query database")
+	}
+	return &createdAt, nil
+}
+
+// GetUnplayedEntryCount returns the number of playlist entries in the given playlist that have not been played, yet.
+// Rejected entries are not counted
+func (r *PlaylistRepo) GetUnplayedEntryCount(playlistID uint) (uint, error) {
+	query := `SELECT COUNT(*) as count FROM PlaylistEntries WHERE playlistId = ? AND playedAt IS NULL AND status <> ?`
+	var c countHelper
+	err := r.db.Get(&c, query, playlistID, models.EntryStatusRejected)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetUnplayedEntryCount: Failed to query database")
+	}
+	return c.Count, nil
+}
+
 // GetEntryCountByIP returns the number of playlist entries in the given playlist added by the given IP address
 func (r *PlaylistRepo) GetEntryCountByIP(playlistID uint, ipAddr string) (uint, error) {
-	query := `SELECT COUNT(*) as count FROM PlaylistEntries WHERE playlistId = ? AND requesterIp = ?`
+	query := `SELECT COUNT(*) as count FROM PlaylistEntries WHERE playlistId = ? AND requesterIp = ? AND status <> ?`
 	var c countHelper
-	err := r.db.Get(&c, query, playlistID, ipAddr)
+	err := r.db.Get(&c, query, playlistID, ipAddr, models.EntryStatusRejected)
 	if err != nil {
 		return 0, errors.Wrap(err, "GetEntryCountByIP: Failed to query database")
 	}
 	return c.Count, nil
 }
 
-// GetEntries returns the entries for the given playlist and the number of entries for the full result - supports
-// pagination
-func (r *PlaylistRepo) GetEntries(playlistID uint, offset uint, limit uint) ([]models.PlaylistVideoEntry, uint, error) {
+// GetNextEntry returns the first entry of the given playlist that has not been played, yet - together with the details
+// of its video
+func (r *PlaylistRepo) GetNextEntry(playlistID uint) (*models.PlaylistVideoEntry, error) {
+	r.logger.WithField("playlist", playlistID).Debug("Loading next playlist entry")
+	query := fmt.Sprintf(
+		"SELECT %s FROM PlaylistEntries WHERE playlistId = ? AND playedAt IS NULL AND status = ? ORDER BY %s LIMIT 1",
+		playlistVideoEntryFields,
+		entryOrder,
+	)
+	var entry models.PlaylistVideoEntry
+	if err := r.db.Get(&entry, query, playlistID, models.EntryStatusApproved); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrEntityNotExisting
+		}
+		return nil, fmt.Errorf("GetNextEntry: Failed to load playlist entry: %v", err)
+	}
+	if err := r.loadVideoSummary(&entry); err != nil {
+		return nil, fmt.Errorf("GetNextEntry: %v", err)
+	}
+	return &entry, nil
+}
+
+// GetVideoEntryByID loads the playlist entry with the given ID together with the details of its video
+func (r *PlaylistRepo) GetVideoEntryByID(entryID uint) (*models.PlaylistVideoEntry, error) {
+	r.logger.WithField(log.FldID, entryID).Debug("Loading playlist entry with video")
+	query := fmt.Sprintf("SELECT %s FROM PlaylistEntries WHERE id = ?", playlistVideoEntryFields)
+	var entry models.PlaylistVideoEntry
+	if err := r.db.Get(&entry, query, entryID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrEntityNotExisting
+		}
+		return nil, fmt.Errorf("GetVideoEntryByID: Failed to load playlist entry: %v", err)
+	}
+	if err := r.loadVideoSummary(&entry); err != nil {
+		return nil, fmt.Errorf("GetVideoEntryByID: %v", err)
+	}
+	return &entry, nil
+}
+
+// loadVideoSummary loads the summary of the video referenced by the given entry - the video is left empty if it does
+// not exist anymore
+func (r *PlaylistRepo) loadVideoSummary(entry *models.PlaylistVideoEntry) error {
+	var vid models.VideoSummary
+	query := fmt.Sprintf("SELECT %s FROM Videos WHERE sha512 = ?", videoFields)
+	if err := r.db.Get(&vid, query, entry.VideoHash); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return fmt.Errorf("Failed to load video: %v", err)
+	}
+	entry.Video = &vid
+	return nil
+}
+
+// GetEntries returns the entries for the given playlist matching the filter and the number of entries for the full
+// result - supports pagination. If a search string is given, only the entries whose video title, artist or requester
+// contain it are returned
+func (r *PlaylistRepo) GetEntries(
+	playlistID uint,
+	search string,
+	filter repos.PlaylistEntryFilter,
+	offset uint,
+	limit uint,
+) ([]models.PlaylistVideoEntry, uint, error) {
 	if limit == 0 {
 		limit = 100
 	}
 	r.logger.WithFields(logrus.Fields{
 		"playlist":    playlistID,
+		log.FldSearch: search,
 		log.FldOffset: offset,
 		log.FldLimit:  limit,
 	}).Debug("Listing playlist entries")
-	query := fmt.Sprintf("SELECT %s FROM PlaylistEntries WHERE playlistId = ? ORDER BY position, id LIMIT ? OFFSET ?", playlistVideoEntryFields)
+	where := "playlistId = ?"
+	args := []interface{}{playlistID}
+	if filter.OnlyApproved {
+		where += " AND status = ?"
+		args = append(args, models.EntryStatusApproved)
+	}
+	if filter.RequestedBy != "" {
+		where += ` AND requestedBy LIKE ? ESCAPE '\'`
+		args = append(args, repos.LikePattern(filter.RequestedBy))
+	}
+	if search != "" {
+		// For now, we're using a simple LIKE search
+		where += ` AND (requestedBy LIKE ? ESCAPE '\' OR videoHash IN (
+			SELECT sha512 FROM Videos WHERE title LIKE ? ESCAPE '\' OR artist LIKE ? ESCAPE '\'
+		))`
+		pattern := repos.LikePattern(search)
+		args = append(args, pattern, pattern, pattern)
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM PlaylistEntries WHERE %s ORDER BY %s LIMIT ? OFFSET ?",
+		playlistVideoEntryFields,
+		where,
+		entryOrder,
+	)
 	var lst []models.PlaylistVideoEntry
-	err := r.db.Select(&lst, query, playlistID, limit, offset)
+	err := r.db.Select(&lst, query, append(args, limit, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -325,22 +752,127 @@ func (r *PlaylistRepo) GetEntries(playlistID uint, offset uint, limit uint) ([]m
 		}
 	}
 	// Query the full count
-	query = `SELECT COUNT(*) FROM PlaylistEntries WHERE playlistId = ?`
+	query = "SELECT COUNT(*) FROM PlaylistEntries WHERE " + where
 	var numRows uint
-	if err = r.db.Get(&numRows, query, playlistID); err != nil {
+	if err = r.db.Get(&numRows, query, args...); err != nil {
 		return nil, 0, err
 	}
 	return lst, numRows, nil
 }
 
+// Shuffle puts the entries of the given playlist into a random order. All positions are rewritten inside a single
+// transaction, so no entry gets lost or duplicated. The priority of the entries is kept, so prioritized entries stay
+// in front - only the entries sharing the same priority are shuffled among each other
+func (r *PlaylistRepo) Shuffle(playlistID uint) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("Shuffle: Unable to start transaction: %v", err)
+	}
+	var ids []uint
+	query := `SELECT id FROM PlaylistEntries WHERE playlistId = ? ORDER BY ` + entryOrder
+	if err = tx.Select(&ids, query, playlistID); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Shuffle: Failed to load playlist entries: %v", err))
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rnd.Shuffle(len(ids), func(i, j int) {
+		ids[i], ids[j] = ids[j], ids[i]
+	})
+	if err = writePositions(tx, ids, 0); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Shuffle: %v", err))
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("Shuffle: Failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
 // PlaceEntryBefore takes the playlist entry with the given ID and moves its position in the playlist to just before
 // the other entry provided
 // It otherEntryID is set to a value <= 0 or if the other entry is not found in the playlist of the first enty, the
 // entry will be placed at the end of the playlist
 func (r *PlaylistRepo) PlaceEntryBefore(entryID uint, otherEntryID uint) error {
+	return r.moveEntry("PlaceEntryBefore", entryID, func(_ *sqlx.Tx, _ *reorderHelper) (uint, error) {
+		return otherEntryID, nil
+	})
+}
+
+// SwapEntries exchanges the places of the two playlist entries with the given IDs in the play order inside a single
+// transaction - their priorities are exchanged together with their positions. Both entries have to belong to the same
+// playlist
+func (r *PlaylistRepo) SwapEntries(entryID uint, otherEntryID uint) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("SwapEntries: Unable to start transaction: %v", err)
+	}
+	var entries []positionHelper
+	query := `SELECT id, playlistId, position, priority FROM PlaylistEntries WHERE id IN (?, ?)`
+	if err = tx.Select(&entries, query, entryID, otherEntryID); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("SwapEntries: Failed to load playlist entries: %v", err))
+	}
+	if entryID == otherEntryID && len(entries) == 1 {
+		// Nothing to swap
+		return tx.Rollback()
+	}
+	if len(entries) != 2 {
+		return repos.DoRollback(tx, repos.ErrEntityNotExisting)
+	}
+	if entries[0].PlaylistID != entries[1].PlaylistID {
+		return repos.DoRollback(tx, fmt.Errorf(
+			"SwapEntries: Playlist entries #%d and #%d belong to different playlists",
+			entryID,
+			otherEntryID,
+		))
+	}
+	query = `UPDATE PlaylistEntries SET position = ?, priority = ? WHERE id = ?`
+	for i, entry := range entries {
+		other := entries[1-i]
+		if _, err = tx.Exec(query, other.Position, other.Priority, entry.EntryID); err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("SwapEntries: Failed to write new playlist position: %v", err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("SwapEntries: Failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// MoveEntryToTop moves the playlist entry with the given ID to the beginning of its playlist. The priority of the entry
+// is kept, so it is placed in front of all entries with the same priority - but still behind the entries having a
+// higher priority
+func (r *PlaylistRepo) MoveEntryToTop(entryID uint) error {
+	return r.moveEntry("MoveEntryToTop", entryID, func(tx *sqlx.Tx, entry *reorderHelper) (uint, error) {
+		var firstID uint
+		query := `SELECT id FROM PlaylistEntries
+				WHERE playlistId = ? AND id <> ? AND priority = (SELECT priority FROM PlaylistEntries WHERE id = ?)
+				ORDER BY ` + entryOrder + ` LIMIT 1`
+		err := tx.Get(&firstID, query, entry.PlaylistID, entry.EntryID, entry.EntryID)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, fmt.Errorf("Failed to load the first playlist entry: %v", err)
+		}
+		return firstID, nil
+	})
+}
+
+// MoveEntryToBottom moves the playlist entry with the given ID to the end of its playlist
+func (r *PlaylistRepo) MoveEntryToBottom(entryID uint) error {
+	return r.moveEntry("MoveEntryToBottom", entryID, func(_ *sqlx.Tx, _ *reorderHelper) (uint, error) {
+		return 0, nil
+	})
+}
+
+// moveEntry places the playlist entry with the given ID just before the entry whose ID is returned by the target
+// function - or at the end of the playlist if there is no such entry in the same playlist. Everything is done inside a
+// single transaction
+// Only the moved entry gets a new position - in the middle of the gap between its new neighbours. The whole playlist is
+// renumbered only if there is no gap left between them
+func (r *PlaylistRepo) moveEntry(
+	name string,
+	entryID uint,
+	target func(tx *sqlx.Tx, entry *reorderHelper) (uint, error),
+) error {
 	tx, err := r.db.Beginx()
 	if err != nil {
-		return fmt.Errorf("PlaceEntryBefore: Unable to start transaction: %v", err)
+		return fmt.Errorf("%s: Unable to start transaction: %v", name, err)
 	}
 	// Load the entry itself
 	query := fmt.Sprintf(`SELECT %s FROM PlaylistEntries WHERE id = ?`, playlistReorderFields)
@@ -350,43 +882,114 @@ func (r *PlaylistRepo) PlaceEntryBefore(entryID uint, otherEntryID uint) error {
 		if err == sql.ErrNoRows {
 			return repos.DoRollback(tx, repos.ErrEntityNotExisting)
 		}
-		return repos.DoRollback(tx, fmt.Errorf("PlaceEntryBefore: Failed to load playlist entry to reorder: %v", err))
+		return repos.DoRollback(tx, fmt.Errorf("%s: Failed to load playlist entry to reorder: %v", name, err))
 	}
-	// Load all the other entries from the same playlist
-	query = fmt.Sprintf(
-		`SELECT %s FROM PlaylistEntries WHERE playlistId = ? AND id <> ? ORDER BY position`,
-		playlistReorderFields,
-	)
-	rest := []*reorderHelper{}
-	err = tx.Select(&rest, query, entry.PlaylistID, entryID)
-	if err != nil {
-		return repos.DoRollback(tx, fmt.Errorf("PlaceEntryBefore: Failed to load playlist entries: %v", err))
-	}
-	// Do some reordering
-	found := false
-	newOrder := []*reorderHelper{}
-	for _, e := range rest {
-		if e.EntryID == otherEntryID {
-			found = true
-			newOrder = append(newOrder, entry)
+	otherEntryID, err := target(tx, entry)
+	if err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("%s: %v", name, err))
+	}
+	if err = placeBefore(tx, entry, otherEntryID); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("%s: %v", name, err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: Failed to commit transaction: %v", name, err)
+	}
+	return nil
+}
+
+// placeBefore gives the entry a new position just before the other entry - or at the end of its playlist if the other
+// entry is not part of it. The playlist is renumbered if there is no gap left between the new neighbours
+func placeBefore(tx *sqlx.Tx, entry *reorderHelper, otherEntryID uint) error {
+	position, err := positionBefore(tx, entry, otherEntryID)
+	if err == errNoGapLeft {
+		if err = rebalance(tx, entry.PlaylistID); err == nil {
+			position, err = positionBefore(tx, entry, otherEntryID)
 		}
-		newOrder = append(newOrder, e)
-	}
-	// Place at the end?
-	if !found {
-		newOrder = append(newOrder, entry)
-	}
-	// Write the newly ordered items back to the database
-	for i, e := range newOrder {
-		// ToDo: Find a more performant way to do this
-		query := `UPDATE PlaylistEntries SET position = ? WHERE id = ?`
-		if _, err := tx.Exec(query, i+1, e.EntryID); err != nil {
-			return repos.DoRollback(tx, fmt.Errorf("PlaceEntryBefore: Failed to write new playlist position: %v", err))
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE PlaylistEntries SET position = ? WHERE id = ?`, position, entry.EntryID); err != nil {
+		return fmt.Errorf("Failed to write new playlist position: %v", err)
+	}
+	return nil
+}
+
+// errNoGapLeft is returned by positionBefore if there is no free position left between two neighbouring entries
+var errNoGapLeft = errors.New("No gap left between the playlist positions")
+
+// positionBefore calculates the position for placing the given entry just before the other entry inside the entry's
+// playlist - or at the end of the playlist if the other entry is not part of it
+func positionBefore(tx *sqlx.Tx, entry *reorderHelper, otherEntryID uint) (int64, error) {
+	var other int64
+	query := `SELECT position FROM PlaylistEntries WHERE id = ? AND id <> ? AND playlistId = ?`
+	err := tx.Get(&other, query, otherEntryID, entry.EntryID, entry.PlaylistID)
+	if err == sql.ErrNoRows {
+		// Place at the end
+		var last int64
+		query = `SELECT IFNULL(MAX(position), 0) FROM PlaylistEntries WHERE playlistId = ? AND id <> ?`
+		if err = tx.Get(&last, query, entry.PlaylistID, entry.EntryID); err != nil {
+			return 0, fmt.Errorf("Failed to load the last playlist position: %v", err)
 		}
+		return last + positionGap, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Failed to load the position of the other playlist entry: %v", err)
 	}
+	// Entries sharing the position of the other entry are sorted by their ID - those with a lower ID are in front of it
+	var previous int64
+	query = `SELECT IFNULL(MAX(position), 0) FROM PlaylistEntries
+			WHERE playlistId = ? AND id NOT IN (?, ?) AND (position < ? OR (position = ? AND id < ?))`
+	err = tx.Get(&previous, query, entry.PlaylistID, entry.EntryID, otherEntryID, other, other, otherEntryID)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to load the position of the previous playlist entry: %v", err)
+	}
+	if other-previous < 2 {
+		return 0, errNoGapLeft
+	}
+	return previous + (other-previous)/2, nil
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("PlaceEntryBefore: Failed to commit transaction: %v", err)
+// rebalance renumbers all entries of the given playlist so that there is an even gap between all of them again - keeping
+// the order defined by entryOrder
+func rebalance(tx *sqlx.Tx, playlistID uint) error {
+	var ids []uint
+	query := `SELECT id FROM PlaylistEntries WHERE playlistId = ? ORDER BY ` + entryOrder
+	if err := tx.Select(&ids, query, playlistID); err != nil {
+		return fmt.Errorf("Failed to load playlist entries: %v", err)
+	}
+	return writePositions(tx, ids, 0)
+}
+
+// writePositions numbers the playlist entries with the given IDs in the order provided, leaving a gap of positionGap
+// between them and after the position given. Instead of updating every entry on its own, the positions are written
+// using one statement per batch of entries
+func writePositions(tx *sqlx.Tx, ids []uint, after int64) error {
+	for start := 0; start < len(ids); start += positionBatchSize {
+		end := start + positionBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+		cases := make([]string, len(batch))
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, 3*len(batch))
+		for i, id := range batch {
+			cases[i] = "WHEN ? THEN ?"
+			placeholders[i] = "?"
+			args = append(args, id, after+int64(start+i+1)*positionGap)
+		}
+		for _, id := range batch {
+			args = append(args, id)
+		}
+		query := fmt.Sprintf(
+			"UPDATE PlaylistEntries SET position = CASE id %s END WHERE id IN (%s)",
+			strings.Join(cases, " "),
+			strings.Join(placeholders, ", "),
+		)
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("Failed to write new playlist positions: %v", err)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,260 @@
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+
+	"github.com/derWhity/kyabia/internal/migrate"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/jmoiron/sqlx"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+// The number of statements run through the counting driver
+var numStatements int64
+
+// countingConn wraps a database connection and counts the statements prepared on it. Since it only provides the
+// methods of driver.Conn, database/sql has to prepare every statement - including the ones run without a transaction
+type countingConn struct {
+	driver.Conn
+}
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	atomic.AddInt64(&numStatements, 1)
+	return c.Conn.Prepare(query)
+}
+
+// countingDriver is a SQLite driver whose connections count the statements run on them
+type countingDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn}, nil
+}
+
+func init() {
+	sql.Register("sqlite3_counting", &countingDriver{})
+}
+
+// newTestRepo creates a playlist repository working on a fresh in-memory database together with a playlist containing
+// the given number of entries
+func newTestRepo(t testing.TB, numEntries int) (*PlaylistRepo, uint) {
+	sqlDB, err := sql.Open("sqlite3_counting", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	// Every connection would get its own in-memory database otherwise
+	sqlDB.SetMaxOpenConns(1)
+	db := sqlx.NewDb(sqlDB, "sqlite3")
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	logger := logrus.NewEntry(l)
+	if err := migrate.ExecuteMigrationsOnDb(db, logger); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	r := New(db, logger).(*PlaylistRepo)
+	pl := models.Playlist{Name: "Test"}
+	if err := r.Create(&pl); err != nil {
+		t.Fatalf("Failed to create playlist: %v", err)
+	}
+	entries := make([]*models.PlaylistEntry, numEntries)
+	for i := range entries {
+		entries[i] = &models.PlaylistEntry{VideoHash: fmt.Sprintf("video%d", i), Status: models.EntryStatusApproved}
+	}
+	if err := r.AddEntries(pl.ID, entries); err != nil {
+		t.Fatalf("Failed to add playlist entries: %v", err)
+	}
+	return r, pl.ID
+}
+
+// entryIDs returns the IDs of all entries of the given playlist in the order they are played in
+func entryIDs(t testing.TB, r *PlaylistRepo, playlistID uint) []uint {
+	var ids []uint
+	query := "SELECT id FROM PlaylistEntries WHERE playlistId = ? ORDER BY " + entryOrder
+	if err := r.db.Select(&ids, query, playlistID); err != nil {
+		t.Fatalf("Failed to load playlist entries: %v", err)
+	}
+	return ids
+}
+
+// countStatements returns the number of statements run by the given function
+func countStatements(t testing.TB, f func() error) int64 {
+	start := atomic.LoadInt64(&numStatements)
+	if err := f(); err != nil {
+		t.Fatal(err)
+	}
+	return atomic.LoadInt64(&numStatements) - start
+}
+
+func TestPlaceEntryBeforeStatementCount(t *testing.T) {
+	var counts []int64
+	for _, size := range []int{10, 1000} {
+		r, plID := newTestRepo(t, size)
+		ids := entryIDs(t, r, plID)
+		last := ids[len(ids)-1]
+		counts = append(counts, countStatements(t, func() error { return r.PlaceEntryBefore(last, ids[0]) }))
+		if got := entryIDs(t, r, plID); got[0] != last || got[1] != ids[0] {
+			t.Errorf("Entry #%d has not been moved to the top of %d entries: %v", last, size, got[:2])
+		}
+	}
+	// Moving an entry must not touch the other entries - the number of statements is independent of the playlist size
+	if counts[0] != counts[1] || counts[0] > 5 {
+		t.Errorf("Moving an entry needed %d statements for 10 and %d for 1000 entries", counts[0], counts[1])
+	}
+}
+
+func TestWritePositionsStatementCount(t *testing.T) {
+	size := 1000
+	r, plID := newTestRepo(t, size)
+	num := countStatements(t, func() error { return r.Shuffle(plID) })
+	// One statement for loading the entries and one per batch of positions
+	want := int64(1 + (size+positionBatchSize-1)/positionBatchSize)
+	if num != want {
+		t.Errorf("Shuffling %d entries needed %d statements, want %d", size, num, want)
+	}
+	if got := entryIDs(t, r, plID); len(got) != size {
+		t.Errorf("Playlist has %d entries after shuffling, want %d", len(got), size)
+	}
+}
+
+func TestPlaceEntryBeforeRebalances(t *testing.T) {
+	r, plID := newTestRepo(t, 5)
+	// Moving the last entry in front of the second one over and over again halves the gap between the first two entries
+	// every time until there is no gap left and the playlist gets renumbered
+	for i := 0; i < 40; i++ {
+		ids := entryIDs(t, r, plID)
+		last := ids[len(ids)-1]
+		if err := r.PlaceEntryBefore(last, ids[1]); err != nil {
+			t.Fatal(err)
+		}
+		got := entryIDs(t, r, plID)
+		if got[1] != last || got[0] != ids[0] {
+			t.Fatalf("Move #%d: Entry #%d has not been placed second: %v", i+1, last, got)
+		}
+	}
+}
+
+func BenchmarkPlaceEntryBefore(b *testing.B) {
+	r, plID := newTestRepo(b, 1000)
+	ids := entryIDs(b, r, plID)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := r.PlaceEntryBefore(ids[i%len(ids)], ids[(i*7)%len(ids)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReorderingKeepsPriorityOrder(t *testing.T) {
+	r, plID := newTestRepo(t, 5)
+	ids := entryIDs(t, r, plID)
+	// The fourth entry gets a priority and is played first
+	if err := r.SetEntryPriority(ids[3], 1); err != nil {
+		t.Fatal(err)
+	}
+	order := []uint{ids[3], ids[0], ids[1], ids[2], ids[4]}
+	assertOrder(t, "SetEntryPriority", entryIDs(t, r, plID), order)
+
+	// Moving an entry to the top places it right behind the prioritized entry
+	if err := r.MoveEntryToTop(ids[4]); err != nil {
+		t.Fatal(err)
+	}
+	order = []uint{ids[3], ids[4], ids[0], ids[1], ids[2]}
+	assertOrder(t, "MoveEntryToTop", entryIDs(t, r, plID), order)
+
+	// Inserting at an index counts the prioritized entry, too
+	entry := models.PlaylistEntry{VideoHash: "inserted", Status: models.EntryStatusApproved}
+	if err := r.InsertEntry(plID, &entry, 2); err != nil {
+		t.Fatal(err)
+	}
+	order = []uint{ids[3], ids[4], entry.ID, ids[0], ids[1], ids[2]}
+	assertOrder(t, "InsertEntry", entryIDs(t, r, plID), order)
+
+	// Rebalancing keeps the order
+	tx := r.db.MustBegin()
+	if err := rebalance(tx, plID); err != nil {
+		t.Fatal(repos.DoRollback(tx, err))
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	assertOrder(t, "rebalance", entryIDs(t, r, plID), order)
+
+	// Swapping the prioritized entry with another one exchanges their priorities, too
+	if err := r.SwapEntries(ids[3], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	order = []uint{ids[1], ids[4], entry.ID, ids[0], ids[3], ids[2]}
+	assertOrder(t, "SwapEntries", entryIDs(t, r, plID), order)
+
+	// Shuffling keeps the prioritized entry in front
+	if err := r.Shuffle(plID); err != nil {
+		t.Fatal(err)
+	}
+	if got := entryIDs(t, r, plID); got[0] != ids[1] {
+		t.Errorf("Shuffle: Prioritized entry #%d is not in front any more: %v", ids[1], got)
+	}
+}
+
+func assertOrder(t *testing.T, name string, got []uint, want []uint) {
+	if len(got) != len(want) {
+		t.Errorf("%s: got order %v, want %v", name, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s: got order %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+func TestGetEntryRankCountsQueueOnly(t *testing.T) {
+	r, plID := newTestRepo(t, 6)
+	ids := entryIDs(t, r, plID)
+	// The first entry has been played, the second is pending and the third has been rejected
+	if err := r.MarkEntryPlayed(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetEntryStatus(ids[1], models.EntryStatusPending); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetEntryStatus(ids[2], models.EntryStatusRejected); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		entryID   uint
+		wantRank  uint
+		wantTotal uint
+	}{
+		{ids[3], 1, 3},
+		{ids[4], 2, 3},
+		{ids[5], 3, 3},
+		// Entries outside of the queue are ranked by the queued entries in front of them
+		{ids[1], 1, 4},
+		{ids[0], 1, 4},
+	}
+	for _, tt := range tests {
+		rank, total, err := r.GetEntryRank(tt.entryID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rank != tt.wantRank || total != tt.wantTotal {
+			t.Errorf("GetEntryRank(%d) = %d of %d, want %d of %d", tt.entryID, rank, total, tt.wantRank, tt.wantTotal)
+		}
+	}
+	if _, _, err := r.GetEntryRank(12345); err != repos.ErrEntityNotExisting {
+		t.Errorf("GetEntryRank of a missing entry returned %v, want %v", err, repos.ErrEntityNotExisting)
+	}
+}
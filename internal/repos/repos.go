@@ -4,6 +4,7 @@ package repos
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -16,20 +17,109 @@ var (
 	ErrEntityNotExisting = fmt.Errorf("Cannot update: Entity does not exist")
 )
 
+// VideoFilter restricts the videos returned by a video search
+type VideoFilter struct {
+	// If set, only videos having this tag are returned
+	Tag string
+	// If set, only videos that are available (or unavailable) are returned
+	Available *bool
+	// If set, videos that have been played within this duration are left out
+	NotPlayedWithin time.Duration
+}
+
+// PlaylistEntryFilter restricts the entries returned when listing the entries of a playlist
+type PlaylistEntryFilter struct {
+	// If set, entries that are pending or have been rejected are left out
+	OnlyApproved bool
+	// If set, only entries whose requester's name contains this string are returned
+	RequestedBy string
+}
+
 // VideoRepo defines a repository that handles storing and querying video information
 type VideoRepo interface {
 	// Create creates a new video entry
 	Create(v *models.Video) error
 	// Update updates an existing video entry
 	Update(v *models.Video) error
-	// Delete removes an existing video entry from the storage
+	// UpdateMany applies the non-empty fields of the patch to all videos having one of the given IDs. Returns the
+	// number of videos updated - IDs of videos not existing are skipped
+	UpdateMany(ids []string, patch models.VideoPatch) (uint, error)
+	// Merge updates the given video and moves the playlist entries, tags, chapters and per-event statistics of the
+	// video with the hash mergeHash over to it. Afterwards, the merged video is removed permanently
+	Merge(v *models.Video, mergeHash string) error
+	// Delete marks an existing video entry as deleted. Deleted videos are no longer returned, but kept until purged
 	Delete(id string) error
+	// Restore restores a deleted video entry
+	Restore(id string) error
+	// Purge permanently removes all video entries that have been deleted longer than the given duration ago and
+	// returns the number of videos removed
+	Purge(olderThan time.Duration) (uint, error)
 	// GetByID returns the video entry having the given ID
 	GetByID(id string) (*models.Video, error)
-	// Find searches for videos matching the given search string - supports pagination
-	Find(search string, offset uint, limit uint) ([]models.Video, uint, error)
+	// GetByFilename returns the video entry that has been scraped from the file with the given name
+	GetByFilename(filename string) (*models.Video, error)
+	// GetByIdentifier returns all video entries having the given identifier
+	GetByIdentifier(identifier string) ([]models.Video, error)
+	// Find searches for videos matching the given search string and filter - supports pagination
+	Find(search string, filter VideoFilter, offset uint, limit uint) ([]models.Video, uint, error)
+	// Each calls the given function for every video matching the given search string and filter - one at a time
+	// without loading all videos into memory. If the function returns an error, the iteration stops and the error is
+	// returned
+	Each(search string, filter VideoFilter, fn func(v *models.Video) error) error
+	// Relocate replaces the prefix of the file names of all videos starting with oldPrefix by newPrefix and returns the
+	// number of videos changed
+	Relocate(oldPrefix string, newPrefix string) (uint, error)
+	// SetAvailable marks the given video as available or unavailable
+	SetAvailable(id string, available bool) error
+	// FindArtists returns the distinct, non-empty artist names starting with the given prefix in alphabetical order
+	FindArtists(prefix string, limit uint) ([]string, error)
+	// FindRelatedMedia returns the distinct, non-empty related media starting with the given prefix in alphabetical
+	// order
+	FindRelatedMedia(prefix string, limit uint) ([]string, error)
+	// CountByLanguage returns the number of videos per language - ordered by the number of videos. Videos without a
+	// language are counted as "unknown". If onlyAvailable is set, unavailable videos are not counted
+	CountByLanguage(onlyAvailable bool) ([]models.FacetCount, error)
+	// FindTop returns the videos that have been requested most - or played most if byPlayed is set. Videos that have
+	// never been requested (or played) are left out
+	FindTop(limit uint, byPlayed bool) ([]models.Video, error)
 	// BumpNumRequested increases the "numRequested" counter on the given video
 	BumpNumRequested(id string) error
+	// BumpNumPlayed increases the "numPlayed" counter on the given video and sets its "lastPlayedAt" timestamp
+	BumpNumPlayed(id string) error
+	// GetTags returns the tags of the given video in alphabetical order
+	GetTags(id string) ([]string, error)
+	// AddTag adds a tag to the given video. Adding a tag the video already has does nothing
+	AddTag(id string, tag string) error
+	// RemoveTag removes a tag from the given video
+	RemoveTag(id string, tag string) error
+	// ListTags returns all distinct tags used by any video in alphabetical order
+	ListTags() ([]string, error)
+}
+
+// ChapterRepo defines a repository that stores the chapter markers of videos
+type ChapterRepo interface {
+	// GetByVideo returns the chapters of the video with the given hash ordered by their index
+	GetByVideo(videoHash string) ([]models.VideoChapter, error)
+	// SetForVideo replaces all chapters of the video with the given hash by the chapters provided
+	SetForVideo(videoHash string, chapters []models.VideoChapter) error
+}
+
+// StatisticsRepo defines a repository that keeps the statistics of videos per event
+type StatisticsRepo interface {
+	// BumpNumRequested increases the request counter of the given video for the given event by one
+	BumpNumRequested(eventID uint, videoHash string) error
+	// BumpNumPlayed increases the play counter of the given video for the given event by one
+	BumpNumPlayed(eventID uint, videoHash string) error
+	// AddRequester records that a guest added a wish from the given IP address during the given event
+	AddRequester(eventID uint, ipAddr string) error
+	// GetByEvent returns the statistics of the videos for the given event - ordered by the number of requests or, if
+	// byPlayed is set, by the number of plays. If limit is 0, the statistics of all videos are returned
+	GetByEvent(eventID uint, byPlayed bool, limit uint) ([]models.VideoStatisticsEntry, error)
+	// ResetByEvent zeroes the statistics of all videos for the given event and forgets its requesters. If
+	// resetVideoCounters is set, the event's counts are subtracted from the global counters of the videos, too
+	ResetByEvent(eventID uint, resetVideoCounters bool) error
+	// GetEventTotals returns the total number of wishes and the number of different requesters for the given event
+	GetEventTotals(eventID uint) (uint, uint, error)
 }
 
 // UserRepo defines a repository that is able to store, query and authenticate users
@@ -42,6 +132,8 @@ type UserRepo interface {
 	Delete(id uint) error
 	// GetByID returns the user with the given ID
 	GetByID(id uint) (*models.User, error)
+	// GetByName returns the user with the given login name
+	GetByName(name string) (*models.User, error)
 	// GetByCredentials returns the user which has the given username and password - this is used for login
 	GetByCredentials(username string, password string) (*models.User, error)
 	// Find searches for users matching the given search string - supports pagination
@@ -54,8 +146,13 @@ type SessionRepo interface {
 	CreateFor(userID uint) (*models.Session, error)
 	// GetByID returns the session associated with the given session ID and extends it's expiry if requested
 	GetByID(sessionID string, extend bool) (*models.Session, error)
+	// ListByUser returns all active sessions of the given user
+	ListByUser(userID uint) ([]models.Session, error)
 	// Delete removes a session from the session storage
 	Delete(sessionID string) error
+	// DeleteForUser removes all sessions of the given user from the session storage and returns the number of sessions
+	// removed
+	DeleteForUser(userID uint) (uint, error)
 }
 
 // PlaylistRepo defines a repository that is able to store and query playlists and their contents
@@ -72,19 +169,81 @@ type PlaylistRepo interface {
 	Find(search string, offset uint, limit uint) ([]models.Playlist, uint, error)
 	// GetEntryByID loads the playlist entry with the given ID from the database
 	GetEntryByID(entryID uint) (*models.PlaylistEntry, error)
+	// GetVideoEntryByID loads the playlist entry with the given ID together with the details of its video
+	GetVideoEntryByID(entryID uint) (*models.PlaylistVideoEntry, error)
 	// AddEntry adds an entry to an existing playlist
 	AddEntry(playlistID uint, entry *models.PlaylistEntry) error
+	// InsertEntry adds an entry to an existing playlist at the given index - the following entries move one step down
+	InsertEntry(playlistID uint, entry *models.PlaylistEntry, index uint) error
+	// AddEntries adds multiple entries to the end of an existing playlist in the given order - all or none of them
+	AddEntries(playlistID uint, entries []*models.PlaylistEntry) error
 	// RemoveEntry removes an entry
 	RemoveEntry(entryID uint) error
+	// MergeEntries moves all entries of the source playlist to the end of the target playlist and returns the number of
+	// entries moved. If deleteSource is set, the source playlist is removed afterwards - all or nothing
+	MergeEntries(sourceID uint, targetID uint, deleteSource bool) (uint, error)
+	// CopyEntries copies all approved entries of the source playlist to the target playlist as unplayed entries and
+	// returns the number of entries copied. The source playlist stays untouched
+	CopyEntries(sourceID uint, targetID uint) (uint, error)
+	// RemovePlayedEntries removes all entries of the given playlist that have been played and returns the number of
+	// entries removed
+	RemovePlayedEntries(playlistID uint) (uint, error)
+	// RemovePendingEntriesByIP removes all entries of the given playlist that have been added by the given IP address and
+	// not been played, yet. Returns the number of entries removed
+	RemovePendingEntriesByIP(playlistID uint, ipAddr string) (uint, error)
+	// MarkEntryPlayed sets the time the video of the given entry has been played to now
+	MarkEntryPlayed(entryID uint) error
 	// UpdateEntry updates an entry - mainly used for internal updating
 	UpdateEntry(entry *models.PlaylistEntry) error
-	// GetEntries returns the entries for the given playlist - supports pagination
-	GetEntries(playlistID uint, offset uint, limit uint) ([]models.PlaylistVideoEntry, uint, error)
+	// SetEntryPriority sets the priority of the given entry - entries with a higher priority are played first
+	SetEntryPriority(entryID uint, priority int) error
+	// SetEntryStatus sets the approval status of the given entry
+	SetEntryStatus(entryID uint, status uint) error
+	// GetEntries returns the entries for the given playlist matching the filter - supports pagination. A non-empty
+	// search string limits the result to the entries whose video title, artist or requester contain it
+	GetEntries(
+		playlistID uint,
+		search string,
+		filter PlaylistEntryFilter,
+		offset uint,
+		limit uint,
+	) ([]models.PlaylistVideoEntry, uint, error)
+	// GetNextEntry returns the first approved entry of the given playlist that has not been played, yet
+	GetNextEntry(playlistID uint) (*models.PlaylistVideoEntry, error)
 	// PlaceEntryBefore reorders the playlist so that the given entry is placed before the other one
 	// If the other entry is not found, the entry will be placed at the end of the list
 	PlaceEntryBefore(entryID uint, otherEntryID uint) error
+	// SwapEntries exchanges the positions and priorities of the two given entries - which have to belong to the same
+	// playlist
+	SwapEntries(entryID uint, otherEntryID uint) error
+	// MoveEntryToTop moves the given entry to the beginning of its playlist - behind all entries with a higher priority
+	MoveEntryToTop(entryID uint) error
+	// MoveEntryToBottom moves the given entry to the end of its playlist
+	MoveEntryToBottom(entryID uint) error
+	// Shuffle puts the entries of the given playlist into a random order
+	Shuffle(playlistID uint) error
+	// GetTotalDuration returns the sum of the durations of all videos in the given playlist. Entries whose video has
+	// been deleted are not counted
+	GetTotalDuration(playlistID uint) (time.Duration, error)
+	// GetDurationAhead returns the sum of the video durations of all approved and unplayed entries placed before the
+	// given entry in its playlist - together with the number of those entries whose video duration is unknown
+	GetDurationAhead(entryID uint) (time.Duration, uint, error)
+	// GetEntryRank returns the 1-based rank of the given entry inside the queue of approved and unplayed entries of its
+	// playlist and the total number of entries in this queue
+	GetEntryRank(entryID uint) (uint, uint, error)
+	// GetTopRequesters returns the given number of requester names that added the most entries to the given playlist.
+	// Entries without a requester name and entries added from one of the excluded IP addresses are not counted
+	GetTopRequesters(playlistID uint, excludedIPs []string, limit uint) ([]models.Requester, error)
+	// GetUnplayedEntryCount returns the number of playlist entries in the given playlist that have not been played, yet
+	GetUnplayedEntryCount(playlistID uint) (uint, error)
 	// GetEntryCountByIP returns the number of playlist entries in the given playlist added by the given IP address
 	GetEntryCountByIP(playlistID uint, ipAddr string) (uint, error)
+	// GetEntryCountByIPAndVideo returns the number of playlist entries in the given playlist added by the given IP
+	// address having the given video selected
+	GetEntryCountByIPAndVideo(playlistID uint, ipAddr string, videoHash string) (uint, error)
+	// GetLastEntryTimeByIP returns the time the latest entry in the given playlist has been added by the given IP address
+	// - or nil if there is none
+	GetLastEntryTimeByIP(playlistID uint, ipAddr string) (*time.Time, error)
 	// GetEntryCountByVideo returns the number of playlist entries in the given playlist having the given video selected
 	GetEntryCountByVideo(playlistID uint, videoHash string) (uint, error)
 }
@@ -101,6 +260,11 @@ type EventRepo interface {
 	GetByID(id uint) (*models.Event, error)
 	// GetByDate returns the event or events that are valid for the given point in time
 	GetByDate(date time.Time) ([]models.Event, error)
+	// GetOverlapping returns the events whose time span overlaps with the given one - except for the event with the
+	// given ID
+	GetOverlapping(startsAt time.Time, endsAt time.Time, excludeID uint) ([]models.Event, error)
+	// FindOverlaps returns all pairs of events whose time spans overlap
+	FindOverlaps() ([]models.EventOverlap, error)
 	// Find searches for events mathing the given search string - supports pagination
 	Find(search string, offset uint, limit uint) ([]models.Event, uint, error)
 }
@@ -114,3 +278,41 @@ func DoRollback(tx *sqlx.Tx, originalError error) error {
 	}
 	return originalError
 }
+
+// LikePattern creates a pattern for a LIKE query matching all values containing the given search string. Wildcards
+// inside the search string are escaped, so the query needs an "ESCAPE '\'" clause
+func LikePattern(search string) string {
+	return "%" + escapeLike(search) + "%"
+}
+
+// LikePrefixPattern creates a pattern for a LIKE query matching all values starting with the given prefix. Like with
+// LikePattern, the query needs an "ESCAPE '\'" clause
+func LikePrefixPattern(prefix string) string {
+	return escapeLike(prefix) + "%"
+}
+
+// escapeLike escapes all wildcards and the escape character itself inside the given string
+func escapeLike(str string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(str)
+}
+
+// AuditRepo defines a repository that stores the audit log of administrative actions
+type AuditRepo interface {
+	// Add adds a new entry to the audit log
+	Add(e *models.AuditEntry) error
+	// Find searches for audit log entries matching the given search string - the newest entries first. Supports
+	// pagination
+	Find(search string, offset uint, limit uint) ([]models.AuditEntry, uint, error)
+}
+
+// APIKeyRepo defines a repository that stores the API keys machine clients authenticate with
+type APIKeyRepo interface {
+	// Create stores a new API key
+	Create(k *models.APIKey) error
+	// Delete removes an API key
+	Delete(id uint) error
+	// List returns all API keys
+	List() ([]models.APIKey, error)
+	// GetByHash returns the API key with the given key hash
+	GetByHash(keyHash string) (*models.APIKey, error)
+}
@@ -25,8 +25,10 @@ type sessionRequest struct {
 
 // sessionResponse is a generic response to a session request that contains the answer to the request made
 type sessionResponse struct {
-	session *models.Session
-	err     error
+	session  *models.Session
+	sessions []models.Session
+	count    uint
+	err      error
 }
 
 // SessionRepo is a session repository that stores the session data in-memory
@@ -37,6 +39,10 @@ type SessionRepo struct {
 	get chan<- sessionRequest
 	// del is a channel to request a session to be deleted
 	del chan<- sessionRequest
+	// list is a channel to request all active sessions of a user
+	list chan<- sessionRequest
+	// delUser is a channel to request all sessions of a user to be deleted
+	delUser chan<- sessionRequest
 }
 
 // New creates a new session repository instance
@@ -46,10 +52,14 @@ func New() *SessionRepo {
 	m := make(chan sessionRequest)
 	g := make(chan sessionRequest)
 	d := make(chan sessionRequest)
-	go repo.control(m, g, d)
+	l := make(chan sessionRequest)
+	du := make(chan sessionRequest)
+	go repo.control(m, g, d, l, du)
 	repo.make = m
 	repo.get = g
 	repo.del = d
+	repo.list = l
+	repo.delUser = du
 	return repo
 }
 
@@ -86,8 +96,25 @@ func RandomString(n int) string {
 // ---------------------------------------------------------------------------------------------------------------------
 
 // control is the control goroutine that runs endlessly waiting for requests for managing sessions
-func (r *SessionRepo) control(make <-chan sessionRequest, get <-chan sessionRequest, del <-chan sessionRequest) {
+func (r *SessionRepo) control(
+	make <-chan sessionRequest,
+	get <-chan sessionRequest,
+	del <-chan sessionRequest,
+	list <-chan sessionRequest,
+	delUser <-chan sessionRequest,
+) {
 	sessions := map[string]*models.Session{}
+	// Index of the session IDs by the ID of the user they belong to
+	byUser := map[uint]map[string]struct{}{}
+	remove := func(sessionID string) {
+		if sess, ok := sessions[sessionID]; ok {
+			delete(byUser[sess.UserID], sessionID)
+			if len(byUser[sess.UserID]) == 0 {
+				delete(byUser, sess.UserID)
+			}
+			delete(sessions, sessionID)
+		}
+	}
 	// Purge channel to purge all expired sessions all ~1 minute
 	purge := time.Tick(time.Minute)
 	for { // To infinity and beyond!
@@ -101,6 +128,10 @@ func (r *SessionRepo) control(make <-chan sessionRequest, get <-chan sessionRequ
 				ExpiresAt: time.Now().Add(time.Minute * expireMinutes),
 			}
 			sessions[sessionID] = &sess
+			if _, ok := byUser[req.userID]; !ok {
+				byUser[req.userID] = map[string]struct{}{}
+			}
+			byUser[req.userID][sessionID] = struct{}{}
 			copy := sess
 			req.answer <- sessionResponse{
 				session: &copy,
@@ -111,7 +142,7 @@ func (r *SessionRepo) control(make <-chan sessionRequest, get <-chan sessionRequ
 			if ok {
 				if sess.Expired() {
 					// Session expired
-					delete(sessions, req.sessionID)
+					remove(req.sessionID)
 					req.answer <- sessionResponse{err: repos.ErrEntityNotExisting}
 				} else {
 					if req.extend {
@@ -125,10 +156,27 @@ func (r *SessionRepo) control(make <-chan sessionRequest, get <-chan sessionRequ
 			}
 		case req := <-del:
 			// Delete a session
-			if _, ok := sessions[req.sessionID]; ok {
-				delete(sessions, req.sessionID)
-			}
+			remove(req.sessionID)
 			req.answer <- sessionResponse{}
+		case req := <-list:
+			// List the active sessions of a user
+			ret := []models.Session{}
+			for sessionID := range byUser[req.userID] {
+				if sess := sessions[sessionID]; !sess.Expired() {
+					ret = append(ret, *sess)
+				}
+			}
+			req.answer <- sessionResponse{sessions: ret}
+		case req := <-delUser:
+			// Delete all sessions of a user
+			var toDelete []string
+			for sessionID := range byUser[req.userID] {
+				toDelete = append(toDelete, sessionID)
+			}
+			for _, sessionID := range toDelete {
+				remove(sessionID)
+			}
+			req.answer <- sessionResponse{count: uint(len(toDelete))}
 		case <-purge:
 			// Purge all expired sessions
 			var toPurge []string
@@ -138,7 +186,7 @@ func (r *SessionRepo) control(make <-chan sessionRequest, get <-chan sessionRequ
 				}
 			}
 			for _, key := range toPurge {
-				delete(sessions, key)
+				remove(key)
 			}
 		}
 	}
@@ -174,6 +222,25 @@ func (r *SessionRepo) GetByID(sessionID string, extend bool) (*models.Session, e
 	return resp.session, nil
 }
 
+// ListByUser returns all active sessions of the given user
+func (r *SessionRepo) ListByUser(userID uint) ([]models.Session, error) {
+	resp := send("", userID, false, r.list)
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	return resp.sessions, nil
+}
+
+// DeleteForUser removes all sessions of the given user from the session storage and returns the number of sessions
+// removed
+func (r *SessionRepo) DeleteForUser(userID uint) (uint, error) {
+	resp := send("", userID, false, r.delUser)
+	if resp.err != nil {
+		return 0, resp.err
+	}
+	return resp.count, nil
+}
+
 // Delete removes a session from the session storage
 func (r *SessionRepo) Delete(sessionID string) error {
 	resp := send(sessionID, 0, false, r.del)
@@ -0,0 +1,137 @@
+// Package jwt provides a stateless session repository. Instead of storing sessions, it issues JSON Web Tokens signed
+// with a shared secret (HMAC-SHA256) that contain the user ID and the expiry. Every instance knowing the secret can
+// validate the tokens - no shared session store is needed.
+//
+// Since nothing is stored, tokens cannot be revoked: deleting a session is a no-op and a token stays valid until it
+// expires. Extending a session issues a new token.
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+)
+
+const (
+	// How long does a token last after it has been issued?
+	expireMinutes = 60
+)
+
+var (
+	enc = base64.RawURLEncoding
+	// The encoded header of all tokens issued - only HMAC-SHA256 signed tokens are accepted
+	tokenHeader = enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+)
+
+// claims is the payload of a token
+type claims struct {
+	// The ID of the user as string - as required by the JWT specification
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// SessionRepo is a session repository that issues and validates signed tokens instead of storing sessions
+type SessionRepo struct {
+	secret []byte
+}
+
+// New creates a new session repository signing its tokens with the given secret
+func New(secret []byte) *SessionRepo {
+	return &SessionRepo{
+		secret: secret,
+	}
+}
+
+// sign returns the signature of the given header and payload
+func (r *SessionRepo) sign(unsigned string) []byte {
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+// issue creates a new token for the given user ID
+func (r *SessionRepo) issue(userID uint) (*models.Session, error) {
+	now := time.Now()
+	sess := models.Session{
+		UserID:    userID,
+		ExpiresAt: now.Add(time.Minute * expireMinutes),
+	}
+	payload, err := json.Marshal(claims{
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: sess.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("issue: Failed to encode token payload: %v", err)
+	}
+	unsigned := tokenHeader + "." + enc.EncodeToString(payload)
+	sess.ID = unsigned + "." + enc.EncodeToString(r.sign(unsigned))
+	return &sess, nil
+}
+
+// CreateFor creates a new session for the given user ID
+func (r *SessionRepo) CreateFor(userID uint) (*models.Session, error) {
+	return r.issue(userID)
+}
+
+// GetByID validates the given token and returns the session it describes. Invalid and expired tokens are reported as
+// non-existing sessions. If the session should be extended, a new token is issued
+func (r *SessionRepo) GetByID(sessionID string, extend bool) (*models.Session, error) {
+	parts := strings.Split(sessionID, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, repos.ErrEntityNotExisting
+	}
+	signature, err := enc.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, r.sign(parts[0]+"."+parts[1])) {
+		return nil, repos.ErrEntityNotExisting
+	}
+	payload, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, repos.ErrEntityNotExisting
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, repos.ErrEntityNotExisting
+	}
+	userID, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil {
+		return nil, repos.ErrEntityNotExisting
+	}
+	sess := models.Session{
+		ID:        sessionID,
+		UserID:    uint(userID),
+		ExpiresAt: time.Unix(c.ExpiresAt, 0),
+	}
+	if sess.Expired() {
+		return nil, repos.ErrEntityNotExisting
+	}
+	if extend {
+		return r.issue(sess.UserID)
+	}
+	return &sess, nil
+}
+
+// ListByUser returns all active sessions of the given user - since tokens are not stored, this list is always empty
+func (r *SessionRepo) ListByUser(userID uint) ([]models.Session, error) {
+	return []models.Session{}, nil
+}
+
+// Delete removes a session from the session storage - since tokens are not stored, this does nothing
+func (r *SessionRepo) Delete(sessionID string) error {
+	return nil
+}
+
+// DeleteForUser removes all sessions of the given user from the session storage - since tokens are not stored, this
+// does nothing
+func (r *SessionRepo) DeleteForUser(userID uint) (uint, error) {
+	return 0, nil
+}
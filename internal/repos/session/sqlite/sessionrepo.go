@@ -0,0 +1,162 @@
+// Package sqlite provides a session repository that stores the session data inside a SQLite database - sessions
+// survive a restart and can be shared between multiple processes using the same database
+package sqlite
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// How long does a session last after the last update?
+	expireMinutes = 60
+	// The number of random bytes a session ID is made of - the ID is hex-encoded and thus twice as long
+	sessionIDBytes = 32
+)
+
+// sessionRow is a session as stored in the database - the expiry is stored as Unix timestamp
+type sessionRow struct {
+	ID        string `db:"id"`
+	UserID    uint   `db:"userId"`
+	ExpiresAt int64  `db:"expiresAt"`
+}
+
+// SessionRepo is a session repository that stores its data inside a SQLite database
+type SessionRepo struct {
+	db     *sqlx.DB
+	logger *logrus.Entry
+}
+
+// New creates a new session repository instance with the given database and logger. Expired sessions are purged from
+// the database every minute
+func New(db *sqlx.DB, logger *logrus.Entry) *SessionRepo {
+	repo := &SessionRepo{
+		db:     db,
+		logger: logger,
+	}
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := repo.purge(); err != nil {
+				logger.WithError(err).Error("Failed to purge expired sessions")
+			}
+		}
+	}()
+	return repo
+}
+
+// expiry returns the expiry time for a session that is created or extended right now
+func expiry() time.Time {
+	return time.Now().Add(time.Minute * expireMinutes)
+}
+
+// purge removes all expired sessions
+func (r *SessionRepo) purge() error {
+	if _, err := r.db.Exec("DELETE FROM Sessions WHERE expiresAt < ?", time.Now().Unix()); err != nil {
+		return fmt.Errorf("purge: Failed to remove expired sessions: %v", err)
+	}
+	return nil
+}
+
+// CreateFor creates a new session for the given user ID
+func (r *SessionRepo) CreateFor(userID uint) (*models.Session, error) {
+	b := make([]byte, sessionIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("CreateFor: Failed to generate session ID: %v", err)
+	}
+	sess := models.Session{
+		ID:        hex.EncodeToString(b),
+		UserID:    userID,
+		ExpiresAt: expiry(),
+	}
+	_, err := r.db.Exec(
+		"INSERT INTO Sessions(id, userId, expiresAt) VALUES(?, ?, ?)",
+		sess.ID, sess.UserID, sess.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("CreateFor: Failed to store session: %v", err)
+	}
+	return &sess, nil
+}
+
+// GetByID returns the session associated with the given session ID and extends it's expiry if requested
+func (r *SessionRepo) GetByID(sessionID string, extend bool) (*models.Session, error) {
+	var row sessionRow
+	if err := r.db.Get(&row, "SELECT id, userId, expiresAt FROM Sessions WHERE id = ?", sessionID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrEntityNotExisting
+		}
+		return nil, fmt.Errorf("GetByID: Failed to load session: %v", err)
+	}
+	sess := models.Session{
+		ID:        row.ID,
+		UserID:    row.UserID,
+		ExpiresAt: time.Unix(row.ExpiresAt, 0),
+	}
+	if sess.Expired() {
+		if err := r.Delete(sessionID); err != nil {
+			return nil, err
+		}
+		return nil, repos.ErrEntityNotExisting
+	}
+	if extend {
+		sess.ExpiresAt = expiry()
+		_, err := r.db.Exec("UPDATE Sessions SET expiresAt = ? WHERE id = ?", sess.ExpiresAt.Unix(), sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("GetByID: Failed to extend session: %v", err)
+		}
+	}
+	return &sess, nil
+}
+
+// ListByUser returns all active sessions of the given user
+func (r *SessionRepo) ListByUser(userID uint) ([]models.Session, error) {
+	var rows []sessionRow
+	err := r.db.Select(
+		&rows,
+		"SELECT id, userId, expiresAt FROM Sessions WHERE userId = ? AND expiresAt >= ? ORDER BY expiresAt DESC",
+		userID, time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ListByUser: Failed to load sessions: %v", err)
+	}
+	ret := make([]models.Session, len(rows))
+	for i, row := range rows {
+		ret[i] = models.Session{
+			ID:        row.ID,
+			UserID:    row.UserID,
+			ExpiresAt: time.Unix(row.ExpiresAt, 0),
+		}
+	}
+	return ret, nil
+}
+
+// Delete removes a session from the session storage
+func (r *SessionRepo) Delete(sessionID string) error {
+	if _, err := r.db.Exec("DELETE FROM Sessions WHERE id = ?", sessionID); err != nil {
+		return fmt.Errorf("Delete: Failed to remove session: %v", err)
+	}
+	return nil
+}
+
+// DeleteForUser removes all sessions of the given user from the session storage and returns the number of sessions
+// removed
+func (r *SessionRepo) DeleteForUser(userID uint) (uint, error) {
+	res, err := r.db.Exec("DELETE FROM Sessions WHERE userId = ?", userID)
+	if err != nil {
+		return 0, fmt.Errorf("DeleteForUser: Failed to remove sessions: %v", err)
+	}
+	num, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("DeleteForUser: Failed to count removed sessions: %v", err)
+	}
+	return uint(num), nil
+}
@@ -0,0 +1,171 @@
+// Package sqlite provides a statistics repository that uses SQLite for storing the per-event statistics of videos
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/derWhity/kyabia/internal/log"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// The field names in the statistics table
+	fieldNames = `id, eventId, videoHash, numPlayed, numRequested`
+	// The field names of the video summaries returned with the statistics
+	videoFields = `sha512, title, artist, language, relatedMedium, mediumDetail, description, duration, identifier`
+)
+
+// StatisticsRepo implements kyabia.StatisticsRepo and provides access to video statistics stored inside a SQLite
+// database
+type StatisticsRepo struct {
+	logger *logrus.Entry
+	db     *sqlx.DB
+}
+
+// New creates a new StatisticsRepo
+func New(db *sqlx.DB, logger *logrus.Entry) repos.StatisticsRepo {
+	return &StatisticsRepo{logger, db}
+}
+
+// BumpNumRequested increases the request counter of the given video for the given event by one
+func (r *StatisticsRepo) BumpNumRequested(eventID uint, videoHash string) error {
+	return r.bump("BumpNumRequested", "numRequested", eventID, videoHash)
+}
+
+// BumpNumPlayed increases the play counter of the given video for the given event by one
+func (r *StatisticsRepo) BumpNumPlayed(eventID uint, videoHash string) error {
+	return r.bump("BumpNumPlayed", "numPlayed", eventID, videoHash)
+}
+
+// bump increases the given counter field of the statistics record for the event and video by one - creating the
+// record first if there is none, yet
+func (r *StatisticsRepo) bump(name string, field string, eventID uint, videoHash string) error {
+	r.logger.WithFields(logrus.Fields{
+		"event":      eventID,
+		log.FldVideo: videoHash,
+		"counter":    field,
+	}).Debug("Updating video statistics")
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("%s: Unable to start transaction: %v", name, err)
+	}
+	query := `INSERT OR IGNORE INTO VideoStatistics(eventId, videoHash) VALUES(?, ?)`
+	if _, err = tx.Exec(query, eventID, videoHash); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("%s: Failed to create statistics record: %v", name, err))
+	}
+	query = fmt.Sprintf(`UPDATE VideoStatistics SET %[1]s = %[1]s + 1 WHERE eventId = ? AND videoHash = ?`, field)
+	if _, err = tx.Exec(query, eventID, videoHash); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("%s: Failed to update statistics record: %v", name, err))
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: Failed to commit transaction: %v", name, err)
+	}
+	return nil
+}
+
+// AddRequester records that a guest added a wish from the given IP address during the given event
+func (r *StatisticsRepo) AddRequester(eventID uint, ipAddr string) error {
+	query := `INSERT OR IGNORE INTO EventRequesters(eventId, requesterIp) VALUES(?, ?)`
+	if _, err := r.db.Exec(query, eventID, ipAddr); err != nil {
+		return fmt.Errorf("AddRequester: Failed to store requester: %v", err)
+	}
+	return nil
+}
+
+// GetByEvent returns the statistics of the videos for the given event together with the summaries of the videos -
+// ordered by the number of requests or, if byPlayed is set, by the number of plays. If limit is 0, the statistics of
+// all videos are returned
+func (r *StatisticsRepo) GetByEvent(eventID uint, byPlayed bool, limit uint) ([]models.VideoStatisticsEntry, error) {
+	r.logger.WithField("event", eventID).Debug("Loading video statistics")
+	order := "numRequested DESC, numPlayed DESC"
+	if byPlayed {
+		order = "numPlayed DESC, numRequested DESC"
+	}
+	query := fmt.Sprintf("SELECT %s FROM VideoStatistics WHERE eventId = ? ORDER BY %s, id", fieldNames, order)
+	params := []interface{}{eventID}
+	if limit > 0 {
+		query += " LIMIT ?"
+		params = append(params, limit)
+	}
+	ret := []models.VideoStatisticsEntry{}
+	if err := r.db.Select(&ret, query, params...); err != nil {
+		return nil, fmt.Errorf("GetByEvent: Failed to query statistics: %v", err)
+	}
+	if len(ret) == 0 {
+		return ret, nil
+	}
+	// Load the video details
+	params = make([]interface{}, len(ret))
+	for i, entry := range ret {
+		params[i] = entry.VideoHash
+	}
+	query = fmt.Sprintf(
+		"SELECT %s FROM Videos WHERE sha512 IN (?%s)",
+		videoFields, strings.Repeat(", ?", len(params)-1),
+	)
+	var videos []models.VideoSummary
+	if err := r.db.Select(&videos, query, params...); err != nil {
+		return nil, fmt.Errorf("GetByEvent: Failed to load videos: %v", err)
+	}
+	vidMap := make(map[string]*models.VideoSummary, len(videos))
+	for i := range videos {
+		vidMap[videos[i].SHA512] = &videos[i]
+	}
+	for i := range ret {
+		ret[i].Video = vidMap[ret[i].VideoHash]
+	}
+	return ret, nil
+}
+
+// GetEventTotals returns the total number of wishes and the number of different requesters for the given event
+func (r *StatisticsRepo) GetEventTotals(eventID uint) (uint, uint, error) {
+	query := `SELECT
+				(SELECT IFNULL(SUM(numRequested), 0) FROM VideoStatistics WHERE eventId = $1) AS numWishes,
+				(SELECT COUNT(*) FROM EventRequesters WHERE eventId = $1) AS numRequesters`
+	var res struct {
+		NumWishes     uint `db:"numWishes"`
+		NumRequesters uint `db:"numRequesters"`
+	}
+	if err := r.db.Get(&res, query, eventID); err != nil {
+		return 0, 0, fmt.Errorf("GetEventTotals: Failed to query database: %v", err)
+	}
+	return res.NumWishes, res.NumRequesters, nil
+}
+
+// ResetByEvent zeroes the statistics of all videos for the given event and forgets its requesters. If
+// resetVideoCounters is set, the event's counts are subtracted from the global counters of the videos, too
+func (r *StatisticsRepo) ResetByEvent(eventID uint, resetVideoCounters bool) error {
+	r.logger.WithField("event", eventID).Debug("Resetting video statistics")
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("ResetByEvent: Unable to start transaction: %v", err)
+	}
+	if resetVideoCounters {
+		query := `UPDATE Videos SET
+					numPlayed = MAX(0, numPlayed - IFNULL((
+						SELECT s.numPlayed FROM VideoStatistics s WHERE s.eventId = $1 AND s.videoHash = Videos.sha512
+					), 0)),
+					numRequested = MAX(0, numRequested - IFNULL((
+						SELECT s.numRequested FROM VideoStatistics s WHERE s.eventId = $1 AND s.videoHash = Videos.sha512
+					), 0))
+				WHERE sha512 IN (SELECT videoHash FROM VideoStatistics WHERE eventId = $1)`
+		if _, err = tx.Exec(query, eventID); err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("ResetByEvent: Failed to update video counters: %v", err))
+		}
+	}
+	query := `UPDATE VideoStatistics SET numPlayed = 0, numRequested = 0 WHERE eventId = ?`
+	if _, err = tx.Exec(query, eventID); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("ResetByEvent: Failed to reset statistics: %v", err))
+	}
+	if _, err = tx.Exec(`DELETE FROM EventRequesters WHERE eventId = ?`, eventID); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("ResetByEvent: Failed to remove requesters: %v", err))
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ResetByEvent: Failed to commit transaction: %v", err)
+	}
+	return nil
+}
@@ -81,6 +81,17 @@ func (r *UserRepo) GetByID(id uint) (*models.User, error) {
 	return nil, nil
 }
 
+// GetByName returns the user with the given login name
+func (r *UserRepo) GetByName(name string) (*models.User, error) {
+	for _, u := range r.users {
+		if u.Name == name {
+			ret := u // copy
+			return &ret, nil
+		}
+	}
+	return nil, nil
+}
+
 // GetByCredentials returns the user which has the given username and password - this is used for login
 func (r *UserRepo) GetByCredentials(username string, password string) (*models.User, error) {
 	for _, u := range r.users {
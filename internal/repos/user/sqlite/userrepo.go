@@ -0,0 +1,141 @@
+// Package sqlite provides a user repository that stores its data inside a SQLite database
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/derWhity/kyabia/internal/log"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	userFields = `name, passwordHash, fullName, permissions`
+)
+
+// UserRepo is a repository that stores its data inside a SQLite database
+type UserRepo struct {
+	db     *sqlx.DB
+	logger *logrus.Entry
+}
+
+// New creates a new user repository instance with the given database and logger
+func New(db *sqlx.DB, logger *logrus.Entry) *UserRepo {
+	return &UserRepo{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create creates a new user
+func (r *UserRepo) Create(u *models.User) error {
+	r.logger.WithField(log.FldUser, u.Name).Debug("Adding new user")
+	query := fmt.Sprintf(
+		"INSERT INTO Users(%s, createdAt, updatedAt) VALUES(?, ?, ?, ?, datetime('now'), datetime('now'))",
+		userFields,
+	)
+	res, err := r.db.Exec(query, u.Name, u.PasswordHash, u.FullName, u.Permissions)
+	if err != nil {
+		return fmt.Errorf("Create: Failed to store user: %v", err)
+	}
+	var id int64
+	if id, err = res.LastInsertId(); err == nil {
+		u.ID = uint(id)
+	}
+	return err
+}
+
+// Update updates an existing user
+func (r *UserRepo) Update(u *models.User) error {
+	r.logger.WithField(log.FldID, u.ID).Debug("Updating user")
+	query := `UPDATE Users SET name = ?, passwordHash = ?, fullName = ?, permissions = ?, updatedAt = datetime('now')
+        WHERE id = ?`
+	res, err := r.db.Exec(query, u.Name, u.PasswordHash, u.FullName, u.Permissions, u.ID)
+	if err != nil {
+		return fmt.Errorf("Update: Failed to update user: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
+// Delete removes an existing user from the user storage
+func (r *UserRepo) Delete(id uint) error {
+	r.logger.WithField(log.FldID, id).Debug("Deleting user")
+	res, err := r.db.Exec("DELETE FROM Users WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("Delete: Failed to remove user: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
+// GetByID returns the user with the given ID
+func (r *UserRepo) GetByID(id uint) (*models.User, error) {
+	query := fmt.Sprintf("SELECT id, %s FROM Users WHERE id = ?", userFields)
+	var u models.User
+	if err := r.db.Get(&u, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrEntityNotExisting
+		}
+		return nil, fmt.Errorf("GetByID: Failed to load user: %v", err)
+	}
+	return &u, nil
+}
+
+// GetByName returns the user with the given login name
+func (r *UserRepo) GetByName(name string) (*models.User, error) {
+	query := fmt.Sprintf("SELECT id, %s FROM Users WHERE name = ?", userFields)
+	var u models.User
+	if err := r.db.Get(&u, query, name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrEntityNotExisting
+		}
+		return nil, fmt.Errorf("GetByName: Failed to load user: %v", err)
+	}
+	return &u, nil
+}
+
+// GetByCredentials returns the user which has the given username and password - this is used for login. If the user
+// does not exist or the password does not match, nil is returned
+func (r *UserRepo) GetByCredentials(username string, password string) (*models.User, error) {
+	query := fmt.Sprintf("SELECT id, %s FROM Users WHERE name = ?", userFields)
+	var u models.User
+	if err := r.db.Get(&u, query, username); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("GetByCredentials: Failed to load user: %v", err)
+	}
+	if u.CheckPassword(password) != nil {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+// Find searches for users matching the given search string - supports pagination
+func (r *UserRepo) Find(search string, offset uint, limit uint) ([]*models.User, error) {
+	if limit == 0 {
+		limit = 50
+	}
+	r.logger.WithFields(logrus.Fields{
+		log.FldSearch: search,
+		log.FldOffset: offset,
+		log.FldLimit:  limit,
+	}).Debug("Searching for user")
+	query := fmt.Sprintf(`SELECT id, %s FROM Users WHERE
+        name LIKE $1 ESCAPE '\' OR fullName LIKE $1 ESCAPE '\'
+        ORDER BY name LIMIT $2 OFFSET $3`, userFields)
+	ret := []*models.User{}
+	if err := r.db.Select(&ret, query, repos.LikePattern(search), limit, offset); err != nil {
+		return nil, fmt.Errorf("Find: Failed to query users: %v", err)
+	}
+	return ret, nil
+}
@@ -3,6 +3,9 @@ package sqlite
 
 import (
 	"fmt"
+	"strings"
+	"time"
+	"unicode"
 
 	"database/sql"
 
@@ -11,24 +14,114 @@ import (
 	"github.com/derWhity/kyabia/internal/repos"
 	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
 	// The field names in the video table
 	fieldNames = `sha512, filename, title, artist, language, relatedMedium, mediumDetail, description, duration,
                     width, height, videoFormat, videoBitrate, audioFormat, audioBitrate, numPlayed, numRequested,
-                    createdAt, updatedAt, identifier`
+                    createdAt, updatedAt, identifier, subtitleLanguages, frameRate, videoProfile, thumbnail, fileModTime,
+                    rotation, container, available, deletedAt, lastPlayedAt`
+	// The query used for updating all fields of a video - expects the arguments created by updateArgs
+	updateQuery = `UPDATE Videos SET
+        filename= ?, title= ?, artist= ?, language= ?, relatedMedium= ?, mediumDetail= ?, description= ?, duration= ?,
+        width= ?, height= ?, videoFormat= ?, videoBitrate= ?, audioFormat= ?, audioBitrate= ?, numPlayed= ?,
+        numRequested= ?, updatedAt = datetime('now'), identifier = ?, subtitleLanguages = ?,
+        frameRate = ?, videoProfile = ?, thumbnail = ?, fileModTime = ?, rotation = ?,
+        container = ?, available = ?, searchText = ?, sortTitle = ?
+    WHERE sha512 = ? AND deletedAt IS NULL`
+	// The facet value videos without a value in the counted field are grouped under
+	unknownFacetValue = "unknown"
+	// The condition used for filtering videos by tag - expects an optional tag as $2
+	tagCondition = `($2 = '' OR sha512 IN (SELECT videoHash FROM Tags WHERE tag = $2))`
+	// The condition used for searching videos - expects the folded search string as $1
+	// SQLite's LIKE only ignores the case of ASCII characters, so the search runs on the folded copy of the searchable
+	// fields instead
+	searchCondition = `searchText LIKE $1 ESCAPE '\'`
+	// The order of video lists - the folded title puts "Übel" between "tunes" and "zoo"
+	videoOrder = `sortTitle, artist COLLATE NOCASE, relatedMedium COLLATE NOCASE, mediumDetail COLLATE NOCASE`
 )
 
 // VideoRepo implements kyabia.VideoRepo and provides access to video data stored inside a SQLlite database
 type VideoRepo struct {
 	logger *logrus.Entry
 	db     *sqlx.DB
+	// Set if the full-text search table is available
+	fts bool
 }
 
 // New creates a new VideoRepo
 func New(db *sqlx.DB, logger *logrus.Entry) repos.VideoRepo {
-	return &VideoRepo{logger, db}
+	r := &VideoRepo{logger: logger, db: db}
+	if _, err := db.Exec("SELECT rowid FROM VideoSearch LIMIT 0"); err != nil {
+		logger.WithError(err).Info("Full-text search is not available - falling back to simple video search")
+	} else {
+		r.fts = true
+	}
+	if err := r.foldAll(); err != nil {
+		logger.WithError(err).Warn("Failed to fill the search columns - search results may be incomplete")
+	}
+	return r
+}
+
+// foldAll fills the folded search and sort columns of all videos that have none, yet - e.g. after they got added by
+// the database migration
+func (r *VideoRepo) foldAll() error {
+	var ids []string
+	if err := r.db.Select(&ids, "SELECT sha512 FROM Videos WHERE searchText IS NULL OR sortTitle IS NULL"); err != nil {
+		return fmt.Errorf("foldAll: Failed to load videos: %v", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	r.logger.Infof("Filling the search columns of %d videos", len(ids))
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("foldAll: Failed to start transaction: %v", err)
+	}
+	for _, id := range ids {
+		if err = updateFolded(tx, id); err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("foldAll: %v", err))
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("foldAll: Failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// updateFolded recalculates the folded search and sort columns of the given video from its current data
+func updateFolded(tx *sqlx.Tx, id string) error {
+	var v models.Video
+	if err := tx.Get(&v, fmt.Sprintf("SELECT %s FROM Videos WHERE sha512 = ?", fieldNames), id); err != nil {
+		return fmt.Errorf("Failed to load video %s: %v", id, err)
+	}
+	query := "UPDATE Videos SET searchText = ?, sortTitle = ? WHERE sha512 = ?"
+	if _, err := tx.Exec(query, searchText(&v), fold(v.Title), id); err != nil {
+		return fmt.Errorf("Failed to update search columns of video %s: %v", id, err)
+	}
+	return nil
+}
+
+// searchText returns the folded text the simple video search runs on - all searchable fields separated by line breaks
+func searchText(v *models.Video) string {
+	return fold(strings.Join([]string{
+		v.Title, v.Artist, v.RelatedMedium, v.MediumDetail, v.Description, v.Identifier,
+	}, "\n"))
+}
+
+// fold returns the given string in lower case and with all accents removed, so "Übel" becomes "ubel"
+// The full-text search does not need this - its tokenizer already ignores case and accents
+func fold(str string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, str)
+	if err != nil {
+		folded = str
+	}
+	return strings.ToLower(folded)
 }
 
 // Create creates a new video entry
@@ -37,13 +130,27 @@ func (r *VideoRepo) Create(v *models.Video) error {
 		"sha512":    v.SHA512,
 		log.FldFile: v.Filename,
 	}).Debug("Creating video")
-	query := fmt.Sprintf(`INSERT INTO Videos(%s) VALUES(
-	    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, 0, datetime('now'), datetime('now'), ?
+	// A deleted video with the same hash is replaced by the new one
+	var numDeleted uint
+	query := "SELECT COUNT(*) FROM Videos WHERE sha512 = ? AND deletedAt IS NOT NULL"
+	if err := r.db.Get(&numDeleted, query, v.SHA512); err != nil {
+		return fmt.Errorf("Create: Failed to check for deleted video: %v", err)
+	}
+	if numDeleted > 0 {
+		if err := r.purge([]string{v.SHA512}); err != nil {
+			return fmt.Errorf("Create: Failed to remove deleted video: %v", err)
+		}
+	}
+	query = fmt.Sprintf(`INSERT INTO Videos(%s, searchText, sortTitle) VALUES(
+	    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, 0, datetime('now'), datetime('now'), ?, ?, ?, ?, ?, ?, ?, ?, 1,
+	    NULL, NULL, ?, ?
 	)`, fieldNames)
 	_, err := r.db.Exec(
 		query,
 		v.SHA512, v.Filename, v.Title, v.Artist, v.Language, v.RelatedMedium, v.MediumDetail, v.Description, v.Duration,
 		v.Width, v.Height, v.VideoFormat, v.VideoBitrate, v.AudioFormat, v.AudioBitrate, v.Identifier,
+		v.SubtitleLanguages, v.FrameRate, v.VideoProfile, v.Thumbnail, v.FileModTime, v.Rotation, v.Container,
+		searchText(v), fold(v.Title),
 	)
 	return err
 }
@@ -61,22 +168,26 @@ func (r *VideoRepo) BumpNumRequested(id string) error {
 	return nil
 }
 
+// BumpNumPlayed increases the "numPlayed" counter on the given video and sets its "lastPlayedAt" timestamp
+func (r *VideoRepo) BumpNumPlayed(id string) error {
+	query := `UPDATE Videos SET numPlayed = numPlayed+1, lastPlayedAt = datetime('now') WHERE sha512 = ?`
+	res, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("BumpNumPlayed: Failed to update video entry: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
 // Update updates an existing video entry
 func (r *VideoRepo) Update(v *models.Video) error {
 	r.logger.WithFields(logrus.Fields{
 		"sha512":    v.SHA512,
 		log.FldFile: v.Filename,
 	}).Debug("Updating video")
-	query := `UPDATE Videos SET
-        filename= ?, title= ?, artist= ?, language= ?, relatedMedium= ?, mediumDetail= ?, description= ?, duration= ?,
-        width= ?, height= ?, videoFormat= ?, videoBitrate= ?, audioFormat= ?, audioBitrate= ?, numPlayed= ?,
-        numRequested= ?, updatedAt = datetime('now'), identifier = ?
-    WHERE sha512 = ?`
-	res, err := r.db.Exec(query,
-		v.Filename, v.Title, v.Artist, v.Language, v.RelatedMedium, v.MediumDetail, v.Description, v.Duration, v.Width,
-		v.Height, v.VideoFormat, v.VideoBitrate, v.AudioFormat, v.AudioBitrate, v.NumPlayed, v.NumRequested,
-		v.Identifier, v.SHA512,
-	)
+	res, err := r.db.Exec(updateQuery, updateArgs(v)...)
 	if err != nil {
 		return err
 	}
@@ -89,10 +200,154 @@ func (r *VideoRepo) Update(v *models.Video) error {
 	return nil
 }
 
-// Delete removes an existing video entry from the storage
+// updateArgs returns the arguments for the update query of the given video
+func updateArgs(v *models.Video) []interface{} {
+	return []interface{}{
+		v.Filename, v.Title, v.Artist, v.Language, v.RelatedMedium, v.MediumDetail, v.Description, v.Duration, v.Width,
+		v.Height, v.VideoFormat, v.VideoBitrate, v.AudioFormat, v.AudioBitrate, v.NumPlayed, v.NumRequested,
+		v.Identifier, v.SubtitleLanguages, v.FrameRate, v.VideoProfile, v.Thumbnail, v.FileModTime, v.Rotation, v.Container,
+		v.Available, searchText(v), fold(v.Title), v.SHA512,
+	}
+}
+
+// Merge updates the given video and moves everything referencing the video with the hash mergeHash over to it - the
+// playlist entries, the tags, the chapters if the given video has none and the per-event statistics, which are added
+// to the ones of the given video. Afterwards, the merged video is removed permanently. Everything happens inside a
+// single transaction
+func (r *VideoRepo) Merge(v *models.Video, mergeHash string) error {
+	r.logger.WithField(log.FldVideo, v.SHA512).WithField("mergedVideo", mergeHash).Debug("Merging videos")
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("Merge: Failed to start transaction: %v", err)
+	}
+	res, err := tx.Exec(updateQuery, updateArgs(v)...)
+	if err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to update video: %v", err))
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.DoRollback(tx, repos.ErrEntityNotExisting)
+	}
+	// The update leaves the timestamp of the last play alone - so take the latest one of both videos
+	query := `UPDATE Videos SET lastPlayedAt = (SELECT MAX(lastPlayedAt) FROM Videos WHERE sha512 IN (?, ?))
+        WHERE sha512 = ?`
+	if _, err = tx.Exec(query, v.SHA512, mergeHash, v.SHA512); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to update last play: %v", err))
+	}
+	query = "UPDATE PlaylistEntries SET videoHash = ? WHERE videoHash = ?"
+	if _, err = tx.Exec(query, v.SHA512, mergeHash); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to move playlist entries: %v", err))
+	}
+	query = "INSERT OR IGNORE INTO Tags(videoHash, tag) SELECT ?, tag FROM Tags WHERE videoHash = ?"
+	if _, err = tx.Exec(query, v.SHA512, mergeHash); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to move tags: %v", err))
+	}
+	var numChapters uint
+	if err = tx.Get(&numChapters, "SELECT COUNT(*) FROM Chapters WHERE videoHash = ?", v.SHA512); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to count chapters: %v", err))
+	}
+	if numChapters == 0 {
+		query = "UPDATE Chapters SET videoHash = ? WHERE videoHash = ?"
+		if _, err = tx.Exec(query, v.SHA512, mergeHash); err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to move chapters: %v", err))
+		}
+	}
+	// The per-event statistics of the merged video are added to the ones of the kept video
+	query = `INSERT OR IGNORE INTO VideoStatistics(eventId, videoHash)
+        SELECT eventId, ? FROM VideoStatistics WHERE videoHash = ?`
+	if _, err = tx.Exec(query, v.SHA512, mergeHash); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to create statistics: %v", err))
+	}
+	query = `UPDATE VideoStatistics SET
+            numPlayed = numPlayed + (
+                SELECT m.numPlayed FROM VideoStatistics m WHERE m.eventId = VideoStatistics.eventId AND m.videoHash = $1
+            ),
+            numRequested = numRequested + (
+                SELECT m.numRequested FROM VideoStatistics m WHERE m.eventId = VideoStatistics.eventId AND m.videoHash = $1
+            )
+        WHERE videoHash = $2 AND eventId IN (SELECT eventId FROM VideoStatistics WHERE videoHash = $1)`
+	if _, err = tx.Exec(query, mergeHash, v.SHA512); err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to move statistics: %v", err))
+	}
+	for _, table := range []string{"Chapters", "Tags", "VideoStatistics"} {
+		if _, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE videoHash = ?", table), mergeHash); err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to remove %s of merged video: %v", table, err))
+		}
+	}
+	res, err = tx.Exec("DELETE FROM Videos WHERE sha512 = ? AND deletedAt IS NULL", mergeHash)
+	if err != nil {
+		return repos.DoRollback(tx, fmt.Errorf("Merge: Failed to remove merged video: %v", err))
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.DoRollback(tx, repos.ErrEntityNotExisting)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("Merge: Failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// UpdateMany applies the non-empty fields of the patch to all videos having one of the given IDs. Returns the number
+// of videos updated - IDs of videos not existing are skipped
+func (r *VideoRepo) UpdateMany(ids []string, patch models.VideoPatch) (uint, error) {
+	r.logger.Debugf("Updating %d videos", len(ids))
+	var sets []string
+	var args []interface{}
+	for _, field := range []struct {
+		name string
+		val  string
+	}{
+		{"title", patch.Title},
+		{"artist", patch.Artist},
+		{"description", patch.Description},
+		{"relatedMedium", patch.RelatedMedium},
+		{"mediumDetail", patch.MediumDetail},
+		{"language", patch.Language},
+	} {
+		if field.val != "" {
+			sets = append(sets, field.name+" = ?")
+			args = append(args, field.val)
+		}
+	}
+	if len(sets) == 0 || len(ids) == 0 {
+		return 0, nil
+	}
+	query := fmt.Sprintf(
+		"UPDATE Videos SET %s, updatedAt = datetime('now') WHERE sha512 = ? AND deletedAt IS NULL",
+		strings.Join(sets, ", "),
+	)
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("UpdateMany: Failed to start transaction: %v", err)
+	}
+	var numUpdated uint
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		res, err := tx.Exec(query, append(args, id)...)
+		if err != nil {
+			return 0, repos.DoRollback(tx, fmt.Errorf("UpdateMany: Failed to update video %s: %v", id, err))
+		}
+		if num, err := res.RowsAffected(); err == nil && num > 0 {
+			numUpdated++
+			if err = updateFolded(tx, id); err != nil {
+				return 0, repos.DoRollback(tx, fmt.Errorf("UpdateMany: %v", err))
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("UpdateMany: Failed to commit transaction: %v", err)
+	}
+	return numUpdated, nil
+}
+
+// Delete marks an existing video entry as deleted. The video and everything referencing it is kept until it gets
+// purged - so it can be restored
 func (r *VideoRepo) Delete(id string) error {
-	r.logger.WithField(log.FldVideo, id).Debug("Deleting video", "sha512", id)
-	query := "DELETE FROM Videos WHERE sha512 = ?"
+	r.logger.WithField(log.FldVideo, id).Debug("Deleting video")
+	query := "UPDATE Videos SET deletedAt = datetime('now') WHERE sha512 = ? AND deletedAt IS NULL"
 	res, err := r.db.Exec(query, id)
 	if err != nil {
 		return err
@@ -103,11 +358,56 @@ func (r *VideoRepo) Delete(id string) error {
 		}
 		return repos.ErrEntityNotExisting
 	}
-	// Also delete all playlist entries that reference this video
-	query = "DELETE FROM PlaylistEntries WHERE videoHash = ?"
-	if _, err := r.db.Exec(query, id); err != nil {
-		// No need to return an error - but we'll log this
-		r.logger.WithField(log.FldVideo, id).WithError(err).Error("Failed to delete playlist entries for deleted video")
+	return nil
+}
+
+// Restore restores a deleted video entry
+func (r *VideoRepo) Restore(id string) error {
+	r.logger.WithField(log.FldVideo, id).Debug("Restoring video")
+	query := "UPDATE Videos SET deletedAt = NULL WHERE sha512 = ? AND deletedAt IS NOT NULL"
+	res, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("Restore: Failed to update video entry: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
+// Purge permanently removes all video entries that have been deleted longer than the given duration ago - together
+// with their playlist entries, chapters and tags. Returns the number of videos removed
+func (r *VideoRepo) Purge(olderThan time.Duration) (uint, error) {
+	r.logger.Debugf("Purging videos deleted more than %s ago", olderThan)
+	query := "SELECT sha512 FROM Videos WHERE deletedAt <= datetime('now', ?)"
+	var ids []string
+	if err := r.db.Select(&ids, query, fmt.Sprintf("-%d seconds", int64(olderThan.Seconds()))); err != nil {
+		return 0, fmt.Errorf("Purge: Failed to load deleted videos: %v", err)
+	}
+	if err := r.purge(ids); err != nil {
+		return 0, fmt.Errorf("Purge: %v", err)
+	}
+	return uint(len(ids)), nil
+}
+
+// purge permanently removes the video entries with the given IDs and everything referencing them
+func (r *VideoRepo) purge(ids []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to start transaction: %v", err)
+	}
+	for _, id := range ids {
+		for _, table := range []string{"PlaylistEntries", "Chapters", "Tags"} {
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE videoHash = ?", table), id); err != nil {
+				return repos.DoRollback(tx, fmt.Errorf("Failed to remove %s of video %s: %v", table, id, err))
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM Videos WHERE sha512 = ?", id); err != nil {
+			return repos.DoRollback(tx, fmt.Errorf("Failed to remove video %s: %v", id, err))
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to commit transaction: %v", err)
 	}
 	return nil
 }
@@ -115,7 +415,7 @@ func (r *VideoRepo) Delete(id string) error {
 // GetByID returns the video entry having the given ID
 func (r *VideoRepo) GetByID(id string) (*models.Video, error) {
 	r.logger.WithField(log.FldVideo, id).Debug("Loading video")
-	query := fmt.Sprintf("SELECT %s FROM Videos WHERE sha512 = ?", fieldNames)
+	query := fmt.Sprintf("SELECT %s FROM Videos WHERE sha512 = ? AND deletedAt IS NULL", fieldNames)
 	var vid models.Video
 	err := r.db.Get(&vid, query, id)
 	if err != nil {
@@ -128,45 +428,301 @@ func (r *VideoRepo) GetByID(id string) (*models.Video, error) {
 	return &vid, nil
 }
 
-// Find searches for videos matching the given search string - supports pagination
+// GetByFilename returns the video entry that has been scraped from the file with the given name
+func (r *VideoRepo) GetByFilename(filename string) (*models.Video, error) {
+	r.logger.WithField(log.FldFile, filename).Debug("Loading video by file name")
+	query := fmt.Sprintf("SELECT %s FROM Videos WHERE filename = ? AND deletedAt IS NULL LIMIT 1", fieldNames)
+	var vid models.Video
+	err := r.db.Get(&vid, query, filename)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Nothing found
+			return nil, repos.ErrEntityNotExisting
+		}
+		return nil, err
+	}
+	return &vid, nil
+}
+
+// GetByIdentifier returns all video entries having the given identifier - ordered by title and artist
+func (r *VideoRepo) GetByIdentifier(identifier string) ([]models.Video, error) {
+	r.logger.WithField("identifier", identifier).Debug("Loading videos by identifier")
+	query := fmt.Sprintf(
+		"SELECT %s FROM Videos WHERE identifier = ? AND deletedAt IS NULL ORDER BY %s",
+		fieldNames,
+		videoOrder,
+	)
+	ret := []models.Video{}
+	if err := r.db.Select(&ret, query, identifier); err != nil {
+		return nil, fmt.Errorf("GetByIdentifier: Failed to load videos: %v", err)
+	}
+	return ret, nil
+}
+
+// Find searches for videos matching the given search string and filter - supports pagination
 // Returned is the requested page of the videos and the number of videos in the full result set
-func (r *VideoRepo) Find(search string, offset uint, limit uint) ([]models.Video, uint, error) {
+func (r *VideoRepo) Find(search string, filter repos.VideoFilter, offset uint, limit uint) ([]models.Video, uint, error) {
 	if limit == 0 {
 		limit = 50
 	}
 	r.logger.WithFields(logrus.Fields{
 		log.FldSearch: search,
+		"tag":         filter.Tag,
 		log.FldOffset: offset,
 		log.FldLimit:  limit,
 	}).Debug("Searching for video")
-	// For now, we're using a simple LIKE search
-	search = "%" + search + "%"
-	query := fmt.Sprintf(`SELECT %s FROM Videos WHERE
-        title LIKE $1 OR
-        artist LIKE $1 OR
-        relatedMedium LIKE $1 OR
-        mediumDetail LIKE $1 OR
-        description LIKE $1 OR
-		identifier LIKE $1
-		ORDER BY title, artist, relatedMedium, mediumDetail
-        LIMIT $2 OFFSET $3
-    `, fieldNames)
+	if match := ftsQuery(search); r.fts && match != "" {
+		ret, numRows, err := r.findFullText(match, filter, offset, limit)
+		if err == nil {
+			return ret, numRows, nil
+		}
+		r.logger.WithError(err).WithField(log.FldSearch, search).Warn("Full-text search failed - using simple search")
+	}
+	search = repos.LikePattern(fold(search))
+	query := fmt.Sprintf(`SELECT %s FROM Videos WHERE %s AND %s
+		ORDER BY %s
+        LIMIT $3 OFFSET $4
+    `, fieldNames, searchCondition, filterCondition(filter), videoOrder)
 	var ret []models.Video
-	err := r.db.Select(&ret, query, search, limit, offset)
+	err := r.db.Select(&ret, query, search, filter.Tag, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
 	// Query the full count
-	query = `SELECT COUNT(*) FROM Videos WHERE
-		title LIKE $1 OR
-        artist LIKE $1 OR
-        relatedMedium LIKE $1 OR
-        mediumDetail LIKE $1 OR
-        description LIKE $1 OR
-		identifier LIKE $1`
+	query = fmt.Sprintf(`SELECT COUNT(*) FROM Videos WHERE %s AND %s`, searchCondition, filterCondition(filter))
+	var numRows uint
+	if err = r.db.Get(&numRows, query, search, filter.Tag); err != nil {
+		return nil, 0, err
+	}
+	return ret, numRows, nil
+}
+
+// findFullText searches for videos using the full-text search table - the results are ordered by relevance
+func (r *VideoRepo) findFullText(
+	match string,
+	filter repos.VideoFilter,
+	offset uint,
+	limit uint,
+) ([]models.Video, uint, error) {
+	query := fmt.Sprintf(`SELECT %s FROM Videos
+        INNER JOIN (SELECT sha512 AS hash, rank FROM VideoSearch WHERE VideoSearch MATCH $1) ON hash = sha512
+        WHERE %s
+        ORDER BY rank, %s
+        LIMIT $3 OFFSET $4
+    `, fieldNames, filterCondition(filter), videoOrder)
+	var ret []models.Video
+	if err := r.db.Select(&ret, query, match, filter.Tag, limit, offset); err != nil {
+		return nil, 0, err
+	}
+	query = fmt.Sprintf(`SELECT COUNT(*) FROM Videos
+        WHERE sha512 IN (SELECT sha512 FROM VideoSearch WHERE VideoSearch MATCH $1) AND %s
+    `, filterCondition(filter))
 	var numRows uint
-	if err = r.db.Get(&numRows, query, search); err != nil {
+	if err := r.db.Get(&numRows, query, match, filter.Tag); err != nil {
 		return nil, 0, err
 	}
 	return ret, numRows, nil
 }
+
+// filterCondition returns the condition restricting a video search to the given filter - it expects the tag as $2
+// Deleted videos are always filtered out
+func filterCondition(filter repos.VideoFilter) string {
+	cond := "deletedAt IS NULL AND " + tagCondition
+	if filter.Available != nil {
+		if *filter.Available {
+			cond += " AND available = 1"
+		} else {
+			cond += " AND available = 0"
+		}
+	}
+	if filter.NotPlayedWithin > 0 {
+		cond += fmt.Sprintf(
+			" AND (lastPlayedAt IS NULL OR lastPlayedAt <= datetime('now', '-%d seconds'))",
+			int64(filter.NotPlayedWithin.Seconds()),
+		)
+	}
+	return cond
+}
+
+// ftsQuery turns the given search string into a full-text query matching all videos containing words starting with
+// each of the search terms. Returns an empty string if there is nothing to search for
+func ftsQuery(search string) string {
+	var terms []string
+	for _, term := range strings.Fields(search) {
+		terms = append(terms, `"`+strings.Replace(term, `"`, `""`, -1)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// FindArtists returns the distinct, non-empty artist names starting with the given prefix in alphabetical order
+func (r *VideoRepo) FindArtists(prefix string, limit uint) ([]string, error) {
+	return r.distinctValues("artist", prefix, limit)
+}
+
+// FindRelatedMedia returns the distinct, non-empty related media starting with the given prefix in alphabetical order
+func (r *VideoRepo) FindRelatedMedia(prefix string, limit uint) ([]string, error) {
+	return r.distinctValues("relatedMedium", prefix, limit)
+}
+
+// distinctValues returns the distinct, non-empty values of the given field that start with the given prefix
+func (r *VideoRepo) distinctValues(field string, prefix string, limit uint) ([]string, error) {
+	r.logger.WithFields(logrus.Fields{
+		log.FldSearch: prefix,
+		log.FldLimit:  limit,
+	}).Debugf("Searching for distinct %s values", field)
+	query := fmt.Sprintf(`SELECT DISTINCT %s FROM Videos
+        WHERE %s != '' AND %s LIKE ? ESCAPE '\' AND deletedAt IS NULL
+        ORDER BY %s COLLATE NOCASE LIMIT ?`, field, field, field, field)
+	ret := []string{}
+	if err := r.db.Select(&ret, query, repos.LikePrefixPattern(prefix), limit); err != nil {
+		return nil, fmt.Errorf("Failed to load distinct %s values: %v", field, err)
+	}
+	return ret, nil
+}
+
+// CountByLanguage returns the number of videos per language - ordered by the number of videos. Videos without a language
+// are counted as "unknown". If onlyAvailable is set, unavailable videos are not counted
+func (r *VideoRepo) CountByLanguage(onlyAvailable bool) ([]models.FacetCount, error) {
+	r.logger.Debug("Counting videos by language")
+	cond := "deletedAt IS NULL"
+	if onlyAvailable {
+		cond += " AND available = 1"
+	}
+	query := fmt.Sprintf(`SELECT CASE WHEN language = '' THEN ? ELSE language END AS value, COUNT(*) AS count
+        FROM Videos WHERE %s GROUP BY value ORDER BY count DESC, value`, cond)
+	ret := []models.FacetCount{}
+	if err := r.db.Select(&ret, query, unknownFacetValue); err != nil {
+		return nil, fmt.Errorf("CountByLanguage: Failed to count videos: %v", err)
+	}
+	return ret, nil
+}
+
+// FindTop returns the videos that have been requested most - or played most if byPlayed is set. Videos that have never
+// been requested (or played) are left out
+func (r *VideoRepo) FindTop(limit uint, byPlayed bool) ([]models.Video, error) {
+	r.logger.WithField(log.FldLimit, limit).Debug("Loading top videos")
+	counter, other := "numRequested", "numPlayed"
+	if byPlayed {
+		counter, other = other, counter
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM Videos WHERE %s > 0 AND deletedAt IS NULL ORDER BY %s DESC, %s DESC, sortTitle LIMIT ?",
+		fieldNames,
+		counter,
+		counter,
+		other,
+	)
+	ret := []models.Video{}
+	if err := r.db.Select(&ret, query, limit); err != nil {
+		return nil, fmt.Errorf("FindTop: Failed to load videos: %v", err)
+	}
+	return ret, nil
+}
+
+// Each calls the given function for every video matching the given search string and filter - one at a time without
+// loading all videos into memory. If the function returns an error, the iteration stops and the error is returned
+func (r *VideoRepo) Each(search string, filter repos.VideoFilter, fn func(v *models.Video) error) error {
+	r.logger.WithFields(logrus.Fields{
+		log.FldSearch: search,
+		"tag":         filter.Tag,
+	}).Debug("Iterating over videos")
+	search = repos.LikePattern(fold(search))
+	query := fmt.Sprintf(`SELECT %s FROM Videos WHERE %s AND %s
+		ORDER BY %s
+    `, fieldNames, searchCondition, filterCondition(filter), videoOrder)
+	rows, err := r.db.Queryx(query, search, filter.Tag)
+	if err != nil {
+		return fmt.Errorf("Each: Failed to query videos: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var vid models.Video
+		if err := rows.StructScan(&vid); err != nil {
+			return fmt.Errorf("Each: Failed to read video: %v", err)
+		}
+		if err := fn(&vid); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Relocate replaces the prefix of the file names of all videos starting with oldPrefix by newPrefix and returns the
+// number of videos changed. Deleted videos are relocated, too
+func (r *VideoRepo) Relocate(oldPrefix string, newPrefix string) (uint, error) {
+	r.logger.WithFields(logrus.Fields{
+		"oldPrefix": oldPrefix,
+		"newPrefix": newPrefix,
+	}).Debug("Relocating videos")
+	query := `UPDATE Videos SET filename = $1 || substr(filename, length($2) + 1), updatedAt = datetime('now')
+        WHERE substr(filename, 1, length($2)) = $2`
+	res, err := r.db.Exec(query, newPrefix, oldPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("Relocate: Failed to update video entries: %v", err)
+	}
+	num, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Relocate: Failed to get number of updated rows: %v", err)
+	}
+	return uint(num), nil
+}
+
+// SetAvailable marks the given video as available or unavailable
+func (r *VideoRepo) SetAvailable(id string, available bool) error {
+	r.logger.WithField(log.FldVideo, id).Debugf("Setting availability to %t", available)
+	query := `UPDATE Videos SET available = ? WHERE sha512 = ?`
+	res, err := r.db.Exec(query, available, id)
+	if err != nil {
+		return fmt.Errorf("SetAvailable: Failed to update video entry: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
+// GetTags returns the tags of the given video in alphabetical order
+func (r *VideoRepo) GetTags(id string) ([]string, error) {
+	query := "SELECT tag FROM Tags WHERE videoHash = ? ORDER BY tag"
+	ret := []string{}
+	if err := r.db.Select(&ret, query, id); err != nil {
+		return nil, fmt.Errorf("GetTags: Failed to load tags: %v", err)
+	}
+	return ret, nil
+}
+
+// AddTag adds a tag to the given video. Adding a tag the video already has does nothing
+func (r *VideoRepo) AddTag(id string, tag string) error {
+	r.logger.WithField(log.FldVideo, id).WithField("tag", tag).Debug("Adding tag to video")
+	query := "INSERT OR IGNORE INTO Tags(videoHash, tag) VALUES(?, ?)"
+	if _, err := r.db.Exec(query, id, tag); err != nil {
+		return fmt.Errorf("AddTag: Failed to add tag: %v", err)
+	}
+	return nil
+}
+
+// RemoveTag removes a tag from the given video
+func (r *VideoRepo) RemoveTag(id string, tag string) error {
+	r.logger.WithField(log.FldVideo, id).WithField("tag", tag).Debug("Removing tag from video")
+	query := "DELETE FROM Tags WHERE videoHash = ? AND tag = ?"
+	res, err := r.db.Exec(query, id, tag)
+	if err != nil {
+		return fmt.Errorf("RemoveTag: Failed to remove tag: %v", err)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return repos.ErrEntityNotExisting
+	}
+	return nil
+}
+
+// ListTags returns all distinct tags used by any video in alphabetical order
+func (r *VideoRepo) ListTags() ([]string, error) {
+	query := `SELECT DISTINCT tag FROM Tags
+        WHERE videoHash IN (SELECT sha512 FROM Videos WHERE deletedAt IS NULL)
+        ORDER BY tag`
+	ret := []string{}
+	if err := r.db.Select(&ret, query); err != nil {
+		return nil, fmt.Errorf("ListTags: Failed to load tags: %v", err)
+	}
+	return ret, nil
+}
@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/derWhity/kyabia/internal/migrate"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestRepo creates a video repository working on a fresh in-memory database containing videos with the given
+// titles. The full-text search is switched off, so searches run on the simple LIKE search
+func newTestRepo(t *testing.T, titles ...string) *VideoRepo {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	// Every connection would get its own in-memory database otherwise
+	db.SetMaxOpenConns(1)
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	logger := logrus.NewEntry(l)
+	if err := migrate.ExecuteMigrationsOnDb(db, logger); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	r := New(db, logger).(*VideoRepo)
+	r.fts = false
+	for i, title := range titles {
+		var v models.Video
+		v.SHA512 = string(rune('a' + i))
+		v.Filename = title + ".mp4"
+		v.Title = title
+		if err := r.Create(&v); err != nil {
+			t.Fatalf("Failed to create video '%s': %v", title, err)
+		}
+	}
+	return r
+}
+
+// findTitles returns the titles of all videos found for the given search string in the order returned
+func findTitles(t *testing.T, r *VideoRepo, search string) []string {
+	videos, numRows, err := r.Find(search, repos.VideoFilter{}, 0, 100)
+	if err != nil {
+		t.Fatalf("Find(%q) failed: %v", search, err)
+	}
+	if numRows != uint(len(videos)) {
+		t.Errorf("Find(%q) returned %d videos, but counted %d", search, len(videos), numRows)
+	}
+	titles := []string{}
+	for _, v := range videos {
+		titles = append(titles, v.Title)
+	}
+	return titles
+}
+
+func assertTitles(t *testing.T, search string, got []string, want []string) {
+	if len(got) != len(want) {
+		t.Errorf("Find(%q) = %q, want %q", search, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("Find(%q) = %q, want %q", search, got, want)
+			return
+		}
+	}
+}
+
+func TestFindEscapesWildcards(t *testing.T) {
+	r := newTestRepo(t, "snake_case", "snakeXcase", "100% pure", "1000 pure", `back\slash`, "backslash")
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"e_c", []string{"snake_case"}},
+		{"_", []string{"snake_case"}},
+		{"0%", []string{"100% pure"}},
+		{"%", []string{"100% pure"}},
+		{`k\s`, []string{`back\slash`}},
+		{`\`, []string{`back\slash`}},
+		{"snake", []string{"snake_case", "snakeXcase"}},
+	}
+	for _, tt := range tests {
+		assertTitles(t, tt.search, findTitles(t, r, tt.search), tt.want)
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{"abc", "%abc%"},
+		{"a_c", `%a\_c%`},
+		{"100%", `%100\%%`},
+		{`a\b`, `%a\\b%`},
+	}
+	for _, tt := range tests {
+		if got := repos.LikePattern(tt.search); got != tt.want {
+			t.Errorf("LikePattern(%q) = %q, want %q", tt.search, got, tt.want)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		str  string
+		want string
+	}{
+		{"Übel", "ubel"},
+		{"TUNES", "tunes"},
+		{"Crème Brûlée", "creme brulee"},
+		{"Ångström", "angstrom"},
+		{"plain", "plain"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := fold(tt.str); got != tt.want {
+			t.Errorf("fold(%q) = %q, want %q", tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestFindSortsAndMatchesFolded(t *testing.T) {
+	r := newTestRepo(t, "zoo", "Übel", "tunes", "Apple", "übel 2")
+	assertTitles(t, "", findTitles(t, r, ""), []string{"Apple", "tunes", "Übel", "übel 2", "zoo"})
+	assertTitles(t, "ubel", findTitles(t, r, "ubel"), []string{"Übel", "übel 2"})
+	assertTitles(t, "ÜBEL", findTitles(t, r, "ÜBEL"), []string{"Übel", "übel 2"})
+	assertTitles(t, "APPLE", findTitles(t, r, "APPLE"), []string{"Apple"})
+}
+
+func TestMergeFoldsStatistics(t *testing.T) {
+	r := newTestRepo(t, "kept", "merged", "other")
+	// Event 1 has statistics for all videos, event 2 only for the merged one
+	r.db.MustExec(`INSERT INTO VideoStatistics(eventId, videoHash, numPlayed, numRequested)
+        VALUES (1, 'a', 1, 2), (1, 'b', 3, 4), (2, 'b', 5, 6), (1, 'c', 7, 8)`)
+	kept, err := r.GetByID("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Merge(kept, "b"); err != nil {
+		t.Fatal(err)
+	}
+	var stats []models.VideoStatistics
+	query := "SELECT eventId, videoHash, numPlayed, numRequested FROM VideoStatistics ORDER BY id"
+	if err := r.db.Select(&stats, query); err != nil {
+		t.Fatal(err)
+	}
+	want := []models.VideoStatistics{
+		{EventID: 1, VideoHash: "a", NumPlayed: 4, NumRequested: 6},
+		{EventID: 1, VideoHash: "c", NumPlayed: 7, NumRequested: 8},
+		{EventID: 2, VideoHash: "a", NumPlayed: 5, NumRequested: 6},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("Got statistics %+v, want %+v", stats, want)
+	}
+	for i := range stats {
+		if stats[i] != want[i] {
+			t.Errorf("Got statistics %+v, want %+v", stats, want)
+			break
+		}
+	}
+}
@@ -16,3 +16,21 @@ type Search struct {
 	// The string to search for
 	Search string
 }
+
+// PlaylistEntrySearch is a search for playlist entries that can additionally be filtered by the requester's name
+type PlaylistEntrySearch struct {
+	Search
+	// If set, only entries whose requester's name contains this string are returned
+	RequestedBy string
+}
+
+// VideoSearch is a search for videos that can additionally be filtered by a tag
+type VideoSearch struct {
+	Search
+	// If set, only videos having this tag are returned
+	Tag string
+	// If set, only videos that are available (or unavailable) are returned
+	Available *bool
+	// If set, videos that have been played within this number of minutes are left out
+	NotPlayedWithin uint
+}
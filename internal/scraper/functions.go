@@ -1,15 +1,16 @@
 package scraper
 
 import (
-	"bytes"
 	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -31,8 +32,9 @@ const (
 
 // FFProbeData is the data format the tool ffprobe generates in JSON
 type FFProbeData struct {
-	Format  *FFFormatInfo   `json:"format"`
-	Streams []*FFStreamInfo `json:"streams"`
+	Format   *FFFormatInfo    `json:"format"`
+	Streams  []*FFStreamInfo  `json:"streams"`
+	Chapters []*FFChapterInfo `json:"chapters"`
 }
 
 // GetFirstSteamByType returns the first stream in the media file's streams that has the given type
@@ -47,6 +49,39 @@ func (d *FFProbeData) GetFirstSteamByType(t string) *FFStreamInfo {
 	return nil
 }
 
+// GetTag returns the value of the tag with the given name (case-insensitive) from the format tags of the media file.
+// If the format has no such tag, the tags of the first video and audio streams are used as fallback
+func (d *FFProbeData) GetTag(name string) string {
+	tagMaps := []map[string]string{}
+	if d.Format != nil {
+		tagMaps = append(tagMaps, d.Format.Tags)
+	}
+	for _, t := range []string{ffTypeVideo, ffTypeAudio} {
+		if str := d.GetFirstSteamByType(t); str != nil {
+			tagMaps = append(tagMaps, str.Tags)
+		}
+	}
+	for _, tags := range tagMaps {
+		for key, val := range tags {
+			if strings.EqualFold(key, name) && strings.TrimSpace(val) != "" {
+				return strings.TrimSpace(val)
+			}
+		}
+	}
+	return ""
+}
+
+// GetStreamsByType returns all streams in the media file's streams that have the given type
+func (d *FFProbeData) GetStreamsByType(t string) []*FFStreamInfo {
+	var ret []*FFStreamInfo
+	for _, s := range d.Streams {
+		if s.CodecType == t {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
 // FFFormatInfo contains information about the media format.
 type FFFormatInfo struct {
 	Filename       string            `json:"filename"`
@@ -65,41 +100,144 @@ type FFFormatInfo struct {
 // FFStreamInfo contains information about a stream inside a media file
 // This struct does not contain all of the fields returned by ffprobe
 type FFStreamInfo struct {
-	CodecType     string `json:"codec_type"`
-	CodecName     string `json:"codec_name"`
-	CodecLongName string `json:"codec_long_name"`
-	Width         int    `json:"width"`
-	Height        int    `json:"height"`
-	Bitrate       string `json:"bit_rate"`
+	CodecType     string            `json:"codec_type"`
+	CodecName     string            `json:"codec_name"`
+	CodecLongName string            `json:"codec_long_name"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	Bitrate       string            `json:"bit_rate"`
+	FrameRate     string            `json:"r_frame_rate"`
+	Profile       string            `json:"profile"`
+	Disposition   map[string]int    `json:"disposition"`
+	Tags          map[string]string `json:"tags"`
+	SideDataList  []*FFSideData     `json:"side_data_list"`
 }
 
-// ScrapeFFProbe uses the ffprobe commandline tool to scrape the video metadata from its JSON output
-func ScrapeFFProbe(filename string, vid *models.Video, logger *logrus.Entry) error {
-	logger = logger.WithField("scraper", "FFProbe")
-	logger.Debug("Start scraping")
-	data, err := exec.Command(
-		"ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", filename,
-	).Output()
+// FFSideData contains additional information attached to a stream - like the display matrix
+type FFSideData struct {
+	SideDataType string `json:"side_data_type"`
+	// The counter-clockwise rotation of the display matrix in degrees
+	Rotation float64 `json:"rotation"`
+}
+
+// FFChapterInfo contains information about a chapter inside a media file
+type FFChapterInfo struct {
+	ID        int               `json:"id"`
+	StartTime string            `json:"start_time"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// GetRotation returns the clockwise rotation in degrees (0-359) the stream needs to be displayed with
+// The "rotate" tag is preferred - if it does not exist, the rotation of the display matrix side data is used
+func (s *FFStreamInfo) GetRotation() int {
+	rotation := 0
+	if i, err := strconv.Atoi(strings.TrimSpace(s.Tags["rotate"])); err == nil {
+		rotation = i
+	} else {
+		for _, sd := range s.SideDataList {
+			if sd.SideDataType == "Display Matrix" {
+				// The display matrix rotates counter-clockwise
+				rotation = -int(math.Round(sd.Rotation))
+				break
+			}
+		}
+	}
+	return ((rotation % 360) + 360) % 360
+}
+
+// parseFrameRate converts a frame rate given as fraction by ffprobe (like "30000/1001") into a number of frames per
+// second. Zero is returned if the frame rate cannot be parsed
+func parseFrameRate(rate string) float64 {
+	parts := strings.SplitN(rate, "/", 2)
+	num, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0
+	}
+	if len(parts) == 1 {
+		return num
+	}
+	den, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+// parseSeconds converts a number of seconds given as decimal string by ffprobe (like "12.345000") into a duration.
+// Zero is returned if the string cannot be parsed
+func parseSeconds(seconds string) time.Duration {
+	f, err := strconv.ParseFloat(strings.TrimSpace(seconds), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
+
+// The name of the ffprobe executable used when no explicit path has been configured
+const defaultFFProbeCmd = "ffprobe"
+
+// runFFProbe executes the given ffprobe command on the file using the given "-show_*" arguments and parses its output
+func runFFProbe(ffprobeCmd string, filename string, logger *logrus.Entry, show ...string) (*FFProbeData, error) {
+	args := append([]string{"-v", "quiet", "-print_format", "json"}, show...)
+	data, err := exec.Command(ffprobeCmd, append(args, filename)...).Output()
 	if err != nil {
 		logger.WithError(err).Error("Could not execute ffprobe")
-		return fmt.Errorf("Failed to execute ffprobe for %s: %v", filename, err)
+		return nil, fmt.Errorf("Failed to execute ffprobe for %s: %v", filename, err)
 	}
 	probeData := &FFProbeData{}
 	if err := json.Unmarshal(data, probeData); err != nil {
 		logger.WithError(err).Error("Failed to parse ffprobe JSON output")
-		return fmt.Errorf("Failed to read ffprobe output for %s: %v", filename, err)
+		return nil, fmt.Errorf("Failed to read ffprobe output for %s: %v", filename, err)
+	}
+	return probeData, nil
+}
+
+// ScrapeFFProbe uses the ffprobe commandline tool to scrape the video metadata from its JSON output
+func ScrapeFFProbe(filename string, vid *models.Video, logger *logrus.Entry) error {
+	return scrapeFFProbe(defaultFFProbeCmd, filename, vid, logger)
+}
+
+// MakeFFProbeScraper returns a scraping function that works like ScrapeFFProbe, but uses the ffprobe executable at
+// the given path. The path may also be a bare command name that is searched for in the PATH. If the path is empty,
+// ffprobe will be searched for in the PATH
+func MakeFFProbeScraper(ffprobePath string) ScrapingFunc {
+	if ffprobePath == "" {
+		return ScrapeFFProbe
+	}
+	return func(filename string, vid *models.Video, logger *logrus.Entry) error {
+		ffprobeCmd, err := exec.LookPath(ffprobePath)
+		if err != nil {
+			return fmt.Errorf("Configured ffprobe executable '%s' cannot be found: %v", ffprobePath, err)
+		}
+		return scrapeFFProbe(ffprobeCmd, filename, vid, logger)
+	}
+}
+
+// scrapeFFProbe executes the given ffprobe command and scrapes the video metadata from its JSON output - including the
+// chapter markers of the video file. Files without chapters result in an empty chapter list
+func scrapeFFProbe(ffprobeCmd string, filename string, vid *models.Video, logger *logrus.Entry) error {
+	logger = logger.WithField("scraper", "FFProbe")
+	logger.Debug("Start scraping")
+	probeData, err := runFFProbe(ffprobeCmd, filename, logger, "-show_format", "-show_streams", "-show_chapters")
+	if err != nil {
+		return err
 	}
 	// Get general info
 	if probeData.Format != nil {
 		if i, err := strconv.ParseInt(
 			probeData.Format.Duration[0:strings.Index(probeData.Format.Duration, ".")], 10, 0,
 		); err == nil {
-			vid.Duration = time.Duration(i) * time.Second
+			vid.Duration = models.Duration(time.Duration(i) * time.Second)
 		}
+		vid.Container = probeData.Format.FormatName
 	}
-	// Get video info
-	if str := probeData.GetFirstSteamByType(ffTypeVideo); str != nil {
+	// Get video info - cover images embedded into audio files are no video streams
+	if str := probeData.GetFirstSteamByType(ffTypeVideo); str != nil && str.Disposition["attached_pic"] == 0 {
 		vid.VideoFormat = str.CodecName
+		vid.VideoProfile = str.Profile
+		vid.FrameRate = parseFrameRate(str.FrameRate)
+		vid.Rotation = str.GetRotation()
 		vid.Width = str.Width
 		vid.Height = str.Height
 		if i, err := strconv.ParseInt(str.Bitrate, 10, 0); err == nil {
@@ -113,12 +251,192 @@ func ScrapeFFProbe(filename string, vid *models.Video, logger *logrus.Entry) err
 			vid.AudioBitrate = int(i)
 		}
 	}
+	// Get the languages of all subtitle streams
+	var subLangs []string
+	knownLangs := map[string]bool{}
+	for _, str := range probeData.GetStreamsByType(ffTypeSub) {
+		lang := strings.TrimSpace(str.Tags["language"])
+		if lang != "" && !knownLangs[lang] {
+			knownLangs[lang] = true
+			subLangs = append(subLangs, lang)
+		}
+	}
+	vid.SubtitleLanguages = strings.Join(subLangs, ",")
+	// Use the embedded title and artist tags if nothing else has filled these fields, yet
+	vid.Title = mergeString(vid.Title, probeData.GetTag("title"))
+	vid.Artist = mergeString(vid.Artist, probeData.GetTag("artist"))
+	// Get the chapter markers
+	vid.Chapters = []models.VideoChapter{}
+	for i, ch := range probeData.Chapters {
+		vid.Chapters = append(vid.Chapters, models.VideoChapter{
+			Index: uint(i),
+			Title: strings.TrimSpace(ch.Tags["title"]),
+			Start: parseSeconds(ch.StartTime),
+			End:   parseSeconds(ch.EndTime),
+		})
+	}
+	logger.Debugf("Found %d chapter(s)", len(vid.Chapters))
 	logger.Debug("Scraping finished")
 	return nil
 }
 
-// ScrapeSHA512 calculates the SHA-512 sum of the video file and adds it to the video metadata provided
+// ThumbnailDir is the name of the subdirectory of the data directory thumbnail images are stored in
+const ThumbnailDir = "thumbnails"
+
+// The name of the ffmpeg executable used when no explicit path has been configured
+const defaultFFMpegCmd = "ffmpeg"
+
+// MakeThumbnailScraper returns a scraping function that uses ffmpeg to extract a frame at 10% of the video's duration
+// and stores it as JPEG image inside the ThumbnailDir of the given data directory. The image is named by the SHA-512
+// hash of the video, so this function needs to run after the hash and the duration have been scraped. Since it writes
+// files, it belongs to the scraper's WritingFns, which are skipped during dry runs.
+// If ffmpeg is not available or fails, no thumbnail is recorded, but scraping continues
+func MakeThumbnailScraper(dataDir string, ffmpegPath string) ScrapingFunc {
+	if ffmpegPath == "" {
+		ffmpegPath = defaultFFMpegCmd
+	}
+	return func(filename string, vid *models.Video, logger *logrus.Entry) error {
+		logger = logger.WithField("scraper", "Thumbnail")
+		if vid.SHA512 == "" {
+			logger.Warn("Cannot create a thumbnail for a video without hash")
+			return nil
+		}
+		relPath := path.Join(ThumbnailDir, vid.SHA512+".jpg")
+		thumbFile := filepath.Join(dataDir, filepath.FromSlash(relPath))
+		if _, err := os.Stat(thumbFile); err == nil {
+			logger.Debug("Thumbnail already exists")
+			vid.Thumbnail = relPath
+			return nil
+		}
+		ffmpegCmd, err := exec.LookPath(ffmpegPath)
+		if err != nil {
+			logger.WithError(err).Warn("ffmpeg is not available - skipping thumbnail creation")
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(thumbFile), 0755); err != nil {
+			logger.WithError(err).Warn("Failed to create the thumbnail directory")
+			return nil
+		}
+		logger.Debug("Start scraping")
+		// Write into a temporary file first so that no half-written thumbnails will be mistaken as existing ones
+		tmpFile := thumbFile + ".part"
+		offset := vid.Duration / 10
+		err = exec.Command(
+			ffmpegCmd, "-v", "quiet", "-y", "-ss", strconv.FormatFloat(offset.Seconds(), 'f', 3, 64), "-i", filename,
+			"-frames:v", "1", "-f", "mjpeg", tmpFile,
+		).Run()
+		if err == nil {
+			err = os.Rename(tmpFile, thumbFile)
+		}
+		if err != nil {
+			os.Remove(tmpFile)
+			logger.WithError(err).Warn("Failed to extract thumbnail using ffmpeg")
+			return nil
+		}
+		vid.Thumbnail = relPath
+		return nil
+	}
+}
+
+// SpriteDir is the name of the subdirectory of the data directory sprite sheets are stored in
+const SpriteDir = "sprites"
+
+// The width in pixels of a single frame inside a sprite sheet
+const spriteFrameWidth = 160
+
+// MakeSprite uses ffmpeg to extract the given number of evenly spaced frames from the video file and tiles them into
+// one JPEG image with the given number of columns. The duration of the video is needed to calculate the spacing
+func MakeSprite(
+	ffmpegPath string,
+	videoFile string,
+	outFile string,
+	duration time.Duration,
+	frames uint,
+	columns uint,
+) error {
+	if ffmpegPath == "" {
+		ffmpegPath = defaultFFMpegCmd
+	}
+	if duration <= 0 {
+		return fmt.Errorf("MakeSprite: Cannot create a sprite sheet for a video without duration")
+	}
+	if frames == 0 || columns == 0 {
+		return fmt.Errorf("MakeSprite: Number of frames and columns must be greater than zero")
+	}
+	ffmpegCmd, err := exec.LookPath(ffmpegPath)
+	if err != nil {
+		return fmt.Errorf("MakeSprite: ffmpeg is not available: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+		return fmt.Errorf("MakeSprite: Failed to create the sprite directory: %v", err)
+	}
+	rows := (frames + columns - 1) / columns
+	filter := fmt.Sprintf(
+		"fps=%s,scale=%d:-1,tile=%dx%d",
+		strconv.FormatFloat(float64(frames)/duration.Seconds(), 'f', 6, 64),
+		spriteFrameWidth,
+		columns,
+		rows,
+	)
+	// Write into a temporary file first so that parallel requests do not see half-written sprite sheets
+	tmpFile := fmt.Sprintf("%s.%d.part", outFile, time.Now().UnixNano())
+	err = exec.Command(
+		ffmpegCmd, "-v", "quiet", "-y", "-i", videoFile, "-vf", filter, "-frames:v", "1", "-f", "mjpeg", tmpFile,
+	).Run()
+	if err == nil {
+		err = os.Rename(tmpFile, outFile)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("MakeSprite: Failed to create sprite sheet using ffmpeg: %v", err)
+	}
+	return nil
+}
+
+// HashMode defines how much of a video file is used for calculating its SHA-512 hash
+type HashMode uint
+
+const (
+	// HashPartial only hashes the first MiB of a video file. This is fast, but two files sharing the same first MiB
+	// will end up with the same hash
+	HashPartial HashMode = iota
+	// HashFull hashes the whole video file. This is slower, but makes hash collisions between different files
+	// practically impossible
+	HashFull
+)
+
+// Number of bytes read from the video file when using partial hashing
+const partialHashLen = 1024 * 1024
+
+// ParseHashMode converts the name of a hash mode ("partial" or "full") into the matching HashMode
+// An empty name results in the default partial hashing mode
+func ParseHashMode(name string) (HashMode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "partial":
+		return HashPartial, nil
+	case "full":
+		return HashFull, nil
+	}
+	return HashPartial, fmt.Errorf("ParseHashMode: Unknown hash mode '%s'", name)
+}
+
+// ScrapeSHA512 calculates the SHA-512 sum of the first MiB of the video file and adds it to the video metadata
+// provided
 func ScrapeSHA512(filename string, vid *models.Video, logger *logrus.Entry) error {
+	return scrapeSHA512(filename, vid, HashPartial, logger)
+}
+
+// MakeSHA512Scraper returns a scraping function that calculates the SHA-512 sum of the video file using the given
+// hash mode
+func MakeSHA512Scraper(mode HashMode) ScrapingFunc {
+	return func(filename string, vid *models.Video, logger *logrus.Entry) error {
+		return scrapeSHA512(filename, vid, mode, logger)
+	}
+}
+
+// scrapeSHA512 calculates the SHA-512 sum of the video file - either from the first MiB or from the full file
+// depending on the hash mode - and adds it to the video metadata provided
+func scrapeSHA512(filename string, vid *models.Video, mode HashMode, logger *logrus.Entry) error {
 	logger = logger.WithField("scraper", "SHA-512")
 	logger.Debug("Start scraping")
 	f, err := os.Open(filename)
@@ -126,14 +444,17 @@ func ScrapeSHA512(filename string, vid *models.Video, logger *logrus.Entry) erro
 		return err
 	}
 	defer f.Close()
-	// Read only 1 MiB from the video file
-	readLen := 1024 * 1024
-	b := make([]byte, readLen)
-	f.Read(b)
-	buf := bytes.NewBuffer(b)
-
 	sha := sha512.New()
-	_, err = io.Copy(sha, buf)
+	if mode == HashFull {
+		// Stream the whole file through the hash
+		_, err = io.Copy(sha, f)
+	} else {
+		// Read only 1 MiB from the video file - files smaller than that are hashed completely
+		_, err = io.CopyN(sha, f, partialHashLen)
+		if err == io.EOF {
+			err = nil
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to calculate SHA512 sum of file %s: %v", filename, err)
 	}
@@ -146,9 +467,10 @@ func ScrapeSHA512(filename string, vid *models.Video, logger *logrus.Entry) erro
 // using capturing groups. These extracted data fields are then mapped to fields of the video struct, resulting in
 // filling them with the appropriate data
 //
-// Regex and field mappings are derived by taking them from the presets stored in this
+// Regex and field mappings are derived by taking them from the presets stored in this package - either built-in or
+// added using AddPreset
 func MakeFileNameScraper(presetName string) (ScrapingFunc, error) {
-	preset, ok := fileNameScrapingPresets[presetName]
+	preset, ok := GetPreset(presetName)
 	if !ok {
 		return nil, fmt.Errorf("MakeFileNameScraper: Cannot find preset '%s'", presetName)
 	}
@@ -156,38 +478,52 @@ func MakeFileNameScraper(presetName string) (ScrapingFunc, error) {
 	if err != nil {
 		return nil, fmt.Errorf("MakeFileSchemaScraper: Cannot create scraper: %v", err)
 	}
+	return makeFileNameScraper(preset, reg), nil
+}
+
+// ScrapeCustomPresets runs the file name scraping of all presets that have been added using AddPreset. The presets
+// are looked up on every call, so presets added or removed while scraping take effect immediately
+func ScrapeCustomPresets(filename string, vid *models.Video, logger *logrus.Entry) error {
+	for _, preset := range CustomPresets() {
+		reg, err := regexp.Compile(preset.Regex)
+		if err != nil {
+			// Should not happen since presets are validated when being added
+			logger.WithError(err).WithField("preset", preset.Name).Warn("Skipping preset with malformed regex")
+			continue
+		}
+		if err := makeFileNameScraper(preset, reg)(filename, vid, logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeFileNameScraper creates the file name scraping function for the given preset using the already compiled regex
+func makeFileNameScraper(preset NameScrapingPreset, reg *regexp.Regexp) ScrapingFunc {
 	return func(filename string, vid *models.Video, logger *logrus.Entry) error {
-		filename = path.Base(filename)
 		logger = logger.WithField("scraper", "FileName")
 		logger.WithField("regex", preset.Regex).Debug("Start scraping")
-		matches := reg.FindStringSubmatch(filename)
+		fields := matchFileName(preset, reg, filename)
 		// We will only do anything if there is at least one match
-		if len(matches) != 0 {
-			logger.Debugf("Found %d match(es)", len(matches))
-			for fieldName, idx := range preset.FieldMap {
-				if idx >= 0 && idx < len(matches) {
-					val := strings.TrimSpace(matches[idx])
-					// I know this would also work with reflection, but... Maybe later
-					switch fieldName {
-					case FldIdentifier:
-						vid.Identifier = val
-					case FldArtist:
-						vid.Artist = val
-					case FldTitle:
-						vid.Title = val
-					case FldRelatedMedium:
-						vid.RelatedMedium = val
-					case FldMediumDetail:
-						vid.MediumDetail = val
-					case FldDescription:
-						vid.Description = val
-					case FldLanguage:
-						tag, err := language.Parse(val)
-						if err == nil {
-							fmt.Printf("Language found: %v\n", tag)
-							vid.Language = tag.String()
-						}
-					}
+		if fields != nil {
+			logger.Debugf("Found %d field(s)", len(fields))
+			for fieldName, val := range fields {
+				// I know this would also work with reflection, but... Maybe later
+				switch fieldName {
+				case FldIdentifier:
+					vid.Identifier = val
+				case FldArtist:
+					vid.Artist = val
+				case FldTitle:
+					vid.Title = val
+				case FldRelatedMedium:
+					vid.RelatedMedium = val
+				case FldMediumDetail:
+					vid.MediumDetail = val
+				case FldDescription:
+					vid.Description = val
+				case FldLanguage:
+					vid.Language = val
 				}
 			}
 		} else {
@@ -195,7 +531,46 @@ func MakeFileNameScraper(presetName string) (ScrapingFunc, error) {
 		}
 		logger.Debug("Scraping finished")
 		return nil
-	}, nil
+	}
+}
+
+// matchFileName matches the base name of the given file against the preset's regex and returns the values found for
+// the fields of the preset's field map. Languages that cannot be parsed are left out. If the file name does not match
+// at all, nil is returned
+func matchFileName(preset NameScrapingPreset, reg *regexp.Regexp, filename string) map[string]string {
+	matches := reg.FindStringSubmatch(path.Base(filename))
+	if len(matches) == 0 {
+		return nil
+	}
+	fields := make(map[string]string)
+	for fieldName, idx := range preset.FieldMap {
+		if idx >= 0 && idx < len(matches) {
+			val := strings.TrimSpace(matches[idx])
+			if fieldName == FldLanguage {
+				tag, err := language.Parse(val)
+				if err != nil {
+					continue
+				}
+				val = tag.String()
+			}
+			fields[fieldName] = val
+		}
+	}
+	return fields
+}
+
+// TestPreset matches the given file name against the preset with the given name and returns the values the file name
+// scraping function would write into the video's fields. If the file name does not match, nil is returned
+func TestPreset(presetName string, filename string) (map[string]string, error) {
+	preset, ok := GetPreset(presetName)
+	if !ok {
+		return nil, ErrPresetNotFound
+	}
+	reg, err := regexp.Compile(preset.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("TestPreset: Cannot compile regex of preset '%s': %v", presetName, err)
+	}
+	return matchFileName(preset, reg, filename), nil
 }
 
 // MustMakeFileNameScraper is a version of MakeFileNameScraper that panics when creating the scraping function fails
@@ -0,0 +1,138 @@
+package scraper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrPresetExists is the error returned when adding a preset with a name that is already in use
+	ErrPresetExists = fmt.Errorf("A scraping preset with this name already exists")
+	// ErrPresetNotFound is the error returned when a preset is requested that does not exist
+	ErrPresetNotFound = fmt.Errorf("Scraping preset not found")
+	// ErrPresetBuiltIn is the error returned when trying to remove one of the built-in presets
+	ErrPresetBuiltIn = fmt.Errorf("Built-in scraping presets cannot be removed")
+)
+
+// The names of the video fields that can be used inside the field map of a scraping preset
+var knownFields = []string{
+	FldTitle,
+	FldArtist,
+	FldRelatedMedium,
+	FldMediumDetail,
+	FldDescription,
+	FldLanguage,
+	FldIdentifier,
+}
+
+// PresetError is returned when a scraping preset fails to validate
+type PresetError struct {
+	// The field of the preset that is invalid
+	Field string
+	// The reason why the field is invalid
+	Reason string
+}
+
+func (e *PresetError) Error() string {
+	return fmt.Sprintf("Invalid scraping preset: %s: %s", e.Field, e.Reason)
+}
+
+// ValidatePreset checks if the given preset can be used for scraping. The regex needs to compile and the field map
+// may only reference known video fields and existing capture groups of the regex
+func ValidatePreset(preset NameScrapingPreset) error {
+	if strings.TrimSpace(preset.Name) == "" {
+		return &PresetError{"name", "The name must not be empty"}
+	}
+	reg, err := regexp.Compile(preset.Regex)
+	if err != nil {
+		return &PresetError{"regex", err.Error()}
+	}
+	if len(preset.FieldMap) == 0 {
+		return &PresetError{"fieldMap", "At least one field needs to be mapped"}
+	}
+	for fieldName, idx := range preset.FieldMap {
+		known := false
+		for _, fld := range knownFields {
+			if fld == fieldName {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return &PresetError{"fieldMap", fmt.Sprintf("Unknown field '%s'", fieldName)}
+		}
+		if idx < 0 || idx > reg.NumSubexp() {
+			return &PresetError{
+				"fieldMap",
+				fmt.Sprintf("The regex has no capture group #%d for field '%s'", idx, fieldName),
+			}
+		}
+	}
+	return nil
+}
+
+// AddPreset validates the given preset and adds it to the list of available file name scraping presets
+func AddPreset(preset NameScrapingPreset) error {
+	if err := ValidatePreset(preset); err != nil {
+		return err
+	}
+	presetLock.Lock()
+	defer presetLock.Unlock()
+	if _, ok := fileNameScrapingPresets[preset.Name]; ok {
+		return ErrPresetExists
+	}
+	preset.BuiltIn = false
+	fileNameScrapingPresets[preset.Name] = preset
+	return nil
+}
+
+// RemovePreset removes the preset with the given name. Built-in presets cannot be removed
+func RemovePreset(name string) error {
+	presetLock.Lock()
+	defer presetLock.Unlock()
+	preset, ok := fileNameScrapingPresets[name]
+	if !ok {
+		return ErrPresetNotFound
+	}
+	if preset.BuiltIn {
+		return ErrPresetBuiltIn
+	}
+	delete(fileNameScrapingPresets, name)
+	return nil
+}
+
+// GetPreset returns the preset with the given name
+func GetPreset(name string) (NameScrapingPreset, bool) {
+	presetLock.RLock()
+	defer presetLock.RUnlock()
+	preset, ok := fileNameScrapingPresets[name]
+	return preset, ok
+}
+
+// Presets returns all available file name scraping presets - sorted by their name
+func Presets() []NameScrapingPreset {
+	return filterPresets(func(NameScrapingPreset) bool { return true })
+}
+
+// CustomPresets returns all file name scraping presets that are not built-in - sorted by their name
+func CustomPresets() []NameScrapingPreset {
+	return filterPresets(func(p NameScrapingPreset) bool { return !p.BuiltIn })
+}
+
+// filterPresets returns all presets matching the given filter function sorted by their name
+func filterPresets(filter func(NameScrapingPreset) bool) []NameScrapingPreset {
+	presetLock.RLock()
+	defer presetLock.RUnlock()
+	ret := []NameScrapingPreset{}
+	for _, preset := range fileNameScrapingPresets {
+		if filter(preset) {
+			ret = append(ret, preset)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
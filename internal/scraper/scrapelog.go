@@ -0,0 +1,90 @@
+package scraper
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The maximum number of log entries kept per scrape. When exceeded, the oldest entries are dropped
+const maxScrapeLogEntries = 1000
+
+// LogEntry is a warning or error that has been logged while scraping
+type LogEntry struct {
+	// The time the entry has been logged at
+	Time time.Time `json:"time"`
+	// The log level of the entry
+	Level string `json:"level"`
+	// The log message
+	Message string `json:"message"`
+	// Additional fields of the entry - like the file being scraped or the error that occurred
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// logBuffer is a logrus hook that captures the warnings and errors of a scrape inside a ring buffer
+type logBuffer struct {
+	mu sync.Mutex
+	// The captured entries - once the buffer is full, start marks the oldest one
+	entries []LogEntry
+	start   int
+	// Fields that are set for every entry of the scrape and are therefore not captured
+	omit logrus.Fields
+}
+
+// Levels returns the log levels captured by the buffer
+func (b *logBuffer) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+// Fire adds the given log entry to the buffer - overwriting the oldest one if the buffer is full
+func (b *logBuffer) Fire(entry *logrus.Entry) error {
+	e := LogEntry{Time: entry.Time, Level: entry.Level.String(), Message: entry.Message}
+	for key, val := range entry.Data {
+		if _, ok := b.omit[key]; ok {
+			continue
+		}
+		if e.Fields == nil {
+			e.Fields = make(map[string]string)
+		}
+		e.Fields[key] = fmt.Sprint(val)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) < maxScrapeLogEntries {
+		b.entries = append(b.entries, e)
+	} else {
+		b.entries[b.start] = e
+		b.start = (b.start + 1) % maxScrapeLogEntries
+	}
+	return nil
+}
+
+// Entries returns a copy of the captured entries - oldest first
+func (b *logBuffer) Entries() []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ret := make([]LogEntry, 0, len(b.entries))
+	ret = append(ret, b.entries[b.start:]...)
+	return append(ret, b.entries[:b.start]...)
+}
+
+// newScrapeLogger creates a logger for a single scrape that writes to the same output as the given logger, but also
+// captures all warnings and errors inside the returned buffer
+func newScrapeLogger(parent *logrus.Entry) (*logrus.Entry, *logBuffer) {
+	buf := &logBuffer{omit: parent.Data}
+	logger := &logrus.Logger{
+		Out:          parent.Logger.Out,
+		Hooks:        make(logrus.LevelHooks),
+		Formatter:    parent.Logger.Formatter,
+		ReportCaller: parent.Logger.ReportCaller,
+		Level:        parent.Logger.GetLevel(),
+		ExitFunc:     parent.Logger.ExitFunc,
+	}
+	for level, hooks := range parent.Logger.Hooks {
+		logger.Hooks[level] = append(logger.Hooks[level], hooks...)
+	}
+	logger.AddHook(buf)
+	return logger.WithFields(parent.Data), buf
+}
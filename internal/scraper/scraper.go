@@ -3,11 +3,15 @@ package scraper
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
+	"net/http"
 	"os"
+	"os/exec"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -47,12 +51,21 @@ const (
 	StatusCancelled
 )
 
+// DefaultMaxParallelScrapes is the number of scrapes allowed to run in parallel if nothing else is configured
+const DefaultMaxParallelScrapes = 2
+
 var (
 	// The scraping presets available - can be used when constructing file name scraping functions
 	fileNameScrapingPresets map[string]NameScrapingPreset
+	// Guards the scraping presets against concurrent modification
+	presetLock sync.RWMutex
 	// ErrAlreadyQueued is the error that is returned when scraping the same or a parent directory is already inside
 	// the scraping queue
 	ErrAlreadyQueued = fmt.Errorf("A scraping operation is already queued for this directory")
+	// ErrBadExcludePattern is the error that is returned when a scrape is started with a malformed exclusion pattern
+	ErrBadExcludePattern = fmt.Errorf("Malformed exclusion pattern")
+	// ErrBadMaxDepth is the error that is returned when a scrape is started with a negative maximum depth
+	ErrBadMaxDepth = fmt.Errorf("The maximum depth must not be negative")
 )
 
 // FieldIndexMap describes the correlation between a field of a video struct and the index in the scraping result
@@ -63,14 +76,83 @@ type FieldIndexMap map[string]int
 // NameScrapingPreset defines a named preset for scraping file names
 // It is used to make it easier for repeating scrapes of a special kind
 type NameScrapingPreset struct {
-	Name     string
-	Regex    string
-	FieldMap FieldIndexMap
+	Name     string        `json:"name"`
+	Regex    string        `json:"regex"`
+	FieldMap FieldIndexMap `json:"fieldMap"`
+	// BuiltIn is set for the presets that come with Kyabia. These cannot be removed
+	BuiltIn bool `json:"builtIn"`
 }
 
 // ScrapeStatus defines the status of a scrape
 type ScrapeStatus uint
 
+// ScrapeOptions contains the options a single scrape can be started with
+type ScrapeOptions struct {
+	// Exclude is a list of patterns (in the syntax of filepath.Match) that are matched against the base name of each
+	// directory and file found while scraping. Matching entries are skipped - use ".*" to skip hidden entries
+	Exclude []string `json:"exclude"`
+	// Force makes the scrape process every video file - even the ones that have not been modified since the last scrape
+	Force bool `json:"force"`
+	// SniffContent enables detecting video files by their contents if their file extension is unknown or not
+	// registered as a video file type
+	SniffContent bool `json:"sniffContent"`
+	// MaxDepth limits how deep the scrape recurses into subdirectories of the root directory. A depth of 0 only scrapes
+	// the root directory itself. If not set, there is no limit
+	MaxDepth *int `json:"maxDepth,omitempty"`
+	// Symlinks defines how symbolic links are treated while traversing the directory tree
+	Symlinks SymlinkPolicy `json:"symlinks"`
+	// DryRun runs the scraping functions without writing the results to the video repo. Instead, a sample of the
+	// videos that would have been created or updated is collected inside the scrape. Scraping functions writing files -
+	// like the thumbnail creation - are skipped
+	DryRun bool `json:"dryRun"`
+	// Priority defines the order queued scrapes are started in. Scrapes with a higher priority leave the queue first
+	// while scrapes having the same priority are started in the order they have been queued
+	Priority int `json:"priority"`
+	// IncludeAudio makes the scrape also process audio-only files - like karaoke tracks with a separate lyric overlay
+	IncludeAudio bool `json:"includeAudio"`
+}
+
+// The maximum number of sample videos collected per kind during a dry run
+const maxDryRunSamples = 50
+
+// SymlinkPolicy defines how a scrape handles symbolic links found while traversing the directory tree
+type SymlinkPolicy uint
+
+const (
+	// SkipSymlinks treats symbolic links as non-directories - linked directories will not be traversed. This is the
+	// default policy
+	SkipSymlinks SymlinkPolicy = iota
+	// FollowSymlinks follows symbolic links to directories and files. Directories already visited during the scrape
+	// will be skipped to prevent cycles and scraping files twice
+	FollowSymlinks
+)
+
+// Converts the symlink policy into a readable name
+func (p SymlinkPolicy) String() string {
+	if p == FollowSymlinks {
+		return "follow"
+	}
+	return "skip"
+}
+
+// MarshalJSON implements the json.Marshaler interface returning the name of the policy
+func (p SymlinkPolicy) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("\"%s\"", p)), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface reading the policy from its name
+func (p *SymlinkPolicy) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), "\"") {
+	case "", "skip":
+		*p = SkipSymlinks
+	case "follow":
+		*p = FollowSymlinks
+	default:
+		return fmt.Errorf("Unknown symlink policy %s", data)
+	}
+	return nil
+}
+
 // Scrape describes a video scraping operation currently running
 type Scrape struct {
 	// The current status of the scrape. See the Status* constants for possible values
@@ -88,18 +170,58 @@ type Scrape struct {
 	NumNewFiles uint `json:"newFiles"`
 	// The number of already existing video files updated
 	NumUpdatedFiles uint `json:"updatedFiles"`
+	// The number of video files skipped because they have not been modified since the last scrape
+	NumSkippedFiles uint `json:"skippedFiles"`
+	// The total number of video files found for this scrape - counted before the scraping begins
+	TotalFiles uint `json:"totalFiles"`
 	// The time the scape has started
 	StartedAt time.Time `json:"startedAt"`
+	// The estimated time the scrape will be finished at - based on the time needed for the files processed so far
+	EstimatedCompletion time.Time `json:"estimatedCompletion"`
+	// The options this scrape has been started with
+	Options ScrapeOptions `json:"options"`
+	// When running dry, this is a sample of the videos that would have been created
+	DryRunCreated []models.Video `json:"dryRunCreated,omitempty"`
+	// When running dry, this is a sample of the videos that would have been updated
+	DryRunUpdated []models.Video `json:"dryRunUpdated,omitempty"`
+	// The files found during this scrape that have the same hash as an already known video file still existing on disk
+	Duplicates []DuplicateFile `json:"duplicates,omitempty"`
 	// If the scrape has failed, this is the error that caused it
 	Err error `json:"error"`
 	// Internal channel that will be closed when the scraping operation needs to be stopped
 	stopChan chan bool
+	// Makes sure the stop channel is only closed once - shared between all copies of the scrape
+	stopOnce *sync.Once
+	// Set if the root directory is no directory, but a single video file to scrape
+	singleFile bool
+	// The time the scrape left the queue and actually started working
+	runningSince time.Time
+	// The number of video files processed so far - including the ones that failed to scrape
+	numProcessed uint
+	// The directories already traversed when following symbolic links
+	visited []os.FileInfo
 	// The logger to use for this scrape
 	logger *logrus.Entry
+	// Captures the warnings and errors logged during this scrape
+	logBuf *logBuffer
 	// The list of scraping functions to execute during this scrape
 	fns []ScrapingFunc
+	// The list of scraping functions writing files - skipped during dry runs
+	writingFns []ScrapingFunc
+	// The file extensions treated as video files regardless of the system's MIME table
+	videoExts []string
 	// The video repo to use
 	vRepo repos.VideoRepo
+	// The repo to store the chapters of the scraped videos in - may be nil
+	chRepo repos.ChapterRepo
+}
+
+// A DuplicateFile describes a video file that has the same SHA-512 hash as an already known video file
+type DuplicateFile struct {
+	// The file name the video is known under so far
+	ExistingFilename string `json:"existingFilename"`
+	// The file name of the duplicate found while scraping
+	DuplicateFilename string `json:"duplicateFilename"`
 }
 
 // A ScrapingFunc is a function that scrapes a file identified by its file name and writes the found meta data into the
@@ -111,6 +233,10 @@ type ScrapingFunc func(filename string, vid *models.Video, logger *logrus.Entry)
 type scrapeRequest struct {
 	// The root directory the scrape has started or should be started
 	rootDir string
+	// If set, the root directory is no directory, but a single video file to scrape
+	singleFile bool
+	// The options to start the scrape with
+	opts ScrapeOptions
 	// The Scrape object requested. If this one is nil, the requested scrape does not exist.
 	// To check if anything bad happened, the scrape contains an err field that contains any error that cancelled the
 	// scraping operations
@@ -119,6 +245,14 @@ type scrapeRequest struct {
 
 type scrapeMap map[string]Scrape
 
+// A stop request waiting for the running scrapes it has stopped to finish
+type stopWaiter struct {
+	// The root directories of the scrapes still running
+	pending map[string]bool
+	// The channel to close when all scrapes have finished
+	answer chan<- *Scrape
+}
+
 // A Scraper runs a set of Scraping functions on files fed to it
 type Scraper struct {
 	vRepo  repos.VideoRepo
@@ -130,40 +264,95 @@ type Scraper struct {
 	stopChan chan<- scrapeRequest
 	// The channel used to retrieve status information for
 	statusChan chan<- scrapeRequest
-	// This is a token semaphore that is used to only start a specific number of scraping operations at once
-	queueSemaphore chan interface{}
+	// The maximum number of scraping operations running at once - further scrapes will be queued
+	maxParallel uint
+	// Exclude is a list of exclusion patterns that is applied to every scrape in addition to the ones provided when
+	// starting the scrape
+	Exclude []string
+	// VideoExtensions is a list of file extensions (like ".ts") that are treated as video files in addition to the
+	// ones registered as video file types in the system's MIME table
+	VideoExtensions []string
+	// WebhookURL is the URL a summary of each scrape is posted to when the scrape has ended. Empty disables the webhook
+	WebhookURL string
+	// ChapterRepo is used to store the chapters found inside the scraped video files. If nil, chapters are not stored
+	ChapterRepo repos.ChapterRepo
+	// WritingFns is a list of scraping functions that write files - like thumbnail images. They run after the other
+	// scraping functions and are skipped during dry runs
+	WritingFns []ScrapingFunc
 }
 
 // New returns a new scraper with the given functions set as scraping functions
-func New(vRepo repos.VideoRepo, functions []ScrapingFunc, logger *logrus.Entry) *Scraper {
+// maxParallel defines how many scrapes are allowed to run in parallel - if set to 0, the default of two parallel
+// scrapes will be used
+func New(vRepo repos.VideoRepo, functions []ScrapingFunc, maxParallel uint, logger *logrus.Entry) *Scraper {
+	if maxParallel == 0 {
+		maxParallel = DefaultMaxParallelScrapes
+	}
 	return &Scraper{
-		vRepo:          vRepo,
-		fns:            functions,
-		logger:         logger,
-		queueSemaphore: make(chan interface{}, 2), // Only two scrapes are allowed in parallel
+		vRepo:       vRepo,
+		fns:         functions,
+		logger:      logger,
+		maxParallel: maxParallel,
 	}
 }
 
-// NewDefault creates a new scraper that is setup using the default scraping functions
-func NewDefault(vRepo repos.VideoRepo, logger *logrus.Entry) *Scraper {
-	return New(
+// NewDefault creates a new scraper that is setup using the default scraping functions configured by the given scraper
+// configuration. Thumbnails are stored inside the given data directory
+func NewDefault(vRepo repos.VideoRepo, dataDir string, conf models.ScraperConfig, logger *logrus.Entry) *Scraper {
+	hashMode, err := ParseHashMode(conf.HashMode)
+	if err != nil {
+		logger.WithError(err).Warn("Illegal hash mode configured - falling back to partial hashing")
+	}
+	if conf.FFProbePath != "" {
+		if _, err := exec.LookPath(conf.FFProbePath); err != nil {
+			logger.WithError(err).WithField(log.FldFile, conf.FFProbePath).
+				Error("Configured ffprobe executable cannot be found")
+		}
+	}
+	for _, preset := range conf.Presets {
+		err := AddPreset(NameScrapingPreset{Name: preset.Name, Regex: preset.Regex, FieldMap: preset.FieldMap})
+		if err != nil {
+			logger.WithError(err).WithField("preset", preset.Name).Error("Cannot load configured scraping preset")
+		}
+	}
+	scr := New(
 		vRepo,
 		[]ScrapingFunc{
-			ScrapeSHA512,
-			ScrapeFFProbe,
+			MakeSHA512Scraper(hashMode),
+			MakeFFProbeScraper(conf.FFProbePath),
 			MustMakeFileNameScraper("ID_Language_Artist_Title_Type_Anime"),
 			MustMakeFileNameScraper("ID_Anime_Title (Type)"),
+			ScrapeCustomPresets,
 			// Disabled for now
 			// MustMakeFileNameScraper("ID-Language-Artist-Title-Type-Anime"),
 			// MustMakeFileNameScraper("ID-Anime-Title (Type)"),
 		},
+		conf.MaxParallelScrapes,
 		logger,
 	)
+	scr.WritingFns = []ScrapingFunc{MakeThumbnailScraper(dataDir, conf.FFMpegPath)}
+	scr.Exclude = conf.Exclude
+	scr.VideoExtensions = conf.VideoExtensions
+	scr.WebhookURL = conf.WebhookURL
+	return scr
 }
 
-// Start begins scraping from the given root directory. It returns the ID of the
-func (s *Scraper) Start(rootDir string) error {
+// Start begins scraping from the given root directory using the given options
+func (s *Scraper) Start(rootDir string, opts ScrapeOptions) error {
 	s.logger.WithField(log.FldPath, rootDir).Debug("Starting scrape")
+	return s.requestStart(rootDir, false, opts)
+}
+
+// StartFile begins scraping the single video file with the given file name. The scrape is identified by the file
+// name in the same way a directory scrape is identified by its root directory
+func (s *Scraper) StartFile(filename string, opts ScrapeOptions) error {
+	s.logger.WithField(log.FldFile, filename).Debug("Starting single file scrape")
+	return s.requestStart(filename, true, opts)
+}
+
+// requestStart sends a start request to the management goroutine - starting it if it is not yet running - and
+// waits for the answer
+func (s *Scraper) requestStart(rootDir string, singleFile bool, opts ScrapeOptions) error {
 	if s.startChan == nil {
 		// We do not have a control method running right now so start one
 		start := make(chan scrapeRequest)
@@ -176,8 +365,10 @@ func (s *Scraper) Start(rootDir string) error {
 	}
 	ret := make(chan *Scrape)
 	s.startChan <- scrapeRequest{
-		rootDir: rootDir,
-		answer:  ret,
+		rootDir:    rootDir,
+		singleFile: singleFile,
+		opts:       opts,
+		answer:     ret,
 	}
 	// Retrieve the answer to check if there was an error
 	scrape := <-ret
@@ -194,7 +385,7 @@ func (s *Scraper) Stop(rootDir string) {
 		return
 	}
 	c := make(chan *Scrape)
-	s.stopChan <- scrapeRequest{rootDir, c}
+	s.stopChan <- scrapeRequest{rootDir: rootDir, answer: c}
 	for range c {
 		// Just wait until the channel is closed
 	}
@@ -221,7 +412,9 @@ func (s *Scraper) doGetStatus(rootDir string) []Scrape {
 	// Send the request to the management goroutine
 	s.statusChan <- req
 	for scr := range answer {
-		ret = append(ret, *scr)
+		if scr != nil {
+			ret = append(ret, *scr)
+		}
 	}
 	return ret
 }
@@ -244,6 +437,16 @@ func (s *Scraper) Status(rootDir string) *Scrape {
 	return nil
 }
 
+// Log returns the warnings and errors that have been logged by the scrape for the given root directory - oldest first.
+// If there is no such scrape, nil is returned
+func (s *Scraper) Log(rootDir string) []LogEntry {
+	scr := s.Status(rootDir)
+	if scr == nil || scr.logBuf == nil {
+		return nil
+	}
+	return scr.logBuf.Entries()
+}
+
 // scrapeRunning checks if a scrape for the same directory is already running inside the list of running scrapes
 func scrapeRunning(runningScrapes scrapeMap, newRootDir string) bool {
 	for _, scrape := range runningScrapes {
@@ -259,14 +462,31 @@ func scrapeRunning(runningScrapes scrapeMap, newRootDir string) bool {
 func (s *Scraper) manage(start <-chan scrapeRequest, stop <-chan scrapeRequest, statusOut <-chan scrapeRequest) {
 	s.logger.Debug("Starting scraper control goroutine")
 	scrapes := make(scrapeMap)
+	// Scrapes waiting for one of the running scrapes to finish
+	var queue []Scrape
+	var numRunning uint
+	var waiters []*stopWaiter
 	// Aggregate channel to receive status updates at
 	status := make(chan Scrape)
+	// Receives the root directory of each scrape whose goroutine has finished
+	done := make(chan string)
 	for {
 		select {
-		case s := <-status:
+		case scr := <-status:
 			// A status update arrived
-			s.logger.WithField("scrape", s).Debug("Status update for scrape")
-			scrapes[s.RootDir] = s
+			scr.logger.WithField("scrape", scr).Debug("Status update for scrape")
+			s.updateScrape(scrapes, scr)
+		case rootDir := <-done:
+			// A running scrape has ended - release the stop requests waiting for it and start the next one queued
+			numRunning--
+			for i := 0; i < len(waiters); i++ {
+				delete(waiters[i].pending, rootDir)
+				if len(waiters[i].pending) == 0 {
+					close(waiters[i].answer)
+					waiters = append(waiters[:i], waiters[i+1:]...)
+					i--
+				}
+			}
 		case statusReq := <-statusOut:
 			// A request for the current status of a scrape has been requested
 			s.logger.WithField(log.FldPath, statusReq.rootDir).Debug("Status request received for scrape")
@@ -288,97 +508,174 @@ func (s *Scraper) manage(start <-chan scrapeRequest, stop <-chan scrapeRequest,
 			close(statusReq.answer)
 		case startReq := <-start:
 			// We need to start a new scrape
-			scr := s.startScraping(startReq.rootDir, scrapes, status)
+			scr := s.startScraping(startReq, scrapes)
+			if scr.Status == StatusQueued {
+				scr.logger.Info("Scraping operation queued")
+				scrapes[scr.RootDir] = scr
+				queue = append(queue, scr)
+			}
 			startReq.answer <- &scr
 		case stopReq := <-stop:
 			// We'll need to stop the scrape having the given root directory
 			s.logger.WithField(log.FldPath, stopReq.rootDir).Info("Stop request received")
-			// The manage function needs to continue here - else we would have a deadlock
-			go func() {
-				if stopReq.rootDir == "" {
-					// Stop all scrapes
-					for _, scr := range scrapes {
-						scr.Stop()
-					}
-				} else {
-					// Stop only one scrape
-					if scr, ok := scrapes[stopReq.rootDir]; ok {
-						scr.Stop()
-					}
+			waiter := &stopWaiter{pending: make(map[string]bool), answer: stopReq.answer}
+			for rootDir, scr := range scrapes {
+				if stopReq.rootDir != "" && stopReq.rootDir != rootDir {
+					continue
 				}
-				// We're done - close the answer channel
-				close(stopReq.answer)
-			}()
+				switch scr.Status {
+				case StatusQueued:
+					// Queued scrapes have no goroutine yet - just remove them from the queue
+					queue = removeQueued(queue, rootDir)
+					scr.Status = StatusCancelled
+					scr.logger.Info("Queued scraping operation has been cancelled")
+					s.updateScrape(scrapes, scr)
+				case StatusRunning:
+					scr.Stop()
+					waiter.pending[rootDir] = true
+				}
+			}
+			if len(waiter.pending) == 0 {
+				close(waiter.answer)
+			} else {
+				waiters = append(waiters, waiter)
+			}
+		}
+		// Start as many queued scrapes as there are free slots
+		for numRunning < s.maxParallel && len(queue) > 0 {
+			var scr Scrape
+			scr, queue = nextQueued(queue)
+			scr.logger.Info("Scraping operation is starting")
+			scr.Status = StatusRunning
+			scr.runningSince = time.Now()
+			scrapes[scr.RootDir] = scr
+			numRunning++
+			go s.run(scr, status, done)
+		}
+	}
+}
+
+// updateScrape stores the given scrape in the scrape map and notifies the webhook if the scrape has just ended
+func (s *Scraper) updateScrape(scrapes scrapeMap, scr Scrape) {
+	if prev, ok := scrapes[scr.RootDir]; scr.Status.ended() && (!ok || !prev.Status.ended()) {
+		// Notify in the background so that a slow webhook cannot block the manage goroutine
+		go s.notifyWebhook(scr)
+	}
+	scrapes[scr.RootDir] = scr
+}
+
+// nextQueued takes the scrape that needs to be started next from the queue. This is the one with the highest
+// priority - or the one queued first if there are multiple scrapes having the same priority
+func nextQueued(queue []Scrape) (Scrape, []Scrape) {
+	next := 0
+	for i, scr := range queue {
+		if scr.Options.Priority > queue[next].Options.Priority ||
+			(scr.Options.Priority == queue[next].Options.Priority && scr.StartedAt.Before(queue[next].StartedAt)) {
+			next = i
 		}
 	}
+	scr := queue[next]
+	return scr, append(queue[:next], queue[next+1:]...)
 }
 
-// Internal function that is used to check the prerequisites for the intended scraping operation, retrieves
-func (s *Scraper) startScraping(rootDir string, running map[string]Scrape, statusChan chan<- Scrape) Scrape {
-	logger := s.logger.WithField(log.FldPath, rootDir)
+// removeQueued removes the scrape having the given root directory from the queue
+func removeQueued(queue []Scrape, rootDir string) []Scrape {
+	for i, scr := range queue {
+		if scr.RootDir == rootDir {
+			return append(queue[:i], queue[i+1:]...)
+		}
+	}
+	return queue
+}
+
+// Internal function that is used to check the prerequisites for the intended scraping operation. Returns the new
+// scrape in queued state if all checks have passed or a failed one if not
+func (s *Scraper) startScraping(req scrapeRequest, running map[string]Scrape) Scrape {
+	rootDir := req.rootDir
+	logger, logBuf := newScrapeLogger(s.logger.WithField(log.FldPath, rootDir))
 	logger.Debug("Incoming scraping request")
-	stop := make(chan bool)
+	opts := req.opts
+	opts.Exclude = append(append([]string{}, s.Exclude...), opts.Exclude...)
 	scr := Scrape{
-		vRepo:     s.vRepo,
-		RootDir:   rootDir,
-		Status:    StatusQueued,
-		StartedAt: time.Now(),
-		stopChan:  stop,
-		logger:    logger,
-		fns:       s.fns,
+		vRepo:      s.vRepo,
+		chRepo:     s.ChapterRepo,
+		RootDir:    rootDir,
+		Status:     StatusQueued,
+		StartedAt:  time.Now(),
+		Options:    opts,
+		stopChan:   make(chan bool),
+		stopOnce:   &sync.Once{},
+		singleFile: req.singleFile,
+		logger:     logger,
+		logBuf:     logBuf,
+		fns:        s.fns,
+		writingFns: s.WritingFns,
+		videoExts:  s.VideoExtensions,
+	}
+	for _, pattern := range opts.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			scr.Err = ErrBadExcludePattern
+			scr.Status = StatusFailed
+			return scr
+		}
+	}
+	if opts.MaxDepth != nil && *opts.MaxDepth < 0 {
+		scr.Err = ErrBadMaxDepth
+		scr.Status = StatusFailed
+		return scr
 	}
 	if scrapeRunning(running, rootDir) {
 		scr.Err = ErrAlreadyQueued
 		scr.Status = StatusFailed
 		return scr
 	}
-	// Everything all right - let's get a token from the semaphore and start after getting one
-	go func() {
-		// Make a copy to not bleed through to the manage goroutine
-		scr := scr
-		scr.logger.Info("Scraping operation queued")
-		s.queueSemaphore <- 1 // Take a token from the semaphore
-		scr.logger.Info("Scraping operation is starting")
-		scr.Status = StatusRunning
+	return scr
+}
+
+// run executes the given scrape that has just left the queue. When finished, the root directory is sent to the done
+// channel to free the slot for the next scrape
+func (s *Scraper) run(scr Scrape, statusChan chan<- Scrape, done chan<- string) {
+	var err error
+	if scr.singleFile {
+		scr.TotalFiles = 1
+		err = scr.scrapeSingleFile(statusChan, scr.stopChan)
+	} else {
 		scr.CurrentDir = scr.RootDir
 		statusChan <- scr
-		err := scr.walkDir(statusChan, stop)
-		// Reset the file status
-		scr.CurrentDir = ""
-		scr.CurrentFile = ""
-		if err != nil {
-			scr.Status = StatusFailed
-			scr.Err = err
-		} else if scr.Status != StatusCancelled {
-			scr.Status = StatusFinished
-		}
-		scr.logger.Info("Scraping operation has finished")
-		<-s.queueSemaphore // Return the token
+		scr.TotalFiles = scr.countFiles(scr.RootDir, 0)
+		scr.visited = nil
+		scr.logger.Infof("Found %d video files to scrape", scr.TotalFiles)
 		statusChan <- scr
-	}()
-	return scr
+		err = scr.walkDir(statusChan, scr.stopChan, 0)
+	}
+	// Reset the file status
+	scr.CurrentDir = ""
+	scr.CurrentFile = ""
+	if err != nil {
+		scr.Status = StatusFailed
+		scr.Err = err
+	} else if scr.Status != StatusCancelled {
+		scr.Status = StatusFinished
+	}
+	scr.logger.Info("Scraping operation has finished")
+	statusChan <- scr
+	done <- scr.RootDir
 }
 
-// Stop sends the stop signal to the current scrape's goroutine
-// This method blocks until the scrape has stopped
+// Stop signals the current scrape's goroutine to stop. This method does not block - the scrape will stop as soon as
+// it has finished the file currently being scraped
 func (scr Scrape) Stop() {
-	switch scr.Status {
-	case StatusRunning:
-		scr.stopChan <- true
-	case StatusQueued:
-		// Do not block here - the channel will be stopped right after being starting as the queue clears up
-		go func() {
-			scr.stopChan <- true
-		}()
-	default:
-		// All others do not need to be stopped
+	if scr.stopOnce == nil {
 		return
 	}
+	scr.stopOnce.Do(func() {
+		close(scr.stopChan)
+	})
 }
 
 // walkDir traverses a directory tree beginning at the given dir and scrapes all video files it can find using the
-// scraping functions configured
-func (scr *Scrape) walkDir(status chan<- Scrape, stop <-chan bool) error {
+// scraping functions configured. The depth is the number of directory levels the current directory is below the root
+func (scr *Scrape) walkDir(status chan<- Scrape, stop <-chan bool, depth int) error {
 	dir := scr.CurrentDir
 	fileInfo, err := os.Stat(dir)
 	if err != nil {
@@ -390,6 +687,10 @@ func (scr *Scrape) walkDir(status chan<- Scrape, stop <-chan bool) error {
 	if !fileInfo.IsDir() {
 		return fmt.Errorf("Target directory is no directory")
 	}
+	if !scr.enterDir(fileInfo) {
+		scr.logger.WithField(log.FldPath, dir).Debug("Skipping directory that has already been visited")
+		return nil
+	}
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("Cannot read contents of directory %s", dir)
@@ -408,25 +709,48 @@ func (scr *Scrape) walkDir(status chan<- Scrape, stop <-chan bool) error {
 			return nil
 		default:
 			fileName := path.Join(dir, file.Name())
+			if scr.excluded(file.Name()) {
+				scr.logger.WithField(log.FldPath, fileName).Debug("Skipping excluded entry")
+				continue
+			}
+			file, err := scr.resolveSymlink(fileName, file)
+			if err != nil {
+				scr.logger.WithField(log.FldPath, fileName).WithError(err).Warn("Skipping broken symbolic link")
+				continue
+			}
 			if file.IsDir() {
+				if !scr.mayRecurse(depth) {
+					scr.logger.WithField(log.FldPath, fileName).Debug("Skipping directory beyond maximum depth")
+					continue
+				}
 				// Recurse deeper into the directory
 				scr.CurrentDir = fileName
 				scr.CurrentFile = ""
 				status <- *scr
-				err := scr.walkDir(status, stop)
+				err := scr.walkDir(status, stop, depth+1)
 				if err != nil {
 					// This is not the root - so we'll just skip this directory
 					scr.logger.WithField("dir", fileName).WithError(err).Warnf("Skipping directory")
 				}
+				if scr.Status == StatusCancelled {
+					return nil
+				}
 			} else {
 				// We have a file - does it have a video file type?
-				mime := mime.TypeByExtension(path.Ext(fileName))
-				if strings.HasPrefix(mime, "video/") {
+				if scr.isVideoFile(fileName) {
 					// A video file!!! (probably...)
 					scr.CurrentFile = fileName
+					if scr.unchanged(fileName, file.ModTime()) {
+						scr.NumSkippedFiles = scr.NumSkippedFiles + 1
+						scr.fileProcessed()
+						status <- *scr
+						continue
+					}
 					status <- *scr
-					err := scr.file(status)
+					err := scr.file(status, file.ModTime())
+					scr.fileProcessed()
 					if err != nil {
+						status <- *scr
 						scr.logger.WithField(log.FldFile, fileName).WithError(err).Warnf("Skipping video file")
 					} else {
 						// Update our status
@@ -437,22 +761,213 @@ func (scr *Scrape) walkDir(status chan<- Scrape, stop <-chan bool) error {
 			}
 		}
 	}
-	// Just to make sure: Cleanup any waiting stop requests
+	return nil
+}
+
+// unchanged checks if the given file has already been scraped and not been modified since. Always returns false if
+// the scrape is forced to process all files or if the video has been marked as unavailable
+func (scr *Scrape) unchanged(fileName string, modTime time.Time) bool {
+	if scr.Options.Force {
+		return false
+	}
+	vid, err := scr.vRepo.GetByFilename(fileName)
+	if err != nil {
+		if err != repos.ErrEntityNotExisting {
+			scr.logger.WithField(log.FldFile, fileName).WithError(err).Warn("Failed to load video data from repo")
+		}
+		return false
+	}
+	return vid.Available && vid.FileModTime.Equal(modTime)
+}
+
+// countFiles counts the video files inside the given directory tree that are not excluded from the scrape
+// Directories that cannot be read are silently skipped - walkDir will complain about them later
+func (scr *Scrape) countFiles(dir string, depth int) uint {
+	if fileInfo, err := os.Stat(dir); err != nil || !scr.enterDir(fileInfo) {
+		return 0
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	var num uint
+	for _, file := range files {
+		if scr.excluded(file.Name()) {
+			continue
+		}
+		fileName := path.Join(dir, file.Name())
+		file, err := scr.resolveSymlink(fileName, file)
+		if err != nil {
+			continue
+		}
+		if file.IsDir() {
+			if scr.mayRecurse(depth) {
+				num += scr.countFiles(fileName, depth+1)
+			}
+		} else if scr.isVideoFile(fileName) {
+			num++
+		}
+	}
+	return num
+}
+
+// resolveSymlink returns the file information of the target if the given directory entry is a symbolic link and the
+// scrape follows symbolic links. In all other cases, the file information is returned unchanged
+func (scr *Scrape) resolveSymlink(fileName string, file os.FileInfo) (os.FileInfo, error) {
+	if file.Mode()&os.ModeSymlink == 0 || scr.Options.Symlinks != FollowSymlinks {
+		return file, nil
+	}
+	return os.Stat(fileName)
+}
+
+// enterDir marks the given directory as visited when following symbolic links. If the directory has already been
+// visited during this scrape, false is returned
+func (scr *Scrape) enterDir(dirInfo os.FileInfo) bool {
+	if scr.Options.Symlinks != FollowSymlinks {
+		return true
+	}
+	for _, visited := range scr.visited {
+		if os.SameFile(visited, dirInfo) {
+			return false
+		}
+	}
+	scr.visited = append(scr.visited, dirInfo)
+	return true
+}
+
+// mayRecurse checks if the scrape is allowed to descend into the subdirectories of a directory at the given depth
+func (scr *Scrape) mayRecurse(depth int) bool {
+	return scr.Options.MaxDepth == nil || depth < *scr.Options.MaxDepth
+}
+
+// fileProcessed counts the file just scraped as processed and updates the estimated completion time
+func (scr *Scrape) fileProcessed() {
+	scr.numProcessed++
+	if scr.numProcessed >= scr.TotalFiles {
+		scr.EstimatedCompletion = time.Now()
+		return
+	}
+	perFile := time.Since(scr.runningSince) / time.Duration(scr.numProcessed)
+	scr.EstimatedCompletion = time.Now().Add(perFile * time.Duration(scr.TotalFiles-scr.numProcessed))
+}
+
+// Number of bytes read from a file for detecting its content type
+const sniffLen = 512
+
+// isVideoFile checks if the given file has a video file type - or an audio file type if the scrape includes audio
+// files. The file extension is checked first - only if this does not match and content sniffing is enabled, the first
+// bytes of the file are used to detect its type
+func (scr *Scrape) isVideoFile(fileName string) bool {
+	if scr.hasVideoExt(fileName) {
+		return true
+	}
+	if scr.acceptsType(mime.TypeByExtension(path.Ext(fileName))) {
+		return true
+	}
+	if !scr.Options.SniffContent {
+		return false
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	return scr.acceptsType(http.DetectContentType(buf[:n]))
+}
+
+// hasVideoExt checks if the given file has one of the video file extensions configured for the scraper. The leading
+// dot of the configured extensions is optional and the comparison is case-insensitive
+func (scr *Scrape) hasVideoExt(fileName string) bool {
+	ext := strings.TrimPrefix(path.Ext(fileName), ".")
+	if ext == "" {
+		return false
+	}
+	for _, videoExt := range scr.videoExts {
+		if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(videoExt), "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsType checks if files of the given MIME type are scraped
+func (scr *Scrape) acceptsType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "video/") || (scr.Options.IncludeAudio && strings.HasPrefix(mimeType, "audio/"))
+}
+
+// excluded checks if the given base name of a file or directory matches one of the scrape's exclusion patterns
+func (scr *Scrape) excluded(name string) bool {
+	for _, pattern := range scr.Options.Exclude {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// scrapeSingleFile scrapes the one video file the scrape has been started for
+func (scr *Scrape) scrapeSingleFile(status chan<- Scrape, stop <-chan bool) error {
+	fileName := scr.RootDir
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return fmt.Errorf("File '%s' does not exist or cannot be accessed", fileName)
+		}
+		return fmt.Errorf("Cannot get file information for '%s': %v", fileName, err)
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return fmt.Errorf("Target file is no regular file")
+	}
+	if !scr.isVideoFile(fileName) {
+		return fmt.Errorf("Target file is no video file")
+	}
+	// Check, if the scraping operation has been stopped before it has started working
 	select {
 	case <-stop:
+		scr.logger.Warn("Received stop command. Finishing right now.")
+		scr.Status = StatusCancelled
+		return nil
 	default:
 	}
+	scr.CurrentDir = path.Dir(fileName)
+	scr.CurrentFile = fileName
+	if scr.unchanged(fileName, fileInfo.ModTime()) {
+		scr.NumSkippedFiles = 1
+		scr.fileProcessed()
+		status <- *scr
+		return nil
+	}
+	status <- *scr
+	err = scr.file(status, fileInfo.ModTime())
+	scr.fileProcessed()
+	if err != nil {
+		return err
+	}
+	scr.NumFiles = 1
+	status <- *scr
 	return nil
 }
 
 // File takes one file name and scraped this file using all scraping functions configured
-func (scr *Scrape) file(status chan<- Scrape) error {
+// The modification time given is stored with the video to detect changes on the next scrape
+func (scr *Scrape) file(status chan<- Scrape, modTime time.Time) error {
 	var vid = models.Video{
-		Filename: scr.CurrentFile,
+		Filename:    scr.CurrentFile,
+		FileModTime: modTime,
+		Available:   true,
 	}
 	logger := scr.logger.WithField(log.FldFile, scr.CurrentFile)
 	logger.Info("Scraping video file")
-	for i, fn := range scr.fns {
+	fns := scr.fns
+	if !scr.Options.DryRun {
+		fns = append(fns[:len(fns):len(fns)], scr.writingFns...)
+	}
+	for i, fn := range fns {
 		if err := fn(scr.CurrentFile, &vid, logger); err != nil {
 			return fmt.Errorf("Failed to execute scraper #%d (%v): %v", i, fn, err)
 		}
@@ -472,6 +987,28 @@ func (scr *Scrape) file(status chan<- Scrape) error {
 	if err != nil && err != repos.ErrEntityNotExisting {
 		return fmt.Errorf("file: Failed to load video data from repo: %v", err)
 	}
+	if exVid != nil && exVid.Filename != vid.Filename {
+		// The file name will be overwritten - if the known file still exists, we have found a duplicate
+		if _, err := os.Stat(exVid.Filename); err == nil {
+			logger.WithField("existingFile", exVid.Filename).Warn("Found duplicate of an already known video file")
+			scr.Duplicates = append(scr.Duplicates, DuplicateFile{exVid.Filename, vid.Filename})
+		}
+	}
+	if scr.Options.DryRun {
+		// Only record what would have happened
+		if exVid != nil {
+			scr.NumUpdatedFiles = scr.NumUpdatedFiles + 1
+			if len(scr.DryRunUpdated) < maxDryRunSamples {
+				scr.DryRunUpdated = append(scr.DryRunUpdated, mergeVideos(*exVid, vid))
+			}
+		} else {
+			scr.NumNewFiles = scr.NumNewFiles + 1
+			if len(scr.DryRunCreated) < maxDryRunSamples {
+				scr.DryRunCreated = append(scr.DryRunCreated, vid)
+			}
+		}
+		return nil
+	}
 	if exVid != nil {
 		vid = mergeVideos(*exVid, vid)
 		if err = scr.vRepo.Update(&vid); err == nil {
@@ -482,7 +1019,16 @@ func (scr *Scrape) file(status chan<- Scrape) error {
 			scr.NumNewFiles = scr.NumNewFiles + 1
 		}
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	// Replace the stored chapters - but only if the chapters have been scraped at all
+	if scr.chRepo != nil && vid.Chapters != nil {
+		if err = scr.chRepo.SetForVideo(vid.SHA512, vid.Chapters); err != nil {
+			return fmt.Errorf("file: Failed to store chapters: %v", err)
+		}
+	}
+	return nil
 }
 
 // Converts the scrape status into a readable name
@@ -502,6 +1048,11 @@ func (s ScrapeStatus) String() string {
 	return "unknown"
 }
 
+// ended checks if the status is a terminal one - the scrape has either finished, failed or been cancelled
+func (s ScrapeStatus) ended() bool {
+	return s == StatusFinished || s == StatusFailed || s == StatusCancelled
+}
+
 // MarshalJSON implements the json.marshaler interface returning the name of the status
 func (s ScrapeStatus) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf("\"%s\"", s)), nil
@@ -535,8 +1086,24 @@ func mergeInt(first int, second int) int {
 	return first
 }
 
+// Returns the matching value when matching floats
+func mergeFloat(first float64, second float64) float64 {
+	if first == 0 {
+		return second
+	}
+	return first
+}
+
+// Returns the matching value when matching timestamps
+func mergeTime(first time.Time, second time.Time) time.Time {
+	if first.IsZero() {
+		return second
+	}
+	return first
+}
+
 // Returns the matching value when matching durations
-func mergeDuration(first time.Duration, second time.Duration) time.Duration {
+func mergeDuration(first models.Duration, second models.Duration) models.Duration {
 	if first == 0 {
 		return second
 	}
@@ -563,10 +1130,19 @@ func mergeVideos(first models.Video, second models.Video) models.Video {
 			Width:  mergeInt(first.Width, second.Width),
 			Height: mergeInt(first.Height, second.Height),
 		},
-		VideoFormat:  mergeString(first.VideoFormat, second.VideoFormat),
-		VideoBitrate: mergeInt(first.VideoBitrate, second.VideoBitrate),
-		AudioFormat:  mergeString(first.AudioFormat, second.AudioFormat),
-		AudioBitrate: mergeInt(first.AudioBitrate, second.AudioBitrate),
+		Container:         mergeString(first.Container, second.Container),
+		VideoFormat:       mergeString(first.VideoFormat, second.VideoFormat),
+		VideoProfile:      mergeString(first.VideoProfile, second.VideoProfile),
+		FrameRate:         mergeFloat(first.FrameRate, second.FrameRate),
+		Rotation:          second.Rotation, // Always taken from the latest scrape since 0 is a valid rotation
+		Thumbnail:         mergeString(second.Thumbnail, first.Thumbnail),
+		FileModTime:       mergeTime(second.FileModTime, first.FileModTime),
+		Available:         second.Available, // The file has just been scraped - so it is available again
+		VideoBitrate:      mergeInt(first.VideoBitrate, second.VideoBitrate),
+		AudioFormat:       mergeString(first.AudioFormat, second.AudioFormat),
+		AudioBitrate:      mergeInt(first.AudioBitrate, second.AudioBitrate),
+		SubtitleLanguages: mergeString(first.SubtitleLanguages, second.SubtitleLanguages),
+		Chapters:          second.Chapters, // Chapters are not loaded with the video - so take the scraped ones
 		// Number of plays ignored - they will always be taken from the original entry
 	}
 }
@@ -587,6 +1163,7 @@ func getDefaultNameScrapingPresets() map[string]NameScrapingPreset {
 				FldMediumDetail:  5,
 				FldRelatedMedium: 6,
 			},
+			true,
 		},
 		"ID-Anime-Title (Type)": NameScrapingPreset{
 			"ID-Anime-Title (Type)",
@@ -598,6 +1175,7 @@ func getDefaultNameScrapingPresets() map[string]NameScrapingPreset {
 				FldMediumDetail:  5,
 				FldRelatedMedium: 2,
 			},
+			true,
 		},
 		"ID_Language_Artist_Title_Type_Anime": NameScrapingPreset{
 			"ID_Language_Artist_Title_Type_Anime",
@@ -610,6 +1188,7 @@ func getDefaultNameScrapingPresets() map[string]NameScrapingPreset {
 				FldMediumDetail:  5,
 				FldRelatedMedium: 6,
 			},
+			true,
 		},
 		"ID_Anime_Title (Type)": NameScrapingPreset{
 			"ID_Anime_Title (Type)",
@@ -621,6 +1200,7 @@ func getDefaultNameScrapingPresets() map[string]NameScrapingPreset {
 				FldMediumDetail:  5,
 				FldRelatedMedium: 2,
 			},
+			true,
 		},
 	}
 }
@@ -0,0 +1,64 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The timeout for delivering a webhook notification
+const webhookTimeout = 10 * time.Second
+
+// The HTTP client used for delivering webhook notifications
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookPayload is the JSON body posted to the webhook URL when a scrape has ended
+type webhookPayload struct {
+	RootDir         string       `json:"rootDir"`
+	Status          ScrapeStatus `json:"status"`
+	NumFiles        uint         `json:"filesScraped"`
+	NumNewFiles     uint         `json:"newFiles"`
+	NumUpdatedFiles uint         `json:"updatedFiles"`
+	NumSkippedFiles uint         `json:"skippedFiles"`
+	StartedAt       time.Time    `json:"startedAt"`
+	Error           string       `json:"error,omitempty"`
+}
+
+// notifyWebhook posts a summary of the given scrape to the configured webhook URL
+// Failing to deliver the notification is only logged and does not affect the scrape
+func (s *Scraper) notifyWebhook(scr Scrape) {
+	if s.WebhookURL == "" {
+		return
+	}
+	logger := scr.logger.WithField("webhook", s.WebhookURL)
+	payload := webhookPayload{
+		RootDir:         scr.RootDir,
+		Status:          scr.Status,
+		NumFiles:        scr.NumFiles,
+		NumNewFiles:     scr.NumNewFiles,
+		NumUpdatedFiles: scr.NumUpdatedFiles,
+		NumSkippedFiles: scr.NumSkippedFiles,
+		StartedAt:       scr.StartedAt,
+	}
+	if scr.Err != nil {
+		payload.Error = scr.Err.Error()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize webhook payload")
+		return
+	}
+	res, err := webhookClient.Post(s.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.WithError(err).Warn("Failed to deliver webhook notification")
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		logger.WithError(fmt.Errorf("Unexpected status %s", res.Status)).Warn("Webhook notification has been rejected")
+		return
+	}
+	logger.Debug("Webhook notification delivered")
+}
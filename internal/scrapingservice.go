@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/derWhity/kyabia/internal/models"
 	"github.com/derWhity/kyabia/internal/scraper"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
@@ -17,7 +18,21 @@ type ScrapingService interface {
 	ListDirs(ctx context.Context, parentDir string) ([]string, error)
 	ListScrapes(ctx context.Context) ([]scraper.Scrape, error)
 	GetScrape(ctx context.Context, rootDir string) *scraper.Scrape
-	Start(ctx context.Context, rootDir string) error
+	GetScrapeLog(ctx context.Context, rootDir string) ([]scraper.LogEntry, error)
+	Start(ctx context.Context, rootDir string, opts scraper.ScrapeOptions) error
+	Stop(ctx context.Context, rootDir string) error
+	ListPresets(ctx context.Context) []scraper.NameScrapingPreset
+	CreatePreset(ctx context.Context, preset scraper.NameScrapingPreset) error
+	DeletePreset(ctx context.Context, name string) error
+	TestPreset(ctx context.Context, name string, fileName string) (*PresetTestResult, error)
+}
+
+// PresetTestResult is the result of matching a sample file name against a file name scraping preset
+type PresetTestResult struct {
+	// Set if the file name matched the preset's regex
+	Matched bool `json:"matched"`
+	// The values found for the fields of the video
+	Fields map[string]string `json:"fields"`
 }
 
 // -- Helpers ----------------------------------------------------------------------------------------------------------
@@ -46,13 +61,16 @@ func (n RootDirSorter) Swap(i, j int) {
 type scrapingService struct {
 	logger          *logrus.Entry
 	scraperInstance *scraper.Scraper
+	config          ConfigService
 }
 
 // NewScrapingService creates a new scraping service instance using the provided scraper and logger
-func NewScrapingService(scr *scraper.Scraper, logger *logrus.Entry) ScrapingService {
+// The configuration service is used for persisting user-defined scraping presets
+func NewScrapingService(scr *scraper.Scraper, cs ConfigService, logger *logrus.Entry) ScrapingService {
 	return &scrapingService{
 		logger:          logger,
 		scraperInstance: scr,
+		config:          cs,
 	}
 }
 
@@ -92,11 +110,131 @@ func (s *scrapingService) GetScrape(ctx context.Context, rootDir string) *scrape
 	return s.scraperInstance.Status(rootDir)
 }
 
+// GetScrapeLog returns the warnings and errors logged by the scrape that has been started using the given root
+// directory
+func (s *scrapingService) GetScrapeLog(ctx context.Context, rootDir string) ([]scraper.LogEntry, error) {
+	entries := s.scraperInstance.Log(rootDir)
+	if entries == nil {
+		return nil, MakeError(http.StatusNotFound, ErrCodeScrapeNotFound, "There is no scrape for this directory")
+	}
+	return entries, nil
+}
+
 // Start starts a new scrape inside the scraper
-func (s *scrapingService) Start(ctx context.Context, rootDir string) error {
-	err := s.scraperInstance.Start(rootDir)
-	if err != nil && err == scraper.ErrAlreadyQueued {
+// If the given path points to a single file instead of a directory, only this file will be scraped
+func (s *scrapingService) Start(ctx context.Context, rootDir string, opts scraper.ScrapeOptions) error {
+	var err error
+	if fileInfo, statErr := os.Stat(rootDir); statErr == nil && fileInfo.Mode().IsRegular() {
+		err = s.scraperInstance.StartFile(rootDir, opts)
+	} else {
+		err = s.scraperInstance.Start(rootDir, opts)
+	}
+	switch err {
+	case scraper.ErrAlreadyQueued:
 		return MakeError(http.StatusConflict, ErrCodeScrapeRunning, "A scrape for this directory is already running")
+	case scraper.ErrBadExcludePattern:
+		return MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"At least one of the exclusion patterns is malformed",
+			map[string]string{
+				"field": "exclude",
+			},
+		)
+	case scraper.ErrBadMaxDepth:
+		return MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"The maximum depth must not be negative",
+			map[string]string{
+				"field": "maxDepth",
+			},
+		)
 	}
 	return err
 }
+
+// Stop stops the scrape that has been started using the given root directory
+func (s *scrapingService) Stop(ctx context.Context, rootDir string) error {
+	if s.scraperInstance.Status(rootDir) == nil {
+		return MakeError(http.StatusNotFound, ErrCodeScrapeNotFound, "There is no scrape for this directory")
+	}
+	s.scraperInstance.Stop(rootDir)
+	return nil
+}
+
+// ListPresets returns all file name scraping presets available - built-in and user-defined ones
+func (s *scrapingService) ListPresets(ctx context.Context) []scraper.NameScrapingPreset {
+	return scraper.Presets()
+}
+
+// CreatePreset validates and adds a new user-defined file name scraping preset
+func (s *scrapingService) CreatePreset(ctx context.Context, preset scraper.NameScrapingPreset) error {
+	if err := scraper.AddPreset(preset); err != nil {
+		if presetErr, ok := err.(*scraper.PresetError); ok {
+			return MakeErrorWithData(
+				http.StatusBadRequest,
+				ErrCodeIllegalValue,
+				presetErr.Reason,
+				map[string]string{
+					"field": presetErr.Field,
+				},
+			)
+		}
+		if err == scraper.ErrPresetExists {
+			return MakeError(http.StatusConflict, ErrCodePresetExists, "A scraping preset with this name already exists")
+		}
+		return err
+	}
+	return s.persistPresets(ctx)
+}
+
+// DeletePreset removes the user-defined file name scraping preset with the given name
+func (s *scrapingService) DeletePreset(ctx context.Context, name string) error {
+	switch err := scraper.RemovePreset(name); err {
+	case nil:
+	case scraper.ErrPresetNotFound:
+		return MakeError(http.StatusNotFound, ErrCodePresetNotFound, "The scraping preset does not exist")
+	case scraper.ErrPresetBuiltIn:
+		return MakeError(http.StatusForbidden, ErrCodePresetBuiltIn, "Built-in scraping presets cannot be removed")
+	default:
+		return err
+	}
+	return s.persistPresets(ctx)
+}
+
+// persistPresets writes the current list of user-defined scraping presets to the configuration file
+func (s *scrapingService) persistPresets(ctx context.Context) error {
+	var presets []models.FileNamePreset
+	for _, preset := range scraper.CustomPresets() {
+		presets = append(presets, models.FileNamePreset{
+			Name:     preset.Name,
+			Regex:    preset.Regex,
+			FieldMap: preset.FieldMap,
+		})
+	}
+	if err := s.config.SetScrapingPresets(ctx, presets); err != nil {
+		s.logger.WithError(err).Error("Failed to persist scraping presets")
+		return MakeError(
+			http.StatusInternalServerError,
+			ErrCodeUnknown,
+			"Failed to write the scraping presets to the configuration",
+		)
+	}
+	return nil
+}
+
+// TestPreset matches the given sample file name against the file name scraping preset with the given name
+func (s *scrapingService) TestPreset(ctx context.Context, name string, fileName string) (*PresetTestResult, error) {
+	fields, err := scraper.TestPreset(name, fileName)
+	if err != nil {
+		if err == scraper.ErrPresetNotFound {
+			return nil, MakeError(http.StatusNotFound, ErrCodePresetNotFound, "The scraping preset does not exist")
+		}
+		return nil, err
+	}
+	if fields == nil {
+		return &PresetTestResult{Matched: false, Fields: map[string]string{}}, nil
+	}
+	return &PresetTestResult{Matched: true, Fields: fields}, nil
+}
@@ -2,8 +2,11 @@ package internal
 
 import (
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/derWhity/kyabia/internal/log"
 	"github.com/derWhity/kyabia/internal/models"
 	"github.com/derWhity/kyabia/internal/repos"
 	"github.com/sirupsen/logrus"
@@ -17,8 +20,15 @@ type SessionService interface {
 	Login(ctx context.Context, user string, password string) (*SessionInfo, error)
 	// Logout logs out a currently active session
 	Logout(ctx context.Context, sessionID string) error
+	// LogoutAll logs out all sessions of the user the given session belongs to and returns the number of sessions
+	// terminated
+	LogoutAll(ctx context.Context, sessionID string) (uint, error)
 	// WhoAmI returns information about the current session
 	WhoAmI(ctx context.Context, sessionID string) (*SessionInfo, error)
+	// Refresh extends the expiry of the current session and returns information about the session
+	Refresh(ctx context.Context, sessionID string) (*SessionInfo, error)
+	// Sessions returns the active sessions of the user the given session belongs to
+	Sessions(ctx context.Context, sessionID string) ([]SessionSummary, error)
 	// GetContents returns the session and user data associated with the given session ID
 	// This service function will be used internally and does not have an endpoint
 	GetContents(ctx context.Context, sessionID string, extendExpiry bool) (*models.Session, *models.User, error)
@@ -29,11 +39,25 @@ type SessionService interface {
 // SessionInfo is a session information object that is returned upon login. It contains both, the session ID and
 // information about the user that is logged in
 type SessionInfo struct {
-	SessionID    string `json:"sessionId"`
-	UserName     string `json:"userName"`
-	UserFullName string `json:"userFullName"`
+	SessionID    string    `json:"sessionId"`
+	UserName     string    `json:"userName"`
+	UserFullName string    `json:"userFullName"`
+	Permissions  []string  `json:"permissions"`
+	ExpiresAt    time.Time `json:"expiresAt"`
 }
 
+// SessionSummary describes an active session without revealing the full session ID
+type SessionSummary struct {
+	// The first characters of the session ID
+	IDPrefix  string    `json:"idPrefix"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Is this the session the request was made with?
+	Current bool `json:"current"`
+}
+
+// The number of characters of the session ID revealed in a session summary
+const sessionIDPrefixLength = 8
+
 type sessionService struct {
 	logger   *logrus.Entry
 	sessions repos.SessionRepo
@@ -55,6 +79,8 @@ func makeSessionInfo(sess *models.Session, user *models.User) *SessionInfo {
 		SessionID:    sess.ID,
 		UserName:     user.Name,
 		UserFullName: user.FullName,
+		Permissions:  user.PermissionList(),
+		ExpiresAt:    sess.ExpiresAt,
 	}
 }
 
@@ -105,15 +131,108 @@ func (s *sessionService) Logout(ctx context.Context, sessionID string) error {
 	return nil
 }
 
+// LogoutAll logs out all sessions of the user the given session belongs to - including the given session itself - and
+// returns the number of sessions terminated
+func (s *sessionService) LogoutAll(ctx context.Context, sessionID string) (uint, error) {
+	sess, _, err := s.GetContents(ctx, sessionID, false)
+	if err != nil {
+		return 0, err
+	}
+	if sess == nil {
+		return 0, MakeError(
+			http.StatusForbidden,
+			ErrCodeNotLoggedIn,
+			"The session does not exist or has expired",
+		)
+	}
+	num, err := s.sessions.DeleteForUser(sess.UserID)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to delete sessions")
+		return 0, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to logout. Error in the data store",
+		)
+	}
+	s.logger.WithFields(logrus.Fields{
+		log.FldUser:   sess.UserID,
+		"numSessions": num,
+	}).Info("Logged out all sessions of user")
+	return num, nil
+}
+
 // WhoAmI returns information about the current session
 func (s *sessionService) WhoAmI(ctx context.Context, sessionID string) (*SessionInfo, error) {
 	sess, u, err := s.GetContents(ctx, sessionID, false)
 	if err != nil {
 		return nil, err
 	}
+	if sess == nil {
+		return nil, MakeError(
+			http.StatusForbidden,
+			ErrCodeNotLoggedIn,
+			"The session does not exist or has expired",
+		)
+	}
+	return makeSessionInfo(sess, u), nil
+}
+
+// Refresh extends the expiry of the current session and returns information about the session
+func (s *sessionService) Refresh(ctx context.Context, sessionID string) (*SessionInfo, error) {
+	sess, u, err := s.GetContents(ctx, sessionID, true)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, MakeError(
+			http.StatusForbidden,
+			ErrCodeNotLoggedIn,
+			"The session does not exist or has expired",
+		)
+	}
 	return makeSessionInfo(sess, u), nil
 }
 
+// Sessions returns the active sessions of the user the given session belongs to - the most recently extended first
+func (s *sessionService) Sessions(ctx context.Context, sessionID string) ([]SessionSummary, error) {
+	sess, _, err := s.GetContents(ctx, sessionID, false)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, MakeError(
+			http.StatusForbidden,
+			ErrCodeNotLoggedIn,
+			"The session does not exist or has expired",
+		)
+	}
+	list, err := s.sessions.ListByUser(sess.UserID)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to list sessions")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to retrieve the sessions from storage",
+		)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ExpiresAt.After(list[j].ExpiresAt)
+	})
+	ret := make([]SessionSummary, len(list))
+	for i, ls := range list {
+		prefix := ls.ID
+		if len(prefix) > sessionIDPrefixLength {
+			prefix = prefix[:sessionIDPrefixLength]
+		}
+		ret[i] = SessionSummary{
+			IDPrefix:  prefix,
+			ExpiresAt: ls.ExpiresAt,
+			Current:   ls.ID == sess.ID,
+		}
+	}
+	return ret, nil
+}
+
 // GetContents returns the session and user data associated with the given session ID
 // This service function will be used internally and does not have an endpoint
 func (s *sessionService) GetContents(ctx context.Context, sessionID string, extendExpiry bool) (*models.Session, *models.User, error) {
@@ -141,5 +260,9 @@ func (s *sessionService) GetContents(ctx context.Context, sessionID string, exte
 			"Failed to retrieve user information from storage",
 		)
 	}
+	if u == nil {
+		return nil, nil, nil
+	}
+	sess.Permissions = u.PermissionList()
 	return sess, u, nil
 }
@@ -3,7 +3,11 @@ package internal
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"os"
 	"path"
 	"strconv"
 
@@ -12,10 +16,12 @@ import (
 	"path/filepath"
 
 	"regexp"
+	"time"
 
 	"github.com/derWhity/kyabia/internal/ctxhelper"
 	"github.com/derWhity/kyabia/internal/log"
 	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/scraper"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/kardianos/osext"
@@ -25,6 +31,10 @@ import (
 
 const (
 	apiBasePath = "/api"
+	// The maximum size of an imported playlist file in bytes
+	maxImportSize = 1 << 20
+	// The name of the cookie holding the session ID if the client has chosen cookie-based authentication
+	sessionCookieName = "kyabia_session"
 )
 
 // Defines an error that defines the HTTP status that should be returned
@@ -57,6 +67,9 @@ func MakeHTTPHandler(
 	ps PlaylistService,
 	es EventService,
 	sServ SessionService,
+	us UserService,
+	as AuditService,
+	ks APIKeyService,
 	cs ConfigService,
 	logger *logrus.Entry,
 ) http.Handler {
@@ -66,6 +79,9 @@ func MakeHTTPHandler(
 		httptransport.ServerErrorEncoder(encodeError),
 		httptransport.ServerBefore(makeContextInjector(logger)),
 		httptransport.ServerBefore(makeSessionDecoder(sServ)),
+		httptransport.ServerBefore(makeAPIKeyDecoder(ks)),
+		httptransport.ServerBefore(makePageSizeInjector(cs)),
+		httptransport.ServerBefore(makeAuditInjector(as)),
 	}
 
 	// -- Config service -------------------------------
@@ -95,6 +111,38 @@ func MakeHTTPHandler(
 			encodeJSONResponse,
 			options...,
 		))
+
+		// GetBanlist
+		r.Methods(http.MethodGet).Path(apiBasePath + "/config/restrictions/banlist").Handler(httptransport.NewServer(
+			configEndpoints.GetBanlist,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// AddToBanlist
+		r.Methods(http.MethodPost).Path(apiBasePath + "/config/restrictions/banlist").Handler(httptransport.NewServer(
+			configEndpoints.AddToBanlist,
+			decodeIPAddressFromJSONBody,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// RemoveFromBanlist
+		r.Methods(http.MethodDelete).Path(apiBasePath + "/config/restrictions/banlist/{ipAddress}").Handler(httptransport.NewServer(
+			configEndpoints.RemoveFromBanlist,
+			decodeIPAddressFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Reload
+		r.Methods(http.MethodPost).Path(apiBasePath + "/config/reload").Handler(httptransport.NewServer(
+			configEndpoints.Reload,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
 	}
 
 	// -- Scraping service -----------------------------
@@ -109,6 +157,38 @@ func MakeHTTPHandler(
 			options...,
 		))
 
+		// ListPresets - the preset routes need to be registered before the scrape routes since these match every path
+		r.Methods(http.MethodGet).Path(apiBasePath + "/scrape/presets").Handler(httptransport.NewServer(
+			scrapingEndpoints.ListPresets,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// CreatePreset
+		r.Methods(http.MethodPost).Path(apiBasePath + "/scrape/presets").Handler(httptransport.NewServer(
+			scrapingEndpoints.CreatePreset,
+			decodeScrapingPreset,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// DeletePreset
+		r.Methods(http.MethodDelete).Path(apiBasePath + "/scrape/presets/{presetName}").Handler(httptransport.NewServer(
+			scrapingEndpoints.DeletePreset,
+			decodePresetNameFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// TestPreset
+		r.Methods(http.MethodPost).Path(apiBasePath + "/scrape/presets/{presetName}/test").Handler(httptransport.NewServer(
+			scrapingEndpoints.TestPreset,
+			decodeTestPresetRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
 		// ListScrapes
 		r.Methods(http.MethodGet).Path(apiBasePath + "/scrapes").Handler(httptransport.NewServer(
 			scrapingEndpoints.ListScrapes,
@@ -117,6 +197,14 @@ func MakeHTTPHandler(
 			options...,
 		))
 
+		// GetScrapeLog - needs to be registered before GetScrape since the path would match it, too
+		r.Methods(http.MethodGet).Path(apiBasePath + "/scrape{pathName:\\/?.*}/log").Handler(httptransport.NewServer(
+			scrapingEndpoints.GetScrapeLog,
+			decodePathName,
+			encodeJSONResponse,
+			options...,
+		))
+
 		// GetScrape
 		r.Methods(http.MethodGet).Path(apiBasePath + "/scrape{pathName:\\/?.*}").Handler(httptransport.NewServer(
 			scrapingEndpoints.GetScrape,
@@ -128,6 +216,14 @@ func MakeHTTPHandler(
 		// Start (scrape)
 		r.Methods(http.MethodPost).Path(apiBasePath + "/scrape{pathName:\\/?.*}").Handler(httptransport.NewServer(
 			scrapingEndpoints.Start,
+			decodeStartScrapeRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Stop (scrape)
+		r.Methods(http.MethodDelete).Path(apiBasePath + "/scrape{pathName:\\/?.*}").Handler(httptransport.NewServer(
+			scrapingEndpoints.Stop,
 			decodePathName,
 			encodeJSONResponse,
 			options...,
@@ -141,11 +237,59 @@ func MakeHTTPHandler(
 		// Find
 		r.Methods(http.MethodGet).Path(apiBasePath + "/videos").Handler(httptransport.NewServer(
 			vEp.List,
+			decodeVideoSearchRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Artists - needs to be registered before Get since the path would match it, too
+		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/artists").Handler(httptransport.NewServer(
+			vEp.Artists,
+			decodeSearchRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// RelatedMedia - needs to be registered before Get since the path would match it, too
+		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/relatedMedia").Handler(httptransport.NewServer(
+			vEp.RelatedMedia,
 			decodeSearchRequest,
 			encodeJSONResponse,
 			options...,
 		))
 
+		// LanguageFacets
+		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/facets/language").Handler(httptransport.NewServer(
+			vEp.Languages,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Top - needs to be registered before Get since the path would match it, too
+		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/top").Handler(httptransport.NewServer(
+			vEp.Top,
+			decodeTopVideosRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Export - needs to be registered before Get since the path would match it, too
+		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/export.csv").Handler(httptransport.NewServer(
+			vEp.Export,
+			decodeVideoSearchRequest,
+			encodeStreamResponse,
+			options...,
+		))
+
+		// GetByIdentifier
+		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/byIdentifier/{id}").Handler(httptransport.NewServer(
+			vEp.GetByIdent,
+			decodeVideoHashFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
 		// Get
 		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/{id}").Handler(httptransport.NewServer(
 			vEp.Get,
@@ -162,6 +306,54 @@ func MakeHTTPHandler(
 			options...,
 		))
 
+		// Purge
+		r.Methods(http.MethodPost).Path(apiBasePath + "/videos/purge").Handler(httptransport.NewServer(
+			vEp.Purge,
+			decodePurgeVideosRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Merge
+		r.Methods(http.MethodPost).Path(apiBasePath + "/videos/merge").Handler(httptransport.NewServer(
+			vEp.Merge,
+			decodeMergeVideosRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Relocate
+		r.Methods(http.MethodPost).Path(apiBasePath + "/videos/relocate").Handler(httptransport.NewServer(
+			vEp.Relocate,
+			decodeRelocateVideosRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Verify
+		r.Methods(http.MethodPost).Path(apiBasePath + "/videos/verify").Handler(httptransport.NewServer(
+			vEp.Verify,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Create
+		r.Methods(http.MethodPost).Path(apiBasePath + "/videos").Handler(httptransport.NewServer(
+			vEp.Create,
+			decodeVideoRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// UpdateMany
+		r.Methods(http.MethodPatch).Path(apiBasePath + "/videos").Handler(httptransport.NewServer(
+			vEp.UpdateMany,
+			decodeBulkVideoUpdateRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
 		// Delete
 		r.Methods(http.MethodDelete).Path(apiBasePath + "/videos/{id}").Handler(httptransport.NewServer(
 			vEp.Delete,
@@ -169,6 +361,70 @@ func MakeHTTPHandler(
 			encodeJSONResponse,
 			options...,
 		))
+
+		// Restore
+		r.Methods(http.MethodPost).Path(apiBasePath + "/videos/{id}/restore").Handler(httptransport.NewServer(
+			vEp.Restore,
+			decodeVideoHashFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// MarkPlayed
+		r.Methods(http.MethodPost).Path(apiBasePath + "/videos/{id}/played").Handler(httptransport.NewServer(
+			vEp.MarkPlayed,
+			decodeVideoHashFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Sprite
+		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/{id}/sprite").Handler(httptransport.NewServer(
+			vEp.Sprite,
+			decodeSpriteRequest,
+			encodeFileResponse,
+			options...,
+		))
+
+		// Thumbnail
+		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/{id}/thumbnail").Handler(httptransport.NewServer(
+			vEp.Thumbnail,
+			decodeVideoHashFromPath,
+			encodeFileResponse,
+			options...,
+		))
+
+		// AddTag
+		r.Methods(http.MethodPost).Path(apiBasePath + "/videos/{id}/tags").Handler(httptransport.NewServer(
+			vEp.AddTag,
+			decodeAddVideoTagRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// RemoveTag
+		r.Methods(http.MethodDelete).Path(apiBasePath + "/videos/{id}/tags/{tag}").Handler(httptransport.NewServer(
+			vEp.RemoveTag,
+			decodeRemoveVideoTagRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// ListTags
+		r.Methods(http.MethodGet).Path(apiBasePath + "/tags").Handler(httptransport.NewServer(
+			vEp.ListTags,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Chapters
+		r.Methods(http.MethodGet).Path(apiBasePath + "/videos/{id}/chapters").Handler(httptransport.NewServer(
+			vEp.Chapters,
+			decodeVideoHashFromPath,
+			encodeJSONResponse,
+			options...,
+		))
 	}
 
 	// -- Playlist service -----------------------------
@@ -226,7 +482,71 @@ func MakeHTTPHandler(
 		// AddEntry
 		r.Methods(http.MethodPost).Path(apiBasePath + "/playlists/{id:[0-9]+}/entries").Handler(httptransport.NewServer(
 			plEp.AddEntry,
-			decodePlaylistEntry,
+			decodeAddPlaylistEntryRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// AddEntries
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlists/{id:[0-9]+}/entries/batch").Handler(httptransport.NewServer(
+			plEp.AddEntries,
+			decodeAddEntriesRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Shuffle
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlists/{id:[0-9]+}/shuffle").Handler(httptransport.NewServer(
+			plEp.Shuffle,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// MergeInto
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlists/{id:[0-9]+}/merge/{targetId:[0-9]+}").Handler(httptransport.NewServer(
+			plEp.MergeInto,
+			decodeMergePlaylistRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// TotalDuration
+		r.Methods(http.MethodGet).Path(apiBasePath + "/playlists/{id:[0-9]+}/duration").Handler(httptransport.NewServer(
+			plEp.TotalDuration,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// RemoveEntriesByIP
+		r.Methods(http.MethodDelete).Path(apiBasePath + "/playlists/{id:[0-9]+}/entries/byIp/{ipAddress}").Handler(httptransport.NewServer(
+			plEp.RemoveByIP,
+			decodeRemoveEntriesByIPRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// RemovePlayedEntries
+		r.Methods(http.MethodDelete).Path(apiBasePath + "/playlists/{id:[0-9]+}/entries/played").Handler(httptransport.NewServer(
+			plEp.RemovePlayed,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// ExportXSPF
+		r.Methods(http.MethodGet).Path(apiBasePath + "/playlists/{id:[0-9]+}/export.xspf").Handler(httptransport.NewServer(
+			plEp.ExportXSPF,
+			decodeIDFromPath,
+			encodeStreamResponse,
+			options...,
+		))
+
+		// ImportM3U
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlists/{id:[0-9]+}/import").Handler(httptransport.NewServer(
+			plEp.ImportM3U,
+			decodePlaylistImportRequest,
 			encodeJSONResponse,
 			options...,
 		))
@@ -239,10 +559,82 @@ func MakeHTTPHandler(
 			options...,
 		))
 
+		// SwapEntries
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlistEntries/{id:[0-9]+}/swap/{otherId:[0-9]+}").Handler(httptransport.NewServer(
+			plEp.SwapEntries,
+			decodeReorderRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
 		// UpdateEntry
 		r.Methods(http.MethodPut).Path(apiBasePath + "/playlistEntries/{entryId:[0-9]+}").Handler(httptransport.NewServer(
 			plEp.UpdateEntry,
-			decodePlaylistEntry,
+			decodeUpdatePlaylistEntryRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// MoveToTop
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlistEntries/{id:[0-9]+}/top").Handler(httptransport.NewServer(
+			plEp.MoveToTop,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// MoveToBottom
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlistEntries/{id:[0-9]+}/bottom").Handler(httptransport.NewServer(
+			plEp.MoveToBottom,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// MarkEntryPlayed
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlistEntries/{id:[0-9]+}/played").Handler(httptransport.NewServer(
+			plEp.MarkEntryPlayed,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// SetEntryPriority
+		r.Methods(http.MethodPut).Path(apiBasePath + "/playlistEntries/{id:[0-9]+}/priority").Handler(httptransport.NewServer(
+			plEp.SetEntryPriority,
+			decodeEntryPriorityRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// ApproveEntry
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlistEntries/{id:[0-9]+}/approve").Handler(httptransport.NewServer(
+			plEp.ApproveEntry,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// RejectEntry
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlistEntries/{id:[0-9]+}/reject").Handler(httptransport.NewServer(
+			plEp.RejectEntry,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// EstimatedWait
+		r.Methods(http.MethodGet).Path(apiBasePath + "/playlistEntries/{id:[0-9]+}/wait").Handler(httptransport.NewServer(
+			plEp.EstimatedWait,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// EntryPosition
+		r.Methods(http.MethodGet).Path(apiBasePath + "/playlistEntries/{id:[0-9]+}/position").Handler(httptransport.NewServer(
+			plEp.EntryPosition,
+			decodeIDFromPath,
 			encodeJSONResponse,
 			options...,
 		))
@@ -265,10 +657,34 @@ func MakeHTTPHandler(
 			options...,
 		))
 
+		// CurrentMainEntry
+		r.Methods(http.MethodGet).Path(apiBasePath + "/playlists/main/current").Handler(httptransport.NewServer(
+			plEp.CurrentMainEntry,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// SetCurrentMainEntry
+		r.Methods(http.MethodPost).Path(apiBasePath + "/playlists/main/current/{id:[0-9]+}").Handler(httptransport.NewServer(
+			plEp.SetCurrentMainEntry,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// NextMainEntry
+		r.Methods(http.MethodGet).Path(apiBasePath + "/playlists/main/next").Handler(httptransport.NewServer(
+			plEp.NextMainEntry,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
 		// ListMainEntries
 		r.Methods(http.MethodGet).Path(apiBasePath + "/playlists/main/entries").Handler(httptransport.NewServer(
 			plEp.ListMainEntries,
-			decodePaginationRequest,
+			decodePlaylistEntrySearchRequest,
 			encodeJSONResponse,
 			options...,
 		))
@@ -303,6 +719,38 @@ func MakeHTTPHandler(
 			options...,
 		))
 
+		// Statistics
+		r.Methods(http.MethodGet).Path(apiBasePath + "/events/{id:[0-9]+}/statistics").Handler(httptransport.NewServer(
+			evEp.Statistics,
+			decodeEventStatisticsRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Reset statistics
+		r.Methods(http.MethodPost).Path(apiBasePath + "/events/{id:[0-9]+}/statistics/reset").Handler(httptransport.NewServer(
+			evEp.ResetStatistics,
+			decodeResetStatisticsRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Top requesters
+		r.Methods(http.MethodGet).Path(apiBasePath + "/events/{id:[0-9]+}/topRequesters").Handler(httptransport.NewServer(
+			evEp.TopRequesters,
+			decodeTopRequestersRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Top videos
+		r.Methods(http.MethodGet).Path(apiBasePath + "/events/{id:[0-9]+}/topVideos").Handler(httptransport.NewServer(
+			evEp.TopVideos,
+			decodeEventTopVideosRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
 		// Create
 		r.Methods(http.MethodPost).Path(apiBasePath + "/events").Handler(httptransport.NewServer(
 			evEp.Create,
@@ -327,6 +775,22 @@ func MakeHTTPHandler(
 			options...,
 		))
 
+		// Archive
+		r.Methods(http.MethodGet).Path(apiBasePath + "/events/{id:[0-9]+}/archive").Handler(httptransport.NewServer(
+			evEp.Archive,
+			decodeIDFromPath,
+			encodeStreamResponse,
+			options...,
+		))
+
+		// Clone
+		r.Methods(http.MethodPost).Path(apiBasePath + "/events/{id:[0-9]+}/clone").Handler(httptransport.NewServer(
+			evEp.Clone,
+			decodeCloneEventRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
 		// SetCurrentEvent
 		r.Methods(http.MethodPost).Path(apiBasePath + "/events/{id:[0-9]+}/makeCurrent").Handler(httptransport.NewServer(
 			evEp.SetCurrentEvent,
@@ -342,6 +806,19 @@ func MakeHTTPHandler(
 			encodeJSONResponse,
 			options...,
 		))
+
+		// Overlaps
+		r.Methods(http.MethodGet).Path(apiBasePath + "/events/overlaps").Handler(httptransport.NewServer(
+			evEp.Overlaps,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Stream of current event changes
+		r.Methods(http.MethodGet).Path(apiBasePath + "/events/current/stream").Handler(
+			makeCurrentEventStreamHandler(es, logger),
+		)
 	}
 
 	// -- Session Service ------------------------------
@@ -352,7 +829,7 @@ func MakeHTTPHandler(
 		r.Methods(http.MethodPost).Path(apiBasePath + "/login").Handler(httptransport.NewServer(
 			sEp.Login,
 			decodeLoginRequest,
-			encodeJSONResponse,
+			encodeSessionCookieResponse,
 			options...,
 		))
 
@@ -360,7 +837,15 @@ func MakeHTTPHandler(
 		r.Methods(http.MethodPost).Path(apiBasePath + "/logout").Handler(httptransport.NewServer(
 			sEp.Logout,
 			decodeToken,
-			encodeJSONResponse,
+			encodeSessionCookieResponse,
+			options...,
+		))
+
+		// LogoutAll
+		r.Methods(http.MethodPost).Path(apiBasePath + "/logout/all").Handler(httptransport.NewServer(
+			sEp.LogoutAll,
+			decodeToken,
+			encodeSessionCookieResponse,
 			options...,
 		))
 
@@ -371,6 +856,125 @@ func MakeHTTPHandler(
 			encodeJSONResponse,
 			options...,
 		))
+
+		// Refresh
+		r.Methods(http.MethodPost).Path(apiBasePath + "/refresh").Handler(httptransport.NewServer(
+			sEp.Refresh,
+			decodeToken,
+			encodeSessionCookieResponse,
+			options...,
+		))
+
+		// Sessions
+		r.Methods(http.MethodGet).Path(apiBasePath + "/sessions").Handler(httptransport.NewServer(
+			sEp.Sessions,
+			decodeToken,
+			encodeJSONResponse,
+			options...,
+		))
+	}
+
+	// -- API Key Service ------------------------------
+	{
+		kEp := MakeAPIKeyEndpoints(ks)
+
+		// List
+		r.Methods(http.MethodGet).Path(apiBasePath + "/apiKeys").Handler(httptransport.NewServer(
+			kEp.List,
+			decodeNilRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Create
+		r.Methods(http.MethodPost).Path(apiBasePath + "/apiKeys").Handler(httptransport.NewServer(
+			kEp.Create,
+			decodeCreateAPIKeyRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Revoke
+		r.Methods(http.MethodDelete).Path(apiBasePath + "/apiKeys/{id:[0-9]+}").Handler(httptransport.NewServer(
+			kEp.Revoke,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+	}
+
+	// -- Audit Service --------------------------------
+	{
+		aEp := MakeAuditEndpoints(as)
+
+		// List
+		r.Methods(http.MethodGet).Path(apiBasePath + "/audit").Handler(httptransport.NewServer(
+			aEp.List,
+			decodeSearchRequest,
+			encodeJSONResponse,
+			options...,
+		))
+	}
+
+	// -- User Service ---------------------------------
+	{
+		uEp := MakeUserEndpoints(us)
+
+		// List
+		r.Methods(http.MethodGet).Path(apiBasePath + "/users").Handler(httptransport.NewServer(
+			uEp.List,
+			decodeSearchRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Create
+		r.Methods(http.MethodPost).Path(apiBasePath + "/users").Handler(httptransport.NewServer(
+			uEp.Create,
+			decodeCreateUserRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Get
+		r.Methods(http.MethodGet).Path(apiBasePath + "/users/{id:[0-9]+}").Handler(httptransport.NewServer(
+			uEp.Get,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Update
+		r.Methods(http.MethodPut).Path(apiBasePath + "/users/{id:[0-9]+}").Handler(httptransport.NewServer(
+			uEp.Update,
+			decodeUpdateUserRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// SetPermissions
+		r.Methods(http.MethodPut).Path(apiBasePath + "/users/{id:[0-9]+}/permissions").Handler(httptransport.NewServer(
+			uEp.SetPermissions,
+			decodeUserPermissionsRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// ChangePassword
+		r.Methods(http.MethodPut).Path(apiBasePath + "/users/{id:[0-9]+}/password").Handler(httptransport.NewServer(
+			uEp.ChangePassword,
+			decodeChangePasswordRequest,
+			encodeJSONResponse,
+			options...,
+		))
+
+		// Delete
+		r.Methods(http.MethodDelete).Path(apiBasePath + "/users/{id:[0-9]+}").Handler(httptransport.NewServer(
+			uEp.Delete,
+			decodeIDFromPath,
+			encodeJSONResponse,
+			options...,
+		))
 	}
 
 	// Simple alive answer for checking if HTTP can be reached
@@ -392,6 +996,64 @@ func MakeHTTPHandler(
 	return r
 }
 
+// makeCurrentEventStreamHandler creates a handler streaming the current event to the client as Server-Sent Events. The
+// current event is sent on connect and on every change - "null" if there is no current event
+func makeCurrentEventStreamHandler(es EventService, logger *logrus.Entry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		ctx := context.WithValue(r.Context(), ctxhelper.KeyLogger, logger)
+		changes, unsubscribe := es.SubscribeCurrentEvent(ctx)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		send := func(ev *models.Event) error {
+			data, err := json.Marshal(guestEvent(ev))
+			if err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(w, "event: currentEvent\ndata: %s\n\n", data); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+		ev, err := es.CurrentEvent(ctx)
+		if err != nil {
+			ev = nil
+		}
+		if err := send(ev); err != nil {
+			return
+		}
+		// Regularly send a comment to keep proxies from closing the idle connection
+		keepAlive := time.NewTicker(30 * time.Second)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-changes:
+				if err := send(ev); err != nil {
+					logger.WithError(err).Debug("Failed to send current event to stream client")
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
 // decodeNilRequest just does nothing with the request. It is used for endpoints that don't need anything to be passed
 func decodeNilRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	return nil, nil
@@ -416,23 +1078,275 @@ func decodeIPAddressFromJSONBody(_ context.Context, r *http.Request) (interface{
 			fmt.Sprint("Missing IP address parameter"),
 		)
 	}
-	return ip, nil
+	return ip, nil
+}
+
+func decodeIPAddressFromPath(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	str, ok := vars["ipAddress"]
+	if !ok {
+		return 0, MakeError(http.StatusBadRequest, ErrCodeRequiredFieldMissing, "Missing IP address")
+	}
+	return str, nil
+}
+
+// decodeLoginRequest decodes a login request from the JSON body
+func decodeLoginRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req loginRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	return req, nil
+}
+
+// decodeCreateUserRequest decodes the data of a user to create from the JSON body
+func decodeCreateUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	return req, nil
+}
+
+// decodeUpdateUserRequest reads the ID of the user to update from the path and the new display name from the JSON body
+func decodeUpdateUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	var req updateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	req.ID = id
+	return req, nil
+}
+
+// decodeUserPermissionsRequest reads the ID of the user from the path and the new permissions from the JSON body
+func decodeUserPermissionsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	var req userPermissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	req.ID = id
+	return req, nil
+}
+
+// decodeChangePasswordRequest reads the ID of the user from the path and the new password from the JSON body
+func decodeChangePasswordRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	req.ID = id
+	return req, nil
+}
+
+// decodeCreateAPIKeyRequest decodes the data of an API key to create from the JSON body
+func decodeCreateAPIKeyRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	return req, nil
+}
+
+// decodeToken gets the token from the call's context
+func decodeToken(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	session := ctxhelper.Session(ctx)
+	if session == nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeNotLoggedIn,
+			"You need an active session for this operation",
+		)
+	}
+	return session.ID, nil
+}
+
+// decodePaginationRequest reads the pagination information from the request's query variables - the limit is capped at
+// the configured maximum page size
+func decodePaginationRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	val := r.URL.Query()
+	pag := Pagination{
+		Limit: 50,
+	}
+	if i, err := strconv.ParseUint(val.Get("offset"), 10, 64); err == nil {
+		pag.Offset = uint(i)
+	}
+	if i, err := strconv.ParseUint(val.Get("limit"), 10, 64); err == nil {
+		pag.Limit = uint(i)
+	}
+	if max := ctxhelper.MaxPageSize(ctx); pag.Limit > max {
+		pag.Limit = max
+	}
+	return pag, nil
+}
+
+// decodeSpriteRequest reads the video's ID (hash) from the path and the sprite sheet's layout from the query variables
+func decodeSpriteRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeVideoHashFromPath(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	val := r.URL.Query()
+	req := spriteRequest{
+		ID:      id.(string),
+		Frames:  DefaultSpriteFrames,
+		Columns: DefaultSpriteColumns,
+	}
+	if i, err := strconv.ParseUint(val.Get("frames"), 10, 64); err == nil {
+		req.Frames = uint(i)
+	}
+	if i, err := strconv.ParseUint(val.Get("columns"), 10, 64); err == nil {
+		req.Columns = uint(i)
+	} else if req.Columns > req.Frames {
+		// Fewer frames than default columns requested - use a single row
+		req.Columns = req.Frames
+	}
+	return req, nil
+}
+
+// decodeTopVideosRequest reads the number of videos and the ranking from the query variables "limit" and "by". Setting
+// "by" to "played" ranks the videos by the number of times they have been played
+func decodeTopVideosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	val := r.URL.Query()
+	req := topVideosRequest{Limit: DefaultTopVideos}
+	if i, err := strconv.ParseUint(val.Get("limit"), 10, 64); err == nil {
+		req.Limit = uint(i)
+	}
+	switch val.Get("by") {
+	case "", "requested":
+	case "played":
+		req.ByPlayed = true
+	default:
+		return nil, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"The ranking must either be 'requested' or 'played'",
+			map[string]string{"field": "by"},
+		)
+	}
+	return req, nil
+}
+
+// decodeEventStatisticsRequest reads the event ID from the path and the ranking from the query variable "by" - which
+// can either be "requested" (default) or "played"
+func decodeEventStatisticsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	req := eventStatisticsRequest{EventID: id}
+	switch r.URL.Query().Get("by") {
+	case "", "requested":
+	case "played":
+		req.ByPlayed = true
+	default:
+		return nil, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"The ranking must either be 'requested' or 'played'",
+			map[string]string{"field": "by"},
+		)
+	}
+	return req, nil
+}
+
+// decodeResetStatisticsRequest reads the event ID from the path and the optional flag "resetVideoCounters" from the
+// query
+func decodeResetStatisticsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	req := resetStatisticsRequest{EventID: id}
+	if val := r.URL.Query().Get("resetVideoCounters"); val != "" {
+		if req.ResetVideoCounters, err = strconv.ParseBool(val); err != nil {
+			return nil, MakeErrorWithData(
+				http.StatusBadRequest,
+				ErrCodeIllegalValue,
+				"The value of 'resetVideoCounters' must be a boolean",
+				map[string]string{"field": "resetVideoCounters"},
+			)
+		}
+	}
+	return req, nil
+}
+
+// decodeTopRequestersRequest reads the event ID from the path and the number of requesters from the query variable
+// "limit"
+func decodeTopRequestersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	req := topRequestersRequest{EventID: id, Limit: DefaultTopRequesters}
+	if i, err := strconv.ParseUint(r.URL.Query().Get("limit"), 10, 64); err == nil {
+		req.Limit = uint(i)
+	}
+	return req, nil
+}
+
+// decodeEventTopVideosRequest reads the event ID from the path and the number of videos from the query variable "limit"
+func decodeEventTopVideosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	req := eventTopVideosRequest{EventID: id, Limit: DefaultTopVideos}
+	if i, err := strconv.ParseUint(r.URL.Query().Get("limit"), 10, 64); err == nil {
+		req.Limit = uint(i)
+	}
+	return req, nil
 }
 
-func decodeIPAddressFromPath(_ context.Context, r *http.Request) (interface{}, error) {
-	vars := mux.Vars(r)
-	str, ok := vars["ipAddress"]
-	if !ok {
-		return 0, MakeError(http.StatusBadRequest, ErrCodeRequiredFieldMissing, "Missing IP address")
+// decodePurgeVideosRequest reads the number of days deleted videos are kept from the query variable "days"
+func decodePurgeVideosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := purgeVideosRequest{Days: DefaultPurgeDays}
+	if i, err := strconv.ParseUint(r.URL.Query().Get("days"), 10, 64); err == nil {
+		req.Days = uint(i)
 	}
-	return str, nil
+	return req, nil
 }
 
-// decodeLoginRequest decodes a login request from the JSON body
-func decodeLoginRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	var req loginRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
+// decodeMergeVideosRequest decodes the IDs of the videos to merge from the JSON body
+func decodeMergeVideosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req mergeVideosRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return nil, MakeError(
 			http.StatusBadRequest,
 			ErrCodeIllegalJSON,
@@ -442,32 +1356,17 @@ func decodeLoginRequest(_ context.Context, r *http.Request) (interface{}, error)
 	return req, nil
 }
 
-// decodeToken gets the token from the call's context
-func decodeToken(ctx context.Context, r *http.Request) (request interface{}, err error) {
-	session := ctxhelper.Session(ctx)
-	if session == nil {
+// decodeRelocateVideosRequest decodes the old and the new directory of a relocation from the JSON body
+func decodeRelocateVideosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req relocateVideosRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return nil, MakeError(
 			http.StatusBadRequest,
-			ErrCodeNotLoggedIn,
-			"You need an active session for this operation",
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
 		)
 	}
-	return session.ID, nil
-}
-
-// decodePaginationRequest reads the pagination information from the request's query variables
-func decodePaginationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
-	val := r.URL.Query()
-	pag := Pagination{
-		Limit: 50,
-	}
-	if i, err := strconv.ParseUint(val.Get("offset"), 10, 64); err == nil {
-		pag.Offset = uint(i)
-	}
-	if i, err := strconv.ParseUint(val.Get("limit"), 10, 64); err == nil {
-		pag.Limit = uint(i)
-	}
-	return pag, nil
+	return req, nil
 }
 
 // decodeVideoUpdateRequest decodes information of the video to update from the JSON body and gets the video's ID (hash)
@@ -486,6 +1385,46 @@ func decodeVideoUpdateRequest(ctx context.Context, r *http.Request) (interface{}
 	return vid, nil
 }
 
+// decodeBulkVideoUpdateRequest reads the IDs of the videos to update and the fields to change from the JSON body
+func decodeBulkVideoUpdateRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req bulkVideoUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	return req, nil
+}
+
+// decodeAddVideoTagRequest reads the video's ID (hash) from the path and the tag to add from the JSON body
+func decodeAddVideoTagRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeVideoHashFromPath(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	var req videoTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	req.ID = id.(string)
+	return req, nil
+}
+
+// decodeRemoveVideoTagRequest reads the video's ID (hash) and the tag to remove from the path
+func decodeRemoveVideoTagRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeVideoHashFromPath(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return videoTagRequest{ID: id.(string), Tag: mux.Vars(r)["tag"]}, nil
+}
+
 // decodeVideoRequest reads information about a video entry from the request's JSON body
 func decodeVideoRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var vid models.Video
@@ -519,28 +1458,120 @@ func decodePlaylistEntry(ctx context.Context, r *http.Request) (interface{}, err
 	if id, err := getUintFromPath("entryId", r); err == nil {
 		en.ID = id
 	}
-	// Add the IP address of the requester
+	en.RequesterIP = requesterIP(r)
+	return en, nil
+}
+
+// decodeUpdatePlaylistEntryRequest decodes the changes to a playlist entry from the JSON body and the entry ID from the
+// path. The note is kept apart, so a missing note can be told from an empty one
+func decodeUpdatePlaylistEntryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req updateEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	if id, err := getUintFromPath("entryId", r); err == nil {
+		req.ID = id
+	}
+	return req, nil
+}
+
+// decodeAddPlaylistEntryRequest decodes a playlist entry to add like decodePlaylistEntry does - together with the
+// optional GET variable "index" the entry should be inserted at
+func decodeAddPlaylistEntryRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	en, err := decodePlaylistEntry(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := addEntryRequest{Entry: en.(models.PlaylistEntry)}
+	if val := r.URL.Query().Get("index"); val != "" {
+		index, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return nil, MakeErrorWithData(
+				http.StatusBadRequest,
+				ErrCodeIllegalValue,
+				"The index must be a non-negative number",
+				map[string]string{"field": "index"},
+			)
+		}
+		i := uint(index)
+		req.Index = &i
+	}
+	return req, nil
+}
+
+// requesterIP returns the IP address of the machine the request came from
+func requesterIP(r *http.Request) string {
 	if fwdIP := r.Header.Get("X-Forwarded-For"); fwdIP != "" {
 		// We have a X-Forwarded-For header that means we're behind a proxy
-		en.RequesterIP = fwdIP
-	} else {
-		// Use the requesting host
-		reg := regexp.MustCompile(":[0-9]+$")
-		en.RequesterIP = reg.ReplaceAllString(r.RemoteAddr, "")
+		return fwdIP
 	}
-	return en, nil
+	// Use the requesting host
+	reg := regexp.MustCompile(":[0-9]+$")
+	return reg.ReplaceAllString(r.RemoteAddr, "")
+}
+
+// decodePlaylistImportRequest reads the playlist file to import from the request's body and the playlist's ID from the
+// path. The requester of the imported entries can be given as query variable "requestedBy"
+func decodeAddEntriesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.PlaylistEntry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	ip := requesterIP(r)
+	for i := range entries {
+		entries[i].RequesterIP = ip
+	}
+	return addEntriesRequest{PlaylistID: id, Entries: entries}, nil
+}
+
+func decodePlaylistImportRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeIDFromPath(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := ioutil.ReadAll(io.LimitReader(r.Body, maxImportSize+1))
+	if err != nil {
+		return nil, MakeError(http.StatusBadRequest, ErrCodeIllegalValue, fmt.Sprintf("Failed to read body: %v", err))
+	}
+	if len(contents) > maxImportSize {
+		return nil, MakeError(
+			http.StatusRequestEntityTooLarge,
+			ErrCodeIllegalValue,
+			fmt.Sprintf("The playlist file must not be larger than %d bytes", maxImportSize),
+		)
+	}
+	return playlistImportRequest{
+		PlaylistID: id.(uint),
+		Contents:   string(contents),
+		Entry: models.PlaylistEntry{
+			RequestedBy: r.URL.Query().Get("requestedBy"),
+			RequesterIP: requesterIP(r),
+		},
+	}, nil
 }
 
 // Decodes a request for listing the entries of a specific playlist
 func decodePlaylistEntryListRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
-	pag, _ := decodePaginationRequest(ctx, r)
+	search, _ := decodePlaylistEntrySearchRequest(ctx, r)
 	id, err := decodeIDFromPath(ctx, r)
 	if err != nil {
 		return nil, err
 	}
 	return playlistEntryListRequest{
-		Pagination: pag.(Pagination),
-		PlaylistID: id.(uint),
+		PlaylistEntrySearch: search.(PlaylistEntrySearch),
+		PlaylistID:          id.(uint),
 	}, nil
 }
 
@@ -555,6 +1586,51 @@ func decodeSearchRequest(ctx context.Context, r *http.Request) (request interfac
 	return search, nil
 }
 
+// decodePlaylistEntrySearchRequest decodes the parameters of a search for playlist entries - which are the ones of a
+// default search plus the GET variable "requestedBy"
+func decodePlaylistEntrySearchRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	search, _ := decodeSearchRequest(ctx, r)
+	return PlaylistEntrySearch{
+		Search:      search.(Search),
+		RequestedBy: r.URL.Query().Get("requestedBy"),
+	}, nil
+}
+
+// decodeVideoSearchRequest decodes the parameters of a video search - which are the ones of a default search plus the
+// GET variables "tag", "available" and "notPlayedWithin"
+func decodeVideoSearchRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	search, _ := decodeSearchRequest(ctx, r)
+	req := VideoSearch{
+		Search: search.(Search),
+		Tag:    r.URL.Query().Get("tag"),
+	}
+	if val := r.URL.Query().Get("available"); val != "" {
+		available, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, MakeErrorWithData(
+				http.StatusBadRequest,
+				ErrCodeIllegalValue,
+				"The availability filter must either be 'true' or 'false'",
+				map[string]string{"field": "available"},
+			)
+		}
+		req.Available = &available
+	}
+	if val := r.URL.Query().Get("notPlayedWithin"); val != "" {
+		minutes, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return nil, MakeErrorWithData(
+				http.StatusBadRequest,
+				ErrCodeIllegalValue,
+				"The cooldown must be a number of minutes",
+				map[string]string{"field": "notPlayedWithin"},
+			)
+		}
+		req.NotPlayedWithin = uint(minutes)
+	}
+	return req, nil
+}
+
 // decodeDirsRequest decodes the parameters for the ListDirs service call
 func decodePathName(_ context.Context, r *http.Request) (request interface{}, err error) {
 	vars := mux.Vars(r)
@@ -566,6 +1642,76 @@ func decodePathName(_ context.Context, r *http.Request) (request interface{}, er
 	return p, nil
 }
 
+// decodeStartScrapeRequest decodes the path to start scraping at from the path and the scrape's options from the
+// optional JSON body
+func decodeStartScrapeRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	p, err := decodePathName(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := startScrapeRequest{RootDir: p.(string)}
+	if err := json.NewDecoder(r.Body).Decode(&req.Options); err != nil && err != io.EOF {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	return req, nil
+}
+
+// decodeScrapingPreset tries to load a file name scraping preset from the provided HTTP request's body
+func decodeScrapingPreset(_ context.Context, r *http.Request) (interface{}, error) {
+	var preset scraper.NameScrapingPreset
+	err := json.NewDecoder(r.Body).Decode(&preset)
+	if err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	return preset, nil
+}
+
+// decodePresetNameFromPath decodes the name of a scraping preset from the path variable "presetName"
+func decodePresetNameFromPath(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	name, ok := vars["presetName"]
+	if !ok || name == "" {
+		return nil, MakeError(http.StatusBadRequest, ErrCodeRequiredFieldMissing, "Missing preset name")
+	}
+	return name, nil
+}
+
+// decodeTestPresetRequest decodes the preset name from the path and the sample file name from the JSON body
+func decodeTestPresetRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	name, err := decodePresetNameFromPath(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	var req testPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	if req.FileName == "" {
+		return nil, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeRequiredFieldMissing,
+			"Missing sample file name",
+			map[string]string{
+				"field": "fileName",
+			},
+		)
+	}
+	req.PresetName = name.(string)
+	return req, nil
+}
+
 // decodePlaylist tries to load a playlist object from the provided HTTP request's body
 func decodePlaylist(_ context.Context, r *http.Request) (interface{}, error) {
 	var pl models.Playlist
@@ -609,6 +1755,33 @@ func getUintFromPath(varname string, r *http.Request) (uint, error) {
 	return uint(id), nil
 }
 
+// decodeEntryPriorityRequest loads the entry ID from the path and its new priority from the JSON body
+func decodeEntryPriorityRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	entryID, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Priority *int `json:"priority"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	if data.Priority == nil {
+		return nil, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeRequiredFieldMissing,
+			"Missing priority",
+			map[string]string{"field": "priority"},
+		)
+	}
+	return entryPriorityRequest{Entry: entryID, Priority: *data.Priority}, nil
+}
+
 // decodeReorderRequest loads the IDs needed for a reorder operation from the path variables
 func decodeReorderRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	entryID, err := getUintFromPath("id", r)
@@ -623,6 +1796,41 @@ func decodeReorderRequest(ctx context.Context, r *http.Request) (interface{}, er
 }
 
 // Decodes an ID from the "id" path variable provided by GoRilla
+func decodeRemoveEntriesByIPRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := decodeIPAddressFromPath(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return removeEntriesByIPRequest{PlaylistID: id, IPAddress: ip.(string)}, nil
+}
+
+func decodeMergePlaylistRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	sourceID, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	targetID, err := getUintFromPath("targetId", r)
+	if err != nil {
+		return nil, err
+	}
+	req := mergePlaylistRequest{Source: sourceID, Target: targetID}
+	if val := r.URL.Query().Get("deleteSource"); val != "" {
+		if req.DeleteSource, err = strconv.ParseBool(val); err != nil {
+			return nil, MakeErrorWithData(
+				http.StatusBadRequest,
+				ErrCodeIllegalValue,
+				"The value of 'deleteSource' must be a boolean",
+				map[string]string{"field": "deleteSource"},
+			)
+		}
+	}
+	return req, nil
+}
+
 func decodeIDFromPath(ctx context.Context, r *http.Request) (interface{}, error) {
 	return getUintFromPath("id", r)
 }
@@ -667,12 +1875,96 @@ func decodeEventUpdate(ctx context.Context, r *http.Request) (interface{}, error
 	return ret, nil
 }
 
+// decodeCloneEventRequest reads the ID of the event to clone from the path and the time span of the new event from the
+// JSON body
+func decodeCloneEventRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := getUintFromPath("id", r)
+	if err != nil {
+		return nil, err
+	}
+	var req cloneEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, MakeError(
+			http.StatusBadRequest,
+			ErrCodeIllegalJSON,
+			fmt.Sprintf("Failed to decode JSON body: %v", err),
+		)
+	}
+	missing := ""
+	if req.EndsAt.IsZero() {
+		missing = "endsAt"
+	}
+	if req.StartsAt.IsZero() {
+		missing = "startsAt"
+	}
+	if missing != "" {
+		return nil, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeRequiredFieldMissing,
+			"The start and end time of the new event are required",
+			map[string]string{"field": missing},
+		)
+	}
+	req.EventID = id
+	return req, nil
+}
+
 // Encodes a typical JSON response
 func encodeJSONResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	return json.NewEncoder(w).Encode(response)
 }
 
+// Sets or clears the session cookie as requested by a sessionCookieResponse before sending the JSON response
+func encodeSessionCookieResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if res, ok := response.(sessionCookieResponse); ok {
+		cookie := &http.Cookie{
+			Name:     sessionCookieName,
+			Value:    res.SessionID,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+		if res.SessionID == "" {
+			cookie.MaxAge = -1
+		}
+		http.SetCookie(w, cookie)
+	}
+	return encodeJSONResponse(ctx, w, response)
+}
+
+// Sends the contents of the file referenced by a fileResponse to the client
+func encodeFileResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res, ok := response.(fileResponse)
+	if !ok {
+		return encodeJSONResponse(ctx, w, response)
+	}
+	f, err := os.Open(res.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	contentType := mime.TypeByExtension(filepath.Ext(res.Path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Writes the body of a streamResponse to the client. Since the headers have already been sent when writing the body
+// fails, such errors cannot be reported to the client anymore
+func encodeStreamResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res, ok := response.(streamResponse)
+	if !ok {
+		return encodeJSONResponse(ctx, w, response)
+	}
+	w.Header().Set("Content-Type", res.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": res.FileName}))
+	return res.Write(w)
+}
+
 // Builds an error response based on the incoming error
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
@@ -709,6 +2001,14 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 func makeSessionDecoder(s SessionService) httptransport.RequestFunc {
 	return func(ctx context.Context, r *http.Request) context.Context {
 		token := strings.TrimSpace(r.Header.Get("token"))
+		fromCookie := false
+		if token == "" {
+			// Clients using cookie-based authentication send the token inside the session cookie
+			if cookie, err := r.Cookie(sessionCookieName); err == nil {
+				token = strings.TrimSpace(cookie.Value)
+				fromCookie = token != ""
+			}
+		}
 		logger := ctxhelper.Logger(ctx)
 		if token != "" {
 			// Try to load the session's data
@@ -722,6 +2022,7 @@ func makeSessionDecoder(s SessionService) httptransport.RequestFunc {
 				return ctx
 			}
 			ctx = context.WithValue(ctx, ctxhelper.KeySession, *sess)
+			ctx = context.WithValue(ctx, ctxhelper.KeySessionFromCookie, fromCookie)
 			ctx = context.WithValue(ctx, ctxhelper.KeyUser, *user)
 			ctx = context.WithValue(ctx, ctxhelper.KeyLogger, logger.WithFields(logrus.Fields{
 				log.FldSession: sess.ID,
@@ -732,6 +2033,48 @@ func makeSessionDecoder(s SessionService) httptransport.RequestFunc {
 	}
 }
 
+// makeAPIKeyDecoder creates a function that authenticates machine clients sending an API key inside the "X-Api-Key"
+// header. The key is only used if no user has been authenticated by session
+func makeAPIKeyDecoder(ks APIKeyService) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		key := strings.TrimSpace(r.Header.Get("X-Api-Key"))
+		if key == "" || ctxhelper.User(ctx) != nil {
+			return ctx
+		}
+		logger := ctxhelper.Logger(ctx)
+		sess, user, err := ks.Authenticate(ctx, key)
+		if err != nil {
+			logger.WithError(err).Error("Failed to authenticate API key")
+			return ctx
+		}
+		if sess == nil || user == nil {
+			logger.Warn("Request with unknown API key")
+			return ctx
+		}
+		ctx = context.WithValue(ctx, ctxhelper.KeySession, *sess)
+		ctx = context.WithValue(ctx, ctxhelper.KeyUser, *user)
+		return context.WithValue(ctx, ctxhelper.KeyLogger, logger.WithFields(logrus.Fields{
+			log.FldSession: sess.ID,
+			log.FldUser:    user.Name,
+		}))
+	}
+}
+
+// makePageSizeInjector creates a function that injects the configured maximum page size into the request context
+func makePageSizeInjector(cs ConfigService) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return context.WithValue(ctx, ctxhelper.KeyMaxPageSize, cs.GetConfig(ctx).MaxPageSize)
+	}
+}
+
+// makeAuditInjector creates a function that injects the audit service into the request context, so services can record
+// administrative actions
+func makeAuditInjector(as AuditService) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return context.WithValue(ctx, ctxhelper.KeyAuditService, as)
+	}
+}
+
 func makeContextInjector(logger *logrus.Entry) httptransport.RequestFunc {
 	return func(ctx context.Context, r *http.Request) context.Context {
 		return context.WithValue(ctx, ctxhelper.KeyLogger, logger)
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/derWhity/kyabia/internal/ctxhelper"
+	"github.com/derWhity/kyabia/internal/log"
+	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// UserService provides service functions for managing the users that are able to log in
+type UserService interface {
+	List(ctx context.Context, search *Search) ([]models.User, error)
+	Get(ctx context.Context, id uint) (*models.User, error)
+	Create(ctx context.Context, name string, password string, fullName string, permissions []string) (*models.User, error)
+	UpdateFullName(ctx context.Context, id uint, fullName string) (*models.User, error)
+	SetPermissions(ctx context.Context, id uint, permissions []string) (*models.User, error)
+	ChangePassword(ctx context.Context, id uint, password string) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// -- UserService implementation ---------------------------------------------------------------------------------------
+
+// UserService implementation
+type userService struct {
+	repo   repos.UserRepo
+	cs     ConfigService
+	logger *logrus.Entry
+}
+
+// NewUserService creates a new user service instance with the provided user repository. The password rules are taken
+// from the given config service
+func NewUserService(ur repos.UserRepo, cs ConfigService, logger *logrus.Entry) UserService {
+	return &userService{
+		repo:   ur,
+		cs:     cs,
+		logger: logger,
+	}
+}
+
+// List returns the users matching the given search
+func (s *userService) List(ctx context.Context, search *Search) ([]models.User, error) {
+	users, err := s.repo.Find(search.Search, search.Offset, search.Limit)
+	if err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError, "Failed to search for users", err)
+	}
+	ret := make([]models.User, len(users))
+	for i, u := range users {
+		ret[i] = *u
+	}
+	return ret, nil
+}
+
+// Get returns the user with the given ID
+func (s *userService) Get(ctx context.Context, id uint) (*models.User, error) {
+	u, err := s.repo.GetByID(id)
+	if (err == nil && u == nil) || err == repos.ErrEntityNotExisting {
+		return nil, MakeError(http.StatusNotFound, ErrCodeUserNotFound, fmt.Sprintf("User #%d does not exist", id))
+	}
+	if err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Error while retrieving user #%d", id), err,
+		)
+	}
+	return u, nil
+}
+
+// Create creates a new user with the given login name and password. The login name is stored in lower case, just like
+// it is compared on login. If no permissions are given, the user is granted all permissions
+func (s *userService) Create(
+	ctx context.Context,
+	name string,
+	password string,
+	fullName string,
+	permissions []string,
+) (*models.User, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return nil, MakeErrorWithData(http.StatusBadRequest, ErrCodeRequiredFieldMissing, "A user name is required",
+			map[string]string{"field": "name"},
+		)
+	}
+	if err := s.checkPassword(ctx, password); err != nil {
+		return nil, err
+	}
+	if permissions == nil {
+		permissions = []string{models.PermAll}
+	}
+	if err := checkPermissions(permissions); err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.GetByName(name)
+	if err != nil && err != repos.ErrEntityNotExisting {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError, "Failed to check user name", err)
+	}
+	if err == nil && existing != nil {
+		return nil, MakeError(http.StatusConflict, ErrCodeUserExists,
+			fmt.Sprintf("A user named '%s' does already exist", name),
+		)
+	}
+	u := models.User{
+		Name:     name,
+		FullName: strings.TrimSpace(fullName),
+	}
+	if u.FullName == "" {
+		u.FullName = name
+	}
+	u.SetPermissions(permissions)
+	if err := u.SetPassword(password); err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeUnknown, "Failed to hash password", err)
+	}
+	if err := s.repo.Create(&u); err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError, "Failed to create user", err)
+	}
+	s.logger.WithField(log.FldUser, u.Name).Info("Created user")
+	audit(ctx, models.AuditUserCreate, u.Name, "Permissions: "+u.Permissions)
+	return &u, nil
+}
+
+// UpdateFullName changes the display name of the user with the given ID
+func (s *userService) UpdateFullName(ctx context.Context, id uint, fullName string) (*models.User, error) {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	u.FullName = strings.TrimSpace(fullName)
+	if u.FullName == "" {
+		return nil, MakeErrorWithData(http.StatusBadRequest, ErrCodeRequiredFieldMissing, "A full name is required",
+			map[string]string{"field": "fullName"},
+		)
+	}
+	if err := s.repo.Update(u); err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Failed to update user #%d", id), err,
+		)
+	}
+	return u, nil
+}
+
+// SetPermissions replaces the permissions granted to the user with the given ID. The changes apply to the user's
+// active sessions immediately
+func (s *userService) SetPermissions(ctx context.Context, id uint, permissions []string) (*models.User, error) {
+	if err := checkPermissions(permissions); err != nil {
+		return nil, err
+	}
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	u.SetPermissions(permissions)
+	if err := s.repo.Update(u); err != nil {
+		return nil, MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Failed to update user #%d", id), err,
+		)
+	}
+	s.logger.WithFields(logrus.Fields{
+		log.FldID:     id,
+		"permissions": u.Permissions,
+	}).Info("Changed user permissions")
+	audit(ctx, models.AuditUserPermissions, u.Name, "Permissions: "+u.Permissions)
+	return u, nil
+}
+
+// ChangePassword sets a new password for the user with the given ID. Users can always change their own password -
+// changing the password of another user requires the permission to manage users
+func (s *userService) ChangePassword(ctx context.Context, id uint, password string) error {
+	current := ctxhelper.User(ctx)
+	if current == nil || current.ID != id {
+		if sess := ctxhelper.Session(ctx); sess == nil || !sess.UserCan(models.PermUserManage) {
+			return MakeErrorWithData(
+				http.StatusForbidden,
+				ErrCodePermissionDenied,
+				"You are not allowed to change the password of other users",
+				map[string]string{"permission": models.PermUserManage},
+			)
+		}
+	}
+	if err := s.checkPassword(ctx, password); err != nil {
+		return err
+	}
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := u.SetPassword(password); err != nil {
+		return MakeErrorWithData(http.StatusInternalServerError, ErrCodeUnknown, "Failed to hash password", err)
+	}
+	if err := s.repo.Update(u); err != nil {
+		return MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Failed to update user #%d", id), err,
+		)
+	}
+	s.logger.WithField(log.FldID, id).Info("Changed user password")
+	return nil
+}
+
+// checkPassword returns an error listing the unmet requirements if the given password does not meet the configured
+// password rules
+func (s *userService) checkPassword(ctx context.Context, password string) error {
+	if password == "" {
+		return MakeErrorWithData(http.StatusBadRequest, ErrCodeRequiredFieldMissing, "A password is required",
+			map[string]string{"field": "password"},
+		)
+	}
+	unmet := s.cs.GetConfig(ctx).PasswordRules.Unmet(password)
+	if len(unmet) > 0 {
+		return MakeErrorWithData(http.StatusBadRequest, ErrCodeWeakPassword,
+			fmt.Sprintf("The password is too weak. It needs %s", strings.Join(unmet, ", ")),
+			map[string][]string{"unmet": unmet},
+		)
+	}
+	return nil
+}
+
+// checkPermissions returns an error if the given list contains an unknown permission
+func checkPermissions(permissions []string) error {
+	for _, p := range permissions {
+		if !models.IsPermission(p) {
+			return MakeErrorWithData(http.StatusBadRequest, ErrCodeIllegalValue,
+				fmt.Sprintf("Unknown permission '%s'", p),
+				map[string]string{"field": "permissions"},
+			)
+		}
+	}
+	return nil
+}
+
+// Delete removes the user with the given ID. Users cannot delete their own account and the last remaining user cannot
+// be deleted - otherwise nobody would be able to log in any more
+func (s *userService) Delete(ctx context.Context, id uint) error {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if current := ctxhelper.User(ctx); current != nil && current.ID == id {
+		return MakeError(http.StatusConflict, ErrCodeUserNotDeletable, "You cannot delete your own user account")
+	}
+	users, err := s.repo.Find("", 0, 2)
+	if err != nil {
+		return MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError, "Failed to count users", err)
+	}
+	if len(users) < 2 {
+		return MakeError(http.StatusConflict, ErrCodeUserNotDeletable, "The last remaining user cannot be deleted")
+	}
+	if err := s.repo.Delete(id); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return MakeError(http.StatusNotFound, ErrCodeUserNotFound, fmt.Sprintf("User #%d does not exist", id))
+		}
+		return MakeErrorWithData(http.StatusInternalServerError, ErrCodeRepoError,
+			fmt.Sprintf("Failed to delete user #%d", id), err,
+		)
+	}
+	s.logger.WithField(log.FldID, id).Info("Deleted user")
+	audit(ctx, models.AuditUserDelete, u.Name, "")
+	return nil
+}
@@ -1,10 +1,23 @@
 package internal
 
 import (
+	"crypto/sha512"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/derWhity/kyabia/internal/log"
 	"github.com/derWhity/kyabia/internal/models"
 	"github.com/derWhity/kyabia/internal/repos"
+	"github.com/derWhity/kyabia/internal/scraper"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 )
@@ -12,16 +25,97 @@ import (
 // VideoService provides functionality for listing scraped videos
 type VideoService interface {
 	// List searches for videos matching the provided search and returns a list of paged results
-	List(ctx context.Context, search *Search) ([]models.Video, uint, error)
+	List(ctx context.Context, search *VideoSearch) ([]models.Video, uint, error)
 	// Get returns the video with the given ID (SHA-512 hash)
 	Get(ctx context.Context, id string) (*models.Video, error)
-	// Create will be added later
-	// Create(ctx context.Context, video *models.Video) (*models.Video, error)
-
+	// GetByIdentifier returns all videos having the given identifier (catalog number) - optionally only the ones
+	// that are available
+	GetByIdentifier(ctx context.Context, identifier string, onlyAvailable bool) ([]models.Video, error)
+	// Create adds a video by hand - e.g. for a streamed video that has no local file
+	Create(ctx context.Context, video *models.Video) (*models.Video, error)
 	// Update updates the given video in the database with the video data provided
 	Update(ctx context.Context, video *models.Video) error
-	// Delete removes the video with the given ID (SHA-512 hash) from the database
+	// UpdateMany applies the non-empty fields of the patch to all videos with the given IDs (SHA-512 hashes) and
+	// returns the number of videos updated
+	UpdateMany(ctx context.Context, ids []string, patch models.VideoPatch) (uint, error)
+	// Merge merges the video with the ID mergeHash into the one with the ID keepHash and returns the resulting video
+	Merge(ctx context.Context, keepHash string, mergeHash string) (*models.Video, error)
+	// Delete removes the video with the given ID (SHA-512 hash) from the database. The video can be restored until it
+	// gets purged
 	Delete(ctx context.Context, id string) error
+	// Restore restores the deleted video with the given ID (SHA-512 hash)
+	Restore(ctx context.Context, id string) error
+	// Purge permanently removes all videos that have been deleted more than the given number of days ago and returns
+	// the number of videos removed
+	Purge(ctx context.Context, days uint) (uint, error)
+	// MarkPlayed increases the play counter of the video with the given ID (SHA-512 hash)
+	MarkPlayed(ctx context.Context, id string) error
+	// Verify checks whether the files of all videos still exist and updates their availability accordingly
+	Verify(ctx context.Context) (*VerifyResult, error)
+	// Relocate moves all videos whose files reside inside the old directory to the new one and returns the number of
+	// videos moved
+	Relocate(ctx context.Context, oldDir string, newDir string) (uint, error)
+	// GetThumbnail returns the absolute path of the thumbnail image of the video with the given ID (SHA-512 hash)
+	GetThumbnail(ctx context.Context, id string) (string, error)
+	// GetSprite returns the absolute path of a sprite sheet containing the given number of evenly spaced frames of the
+	// video with the given ID (SHA-512 hash). The sprite sheet is generated if it does not exist, yet
+	GetSprite(ctx context.Context, id string, frames uint, columns uint) (string, error)
+	// GetChapters returns the chapters of the video with the given ID (SHA-512 hash)
+	GetChapters(ctx context.Context, id string) ([]models.VideoChapter, error)
+	// AddTag adds a tag to the video with the given ID (SHA-512 hash)
+	AddTag(ctx context.Context, id string, tag string) error
+	// RemoveTag removes a tag from the video with the given ID (SHA-512 hash)
+	RemoveTag(ctx context.Context, id string, tag string) error
+	// ListTags returns all distinct tags used by any video
+	ListTags(ctx context.Context) ([]string, error)
+	// Artists returns the artist names starting with the search string - for auto-completion
+	Artists(ctx context.Context, search *Search) ([]string, error)
+	// RelatedMedia returns the related media starting with the search string - for auto-completion
+	RelatedMedia(ctx context.Context, search *Search) ([]string, error)
+	// LanguageFacets returns the number of videos per language - optionally counting only the available videos
+	LanguageFacets(ctx context.Context, onlyAvailable bool) ([]models.FacetCount, error)
+	// Top returns the given number of videos that have been requested most - or played most if byPlayed is set
+	Top(ctx context.Context, limit uint, byPlayed bool) ([]models.Video, error)
+	// Export writes all videos matching the search as CSV into the given writer. Pagination is ignored
+	Export(ctx context.Context, search *VideoSearch, w io.Writer) error
+}
+
+const (
+	// DefaultSpriteFrames is the number of frames inside a sprite sheet if nothing else is requested
+	DefaultSpriteFrames = 10
+	// DefaultSpriteColumns is the number of columns of a sprite sheet if nothing else is requested
+	DefaultSpriteColumns = 5
+	// MaxSpriteFrames is the maximum number of frames allowed inside a sprite sheet
+	MaxSpriteFrames = 100
+	// MaxTagLength is the maximum number of characters allowed for a video tag
+	MaxTagLength = 64
+	// DefaultTopVideos is the number of videos returned by the top list if nothing else is requested
+	DefaultTopVideos = 10
+	// MaxTopVideos is the maximum number of videos returned by the top list
+	MaxTopVideos = 100
+	// MaxSuggestions is the maximum number of values returned for auto-completion
+	MaxSuggestions = 25
+	// DefaultPurgeDays is the number of days deleted videos are kept when purging if nothing else is requested
+	DefaultPurgeDays = 30
+)
+
+// videoFilter creates the repo filter for the given video search
+func videoFilter(search *VideoSearch) repos.VideoFilter {
+	return repos.VideoFilter{
+		Tag:             normalizeTag(search.Tag),
+		Available:       search.Available,
+		NotPlayedWithin: time.Duration(search.NotPlayedWithin) * time.Minute,
+	}
+}
+
+// isRemote checks whether the given file name is a URL instead of the path of a local file
+func isRemote(filename string) bool {
+	return strings.Contains(filename, "://")
+}
+
+// normalizeTag converts a tag into the form it is stored in - trimmed and lower-case
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
 }
 
 // -- VideoService implementation --------------------------------------------------------------------------------------
@@ -29,16 +123,37 @@ type VideoService interface {
 type videoService struct {
 	logger *logrus.Entry
 	repo   repos.VideoRepo
+	chRepo repos.ChapterRepo
+	config ConfigService
+	// Prevents multiple verifications from running at the same time
+	verifyMutex sync.Mutex
+}
+
+// VerifyResult is the summary of a verification of the video files
+type VerifyResult struct {
+	// The number of videos checked
+	NumChecked uint `json:"numChecked"`
+	// The number of videos whose files went missing since the last verification
+	NumNowUnavailable uint `json:"numNowUnavailable"`
+	// The number of videos whose files have reappeared since the last verification
+	NumNowAvailable uint `json:"numNowAvailable"`
+	// The total number of videos whose files are missing
+	NumUnavailable uint `json:"numUnavailable"`
 }
 
 // NewVideoService creates a new videoService instance to use for creating endpoints
-func NewVideoService(vRepo repos.VideoRepo, logger *logrus.Entry) VideoService {
-	return &videoService{logger, vRepo}
+func NewVideoService(
+	vRepo repos.VideoRepo,
+	chRepo repos.ChapterRepo,
+	cs ConfigService,
+	logger *logrus.Entry,
+) VideoService {
+	return &videoService{logger: logger, repo: vRepo, chRepo: chRepo, config: cs}
 }
 
 // List searches for videos matching the provided search and returns a list of paged results
-func (s *videoService) List(ctx context.Context, search *Search) ([]models.Video, uint, error) {
-	vids, numRows, err := s.repo.Find(search.Search, search.Offset, search.Limit)
+func (s *videoService) List(ctx context.Context, search *VideoSearch) ([]models.Video, uint, error) {
+	vids, numRows, err := s.repo.Find(search.Search.Search, videoFilter(search), search.Offset, search.Limit)
 	if err != nil {
 		s.logger.WithError(err).Error("Video list query failed")
 		return nil, 0, MakeError(
@@ -64,9 +179,111 @@ func (s *videoService) Get(ctx context.Context, id string) (*models.Video, error
 			"Failed to load video information from storage",
 		)
 	}
+	if vid.Tags, err = s.repo.GetTags(id); err != nil {
+		s.logger.WithError(err).WithField(log.FldVideo, id).Error("Tag query failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load tag information from storage",
+		)
+	}
 	return vid, nil
 }
 
+// GetByIdentifier returns all videos having the given identifier (catalog number) - optionally only the ones that are
+// available. Since identifiers are not unique, there may be more than one
+func (s *videoService) GetByIdentifier(
+	ctx context.Context,
+	identifier string,
+	onlyAvailable bool,
+) ([]models.Video, error) {
+	vids, err := s.repo.GetByIdentifier(strings.TrimSpace(identifier))
+	if err != nil {
+		s.logger.WithError(err).Error("Video query by identifier failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load video information from storage",
+		)
+	}
+	if onlyAvailable {
+		available := vids[:0]
+		for _, vid := range vids {
+			if vid.Available {
+				available = append(available, vid)
+			}
+		}
+		vids = available
+	}
+	if len(vids) == 0 {
+		return nil, MakeError(
+			http.StatusNotFound,
+			ErrCodeVideoNotFound,
+			fmt.Sprintf("There is no video with the identifier '%s'", identifier),
+		)
+	}
+	return vids, nil
+}
+
+// Create adds a video by hand - e.g. for a streamed video that has no local file. Since there is no file to calculate
+// the SHA-512 hash from, the ID can either be provided or is derived from the file name - which may also be a URL
+func (s *videoService) Create(ctx context.Context, video *models.Video) (*models.Video, error) {
+	video.Title = strings.TrimSpace(video.Title)
+	video.Filename = strings.TrimSpace(video.Filename)
+	video.SHA512 = strings.ToLower(strings.TrimSpace(video.SHA512))
+	for _, field := range []struct {
+		name string
+		val  string
+	}{
+		{"title", video.Title},
+		{"fileName", video.Filename},
+	} {
+		if field.val == "" {
+			return nil, MakeErrorWithData(
+				http.StatusBadRequest,
+				ErrCodeRequiredFieldMissing,
+				fmt.Sprintf("The field '%s' is required", field.name),
+				map[string]string{"field": field.name},
+			)
+		}
+	}
+	if video.SHA512 == "" {
+		sum := sha512.Sum512([]byte(video.Filename))
+		video.SHA512 = hex.EncodeToString(sum[:])
+	} else if _, err := hex.DecodeString(video.SHA512); err != nil || len(video.SHA512) != sha512.Size*2 {
+		return nil, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"The ID must be a hex-encoded SHA-512 hash",
+			map[string]string{"field": "sha512"},
+		)
+	}
+	if _, err := s.repo.GetByID(video.SHA512); err == nil {
+		return nil, MakeErrorWithData(
+			http.StatusConflict,
+			ErrCodeVideoExists,
+			fmt.Sprintf("There already is a video with the ID '%s'", video.SHA512),
+			map[string]string{"field": "sha512"},
+		)
+	} else if err != repos.ErrEntityNotExisting {
+		s.logger.WithError(err).Error("Video query failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load video information from storage",
+		)
+	}
+	if err := s.repo.Create(video); err != nil {
+		s.logger.WithError(err).Error("Video creation failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to write video information to storage",
+		)
+	}
+	return s.Get(ctx, video.SHA512)
+}
+
 // Update updates the given video in the database with the video data provided
 func (s *videoService) Update(ctx context.Context, video *models.Video) error {
 	vid, err := s.Get(ctx, video.SHA512)
@@ -95,6 +312,37 @@ func (s *videoService) Update(ctx context.Context, video *models.Video) error {
 	return nil
 }
 
+// UpdateMany applies the non-empty fields of the patch to all videos with the given IDs (SHA-512 hashes) and returns
+// the number of videos updated. Videos that do not exist are skipped
+func (s *videoService) UpdateMany(ctx context.Context, ids []string, patch models.VideoPatch) (uint, error) {
+	if len(ids) == 0 {
+		return 0, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeRequiredFieldMissing,
+			"At least one video needs to be selected",
+			map[string]string{"field": "ids"},
+		)
+	}
+	if patch == (models.VideoPatch{}) {
+		return 0, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeRequiredFieldMissing,
+			"At least one field needs to be changed",
+			map[string]string{"field": "patch"},
+		)
+	}
+	num, err := s.repo.UpdateMany(ids, patch)
+	if err != nil {
+		s.logger.WithError(err).Error("Bulk video update failed")
+		return 0, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to write video information to storage",
+		)
+	}
+	return num, nil
+}
+
 // Delete removes the video with the given ID (SHA-512 hash) from the database
 func (s *videoService) Delete(ctx context.Context, id string) error {
 	err := s.repo.Delete(id)
@@ -109,5 +357,538 @@ func (s *videoService) Delete(ctx context.Context, id string) error {
 			"Failed to delete video from storage",
 		)
 	}
+	audit(ctx, models.AuditVideoDelete, id, "")
 	return nil
 }
+
+// Merge merges the video with the ID mergeHash into the one with the ID keepHash and returns the resulting video
+// The play and request counters of both videos are summed up and empty metadata fields of the kept video are filled
+// with the ones of the merged video. Its playlist entries, tags and chapters are moved to the kept video before the
+// merged video is removed
+func (s *videoService) Merge(ctx context.Context, keepHash string, mergeHash string) (*models.Video, error) {
+	if keepHash == mergeHash {
+		return nil, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"A video cannot be merged with itself",
+			map[string]string{"field": "merge"},
+		)
+	}
+	keep, err := s.loadForMerge(keepHash, "keep")
+	if err != nil {
+		return nil, err
+	}
+	merge, err := s.loadForMerge(mergeHash, "merge")
+	if err != nil {
+		return nil, err
+	}
+	keep.NumPlayed += merge.NumPlayed
+	keep.NumRequested += merge.NumRequested
+	for _, field := range []struct {
+		keep  *string
+		merge string
+	}{
+		{&keep.Title, merge.Title},
+		{&keep.Artist, merge.Artist},
+		{&keep.Language, merge.Language},
+		{&keep.RelatedMedium, merge.RelatedMedium},
+		{&keep.MediumDetail, merge.MediumDetail},
+		{&keep.Description, merge.Description},
+		{&keep.Identifier, merge.Identifier},
+		{&keep.Thumbnail, merge.Thumbnail},
+	} {
+		if *field.keep == "" {
+			*field.keep = field.merge
+		}
+	}
+	if keep.Duration == 0 {
+		keep.Duration = merge.Duration
+	}
+	if err := s.repo.Merge(keep, mergeHash); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return nil, MakeError(http.StatusNotFound, ErrCodeVideoNotFound, "One of the videos does not exist")
+		}
+		s.logger.WithError(err).Error("Video merge failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to merge videos in storage",
+		)
+	}
+	return s.Get(ctx, keepHash)
+}
+
+// loadForMerge loads one of the videos taking part in a merge. The field name is reported if the video does not exist
+func (s *videoService) loadForMerge(id string, field string) (*models.Video, error) {
+	vid, err := s.repo.GetByID(id)
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return nil, MakeErrorWithData(
+				http.StatusNotFound,
+				ErrCodeVideoNotFound,
+				fmt.Sprintf("The video %s does not exist", id),
+				map[string]string{"field": field},
+			)
+		}
+		s.logger.WithError(err).Error("Video query failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load video information from storage",
+		)
+	}
+	return vid, nil
+}
+
+// Restore restores the deleted video with the given ID (SHA-512 hash)
+func (s *videoService) Restore(ctx context.Context, id string) error {
+	if err := s.repo.Restore(id); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return MakeError(http.StatusNotFound, ErrCodeVideoNotFound, "There is no deleted video with this ID")
+		}
+		s.logger.WithError(err).Error("Video restore failed")
+		return MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to restore video in storage",
+		)
+	}
+	return nil
+}
+
+// Purge permanently removes all videos that have been deleted more than the given number of days ago and returns the
+// number of videos removed
+func (s *videoService) Purge(ctx context.Context, days uint) (uint, error) {
+	num, err := s.repo.Purge(time.Duration(days) * 24 * time.Hour)
+	if err != nil {
+		s.logger.WithError(err).Error("Video purge failed")
+		return 0, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to remove deleted videos from storage",
+		)
+	}
+	s.logger.Infof("Purged %d deleted video(s)", num)
+	audit(ctx, models.AuditVideoPurge, "", fmt.Sprintf("%d video(s) deleted more than %d day(s) ago", num, days))
+	return num, nil
+}
+
+// MarkPlayed increases the play counter of the video with the given ID (SHA-512 hash)
+func (s *videoService) MarkPlayed(ctx context.Context, id string) error {
+	if err := s.repo.BumpNumPlayed(id); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return MakeError(http.StatusNotFound, ErrCodeVideoNotFound, "The requested video does not exist")
+		}
+		s.logger.WithError(err).Error("Updating the play counter failed")
+		return MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to update video in storage",
+		)
+	}
+	return nil
+}
+
+// Verify checks whether the files of all videos still exist and updates their availability accordingly. Returned is
+// a summary of the verification
+func (s *videoService) Verify(ctx context.Context) (*VerifyResult, error) {
+	s.verifyMutex.Lock()
+	defer s.verifyMutex.Unlock()
+	s.logger.Info("Verifying the availability of all video files")
+	var res VerifyResult
+	changed := make(map[string]bool)
+	err := s.repo.Each("", repos.VideoFilter{}, func(vid *models.Video) error {
+		res.NumChecked++
+		available := true
+		if isRemote(vid.Filename) {
+			// Streamed videos added by hand - there is no file to check
+			available = vid.Available
+		} else if _, err := os.Stat(vid.Filename); err != nil {
+			if os.IsNotExist(err) {
+				available = false
+			} else {
+				// Keep the current state if we cannot tell whether the file exists
+				s.logger.WithError(err).WithField(log.FldFile, vid.Filename).Warn("Failed to check video file")
+				available = vid.Available
+			}
+		}
+		if available != vid.Available {
+			changed[vid.SHA512] = available
+		}
+		if !available {
+			res.NumUnavailable++
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to iterate over the videos for verification")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load video information from storage",
+		)
+	}
+	// SQLite does not allow writing while a query is still reading - so update the videos afterwards
+	for id, available := range changed {
+		if err := s.repo.SetAvailable(id, available); err != nil {
+			s.logger.WithError(err).WithField(log.FldVideo, id).Error("Failed to update video availability")
+			return nil, MakeError(
+				http.StatusInternalServerError,
+				ErrCodeRepoError,
+				"Failed to update video in storage",
+			)
+		}
+		if available {
+			res.NumNowAvailable++
+		} else {
+			res.NumNowUnavailable++
+		}
+	}
+	s.logger.WithFields(logrus.Fields{
+		"numChecked":        res.NumChecked,
+		"numNowUnavailable": res.NumNowUnavailable,
+		"numNowAvailable":   res.NumNowAvailable,
+	}).Info("Verification finished")
+	return &res, nil
+}
+
+// Relocate moves all videos whose files reside inside the old directory to the new one and returns the number of videos
+// moved. Only the file names stored in the database are changed - the files need to have been moved already, so the
+// new directory needs to exist
+func (s *videoService) Relocate(ctx context.Context, oldDir string, newDir string) (uint, error) {
+	if strings.TrimSpace(oldDir) == "" || strings.TrimSpace(newDir) == "" {
+		field := "oldDir"
+		if strings.TrimSpace(oldDir) != "" {
+			field = "newDir"
+		}
+		return 0, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeRequiredFieldMissing,
+			"Both the old and the new directory need to be provided",
+			map[string]string{"field": field},
+		)
+	}
+	oldDir = dirPrefix(oldDir)
+	newDir = dirPrefix(newDir)
+	if oldDir == newDir {
+		return 0, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"The new directory must differ from the old one",
+			map[string]string{"field": "newDir"},
+		)
+	}
+	if info, err := os.Stat(newDir); err != nil || !info.IsDir() {
+		return 0, MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeDirNotFound,
+			"The new directory does not exist",
+			map[string]string{"field": "newDir"},
+		)
+	}
+	num, err := s.repo.Relocate(oldDir, newDir)
+	if err != nil {
+		s.logger.WithError(err).Error("Video relocation failed")
+		return 0, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to update videos in storage",
+		)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"oldDir": oldDir,
+		"newDir": newDir,
+	}).Infof("Relocated %d video(s)", num)
+	return num, nil
+}
+
+// dirPrefix cleans the given directory name and adds a trailing separator, so it only matches the files inside the
+// directory when used as prefix - and not the ones of a directory sharing the beginning of its name
+func dirPrefix(dir string) string {
+	dir = filepath.Clean(dir)
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return dir
+}
+
+// GetThumbnail returns the absolute path of the thumbnail image of the video with the given ID (SHA-512 hash)
+func (s *videoService) GetThumbnail(ctx context.Context, id string) (string, error) {
+	vid, err := s.Get(ctx, id)
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return "", MakeError(http.StatusNotFound, ErrCodeVideoNotFound, "The requested video does not exist")
+		}
+		return "", err
+	}
+	if vid.Thumbnail == "" {
+		return "", MakeError(http.StatusNotFound, ErrCodeThumbnailNotFound, "There is no thumbnail for this video")
+	}
+	conf := s.config.GetConfig(ctx)
+	fileName := filepath.Join(conf.DataDir, filepath.FromSlash(vid.Thumbnail))
+	if _, err := os.Stat(fileName); err != nil {
+		s.logger.WithError(err).WithField(log.FldFile, fileName).Warn("Thumbnail file cannot be accessed")
+		return "", MakeError(http.StatusNotFound, ErrCodeThumbnailNotFound, "There is no thumbnail for this video")
+	}
+	return fileName, nil
+}
+
+// GetSprite returns the absolute path of a sprite sheet containing the given number of evenly spaced frames of the
+// video with the given ID (SHA-512 hash). The sprite sheet is generated if it does not exist, yet
+func (s *videoService) GetSprite(ctx context.Context, id string, frames uint, columns uint) (string, error) {
+	if frames == 0 || frames > MaxSpriteFrames {
+		return "", MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			fmt.Sprintf("The number of frames must be between 1 and %d", MaxSpriteFrames),
+			map[string]string{"field": "frames"},
+		)
+	}
+	if columns == 0 || columns > frames {
+		return "", MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			"The number of columns must be between 1 and the number of frames",
+			map[string]string{"field": "columns"},
+		)
+	}
+	vid, err := s.Get(ctx, id)
+	if err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return "", MakeError(http.StatusNotFound, ErrCodeVideoNotFound, "The requested video does not exist")
+		}
+		return "", err
+	}
+	conf := s.config.GetConfig(ctx)
+	fileName := filepath.Join(
+		conf.DataDir,
+		scraper.SpriteDir,
+		fmt.Sprintf("%s_%d_%d.jpg", vid.SHA512, frames, columns),
+	)
+	if _, err := os.Stat(fileName); err == nil {
+		return fileName, nil
+	}
+	if _, err := os.Stat(vid.Filename); err != nil {
+		return "", MakeError(
+			http.StatusNotFound,
+			ErrCodeVideoFileMissing,
+			"The video file does not exist anymore",
+		)
+	}
+	err = scraper.MakeSprite(conf.Scraper.FFMpegPath, vid.Filename, fileName, time.Duration(vid.Duration), frames, columns)
+	if err != nil {
+		s.logger.WithError(err).WithField(log.FldVideo, id).Error("Sprite sheet generation failed")
+		return "", MakeError(
+			http.StatusInternalServerError,
+			ErrCodeSpriteFailed,
+			"Failed to generate the sprite sheet for this video",
+		)
+	}
+	return fileName, nil
+}
+
+// GetChapters returns the chapters of the video with the given ID (SHA-512 hash)
+func (s *videoService) GetChapters(ctx context.Context, id string) ([]models.VideoChapter, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return nil, MakeError(http.StatusNotFound, ErrCodeVideoNotFound, "The requested video does not exist")
+		}
+		return nil, err
+	}
+	chapters, err := s.chRepo.GetByVideo(id)
+	if err != nil {
+		s.logger.WithError(err).WithField(log.FldVideo, id).Error("Chapter query failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load chapter information from storage",
+		)
+	}
+	return chapters, nil
+}
+
+// AddTag adds a tag to the video with the given ID (SHA-512 hash). Tags are stored in lower case
+func (s *videoService) AddTag(ctx context.Context, id string, tag string) error {
+	tag = normalizeTag(tag)
+	if tag == "" {
+		return MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeRequiredFieldMissing,
+			"The tag must not be empty",
+			map[string]string{"field": "tag"},
+		)
+	}
+	if len([]rune(tag)) > MaxTagLength {
+		return MakeErrorWithData(
+			http.StatusBadRequest,
+			ErrCodeIllegalValue,
+			fmt.Sprintf("The tag must not be longer than %d characters", MaxTagLength),
+			map[string]string{"field": "tag"},
+		)
+	}
+	if _, err := s.Get(ctx, id); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return MakeError(http.StatusNotFound, ErrCodeVideoNotFound, "The requested video does not exist")
+		}
+		return err
+	}
+	if err := s.repo.AddTag(id, tag); err != nil {
+		s.logger.WithError(err).WithField(log.FldVideo, id).Error("Adding tag failed")
+		return MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to write tag information to storage",
+		)
+	}
+	return nil
+}
+
+// RemoveTag removes a tag from the video with the given ID (SHA-512 hash)
+func (s *videoService) RemoveTag(ctx context.Context, id string, tag string) error {
+	if err := s.repo.RemoveTag(id, normalizeTag(tag)); err != nil {
+		if err == repos.ErrEntityNotExisting {
+			return MakeError(http.StatusNotFound, ErrCodeTagNotFound, "The video does not have this tag")
+		}
+		s.logger.WithError(err).WithField(log.FldVideo, id).Error("Removing tag failed")
+		return MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to delete tag from storage",
+		)
+	}
+	return nil
+}
+
+// ListTags returns all distinct tags used by any video
+func (s *videoService) ListTags(ctx context.Context) ([]string, error) {
+	tags, err := s.repo.ListTags()
+	if err != nil {
+		s.logger.WithError(err).Error("Tag list query failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load tag information from storage",
+		)
+	}
+	return tags, nil
+}
+
+// Artists returns the artist names starting with the search string - for auto-completion. The offset of the search is
+// ignored and the limit is capped at MaxSuggestions
+func (s *videoService) Artists(ctx context.Context, search *Search) ([]string, error) {
+	artists, err := s.repo.FindArtists(search.Search, suggestionLimit(search.Limit))
+	if err != nil {
+		s.logger.WithError(err).Error("Artist query failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load artist information from storage",
+		)
+	}
+	return artists, nil
+}
+
+// RelatedMedia returns the related media starting with the search string - for auto-completion. The offset of the
+// search is ignored and the limit is capped at MaxSuggestions
+func (s *videoService) RelatedMedia(ctx context.Context, search *Search) ([]string, error) {
+	media, err := s.repo.FindRelatedMedia(search.Search, suggestionLimit(search.Limit))
+	if err != nil {
+		s.logger.WithError(err).Error("Related media query failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load related media information from storage",
+		)
+	}
+	return media, nil
+}
+
+// suggestionLimit caps the given limit at MaxSuggestions
+func suggestionLimit(limit uint) uint {
+	if limit == 0 || limit > MaxSuggestions {
+		return MaxSuggestions
+	}
+	return limit
+}
+
+// LanguageFacets returns the number of videos per language ordered by the number of videos - optionally counting only
+// the available videos. Videos without a language are counted as "unknown"
+func (s *videoService) LanguageFacets(ctx context.Context, onlyAvailable bool) ([]models.FacetCount, error) {
+	facets, err := s.repo.CountByLanguage(onlyAvailable)
+	if err != nil {
+		s.logger.WithError(err).Error("Language facet query failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load video information from storage",
+		)
+	}
+	return facets, nil
+}
+
+// Top returns the given number of videos that have been requested most - or played most if byPlayed is set. The limit
+// is capped at MaxTopVideos
+func (s *videoService) Top(ctx context.Context, limit uint, byPlayed bool) ([]models.Video, error) {
+	if limit == 0 {
+		limit = DefaultTopVideos
+	} else if limit > MaxTopVideos {
+		limit = MaxTopVideos
+	}
+	vids, err := s.repo.FindTop(limit, byPlayed)
+	if err != nil {
+		s.logger.WithError(err).Error("Top video query failed")
+		return nil, MakeError(
+			http.StatusInternalServerError,
+			ErrCodeRepoError,
+			"Failed to load video information from storage",
+		)
+	}
+	return vids, nil
+}
+
+// The header row of the CSV export
+var exportColumns = []string{
+	"sha512", "identifier", "title", "artist", "language", "relatedMedium", "mediumDetail", "description", "duration",
+	"tags", "fileName", "container", "videoFormat", "audioFormat", "width", "height", "numPlayed", "numRequested",
+}
+
+// Export writes all videos matching the search as CSV into the given writer. Pagination is ignored and the videos are
+// written one by one, so that the library does not need to fit into memory. The duration is written in seconds
+func (s *videoService) Export(ctx context.Context, search *VideoSearch, w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(exportColumns); err != nil {
+		return err
+	}
+	err := s.repo.Each(search.Search.Search, videoFilter(search), func(vid *models.Video) error {
+		tags, err := s.repo.GetTags(vid.SHA512)
+		if err != nil {
+			return err
+		}
+		return out.Write([]string{
+			vid.SHA512,
+			vid.Identifier,
+			vid.Title,
+			vid.Artist,
+			vid.Language,
+			vid.RelatedMedium,
+			vid.MediumDetail,
+			vid.Description,
+			strconv.Itoa(int(vid.Duration.Seconds())),
+			strings.Join(tags, ","),
+			vid.Filename,
+			vid.Container,
+			vid.VideoFormat,
+			vid.AudioFormat,
+			strconv.Itoa(vid.Width),
+			strconv.Itoa(vid.Height),
+			strconv.FormatUint(uint64(vid.NumPlayed), 10),
+			strconv.FormatUint(uint64(vid.NumRequested), 10),
+		})
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Video export failed")
+		return err
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -18,10 +18,17 @@ import (
 	"github.com/derWhity/kyabia/internal/log"
 	"github.com/derWhity/kyabia/internal/migrate"
 	"github.com/derWhity/kyabia/internal/models"
+	"github.com/derWhity/kyabia/internal/repos"
+	apikeyrepo "github.com/derWhity/kyabia/internal/repos/apikey/sqlite"
+	auditrepo "github.com/derWhity/kyabia/internal/repos/audit/sqlite"
+	chapterrepo "github.com/derWhity/kyabia/internal/repos/chapter/sqlite"
 	eventrepo "github.com/derWhity/kyabia/internal/repos/event/sqlite"
 	plrepo "github.com/derWhity/kyabia/internal/repos/playlist/sqlite"
 	sessionrepo "github.com/derWhity/kyabia/internal/repos/session/inmem"
-	userrepo "github.com/derWhity/kyabia/internal/repos/user/inmem"
+	jwtsessionrepo "github.com/derWhity/kyabia/internal/repos/session/jwt"
+	sqlsessionrepo "github.com/derWhity/kyabia/internal/repos/session/sqlite"
+	statsrepo "github.com/derWhity/kyabia/internal/repos/statistics/sqlite"
+	userrepo "github.com/derWhity/kyabia/internal/repos/user/sqlite"
 	vidrepo "github.com/derWhity/kyabia/internal/repos/video/sqlite"
 	"github.com/derWhity/kyabia/internal/scraper"
 	"github.com/jmoiron/sqlx"
@@ -57,6 +64,23 @@ func checkAndCreateDir(path string, logger *logrus.Entry) {
 	}
 }
 
+// runPeriodically runs the given function every time the interval in minutes returned by the interval function has
+// passed. The interval is read again after every run, so changes made by reloading the configuration take effect
+// without a restart. While the interval is 0, the function is not run - the interval is checked again every minute
+func runPeriodically(interval func() uint, fn func()) {
+	for {
+		minutes := interval()
+		if minutes == 0 {
+			time.Sleep(time.Minute)
+			continue
+		}
+		time.Sleep(time.Duration(minutes) * time.Minute)
+		if interval() > 0 {
+			fn()
+		}
+	}
+}
+
 func main() {
 	execDir, err := osext.ExecutableFolder()
 	if err != nil {
@@ -97,40 +121,92 @@ func main() {
 		logger.WithError(err).Fatal("Database migration has failed. Please check database for consistency and try again.")
 	}
 
-	// Prepare the in-memory user repo and fill it with the default user
-	// TODO: Implement proper user management with database backend
-	userRepo := userrepo.New()
-	u := models.User{
-		Name:     strings.ToLower(conf.DefaultUser.Name),
-		FullName: conf.DefaultUser.Name,
+	if unmet := conf.PasswordRules.Unmet(conf.DefaultUser.Password); len(unmet) > 0 {
+		logger.WithField("unmet", strings.Join(unmet, ", ")).
+			Warn("The password configured for the default user is weak - please change it")
 	}
-	err = u.SetPassword(conf.DefaultUser.Password)
+
+	// Prepare the user repo and fill it with the default user if there are no users, yet
+	userRepo := userrepo.New(db, logger)
+	users, err := userRepo.Find("", 0, 1)
 	if err != nil {
-		logger.WithError(err).Fatal("Failed to set password for default user")
-		panic("Without user, there is no use to live on!")
+		logger.WithError(err).Fatal("Failed to load users")
+	}
+	if len(users) == 0 {
+		u := models.User{
+			Name:        strings.ToLower(conf.DefaultUser.Name),
+			FullName:    conf.DefaultUser.Name,
+			Permissions: models.PermAll,
+		}
+		err = u.SetPassword(conf.DefaultUser.Password)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to set password for default user")
+			panic("Without user, there is no use to live on!")
+		}
+		if err = userRepo.Create(&u); err != nil {
+			logger.WithError(err).Fatal("Failed to create default user")
+		}
+		logger.Info(fmt.Sprintf("Created user '%s' with password hash %s", u.Name, u.PasswordHash))
 	}
-	userRepo.Create(&u)
-	logger.Info(fmt.Sprintf("Created user '%s' with password hash %s", u.Name, u.PasswordHash))
 
 	videoRepo := vidrepo.New(db, logger)
+	chapterRepo := chapterrepo.New(db, logger)
 	playlistRepo := plrepo.New(db, logger)
 	eventRepo := eventrepo.New(db, logger)
-	sessionRepo := sessionrepo.New()
+	statsRepo := statsrepo.New(db, logger)
+	var sessionRepo repos.SessionRepo
+	switch conf.AuthMode {
+	case models.AuthModeJWT:
+		if conf.JWTSecret == "" {
+			logger.Fatal("Authentication by JWT needs a JWT secret to be configured")
+		}
+		sessionRepo = jwtsessionrepo.New([]byte(conf.JWTSecret))
+	case models.AuthModeSession, "":
+		switch conf.SessionStore {
+		case models.SessionStoreSQLite:
+			sessionRepo = sqlsessionrepo.New(db, logger)
+		case models.SessionStoreMemory, "":
+			sessionRepo = sessionrepo.New()
+		default:
+			logger.WithField("sessionStore", conf.SessionStore).
+				Warn("Illegal session store configured - falling back to storing sessions in memory")
+			sessionRepo = sessionrepo.New()
+		}
+	default:
+		logger.WithField("authMode", conf.AuthMode).Fatal("Illegal authentication mode configured")
+	}
 
-	scr := scraper.NewDefault(videoRepo, logger)
+	scr := scraper.NewDefault(videoRepo, conf.DataDir, conf.Scraper, logger)
+	scr.ChapterRepo = chapterRepo
 
-	scrServ := kyabia.NewScrapingService(scr, logger)
-	viSrv := kyabia.NewVideoService(videoRepo, logger)
-	evSrv := kyabia.NewEventService(eventRepo, playlistRepo, logger)
-	plSrv := kyabia.NewPlaylistService(playlistRepo, videoRepo, evSrv, cs, logger)
+	scrServ := kyabia.NewScrapingService(scr, cs, logger)
+	viSrv := kyabia.NewVideoService(videoRepo, chapterRepo, cs, logger)
+	evSrv := kyabia.NewEventService(eventRepo, playlistRepo, statsRepo, cs, logger)
+	plSrv := kyabia.NewPlaylistService(playlistRepo, videoRepo, statsRepo, evSrv, cs, logger)
 	sessServ := kyabia.NewSessionService(sessionRepo, userRepo, logger)
+	usrServ := kyabia.NewUserService(userRepo, cs, logger)
+	auditServ := kyabia.NewAuditService(auditrepo.New(db, logger), logger)
+	keyServ := kyabia.NewAPIKeyService(apikeyrepo.New(db, logger), logger)
 
-	// Auto-Select an event with matchin start and end times
-	evts, _ := eventRepo.GetByDate(time.Now())
-	if len(evts) > 0 {
-		logger.Infof("Auto-selecting event %d (%s) as current event", evts[0].ID, evts[0].Name)
-		evSrv.SetCurrentEvent(ctx, evts[0].ID)
+	// Periodically verify that the video files still exist
+	go runPeriodically(func() uint { return cs.GetConfig(ctx).Scraper.VerifyInterval }, func() {
+		viSrv.Verify(ctx)
+	})
+
+	// Auto-Select an event with matchin start and end times - and keep checking for events starting later on
+	if err := evSrv.SelectEventByDate(ctx, time.Now()); err != nil {
+		logger.WithError(err).Error("Failed to auto-select the current event")
 	}
+	go runPeriodically(func() uint { return cs.GetConfig(ctx).EventSelectInterval }, func() {
+		if err := evSrv.SelectEventByDate(ctx, time.Now()); err != nil {
+			logger.WithError(err).Error("Failed to auto-select the current event")
+		}
+		if cs.GetConfig(ctx).AutoClosePlaylist {
+			if err := evSrv.CloseEndedEvent(ctx, time.Now()); err != nil {
+				logger.WithError(err).Error("Failed to close the main playlist of the ended event")
+			}
+		}
+	})
 
 	httpLogger := logger.WithField(log.FldTransport, "HTTP")
 
@@ -140,6 +216,9 @@ func main() {
 		plSrv,
 		evSrv,
 		sessServ,
+		usrServ,
+		auditServ,
+		keyServ,
 		cs,
 		httpLogger,
 	)
@@ -149,7 +228,7 @@ func main() {
 
 	// Listen for stop signals that will end the service
 	go func() {
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 		err := fmt.Errorf("%s", <-c)
 		logger.Info("Caught signal to stop. Shutting down.")